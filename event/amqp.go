@@ -0,0 +1,345 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Kaese72/riskie-lib/logging"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+type AMQPConfig struct {
+	ConnectionString string
+	// Exchange is the durable topic exchange events are published on, with routing keys from RoutingKey
+	Exchange string
+	// QueueName is an optional durable queue bound to every event on the exchange
+	QueueName string
+	// BufferSize is the maximum number of events waiting to be published
+	BufferSize int
+	// MaxRetries is the number of times an event rejected by the broker is retried before it is dropped
+	MaxRetries int
+	// MinBackoff and MaxBackoff bound the exponential backoff used between reconnects and retries
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// ConfirmTimeout is how long to wait for the broker to confirm a publish before retrying it
+	ConfirmTimeout time.Duration
+	CloudEventsConfig
+}
+
+func (config AMQPConfig) withDefaults() AMQPConfig {
+	if config.BufferSize <= 0 {
+		config.BufferSize = 1000
+	}
+	if config.MaxRetries <= 0 {
+		config.MaxRetries = 5
+	}
+	if config.MinBackoff <= 0 {
+		config.MinBackoff = 500 * time.Millisecond
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = 30 * time.Second
+	}
+	if config.ConfirmTimeout <= 0 {
+		config.ConfirmTimeout = 5 * time.Second
+	}
+	if config.Exchange == "" {
+		config.Exchange = DefaultExchange
+	}
+	config.CloudEventsConfig = config.CloudEventsConfig.withDefaults()
+	return config
+}
+
+type publishRequest struct {
+	event    Event
+	attempts int
+	// result receives the outcome of the publish, and is buffered so that it never blocks
+	result chan error
+}
+
+func (request publishRequest) finish(err error) {
+	request.result <- err
+}
+
+// AMQPPublisher publishes events on a durable topic exchange with publisher confirms.
+// Events are buffered while the broker is unreachable, and the connection is
+// re-established with exponential backoff when lost.
+type AMQPPublisher struct {
+	config      AMQPConfig
+	requests    chan publishRequest
+	done        chan struct{}
+	closeOnce   sync.Once
+	healthMutex sync.RWMutex
+	healthErr   error
+}
+
+// amqpSession is a single connection to the broker, replaced whenever the connection is lost
+type amqpSession struct {
+	connection *amqp.Connection
+	channel    *amqp.Channel
+	closed     chan *amqp.Error
+}
+
+// SetupAMQP connects to the broker and starts publishing in the background.
+// The initial connection must succeed, so that misconfiguration is detected at startup.
+func SetupAMQP(config AMQPConfig) (*AMQPPublisher, error) {
+	config = config.withDefaults()
+	if err := config.ContentMode.Validate(); err != nil {
+		return nil, err
+	}
+	publisher := &AMQPPublisher{
+		config: config,
+		done:   make(chan struct{}),
+	}
+	publisher.requests = make(chan publishRequest, publisher.config.BufferSize)
+	session, err := publisher.connect()
+	if err != nil {
+		return nil, err
+	}
+	go publisher.run(session)
+	return publisher, nil
+}
+
+func (publisher *AMQPPublisher) connect() (*amqpSession, error) {
+	connection, err := amqp.Dial(publisher.config.ConnectionString)
+	if err != nil {
+		return nil, err
+	}
+	channel, err := connection.Channel()
+	if err != nil {
+		connection.Close()
+		return nil, err
+	}
+	if err := publisher.declareTopology(channel); err != nil {
+		connection.Close()
+		return nil, err
+	}
+	if err := channel.Confirm(false); err != nil {
+		connection.Close()
+		return nil, err
+	}
+	return &amqpSession{
+		connection: connection,
+		channel:    channel,
+		closed:     connection.NotifyClose(make(chan *amqp.Error, 1)),
+	}, nil
+}
+
+// declareTopology declares the exchange, and the queue bound to it if configured
+func (publisher *AMQPPublisher) declareTopology(channel *amqp.Channel) error {
+	err := channel.ExchangeDeclare(
+		publisher.config.Exchange, // name
+		amqp.ExchangeTopic,        // type
+		true,                      // durable
+		false,                     // auto-deleted
+		false,                     // internal
+		false,                     // no-wait
+		nil,                       // arguments
+	)
+	if err != nil {
+		return err
+	}
+	if publisher.config.QueueName == "" {
+		return nil
+	}
+	_, err = channel.QueueDeclare(
+		publisher.config.QueueName, // name
+		true,                       // durable
+		false,                      // delete when unused
+		false,                      // exclusive
+		false,                      // no-wait
+		nil,                        // arguments
+	)
+	if err != nil {
+		return err
+	}
+	return channel.QueueBind(
+		publisher.config.QueueName, // name
+		"finding.#",                // routing key
+		publisher.config.Exchange,  // exchange
+		false,                      // no-wait
+		nil,                        // arguments
+	)
+}
+
+func (publisher *AMQPPublisher) setHealth(err error) {
+	publisher.healthMutex.Lock()
+	defer publisher.healthMutex.Unlock()
+	publisher.healthErr = err
+}
+
+// Health returns an error describing why the broker is unreachable, or nil if it is connected
+func (publisher *AMQPPublisher) Health() error {
+	publisher.healthMutex.RLock()
+	defer publisher.healthMutex.RUnlock()
+	return publisher.healthErr
+}
+
+// Publish publishes the event and waits for the broker to confirm it, or for the context to expire.
+// ErrBufferFull is returned immediately if too many events are already waiting to be published.
+func (publisher *AMQPPublisher) Publish(ctx context.Context, event Event) error {
+	request := publishRequest{event: event, result: make(chan error, 1)}
+	if err := publisher.enqueue(request); err != nil {
+		return err
+	}
+	select {
+	case err := <-request.result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (publisher *AMQPPublisher) enqueue(request publishRequest) error {
+	select {
+	case <-publisher.done:
+		return ErrClosed
+	default:
+	}
+	select {
+	case publisher.requests <- request:
+		return nil
+	default:
+		return ErrBufferFull
+	}
+}
+
+// Close stops publishing. Updates still waiting to be published are dropped.
+func (publisher *AMQPPublisher) Close() {
+	publisher.closeOnce.Do(func() { close(publisher.done) })
+}
+
+func (publisher *AMQPPublisher) sleep(duration time.Duration) bool {
+	select {
+	case <-publisher.done:
+		return false
+	case <-time.After(duration):
+		return true
+	}
+}
+
+func (publisher *AMQPPublisher) nextBackoff(backoff time.Duration) time.Duration {
+	backoff *= 2
+	if backoff > publisher.config.MaxBackoff {
+		return publisher.config.MaxBackoff
+	}
+	return backoff
+}
+
+func (publisher *AMQPPublisher) run(session *amqpSession) {
+	logging.Info(context.Background(), "Started event sender")
+	backoff := publisher.config.MinBackoff
+	var pending *publishRequest
+	for {
+		if session == nil {
+			var err error
+			session, err = publisher.connect()
+			if err != nil {
+				publisher.setHealth(fmt.Errorf("event broker unreachable: %s", err.Error()))
+				logging.Error(context.Background(), "Failed to connect to event broker", map[string]interface{}{"error": err.Error(), "backoff": backoff.String()})
+				if !publisher.sleep(backoff) {
+					return
+				}
+				backoff = publisher.nextBackoff(backoff)
+				continue
+			}
+			logging.Info(context.Background(), "Connected to event broker")
+		}
+		publisher.setHealth(nil)
+		backoff = publisher.config.MinBackoff
+		pending = publisher.serve(session, pending)
+		session.connection.Close()
+		session = nil
+		select {
+		case <-publisher.done:
+			return
+		default:
+		}
+	}
+}
+
+// serve publishes requests on the session until the connection is lost or the publisher is closed.
+// A request that could not be published because the connection was lost is returned, to be retried on the next session.
+func (publisher *AMQPPublisher) serve(session *amqpSession, pending *publishRequest) *publishRequest {
+	for {
+		var request publishRequest
+		if pending != nil {
+			request = *pending
+			pending = nil
+		} else {
+			select {
+			case <-publisher.done:
+				return nil
+			case amqpErr := <-session.closed:
+				publisher.connectionLost(amqpErr)
+				return nil
+			case request = <-publisher.requests:
+			}
+		}
+		for {
+			err := publisher.publish(session, request.event)
+			if err == nil {
+				request.finish(nil)
+				break
+			}
+			if session.connection.IsClosed() || session.channel.IsClosed() {
+				publisher.connectionLost(nil)
+				return &request
+			}
+			request.attempts++
+			if request.attempts > publisher.config.MaxRetries {
+				logging.Error(context.Background(), "Dropped event after retries", map[string]interface{}{"eventId": request.event.EventHeader().EventID, "error": err.Error()})
+				request.finish(err)
+				break
+			}
+			logging.Info(context.Background(), "Failed to publish event... Retrying", map[string]interface{}{"eventId": request.event.EventHeader().EventID, "error": err.Error(), "attempt": request.attempts})
+			if !publisher.sleep(publisher.config.MinBackoff * time.Duration(1<<(request.attempts-1))) {
+				return nil
+			}
+		}
+	}
+}
+
+func (publisher *AMQPPublisher) connectionLost(amqpErr *amqp.Error) {
+	err := errors.New("event broker connection lost")
+	if amqpErr != nil {
+		err = fmt.Errorf("event broker connection lost: %s", amqpErr.Error())
+	}
+	publisher.setHealth(err)
+	logging.Error(context.Background(), "Lost connection to event broker... Reconnecting", map[string]interface{}{"error": err.Error()})
+}
+
+// publish publishes a single event as a CloudEvent and waits for the broker to confirm it
+func (publisher *AMQPPublisher) publish(session *amqpSession, event Event) error {
+	cloudEvent, err := NewCloudEvent(publisher.config.Source, event)
+	if err != nil {
+		return err
+	}
+	publishing, err := cloudEvent.AMQPPublishing(publisher.config.ContentMode)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), publisher.config.ConfirmTimeout)
+	defer cancel()
+	confirmation, err := session.channel.PublishWithDeferredConfirmWithContext(ctx,
+		publisher.config.Exchange, // exchange
+		RoutingKey(event),         // routing key
+		false,                     // mandatory
+		false,                     // immediate
+		publishing,
+	)
+	if err != nil {
+		return err
+	}
+	acked, err := confirmation.WaitContext(ctx)
+	if err != nil {
+		return err
+	}
+	if !acked {
+		return errors.New("event rejected by event broker")
+	}
+	return nil
+}
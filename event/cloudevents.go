@@ -0,0 +1,145 @@
+package event
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// CloudEventsSpecVersion is the version of the CloudEvents specification events are published with
+const CloudEventsSpecVersion = "1.0"
+
+// DefaultSource is the CloudEvents source of published events, unless configured otherwise
+const DefaultSource = "/finding-registry"
+
+// ContentMode is how a CloudEvent is mapped onto an AMQP message
+type ContentMode string
+
+const (
+	// ContentModeStructured encodes the whole CloudEvent, attributes and data, as the message body
+	ContentModeStructured ContentMode = "structured"
+	// ContentModeBinary carries the attributes as message headers and the data as the message body
+	ContentModeBinary ContentMode = "binary"
+)
+
+// CloudEventsConfig configures how events are published as CloudEvents, and is shared by every transport
+type CloudEventsConfig struct {
+	// Source is the CloudEvents source attribute of published events
+	Source string
+	// ContentMode selects the CloudEvents content mode, structured or binary
+	ContentMode ContentMode
+}
+
+func (config CloudEventsConfig) withDefaults() CloudEventsConfig {
+	if config.Source == "" {
+		config.Source = DefaultSource
+	}
+	if config.ContentMode == "" {
+		config.ContentMode = ContentModeStructured
+	}
+	return config
+}
+
+func (mode ContentMode) Validate() error {
+	switch mode {
+	case ContentModeStructured, ContentModeBinary:
+		return nil
+	default:
+		return fmt.Errorf("invalid content mode: %s", mode)
+	}
+}
+
+const (
+	cloudEventsContentType = "application/cloudevents+json; charset=utf-8"
+	dataContentType        = "application/json"
+	// amqpHeaderPrefix prefixes CloudEvents attributes carried as AMQP headers in binary content mode
+	amqpHeaderPrefix = "cloudEvents:"
+	// schemaPath is where the JSON Schema documents of the events are served
+	schemaPath = "/finding-registry/event-schemas"
+)
+
+// CloudEvent is a published event in the CloudEvents 1.0 format
+type CloudEvent struct {
+	SpecVersion     string    `json:"specversion"`
+	ID              string    `json:"id"`
+	Source          string    `json:"source"`
+	Type            string    `json:"type"`
+	Subject         string    `json:"subject"`
+	Time            time.Time `json:"time"`
+	DataContentType string    `json:"datacontenttype"`
+	DataSchema      string    `json:"dataschema"`
+	// OrganizationID is an extension attribute, so that events can be routed by organization without parsing the data
+	OrganizationID string          `json:"organizationid"`
+	Data           json.RawMessage `json:"data"`
+}
+
+// NewCloudEvent wraps an event in a CloudEvent. The data of the CloudEvent is the event as described by its JSON Schema.
+func NewCloudEvent(source string, event Event) (CloudEvent, error) {
+	header := event.EventHeader()
+	data, err := json.Marshal(event)
+	if err != nil {
+		return CloudEvent{}, err
+	}
+	return CloudEvent{
+		SpecVersion:     CloudEventsSpecVersion,
+		ID:              header.EventID,
+		Source:          source,
+		Type:            string(header.Type),
+		Subject:         event.EventFinding().ID,
+		Time:            header.OccurredAt,
+		DataContentType: dataContentType,
+		DataSchema:      fmt.Sprintf("%s/%s", schemaPath, header.Type),
+		OrganizationID:  fmt.Sprintf("%d", header.OrganizationId),
+		Data:            data,
+	}, nil
+}
+
+// structured encodes the whole CloudEvent, as carried in structured content mode
+func (cloudEvent CloudEvent) structured() ([]byte, error) {
+	return json.Marshal(cloudEvent)
+}
+
+// attributes lists the context attributes of the CloudEvent, as carried in binary content mode
+func (cloudEvent CloudEvent) attributes() map[string]string {
+	return map[string]string{
+		"specversion":    cloudEvent.SpecVersion,
+		"id":             cloudEvent.ID,
+		"source":         cloudEvent.Source,
+		"type":           cloudEvent.Type,
+		"subject":        cloudEvent.Subject,
+		"time":           cloudEvent.Time.UTC().Format(time.RFC3339Nano),
+		"dataschema":     cloudEvent.DataSchema,
+		"organizationid": cloudEvent.OrganizationID,
+	}
+}
+
+// AMQPPublishing maps the CloudEvent onto an AMQP message according to the CloudEvents AMQP protocol binding
+func (cloudEvent CloudEvent) AMQPPublishing(mode ContentMode) (amqp.Publishing, error) {
+	publishing := amqp.Publishing{
+		DeliveryMode: amqp.Persistent,
+		MessageId:    cloudEvent.ID,
+		Type:         cloudEvent.Type,
+		Timestamp:    cloudEvent.Time,
+	}
+	switch mode {
+	case ContentModeStructured:
+		encoded, err := cloudEvent.structured()
+		if err != nil {
+			return amqp.Publishing{}, err
+		}
+		publishing.ContentType = cloudEventsContentType
+		publishing.Body = encoded
+	case ContentModeBinary:
+		publishing.ContentType = cloudEvent.DataContentType
+		publishing.Headers = amqp.Table{}
+		for attribute, value := range cloudEvent.attributes() {
+			publishing.Headers[amqpHeaderPrefix+attribute] = value
+		}
+		publishing.Body = cloudEvent.Data
+	default:
+		return amqp.Publishing{}, mode.Validate()
+	}
+	return publishing, nil
+}
@@ -0,0 +1,102 @@
+package event_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Kaese72/finding-registry/event"
+)
+
+func testEvent() event.FindingCreated {
+	return event.FindingCreated{
+		Header:  event.NewHeader("abc", event.FindingCreatedType, 7, time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)),
+		Finding: event.Finding{ID: "finding-1", Name: "open port", OrganizationId: 7, Status: "open"},
+	}
+}
+
+func TestNewCloudEvent(t *testing.T) {
+	cloudEvent, err := event.NewCloudEvent(event.DefaultSource, testEvent())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"specversion":    "1.0",
+		"id":             "abc",
+		"source":         "/finding-registry",
+		"type":           "finding.created",
+		"subject":        "finding-1",
+		"organizationid": "7",
+		"dataschema":     "/finding-registry/event-schemas/finding.created",
+	}
+	actual := map[string]string{
+		"specversion":    cloudEvent.SpecVersion,
+		"id":             cloudEvent.ID,
+		"source":         cloudEvent.Source,
+		"type":           cloudEvent.Type,
+		"subject":        cloudEvent.Subject,
+		"organizationid": cloudEvent.OrganizationID,
+		"dataschema":     cloudEvent.DataSchema,
+	}
+	for attribute, value := range expected {
+		if actual[attribute] != value {
+			t.Errorf("expected %s to be %q, got %q", attribute, value, actual[attribute])
+		}
+	}
+	decoded, err := event.DecodeEvent(event.EventType(cloudEvent.Type), cloudEvent.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.EventFinding().ID != "finding-1" {
+		t.Errorf("expected data to decode to the event, got %+v", decoded)
+	}
+}
+
+func TestCloudEventAMQPPublishing(t *testing.T) {
+	cloudEvent, err := event.NewCloudEvent(event.DefaultSource, testEvent())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Run("structured", func(t *testing.T) {
+		publishing, err := cloudEvent.AMQPPublishing(event.ContentModeStructured)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if publishing.ContentType != "application/cloudevents+json; charset=utf-8" {
+			t.Errorf("unexpected content type %s", publishing.ContentType)
+		}
+		decoded := map[string]interface{}{}
+		if err := json.Unmarshal(publishing.Body, &decoded); err != nil {
+			t.Fatal(err)
+		}
+		if decoded["type"] != "finding.created" || decoded["subject"] != "finding-1" {
+			t.Errorf("unexpected body %s", publishing.Body)
+		}
+		if _, ok := decoded["data"].(map[string]interface{}); !ok {
+			t.Errorf("expected data to be embedded as JSON, got %s", publishing.Body)
+		}
+	})
+	t.Run("binary", func(t *testing.T) {
+		publishing, err := cloudEvent.AMQPPublishing(event.ContentModeBinary)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if publishing.ContentType != "application/json" {
+			t.Errorf("unexpected content type %s", publishing.ContentType)
+		}
+		if publishing.Headers["cloudEvents:type"] != "finding.created" || publishing.Headers["cloudEvents:organizationid"] != "7" {
+			t.Errorf("unexpected headers %v", publishing.Headers)
+		}
+		if publishing.Headers["cloudEvents:time"] != "2024-01-01T12:00:00Z" {
+			t.Errorf("unexpected time %v", publishing.Headers["cloudEvents:time"])
+		}
+		if string(publishing.Body) != string(cloudEvent.Data) {
+			t.Errorf("expected body to be the event data, got %s", publishing.Body)
+		}
+	})
+	t.Run("invalid", func(t *testing.T) {
+		if _, err := cloudEvent.AMQPPublishing("other"); err == nil {
+			t.Error("expected error for invalid content mode")
+		}
+	})
+}
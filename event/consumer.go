@@ -0,0 +1,313 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Kaese72/organization-registry/authentication"
+	"github.com/Kaese72/riskie-lib/apierror"
+	"github.com/Kaese72/riskie-lib/logging"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// ErrorHeader is the header of a dead-lettered submission describing why it was rejected
+const ErrorHeader = "x-submission-error"
+
+type ConsumerConfig struct {
+	ConnectionString string
+	// QueueName is the durable queue finding submissions are consumed from
+	QueueName string
+	// DeadLetterQueueName is the durable queue rejected submissions are moved to, defaults to the queue name suffixed with .deadLetter
+	DeadLetterQueueName string
+	// JWTSecret verifies the token of every submission
+	JWTSecret string
+	// Prefetch is the number of submissions received from the broker before they are acknowledged
+	Prefetch int
+	// MinBackoff and MaxBackoff bound the exponential backoff used between reconnects and failed submissions
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+func (config ConsumerConfig) withDefaults() ConsumerConfig {
+	if config.DeadLetterQueueName == "" {
+		config.DeadLetterQueueName = config.QueueName + ".deadLetter"
+	}
+	if config.Prefetch <= 0 {
+		config.Prefetch = 10
+	}
+	if config.MinBackoff <= 0 {
+		config.MinBackoff = 500 * time.Millisecond
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = 30 * time.Second
+	}
+	return config
+}
+
+// SubmittedFinding is the finding of a submission. It has the fields of a finding posted to the REST API,
+// with the organization it belongs to.
+type SubmittedFinding struct {
+	Name                string              `json:"name"`
+	OrganizationId      int                 `json:"organizationId"`
+	ReportDistinguisher ReportDistinguisher `json:"reportDistinguisher"`
+	ReportLocator       ReportLocator       `json:"reportLocator"`
+	Severity            string              `json:"severity"`
+}
+
+// FindingSubmission is a finding submitted through the queue, together with a token of a user of its organization
+type FindingSubmission struct {
+	SubmittedFinding
+	Token string `json:"token"`
+}
+
+// SubmissionHandler stores a submitted finding on behalf of the organization in the context
+type SubmissionHandler func(ctx context.Context, finding SubmittedFinding, organizationID int) error
+
+// ParseSubmission decodes a finding submission and verifies that its token belongs to the organization it is submitted for.
+// The returned context carries the user and organization of the token, like an authenticated HTTP request.
+func ParseSubmission(ctx context.Context, jwtSecret string, body []byte) (context.Context, SubmittedFinding, error) {
+	submission := FindingSubmission{}
+	if err := json.Unmarshal(body, &submission); err != nil {
+		return ctx, SubmittedFinding{}, apierror.APIError{Code: http.StatusBadRequest, WrappedError: fmt.Errorf("error decoding submission: %s", err.Error())}
+	}
+	if submission.Token == "" {
+		return ctx, SubmittedFinding{}, apierror.APIError{Code: http.StatusUnauthorized, WrappedError: errors.New("missing token")}
+	}
+	userID, organizationID, err := authentication.AuthenticateToken(jwtSecret, submission.Token)
+	if err != nil {
+		return ctx, SubmittedFinding{}, err
+	}
+	if submission.OrganizationId != int(organizationID) {
+		return ctx, SubmittedFinding{}, apierror.APIError{Code: http.StatusForbidden, WrappedError: fmt.Errorf("token does not belong to organization %d", submission.OrganizationId)}
+	}
+	ctx = context.WithValue(ctx, authentication.UserIDKey, userID)
+	ctx = context.WithValue(ctx, authentication.OrganizationIDKey, organizationID)
+	return ctx, submission.SubmittedFinding, nil
+}
+
+// invalidSubmission tells whether a submission was rejected because of the submission itself,
+// and retrying it will not help
+func invalidSubmission(err error) bool {
+	var apiError apierror.APIError
+	return errors.As(err, &apiError) && apiError.Code >= 400 && apiError.Code < 500
+}
+
+// Consumer consumes finding submissions from a durable queue. Submissions are acknowledged once stored,
+// invalid submissions are moved to a dead letter queue with the reason in the ErrorHeader header,
+// and submissions failing for other reasons are requeued.
+type Consumer struct {
+	config      ConsumerConfig
+	handler     SubmissionHandler
+	healthMutex sync.RWMutex
+	healthErr   error
+}
+
+func NewConsumer(config ConsumerConfig, handler SubmissionHandler) (*Consumer, error) {
+	if config.QueueName == "" {
+		return nil, errors.New("no submission queue configured")
+	}
+	return &Consumer{config: config.withDefaults(), handler: handler}, nil
+}
+
+func (consumer *Consumer) setHealth(err error) {
+	consumer.healthMutex.Lock()
+	defer consumer.healthMutex.Unlock()
+	consumer.healthErr = err
+}
+
+// Health returns an error describing why the broker is unreachable, or nil if it is connected
+func (consumer *Consumer) Health() error {
+	consumer.healthMutex.RLock()
+	defer consumer.healthMutex.RUnlock()
+	return consumer.healthErr
+}
+
+func (consumer *Consumer) sleep(ctx context.Context, duration time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(duration):
+		return true
+	}
+}
+
+// Run consumes submissions until the context is cancelled, reconnecting with exponential backoff when the connection is lost
+func (consumer *Consumer) Run(ctx context.Context) {
+	logging.Info(ctx, "Started submission consumer", map[string]interface{}{"queue": consumer.config.QueueName})
+	backoff := consumer.config.MinBackoff
+	for {
+		session, deliveries, err := consumer.connect()
+		if err != nil {
+			consumer.setHealth(fmt.Errorf("submission broker unreachable: %s", err.Error()))
+			logging.Error(ctx, "Failed to connect to submission broker", map[string]interface{}{"error": err.Error(), "backoff": backoff.String()})
+			if !consumer.sleep(ctx, backoff) {
+				return
+			}
+			backoff *= 2
+			if backoff > consumer.config.MaxBackoff {
+				backoff = consumer.config.MaxBackoff
+			}
+			continue
+		}
+		consumer.setHealth(nil)
+		backoff = consumer.config.MinBackoff
+		consumer.serve(ctx, session, deliveries)
+		session.connection.Close()
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+		consumer.setHealth(errors.New("submission broker connection lost"))
+		logging.Error(ctx, "Lost connection to submission broker... Reconnecting")
+	}
+}
+
+func (consumer *Consumer) connect() (*amqpSession, <-chan amqp.Delivery, error) {
+	connection, err := amqp.Dial(consumer.config.ConnectionString)
+	if err != nil {
+		return nil, nil, err
+	}
+	channel, err := connection.Channel()
+	if err != nil {
+		connection.Close()
+		return nil, nil, err
+	}
+	for _, queue := range []string{consumer.config.QueueName, consumer.config.DeadLetterQueueName} {
+		_, err = channel.QueueDeclare(
+			queue, // name
+			true,  // durable
+			false, // delete when unused
+			false, // exclusive
+			false, // no-wait
+			nil,   // arguments
+		)
+		if err != nil {
+			connection.Close()
+			return nil, nil, err
+		}
+	}
+	if err := channel.Qos(consumer.config.Prefetch, 0, false); err != nil {
+		connection.Close()
+		return nil, nil, err
+	}
+	if err := channel.Confirm(false); err != nil {
+		connection.Close()
+		return nil, nil, err
+	}
+	deliveries, err := channel.Consume(
+		consumer.config.QueueName, // queue
+		"",                        // consumer
+		false,                     // auto-ack
+		false,                     // exclusive
+		false,                     // no-local
+		false,                     // no-wait
+		nil,                       // arguments
+	)
+	if err != nil {
+		connection.Close()
+		return nil, nil, err
+	}
+	return &amqpSession{connection: connection, channel: channel}, deliveries, nil
+}
+
+// serve handles deliveries until the connection is lost or the context is cancelled
+func (consumer *Consumer) serve(ctx context.Context, session *amqpSession, deliveries <-chan amqp.Delivery) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case delivery, ok := <-deliveries:
+			if !ok {
+				return
+			}
+			consumer.handle(ctx, session, delivery)
+		}
+	}
+}
+
+func (consumer *Consumer) handle(ctx context.Context, session *amqpSession, delivery amqp.Delivery) {
+	submissionCtx, finding, err := ParseSubmission(ctx, consumer.config.JWTSecret, delivery.Body)
+	if err == nil {
+		err = consumer.handler(submissionCtx, finding, finding.OrganizationId)
+	}
+	if err == nil {
+		if err := delivery.Ack(false); err != nil {
+			logging.Error(ctx, "Failed to acknowledge submission", map[string]interface{}{"error": err.Error()})
+		}
+		return
+	}
+	if invalidSubmission(err) {
+		logging.Info(ctx, "Rejected invalid submission", map[string]interface{}{"error": err.Error()})
+		if deadLetterErr := consumer.deadLetter(ctx, session, delivery, err); deadLetterErr != nil {
+			logging.Error(ctx, "Failed to dead letter submission", map[string]interface{}{"error": deadLetterErr.Error()})
+			delivery.Nack(false, true)
+			return
+		}
+		if err := delivery.Ack(false); err != nil {
+			logging.Error(ctx, "Failed to acknowledge submission", map[string]interface{}{"error": err.Error()})
+		}
+		return
+	}
+	logging.Error(ctx, "Failed to store submission... Requeueing", map[string]interface{}{"error": err.Error()})
+	// Hold off before requeueing, so that a failing dependency is not hammered with the same submission
+	consumer.sleep(ctx, consumer.config.MinBackoff)
+	delivery.Nack(false, true)
+}
+
+// RedactSubmission removes the token from a submission, so that a rejected submission does not hand a live
+// credential to whoever reads the dead letter queue. The rest of the submission is kept as it was, to diagnose
+// the rejection and to submit it again with a new token. A body that is not a JSON object can not be searched
+// for a token, so nothing of it is kept.
+func RedactSubmission(body []byte) []byte {
+	submission := map[string]json.RawMessage{}
+	if err := json.Unmarshal(body, &submission); err != nil {
+		return []byte{}
+	}
+	delete(submission, "token")
+	redacted, err := json.Marshal(submission)
+	if err != nil {
+		return []byte{}
+	}
+	return redacted
+}
+
+// deadLetter moves the delivery to the dead letter queue without its token, with the reason it was rejected attached
+func (consumer *Consumer) deadLetter(ctx context.Context, session *amqpSession, delivery amqp.Delivery, reason error) error {
+	headers := amqp.Table{}
+	for key, value := range delivery.Headers {
+		headers[key] = value
+	}
+	headers[ErrorHeader] = reason.Error()
+	confirmation, err := session.channel.PublishWithDeferredConfirmWithContext(ctx,
+		"",                                  // exchange
+		consumer.config.DeadLetterQueueName, // routing key
+		false,                               // mandatory
+		false,                               // immediate
+		amqp.Publishing{
+			Headers:      headers,
+			ContentType:  delivery.ContentType,
+			DeliveryMode: amqp.Persistent,
+			MessageId:    delivery.MessageId,
+			Timestamp:    delivery.Timestamp,
+			Body:         RedactSubmission(delivery.Body),
+		},
+	)
+	if err != nil {
+		return err
+	}
+	acked, err := confirmation.WaitContext(ctx)
+	if err != nil {
+		return err
+	}
+	if !acked {
+		return errors.New("dead letter rejected by broker")
+	}
+	return nil
+}
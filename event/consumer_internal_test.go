@@ -0,0 +1,111 @@
+package event_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/Kaese72/finding-registry/event"
+	"github.com/Kaese72/organization-registry/authentication"
+	"github.com/Kaese72/riskie-lib/apierror"
+)
+
+const testSecret = "secret"
+
+// testToken signs a token like the organization registry does
+func testToken(secret string, userID int, organizationID int) string {
+	encode := func(value interface{}) string {
+		encoded, _ := json.Marshal(value)
+		return base64.RawURLEncoding.EncodeToString(encoded)
+	}
+	unsigned := encode(map[string]string{"alg": "HS256", "typ": "JWT"}) + "." + encode(map[string]int{"userID": userID, "organizationID": organizationID})
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func testSubmission(token string, organizationID int) []byte {
+	return []byte(fmt.Sprintf(`{
+		"token": %q,
+		"identifier": "ignored",
+		"name": "open port",
+		"organizationId": %d,
+		"reportDistinguisher": {"type": "nmap", "value": "22"},
+		"reportLocator": {"type": "TCP", "value": "10.0.0.1:22"}
+	}`, token, organizationID))
+}
+
+func TestParseSubmission(t *testing.T) {
+	ctx, finding, err := event.ParseSubmission(context.Background(), testSecret, testSubmission(testToken(testSecret, 3, 7), 7))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if finding.Name != "open port" || finding.ReportLocator.Value != "10.0.0.1:22" || finding.OrganizationId != 7 {
+		t.Errorf("unexpected finding %+v", finding)
+	}
+	if ctx.Value(authentication.UserIDKey) != float64(3) || ctx.Value(authentication.OrganizationIDKey) != float64(7) {
+		t.Errorf("expected context to carry user and organization")
+	}
+}
+
+func TestParseSubmissionError(t *testing.T) {
+	var tests = []struct {
+		name     string
+		body     []byte
+		expected int
+	}{
+		{"malformed", []byte(`{"name": `), http.StatusBadRequest},
+		{"missing token", testSubmission("", 7), http.StatusUnauthorized},
+		{"wrong secret", testSubmission(testToken("other", 3, 7), 7), http.StatusUnauthorized},
+		{"other organization", testSubmission(testToken(testSecret, 3, 7), 8), http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := event.ParseSubmission(context.Background(), testSecret, tt.body)
+			var apiError apierror.APIError
+			if !errors.As(err, &apiError) {
+				t.Fatalf("expected APIError, got %v", err)
+			}
+			if apiError.Code != tt.expected {
+				t.Errorf("expected code %d, got %d", tt.expected, apiError.Code)
+			}
+		})
+	}
+}
+
+func TestRedactSubmission(t *testing.T) {
+	var tests = []struct {
+		name     string
+		body     []byte
+		expected map[string]interface{}
+	}{
+		{"token removed", []byte(`{"token": "secret", "name": "open port", "organizationId": 1}`), map[string]interface{}{"name": "open port", "organizationId": float64(1)}},
+		{"without token", []byte(`{"name": "open port"}`), map[string]interface{}{"name": "open port"}},
+		{"not an object", []byte(`"token": "secret"`), nil},
+		{"not JSON", []byte(`token=secret`), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			redacted := event.RedactSubmission(tt.body)
+			if tt.expected == nil {
+				if len(redacted) != 0 {
+					t.Errorf("expected nothing to be kept, got %s", redacted)
+				}
+				return
+			}
+			decoded := map[string]interface{}{}
+			if err := json.Unmarshal(redacted, &decoded); err != nil {
+				t.Fatal(err.Error())
+			}
+			if fmt.Sprint(decoded) != fmt.Sprint(tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, decoded)
+			}
+		})
+	}
+}
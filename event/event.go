@@ -2,61 +2,60 @@ package event
 
 import (
 	"context"
-	"encoding/json"
-	"time"
+	"errors"
+	"fmt"
+)
+
+// ErrBufferFull is returned when more events are waiting to be published than the buffer allows
+var ErrBufferFull = errors.New("event buffer full")
+
+// ErrClosed is returned when publishing on a closed publisher
+var ErrClosed = errors.New("event publisher closed")
+
+// Publisher publishes events on an event transport
+type Publisher interface {
+	// Publish publishes the event and returns once the transport has accepted it, or the context expires
+	Publish(ctx context.Context, event Event) error
+	// Health returns an error describing why the transport is unreachable, or nil if it is connected
+	Health() error
+	// Close stops publishing
+	Close()
+}
 
-	"github.com/Kaese72/riskie-lib/logging"
+type Transport string
 
-	amqp "github.com/rabbitmq/amqp091-go"
+const (
+	TransportAMQP   Transport = "amqp"
+	TransportKafka  Transport = "kafka"
+	TransportNATS   Transport = "nats"
+	TransportMemory Transport = "memory"
 )
 
-func Setup(connectionString string, queueName string) (chan FindingUpdate, error) {
-	connection, err := amqp.Dial(connectionString)
-	if err != nil {
-		return nil, err
-	}
-	channel, err := connection.Channel()
-	if err != nil {
-		return nil, err
-	}
-	queue, err := channel.QueueDeclare(
-		queueName, // name
-		false,     // durable
-		false,     // delete when unused
-		false,     // exclusive
-		false,     // no-wait
-		nil,       // arguments
-	)
-	if err != nil {
-		return nil, err
+// Config selects the event transport and configures it
+type Config struct {
+	Transport   Transport
+	CloudEvents CloudEventsConfig
+	AMQP        AMQPConfig
+	Kafka       KafkaConfig
+	NATS        NATSConfig
+	Memory      MemoryConfig
+}
+
+// Setup connects the configured transport
+func Setup(config Config) (Publisher, error) {
+	switch config.Transport {
+	case TransportAMQP, "":
+		config.AMQP.CloudEventsConfig = config.CloudEvents
+		return SetupAMQP(config.AMQP)
+	case TransportKafka:
+		config.Kafka.CloudEventsConfig = config.CloudEvents
+		return SetupKafka(config.Kafka)
+	case TransportNATS:
+		config.NATS.CloudEventsConfig = config.CloudEvents
+		return SetupNATS(config.NATS)
+	case TransportMemory:
+		return NewMemoryPublisher(config.Memory), nil
+	default:
+		return nil, fmt.Errorf("unknown event transport: %s", config.Transport)
 	}
-	findingUpdatesChan := make(chan FindingUpdate)
-	go func() {
-		logging.Info(context.Background(), "Started event sender")
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-		for findingUpdate := range findingUpdatesChan {
-			logging.Info(context.Background(), "Received finding update", map[string]interface{}{"findingId": findingUpdate.ID})
-			encoded, err := json.Marshal(findingUpdate)
-			if err != nil {
-				logging.Info(context.Background(), "Failed to marshal finding update... Continued", map[string]interface{}{"findingId": findingUpdate.ID, "error": err.Error()})
-				continue
-			}
-			err = channel.PublishWithContext(ctx,
-				"",         // exchange
-				queue.Name, // routing key
-				false,      // mandatory
-				false,      // immediate
-				amqp.Publishing{
-					ContentType: "application/json",
-					Body:        encoded,
-				},
-			)
-			if err != nil {
-				logging.Info(context.Background(), "Failed to marshal finding update... Continued", map[string]interface{}{"findingId": findingUpdate.ID, "error": err.Error()})
-				continue
-			}
-		}
-	}()
-	return findingUpdatesChan, nil
 }
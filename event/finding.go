@@ -1,13 +1,191 @@
 package event
 
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// SchemaVersion is the version of the event schemas published by this build.
+// It is increased whenever an event changes in a way that is not backwards compatible.
+const SchemaVersion = 1
+
+type EventType string
+
+const (
+	FindingCreatedType       EventType = "finding.created"
+	FindingUpdatedType       EventType = "finding.updated"
+	FindingStatusChangedType EventType = "finding.statusChanged"
+	FindingDeletedType       EventType = "finding.deleted"
+	FindingSnapshotType      EventType = "finding.snapshot"
+)
+
+// EventTypes lists every event type, in the order they are documented
+var EventTypes = []EventType{FindingCreatedType, FindingUpdatedType, FindingStatusChangedType, FindingDeletedType, FindingSnapshotType}
+
+// Event is implemented by every event published by the registry
+type Event interface {
+	EventHeader() Header
+	// EventFinding is the snapshot of the finding the event is about
+	EventFinding() Finding
+}
+
+// Header is common to every event
+type Header struct {
+	// EventID is unique per event. Events are delivered at least once, and consumers should deduplicate on it
+	EventID        string    `json:"eventId"`
+	Type           EventType `json:"type"`
+	SchemaVersion  int       `json:"schemaVersion"`
+	OrganizationId int       `json:"organizationId"`
+	OccurredAt     time.Time `json:"occurredAt"`
+}
+
+func (header Header) EventHeader() Header {
+	return header
+}
+
 type ReportLocator struct {
 	Type          string `json:"type"`
 	Value         string `json:"value"`
 	Distinguisher string `json:"distinguisher"`
 }
 
-type FindingUpdate struct {
-	ID             string        `json:"id"`
-	OrganizationId int           `json:"organizationId"`
-	ReportLocator  ReportLocator `json:"reportLocator"`
+type ReportDistinguisher struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type Owner struct {
+	Team    string `json:"team"`
+	Contact string `json:"contact"`
+}
+
+// Finding is a full snapshot of a finding at the time of the event
+type Finding struct {
+	ID                    string              `json:"id"`
+	Name                  string              `json:"name"`
+	OrganizationId        int                 `json:"organizationId"`
+	ReportDistinguisher   ReportDistinguisher `json:"reportDistinguisher"`
+	ReportLocator         ReportLocator       `json:"reportLocator"`
+	ImpliedReportLocators []ReportLocator     `json:"impliedReportLocators"`
+	Owner                 Owner               `json:"owner"`
+	Severity              string              `json:"severity"`
+	Status                string              `json:"status"`
+	CreatedAt             time.Time           `json:"createdAt"`
+	UpdatedAt             time.Time           `json:"updatedAt"`
+}
+
+// FieldChange describes a single changed field of a finding, using the JSON encoding of the field values
+type FieldChange struct {
+	Field  string      `json:"field"`
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+type FindingCreated struct {
+	Header
+	Finding Finding `json:"finding"`
+}
+
+type FindingUpdated struct {
+	Header
+	Finding Finding       `json:"finding"`
+	Changes []FieldChange `json:"changes"`
+}
+
+type FindingStatusChanged struct {
+	Header
+	Finding        Finding `json:"finding"`
+	PreviousStatus string  `json:"previousStatus"`
+	Status         string  `json:"status"`
+}
+
+type FindingDeleted struct {
+	Header
+	Finding Finding `json:"finding"`
+}
+
+// FindingSnapshot is not caused by a change, but republishes the current state of a finding
+type FindingSnapshot struct {
+	Header
+	Finding Finding `json:"finding"`
+}
+
+func (event FindingCreated) EventFinding() Finding {
+	return event.Finding
+}
+
+func (event FindingUpdated) EventFinding() Finding {
+	return event.Finding
+}
+
+func (event FindingStatusChanged) EventFinding() Finding {
+	return event.Finding
+}
+
+func (event FindingDeleted) EventFinding() Finding {
+	return event.Finding
+}
+
+func (event FindingSnapshot) EventFinding() Finding {
+	return event.Finding
+}
+
+// NewHeader creates the header of a new event
+func NewHeader(eventID string, eventType EventType, organizationID int, occurredAt time.Time) Header {
+	return Header{
+		EventID:        eventID,
+		Type:           eventType,
+		SchemaVersion:  SchemaVersion,
+		OrganizationId: organizationID,
+		OccurredAt:     occurredAt,
+	}
+}
+
+// DiffFindings lists the fields that differ between two snapshots of the same finding.
+// Status and timestamps are not included, status changes have their own event.
+func DiffFindings(before Finding, after Finding) []FieldChange {
+	changes := []FieldChange{}
+	fields := []struct {
+		name   string
+		before interface{}
+		after  interface{}
+	}{
+		{"name", before.Name, after.Name},
+		{"reportDistinguisher", before.ReportDistinguisher, after.ReportDistinguisher},
+		{"reportLocator", before.ReportLocator, after.ReportLocator},
+		{"impliedReportLocators", before.ImpliedReportLocators, after.ImpliedReportLocators},
+		{"owner", before.Owner, after.Owner},
+		{"severity", before.Severity, after.Severity},
+	}
+	for _, field := range fields {
+		if !reflect.DeepEqual(field.before, field.after) {
+			changes = append(changes, FieldChange{Field: field.name, Before: field.before, After: field.after})
+		}
+	}
+	return changes
+}
+
+// DecodeEvent decodes an encoded event of the given type
+func DecodeEvent(eventType EventType, payload []byte) (Event, error) {
+	var decoded Event
+	switch eventType {
+	case FindingCreatedType:
+		decoded = &FindingCreated{}
+	case FindingUpdatedType:
+		decoded = &FindingUpdated{}
+	case FindingStatusChangedType:
+		decoded = &FindingStatusChanged{}
+	case FindingDeletedType:
+		decoded = &FindingDeleted{}
+	case FindingSnapshotType:
+		decoded = &FindingSnapshot{}
+	default:
+		return nil, fmt.Errorf("unknown event type: %s", eventType)
+	}
+	if err := json.Unmarshal(payload, decoded); err != nil {
+		return nil, err
+	}
+	return decoded, nil
 }
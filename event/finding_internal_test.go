@@ -0,0 +1,93 @@
+package event_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Kaese72/finding-registry/event"
+)
+
+func TestDiffFindings(t *testing.T) {
+	before := event.Finding{
+		ID:                  "1",
+		Name:                "open port",
+		ReportDistinguisher: event.ReportDistinguisher{Type: "nmap", Value: "22"},
+		ReportLocator:       event.ReportLocator{Type: "TCP", Value: "10.0.0.1:22", Distinguisher: "global"},
+		Status:              "open",
+	}
+	var tests = []struct {
+		name     string
+		modify   func(finding event.Finding) event.Finding
+		expected []string
+	}{
+		{"unchanged", func(finding event.Finding) event.Finding { return finding }, []string{}},
+		{"name", func(finding event.Finding) event.Finding { finding.Name = "ssh"; return finding }, []string{"name"}},
+		{"owner", func(finding event.Finding) event.Finding { finding.Owner = event.Owner{Team: "infra"}; return finding }, []string{"owner"}},
+		{"status is not a field change", func(finding event.Finding) event.Finding { finding.Status = "resolved"; return finding }, []string{}},
+		{"timestamps are not field changes", func(finding event.Finding) event.Finding { finding.UpdatedAt = time.Now(); return finding }, []string{}},
+		{"several", func(finding event.Finding) event.Finding {
+			finding.Name = "ssh"
+			finding.ReportLocator.Distinguisher = "dc1"
+			return finding
+		}, []string{"name", "reportLocator"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes := event.DiffFindings(before, tt.modify(before))
+			if len(changes) != len(tt.expected) {
+				t.Fatalf("expected %d changes, got %v", len(tt.expected), changes)
+			}
+			for index := range changes {
+				if changes[index].Field != tt.expected[index] {
+					t.Errorf("expected change of %s, got %s", tt.expected[index], changes[index].Field)
+				}
+			}
+		})
+	}
+}
+
+func TestSchemas(t *testing.T) {
+	for _, eventType := range event.EventTypes {
+		t.Run(string(eventType), func(t *testing.T) {
+			schema, err := event.Schema(eventType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			decoded := map[string]interface{}{}
+			if err := json.Unmarshal(schema, &decoded); err != nil {
+				t.Fatalf("schema is not valid JSON: %s", err.Error())
+			}
+		})
+	}
+	if _, err := event.Schema("finding.unknown"); err == nil {
+		t.Error("expected error for unknown event type")
+	}
+}
+
+func TestDecodeEvent(t *testing.T) {
+	original := event.FindingStatusChanged{
+		Header:         event.NewHeader("abc", event.FindingStatusChangedType, 1, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)),
+		Finding:        event.Finding{ID: "1", Status: "resolved"},
+		PreviousStatus: "open",
+		Status:         "resolved",
+	}
+	payload, err := json.Marshal(original)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := event.DecodeEvent(event.FindingStatusChangedType, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statusChanged, ok := decoded.(*event.FindingStatusChanged)
+	if !ok {
+		t.Fatalf("expected *FindingStatusChanged, got %T", decoded)
+	}
+	if statusChanged.EventHeader() != original.Header || statusChanged.PreviousStatus != "open" {
+		t.Errorf("decoded event differs: %+v", statusChanged)
+	}
+	if _, err := event.DecodeEvent("finding.unknown", payload); err == nil {
+		t.Error("expected error for unknown event type")
+	}
+}
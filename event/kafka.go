@@ -0,0 +1,161 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// DefaultTopic is the Kafka topic events are published on, unless configured otherwise
+const DefaultTopic = "findings"
+
+type KafkaConfig struct {
+	Brokers []string
+	Topic   string
+	// MaxRetries is the number of times an event rejected by the brokers is retried before it is dropped
+	MaxRetries int
+	// WriteTimeout is how long to wait for the brokers to acknowledge a publish
+	WriteTimeout time.Duration
+	CloudEventsConfig
+}
+
+func (config KafkaConfig) withDefaults() KafkaConfig {
+	if config.Topic == "" {
+		config.Topic = DefaultTopic
+	}
+	if config.MaxRetries <= 0 {
+		config.MaxRetries = 5
+	}
+	if config.WriteTimeout <= 0 {
+		config.WriteTimeout = 10 * time.Second
+	}
+	config.CloudEventsConfig = config.CloudEventsConfig.withDefaults()
+	return config
+}
+
+const (
+	kafkaContentTypeHeader = "content-type"
+	// kafkaHeaderPrefix prefixes CloudEvents attributes carried as Kafka headers in binary content mode
+	kafkaHeaderPrefix = "ce_"
+)
+
+// KafkaPublisher publishes events on a Kafka topic, keyed by PartitionKey so that the events
+// of a finding stay in order, and waits for every in-sync replica to acknowledge them
+type KafkaPublisher struct {
+	config      KafkaConfig
+	writer      *kafka.Writer
+	closeOnce   sync.Once
+	healthMutex sync.RWMutex
+	healthErr   error
+}
+
+// SetupKafka verifies that the topic exists on the brokers, so that misconfiguration is detected at startup
+func SetupKafka(config KafkaConfig) (*KafkaPublisher, error) {
+	config = config.withDefaults()
+	if err := config.ContentMode.Validate(); err != nil {
+		return nil, err
+	}
+	if len(config.Brokers) == 0 {
+		return nil, errors.New("no Kafka brokers configured")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), config.WriteTimeout)
+	defer cancel()
+	connection, err := kafka.DialContext(ctx, "tcp", config.Brokers[0])
+	if err != nil {
+		return nil, err
+	}
+	defer connection.Close()
+	partitions, err := connection.ReadPartitions(config.Topic)
+	if err != nil {
+		return nil, err
+	}
+	if len(partitions) == 0 {
+		return nil, fmt.Errorf("Kafka topic %s does not exist", config.Topic)
+	}
+	return &KafkaPublisher{
+		config: config,
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(config.Brokers...),
+			Topic:        config.Topic,
+			Balancer:     &kafka.Hash{},
+			MaxAttempts:  config.MaxRetries,
+			RequiredAcks: kafka.RequireAll,
+			BatchTimeout: 10 * time.Millisecond,
+			WriteTimeout: config.WriteTimeout,
+		},
+	}, nil
+}
+
+func (publisher *KafkaPublisher) setHealth(err error) {
+	publisher.healthMutex.Lock()
+	defer publisher.healthMutex.Unlock()
+	publisher.healthErr = err
+}
+
+// Health returns the error of the last failed publish, or nil if the last publish succeeded
+func (publisher *KafkaPublisher) Health() error {
+	publisher.healthMutex.RLock()
+	defer publisher.healthMutex.RUnlock()
+	return publisher.healthErr
+}
+
+func (publisher *KafkaPublisher) Publish(ctx context.Context, event Event) error {
+	cloudEvent, err := NewCloudEvent(publisher.config.Source, event)
+	if err != nil {
+		return err
+	}
+	message, err := cloudEvent.kafkaMessage(publisher.config.ContentMode)
+	if err != nil {
+		return err
+	}
+	message.Key = []byte(PartitionKey(event))
+	err = publisher.writer.WriteMessages(ctx, message)
+	if errors.Is(err, io.ErrClosedPipe) {
+		return ErrClosed
+	}
+	if err != nil {
+		if ctx.Err() == nil {
+			publisher.setHealth(fmt.Errorf("event broker unreachable: %s", err.Error()))
+		}
+		return err
+	}
+	publisher.setHealth(nil)
+	return nil
+}
+
+func (publisher *KafkaPublisher) Close() {
+	publisher.closeOnce.Do(func() { publisher.writer.Close() })
+}
+
+// kafkaMessage maps the CloudEvent onto a Kafka message according to the CloudEvents Kafka protocol binding
+func (cloudEvent CloudEvent) kafkaMessage(mode ContentMode) (kafka.Message, error) {
+	switch mode {
+	case ContentModeStructured:
+		encoded, err := cloudEvent.structured()
+		if err != nil {
+			return kafka.Message{}, err
+		}
+		return kafka.Message{
+			Headers: []kafka.Header{{Key: kafkaContentTypeHeader, Value: []byte(cloudEventsContentType)}},
+			Value:   encoded,
+			Time:    cloudEvent.Time,
+		}, nil
+	case ContentModeBinary:
+		headers := []kafka.Header{{Key: kafkaContentTypeHeader, Value: []byte(cloudEvent.DataContentType)}}
+		for attribute, value := range cloudEvent.attributes() {
+			headers = append(headers, kafka.Header{Key: kafkaHeaderPrefix + attribute, Value: []byte(value)})
+		}
+		return kafka.Message{
+			Headers: headers,
+			Value:   cloudEvent.Data,
+			Time:    cloudEvent.Time,
+		}, nil
+	default:
+		return kafka.Message{}, mode.Validate()
+	}
+}
@@ -0,0 +1,95 @@
+package event
+
+import (
+	"context"
+	"sync"
+
+	"github.com/Kaese72/riskie-lib/logging"
+)
+
+type MemoryConfig struct {
+	// BufferSize is the number of events buffered per subscriber before events are dropped for it
+	BufferSize int
+}
+
+func (config MemoryConfig) withDefaults() MemoryConfig {
+	if config.BufferSize <= 0 {
+		config.BufferSize = 1000
+	}
+	return config
+}
+
+// MemoryPublisher delivers events to subscribers within the same process, without a broker.
+// A subscriber that does not keep up has events dropped rather than holding up publishing.
+type MemoryPublisher struct {
+	config      MemoryConfig
+	mutex       sync.Mutex
+	subscribers map[int]chan Event
+	nextID      int
+	closed      bool
+}
+
+func NewMemoryPublisher(config MemoryConfig) *MemoryPublisher {
+	return &MemoryPublisher{
+		config:      config.withDefaults(),
+		subscribers: map[int]chan Event{},
+	}
+}
+
+// Subscribe returns a channel receiving every event published from now on,
+// and a function that ends the subscription and closes the channel
+func (publisher *MemoryPublisher) Subscribe() (<-chan Event, func()) {
+	publisher.mutex.Lock()
+	defer publisher.mutex.Unlock()
+	events := make(chan Event, publisher.config.BufferSize)
+	if publisher.closed {
+		close(events)
+		return events, func() {}
+	}
+	id := publisher.nextID
+	publisher.nextID++
+	publisher.subscribers[id] = events
+	return events, func() {
+		publisher.mutex.Lock()
+		defer publisher.mutex.Unlock()
+		if subscriber, ok := publisher.subscribers[id]; ok {
+			delete(publisher.subscribers, id)
+			close(subscriber)
+		}
+	}
+}
+
+func (publisher *MemoryPublisher) Publish(ctx context.Context, event Event) error {
+	publisher.mutex.Lock()
+	defer publisher.mutex.Unlock()
+	if publisher.closed {
+		return ErrClosed
+	}
+	for _, subscriber := range publisher.subscribers {
+		select {
+		case subscriber <- event:
+		default:
+			logging.Error(ctx, "Dropped event for slow subscriber", map[string]interface{}{"eventId": event.EventHeader().EventID})
+		}
+	}
+	return nil
+}
+
+// Health always succeeds, there is no broker to lose
+func (publisher *MemoryPublisher) Health() error {
+	return nil
+}
+
+// Close ends every subscription
+func (publisher *MemoryPublisher) Close() {
+	publisher.mutex.Lock()
+	defer publisher.mutex.Unlock()
+	if publisher.closed {
+		return
+	}
+	publisher.closed = true
+	for id, subscriber := range publisher.subscribers {
+		delete(publisher.subscribers, id)
+		close(subscriber)
+	}
+}
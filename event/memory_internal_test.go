@@ -0,0 +1,49 @@
+package event_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Kaese72/finding-registry/event"
+)
+
+func TestMemoryPublisher(t *testing.T) {
+	publisher := event.NewMemoryPublisher(event.MemoryConfig{BufferSize: 1})
+	first, unsubscribeFirst := publisher.Subscribe()
+	second, _ := publisher.Subscribe()
+	if err := publisher.Publish(context.Background(), testEvent()); err != nil {
+		t.Fatal(err)
+	}
+	for _, subscriber := range []<-chan event.Event{first, second} {
+		received := <-subscriber
+		if received.EventHeader().EventID != "abc" {
+			t.Errorf("unexpected event %+v", received)
+		}
+	}
+
+	// A subscriber that does not keep up does not hold up publishing
+	if err := publisher.Publish(context.Background(), testEvent()); err != nil {
+		t.Fatal(err)
+	}
+	if err := publisher.Publish(context.Background(), testEvent()); err != nil {
+		t.Fatal(err)
+	}
+	if len(first) != 1 {
+		t.Errorf("expected a single buffered event, got %d", len(first))
+	}
+
+	unsubscribeFirst()
+	for range first {
+	}
+	publisher.Close()
+	if _, ok := <-second; !ok {
+		t.Error("expected buffered event to survive close")
+	}
+	if _, ok := <-second; ok {
+		t.Error("expected subscription to end on close")
+	}
+	if err := publisher.Publish(context.Background(), testEvent()); !errors.Is(err, event.ErrClosed) {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+}
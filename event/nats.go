@@ -0,0 +1,162 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Kaese72/riskie-lib/logging"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// DefaultStream is the JetStream stream events are published on, unless configured otherwise
+const DefaultStream = "FINDINGS"
+
+type NATSConfig struct {
+	URL    string
+	Stream string
+	// PublishTimeout is how long to wait for JetStream to acknowledge a publish
+	PublishTimeout time.Duration
+	CloudEventsConfig
+}
+
+func (config NATSConfig) withDefaults() NATSConfig {
+	if config.Stream == "" {
+		config.Stream = DefaultStream
+	}
+	if config.PublishTimeout <= 0 {
+		config.PublishTimeout = 10 * time.Second
+	}
+	config.CloudEventsConfig = config.CloudEventsConfig.withDefaults()
+	return config
+}
+
+const (
+	natsContentTypeHeader = "content-type"
+	// natsHeaderPrefix prefixes CloudEvents attributes carried as NATS headers in binary content mode
+	natsHeaderPrefix = "ce-"
+)
+
+// NATSPublisher publishes events on a JetStream stream, with subjects from Subject.
+// JetStream deduplicates republished events on their event id.
+type NATSPublisher struct {
+	config      NATSConfig
+	connection  *nats.Conn
+	jetStream   jetstream.JetStream
+	closeOnce   sync.Once
+	healthMutex sync.RWMutex
+	healthErr   error
+}
+
+// SetupNATS connects to NATS and declares the stream. The initial connection must succeed,
+// so that misconfiguration is detected at startup. Lost connections are re-established by the client.
+func SetupNATS(config NATSConfig) (*NATSPublisher, error) {
+	config = config.withDefaults()
+	if err := config.ContentMode.Validate(); err != nil {
+		return nil, err
+	}
+	publisher := &NATSPublisher{config: config}
+	connection, err := nats.Connect(
+		config.URL,
+		nats.Name("finding-registry"),
+		nats.MaxReconnects(-1),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			lost := errors.New("event broker connection lost")
+			if err != nil {
+				lost = fmt.Errorf("event broker connection lost: %s", err.Error())
+			}
+			publisher.setHealth(lost)
+			logging.Error(context.Background(), "Lost connection to event broker... Reconnecting", map[string]interface{}{"error": lost.Error()})
+		}),
+		nats.ReconnectHandler(func(_ *nats.Conn) {
+			publisher.setHealth(nil)
+			logging.Info(context.Background(), "Connected to event broker")
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	jetStream, err := jetstream.New(connection)
+	if err != nil {
+		connection.Close()
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), config.PublishTimeout)
+	defer cancel()
+	_, err = jetStream.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:     config.Stream,
+		Subjects: []string{"finding.>"},
+		Storage:  jetstream.FileStorage,
+	})
+	if err != nil {
+		connection.Close()
+		return nil, err
+	}
+	publisher.connection = connection
+	publisher.jetStream = jetStream
+	return publisher, nil
+}
+
+func (publisher *NATSPublisher) setHealth(err error) {
+	publisher.healthMutex.Lock()
+	defer publisher.healthMutex.Unlock()
+	publisher.healthErr = err
+}
+
+// Health returns an error describing why NATS is unreachable, or nil if it is connected
+func (publisher *NATSPublisher) Health() error {
+	publisher.healthMutex.RLock()
+	defer publisher.healthMutex.RUnlock()
+	return publisher.healthErr
+}
+
+func (publisher *NATSPublisher) Publish(ctx context.Context, event Event) error {
+	if publisher.connection.IsClosed() {
+		return ErrClosed
+	}
+	cloudEvent, err := NewCloudEvent(publisher.config.Source, event)
+	if err != nil {
+		return err
+	}
+	message, err := cloudEvent.natsMessage(publisher.config.ContentMode)
+	if err != nil {
+		return err
+	}
+	message.Subject = Subject(event)
+	ctx, cancel := context.WithTimeout(ctx, publisher.config.PublishTimeout)
+	defer cancel()
+	_, err = publisher.jetStream.PublishMsg(ctx, message, jetstream.WithMsgID(cloudEvent.ID))
+	return err
+}
+
+func (publisher *NATSPublisher) Close() {
+	publisher.closeOnce.Do(func() { publisher.connection.Close() })
+}
+
+// natsMessage maps the CloudEvent onto a NATS message according to the CloudEvents NATS protocol binding
+func (cloudEvent CloudEvent) natsMessage(mode ContentMode) (*nats.Msg, error) {
+	switch mode {
+	case ContentModeStructured:
+		encoded, err := cloudEvent.structured()
+		if err != nil {
+			return nil, err
+		}
+		message := nats.NewMsg("")
+		message.Header.Set(natsContentTypeHeader, cloudEventsContentType)
+		message.Data = encoded
+		return message, nil
+	case ContentModeBinary:
+		message := nats.NewMsg("")
+		message.Header.Set(natsContentTypeHeader, cloudEvent.DataContentType)
+		for attribute, value := range cloudEvent.attributes() {
+			message.Header.Set(natsHeaderPrefix+attribute, value)
+		}
+		message.Data = cloudEvent.Data
+		return message, nil
+	default:
+		return nil, mode.Validate()
+	}
+}
@@ -0,0 +1,35 @@
+package event
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultExchange is the topic exchange events are published on, unless configured otherwise
+const DefaultExchange = "findings"
+
+// RoutingKey is the topic routing key of an event, formatted as finding.<organizationId>.<eventType>.<locatorType>,
+// where the event type is without its "finding." prefix, like finding.7.statusChanged.HTTP.
+// Consumers can bind on any part of it, like finding.7.# for every event of a single organization
+// or finding.*.*.HTTP for every event about HTTP findings.
+func RoutingKey(event Event) string {
+	header := event.EventHeader()
+	return fmt.Sprintf(
+		"finding.%d.%s.%s",
+		header.OrganizationId,
+		strings.TrimPrefix(string(header.Type), "finding."),
+		event.EventFinding().ReportLocator.Type,
+	)
+}
+
+// PartitionKey keys an event by organization and finding, formatted as <organizationId>.<findingId>,
+// so that transports preserving order per key deliver the events of a single finding in order
+func PartitionKey(event Event) string {
+	return fmt.Sprintf("%d.%s", event.EventHeader().OrganizationId, event.EventFinding().ID)
+}
+
+// Subject is the subject of an event on subject based transports, formatted as the RoutingKey followed by the finding id,
+// like finding.7.statusChanged.HTTP.<findingId>
+func Subject(event Event) string {
+	return fmt.Sprintf("%s.%s", RoutingKey(event), event.EventFinding().ID)
+}
@@ -0,0 +1,38 @@
+package event_test
+
+import (
+	"testing"
+
+	"github.com/Kaese72/finding-registry/event"
+)
+
+func TestRoutingKey(t *testing.T) {
+	finding := event.Finding{ID: "1", ReportLocator: event.ReportLocator{Type: "HTTP", Value: "http://example.com/"}}
+	var tests = []struct {
+		event    event.Event
+		expected string
+	}{
+		{event.FindingCreated{Header: event.NewHeader("a", event.FindingCreatedType, 7, testEvent().OccurredAt), Finding: finding}, "finding.7.created.HTTP"},
+		{event.FindingUpdated{Header: event.NewHeader("b", event.FindingUpdatedType, 7, testEvent().OccurredAt), Finding: finding}, "finding.7.updated.HTTP"},
+		{event.FindingStatusChanged{Header: event.NewHeader("c", event.FindingStatusChangedType, 12, testEvent().OccurredAt), Finding: finding}, "finding.12.statusChanged.HTTP"},
+		{event.FindingDeleted{Header: event.NewHeader("d", event.FindingDeletedType, 7, testEvent().OccurredAt), Finding: finding}, "finding.7.deleted.HTTP"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expected, func(t *testing.T) {
+			if actual := event.RoutingKey(tt.event); actual != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestPartitionKey(t *testing.T) {
+	created := testEvent()
+	if actual := event.PartitionKey(created); actual != "7.finding-1" {
+		t.Errorf("unexpected partition key %s", actual)
+	}
+	created.Finding.ReportLocator.Type = "IPv4"
+	if actual := event.Subject(created); actual != "finding.7.created.IPv4.finding-1" {
+		t.Errorf("unexpected subject %s", actual)
+	}
+}
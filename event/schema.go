@@ -0,0 +1,14 @@
+package event
+
+import (
+	"embed"
+	"fmt"
+)
+
+//go:embed schemas/*.json
+var schemas embed.FS
+
+// Schema returns the JSON Schema document describing events of the given type
+func Schema(eventType EventType) ([]byte, error) {
+	return schemas.ReadFile(fmt.Sprintf("schemas/%s.json", eventType))
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/Kaese72/finding-registry/rest/models"
+	"github.com/Kaese72/riskie-lib/logging"
+)
+
+// exportCommand writes the findings of an organization to a file, like GET /finding-registry/admin/export.
+// The export is not written to stdout, which the service logs to.
+func exportCommand(args []string) {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	organizationID := flags.Int("organization", 0, "organization to export the findings of")
+	output := flags.String("output", "", "file to write the export to")
+	flags.Parse(args)
+	if *organizationID == 0 || *output == "" {
+		fmt.Fprintln(os.Stderr, "-organization and -output are required")
+		flags.Usage()
+		os.Exit(2)
+	}
+	logic := setupApplication()
+	ctx := context.Background()
+	file, err := os.Create(*output)
+	if err != nil {
+		logging.Fatal(ctx, "Export failed", map[string]interface{}{"organizationId": *organizationID, "error": err.Error()})
+	}
+	buffered := bufio.NewWriter(file)
+	writer := models.NewExportWriter(buffered)
+	err = logic.ExportFindings(ctx, *organizationID, writer)
+	if err == nil {
+		err = buffered.Flush()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		logging.Fatal(ctx, "Export failed", map[string]interface{}{"organizationId": *organizationID, "error": err.Error()})
+	}
+	// Every line but the header is a finding
+	logging.Info(ctx, "Exported findings", map[string]interface{}{"organizationId": *organizationID, "findings": writer.Written() - 1})
+}
+
+// importCommand restores the findings of an export into an organization, like POST /finding-registry/admin/import
+func importCommand(args []string) {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	organizationID := flags.Int("organization", 0, "organization to import the findings into")
+	input := flags.String("input", "", "file to read the export from")
+	flags.Parse(args)
+	if *organizationID == 0 || *input == "" {
+		fmt.Fprintln(os.Stderr, "-organization and -input are required")
+		flags.Usage()
+		os.Exit(2)
+	}
+	ctx := context.Background()
+	file, err := os.Open(*input)
+	if err != nil {
+		logging.Fatal(ctx, "Import failed", map[string]interface{}{"organizationId": *organizationID, "error": err.Error()})
+	}
+	defer file.Close()
+	reader, err := models.NewExportReader(file)
+	if err != nil {
+		logging.Fatal(ctx, "Import failed", map[string]interface{}{"organizationId": *organizationID, "error": err.Error()})
+	}
+	logic := setupApplication()
+	result, err := logic.ImportFindings(ctx, reader, *organizationID)
+	if err != nil {
+		logging.Fatal(ctx, "Import failed", map[string]interface{}{"organizationId": *organizationID, "error": err.Error()})
+	}
+	logging.Info(ctx, "Imported findings", map[string]interface{}{"organizationId": *organizationID, "created": result.Created, "updated": result.Updated, "unchanged": result.Unchanged})
+}
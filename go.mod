@@ -5,8 +5,12 @@ go 1.22.0
 require (
 	github.com/Kaese72/organization-registry v0.0.15
 	github.com/Kaese72/riskie-lib v0.0.4
+	github.com/jackc/pgx/v5 v5.6.0
+	github.com/nats-io/nats.go v1.31.0
 	github.com/rabbitmq/amqp091-go v1.9.0
+	github.com/segmentio/kafka-go v0.4.47
 	go.elastic.co/apm/module/apmgorilla/v2 v2.6.0
+	go.etcd.io/bbolt v1.3.10
 	go.mongodb.org/mongo-driver v1.13.1
 )
 
@@ -17,11 +21,17 @@ require (
 	github.com/elastic/go-windows v1.0.0 // indirect
 	github.com/fsnotify/fsnotify v1.7.0 // indirect
 	github.com/hashicorp/hcl v1.0.0 // indirect
+	github.com/jackc/pgpassfile v1.0.0 // indirect
+	github.com/jackc/pgservicefile v0.0.0-20221227161230-091c0ba34f0a // indirect
+	github.com/jackc/puddle/v2 v2.2.1 // indirect
 	github.com/jcchavezs/porto v0.1.0 // indirect
 	github.com/joeshaw/multierror v0.0.0-20140124173710-69b34d4ec901 // indirect
 	github.com/magiconair/properties v1.8.7 // indirect
 	github.com/mitchellh/mapstructure v1.5.0 // indirect
+	github.com/nats-io/nkeys v0.4.6 // indirect
+	github.com/nats-io/nuid v1.0.1 // indirect
 	github.com/pelletier/go-toml/v2 v2.1.0 // indirect
+	github.com/pierrec/lz4/v4 v4.1.15 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
 	github.com/prometheus/procfs v0.0.0-20190425082905-87a4384529e0 // indirect
 	github.com/sagikazarmark/locafero v0.4.0 // indirect
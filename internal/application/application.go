@@ -3,68 +3,292 @@ package application
 import (
 	"context"
 	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
 
 	"github.com/Kaese72/finding-registry/event"
 	"github.com/Kaese72/finding-registry/internal/database"
 	"github.com/Kaese72/finding-registry/internal/intermediaries"
+	"github.com/Kaese72/riskie-lib/apierror"
 )
 
 type ApplicationLogic struct {
-	persistence    database.Persistence
-	findingUpdates chan event.FindingUpdate
+	persistence database.Persistence
+	events      event.Publisher
+	// healthChecks are checked by Health after the event transport
+	healthChecks []func() error
+	// replays are the replays run in the background by this instance
+	replays *replayRegistry
+	stream  StreamConfig
+	// streams are the finding streams served by this instance
+	streams *streamRegistry
 }
 
-func NewApplicationLogic(persistence database.Persistence, findingUpdates chan event.FindingUpdate) ApplicationLogic {
+func NewApplicationLogic(persistence database.Persistence, events event.Publisher) ApplicationLogic {
 	return ApplicationLogic{
-		persistence:    persistence,
-		findingUpdates: findingUpdates,
+		persistence: persistence,
+		events:      events,
+		replays:     newReplayRegistry(),
+		stream:      StreamConfig{}.withDefaults(),
+		streams:     newStreamRegistry(),
 	}
 }
 
-func (logic ApplicationLogic) ReadFinding(ctx context.Context, identifier string, organizationID int) (intermediaries.Finding, error) {
-	return logic.persistence.GetFinding(ctx, identifier, organizationID)
+// WithHealthCheck returns the application with the check added to its health, like the health of a consumer feeding it
+func (logic ApplicationLogic) WithHealthCheck(check func() error) ApplicationLogic {
+	logic.healthChecks = append(append([]func() error{}, logic.healthChecks...), check)
+	return logic
 }
 
-func (logic ApplicationLogic) ReadFindings(ctx context.Context, organizationID int) ([]intermediaries.Finding, error) {
-	return logic.persistence.GetFindings(ctx, organizationID)
+// Health returns an error if the application is not able to serve requests and publish events,
+// or if any of its health checks fail
+func (logic ApplicationLogic) Health(ctx context.Context) error {
+	if err := logic.events.Health(); err != nil {
+		return err
+	}
+	for _, check := range logic.healthChecks {
+		if err := check(); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func (logic ApplicationLogic) PostFinding(ctx context.Context, finding intermediaries.Finding, organizationID int) (intermediaries.Finding, error) {
-	finding.Identifier = "" // Do not allow identifier to be set
-	if finding.ReportDistinguisher.Type == "" {
-		return intermediaries.Finding{}, errors.New("must set report distingusher type")
+// now is the time stored on findings, truncated to the millisecond precision of the persistence layer
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Millisecond)
+}
+
+// notFoundAsAPIError translates ErrNotFound from the persistence layer into a 404 API Error
+func notFoundAsAPIError(err error) error {
+	if errors.Is(err, database.ErrNotFound) {
+		return apierror.APIError{Code: http.StatusNotFound, WrappedError: err}
 	}
-	if finding.ReportDistinguisher.Value == "" {
-		return intermediaries.Finding{}, errors.New("must set report distingusher value")
+	return err
+}
+
+// versionMismatchAsAPIError translates ErrVersionMismatch from the persistence layer into a 412 API Error,
+// and otherwise translates the error like notFoundAsAPIError
+func versionMismatchAsAPIError(err error) error {
+	if errors.Is(err, database.ErrVersionMismatch) {
+		return apierror.APIError{Code: http.StatusPreconditionFailed, WrappedError: err}
 	}
-	if finding.ReportLocator.Type == "" {
-		return intermediaries.Finding{}, errors.New("must set report locator type")
+	return notFoundAsAPIError(err)
+}
+
+// getFinding reads a finding of the organization, and returns ErrNotFound for deleted findings.
+// Archived findings can not be changed, and are refused with a 409 API Error.
+func (logic ApplicationLogic) getFinding(ctx context.Context, identifier string, organizationID int) (intermediaries.Finding, error) {
+	finding, err := logic.persistence.GetFinding(ctx, identifier, organizationID)
+	if errors.Is(err, database.ErrNotFound) {
+		if _, archivedErr := logic.persistence.GetArchivedFinding(ctx, identifier, organizationID); archivedErr == nil {
+			return intermediaries.Finding{}, apierror.APIError{Code: http.StatusConflict, WrappedError: fmt.Errorf("finding %s is archived", identifier)}
+		}
 	}
-	if finding.ReportLocator.Value == "" {
-		return intermediaries.Finding{}, errors.New("must set report locator value")
+	if err == nil && finding.Deleted() {
+		return intermediaries.Finding{}, database.ErrNotFound
 	}
+	return finding, err
+}
+
+// ReadFinding reads a finding of the organization, which may be archived
+func (logic ApplicationLogic) ReadFinding(ctx context.Context, identifier string, organizationID int) (intermediaries.Finding, error) {
+	finding, err := logic.persistence.GetFinding(ctx, identifier, organizationID)
+	if errors.Is(err, database.ErrNotFound) {
+		finding, err = logic.persistence.GetArchivedFinding(ctx, identifier, organizationID)
+	}
+	if err == nil && finding.Deleted() {
+		return intermediaries.Finding{}, notFoundAsAPIError(database.ErrNotFound)
+	}
+	return finding, notFoundAsAPIError(err)
+}
+
+func (logic ApplicationLogic) ReadFindings(ctx context.Context, organizationID int, filter intermediaries.FindingFilter) ([]intermediaries.Finding, error) {
+	findings, err := logic.findingCandidates(ctx, organizationID, filter)
+	if err != nil {
+		return nil, err
+	}
+	if filter.IncludeArchived {
+		archived, err := logic.persistence.GetArchivedFindings(ctx, organizationID)
+		if err != nil {
+			return nil, err
+		}
+		findings = append(findings, archived...)
+	}
+	filtered := []intermediaries.Finding{}
+	for index := range findings {
+		if filter.Matches(findings[index]) {
+			filtered = append(filtered, findings[index])
+		}
+	}
+	return filtered, nil
+}
+
+// findingCandidates are the active findings that may match the filter, in the order they were created.
+// A locator pattern only matches locators of its own type, so patterns narrow the findings down to those
+// reported on, or implying, a locator of the types of the patterns.
+func (logic ApplicationLogic) findingCandidates(ctx context.Context, organizationID int, filter intermediaries.FindingFilter) ([]intermediaries.Finding, error) {
+	if len(filter.LocatorPatterns) == 0 {
+		return logic.persistence.GetFindings(ctx, organizationID)
+	}
+	looked := map[intermediaries.ReportLocatorType]bool{}
+	seen := map[string]bool{}
+	findings := []intermediaries.Finding{}
+	for _, pattern := range filter.LocatorPatterns {
+		if looked[pattern.Type] {
+			continue
+		}
+		looked[pattern.Type] = true
+		ofType, err := logic.persistence.GetFindingsByLocatorType(ctx, pattern.Type, organizationID)
+		if err != nil {
+			return nil, err
+		}
+		for _, finding := range ofType {
+			if !seen[finding.Identifier] {
+				seen[finding.Identifier] = true
+				findings = append(findings, finding)
+			}
+		}
+	}
+	sort.Slice(findings, func(i, j int) bool { return findings[i].Identifier < findings[j].Identifier })
+	return findings, nil
+}
+
+func (logic ApplicationLogic) ReadLocatorTypes(ctx context.Context) []intermediaries.LocatorType {
+	return intermediaries.LocatorTypes()
+}
+
+// locateFinding resolves the report locator of a finding to the locator it is stored under, an alias of a
+// distinguisher resolved to the distinguisher it is an alias of and the locator value canonicalized, and derives
+// the implied locators and owner of the finding from it
+func (logic ApplicationLogic) locateFinding(ctx context.Context, finding intermediaries.Finding, organizationID int) (intermediaries.Finding, error) {
 	if finding.ReportLocator.Distinguisher == "" {
 		// If the locator is not set, we default to "global", indicating
 		// it has no locality.
 		finding.ReportLocator.Distinguisher = intermediaries.GlobalDistinguisher
 	}
+	distinguisher, err := logic.resolveDistinguisher(ctx, finding.ReportLocator.Distinguisher, organizationID)
+	if err != nil {
+		return intermediaries.Finding{}, err
+	}
+	finding.ReportLocator.Distinguisher = distinguisher
+	finding.ReportLocator = finding.ReportLocator.Canonical()
 	implied, err := finding.ReportLocator.Implied()
 	if err != nil {
 		return intermediaries.Finding{}, err
 	}
 	finding.ImpliedReportLocators = implied
-	resFinding, err := logic.persistence.UpdateFinding(ctx, finding, organizationID)
+	rules, err := logic.persistence.GetOwnershipRules(ctx, organizationID)
 	if err != nil {
-		return resFinding, err
-	}
-	logic.findingUpdates <- event.FindingUpdate{
-		ID:             resFinding.Identifier,
-		OrganizationId: resFinding.OrganizationId,
-		ReportLocator: event.ReportLocator{
-			Type:          string(resFinding.ReportLocator.Type),
-			Value:         resFinding.ReportLocator.Value,
-			Distinguisher: resFinding.ReportLocator.Distinguisher,
-		},
-	}
-	return resFinding, err
+		return intermediaries.Finding{}, err
+	}
+	finding.Owner = intermediaries.ResolveOwner(rules, finding)
+	return finding, nil
+}
+
+// PostFinding creates the finding, or updates the finding reported on the same report distinguisher and locator.
+// The precondition is checked against the finding that is updated, and a finding that is created does not exist.
+func (logic ApplicationLogic) PostFinding(ctx context.Context, finding intermediaries.Finding, precondition intermediaries.VersionPrecondition, organizationID int) (intermediaries.Finding, error) {
+	finding.Identifier = "" // Do not allow identifier to be set
+	if finding.ReportDistinguisher.Type == "" {
+		return intermediaries.Finding{}, apierror.APIError{Code: http.StatusBadRequest, WrappedError: errors.New("must set report distingusher type")}
+	}
+	if finding.ReportDistinguisher.Value == "" {
+		return intermediaries.Finding{}, apierror.APIError{Code: http.StatusBadRequest, WrappedError: errors.New("must set report distingusher value")}
+	}
+	if finding.ReportLocator.Type == "" {
+		return intermediaries.Finding{}, apierror.APIError{Code: http.StatusBadRequest, WrappedError: errors.New("must set report locator type")}
+	}
+	if finding.ReportLocator.Value == "" {
+		return intermediaries.Finding{}, apierror.APIError{Code: http.StatusBadRequest, WrappedError: errors.New("must set report locator value")}
+	}
+	if err := finding.Severity.Validate(); err != nil {
+		return intermediaries.Finding{}, err
+	}
+	finding, err := logic.locateFinding(ctx, finding, organizationID)
+	if err != nil {
+		return intermediaries.Finding{}, err
+	}
+	change, err := logic.storeFindingChange(ctx, func(ctx context.Context) (findingChange, error) {
+		existing, err := logic.persistence.GetFindingByReport(ctx, finding.ReportDistinguisher, finding.ReportLocator, organizationID)
+		var archived *intermediaries.Finding
+		if errors.Is(err, database.ErrNotFound) {
+			// An archived finding that is reported again is restored, and then updated like any other finding
+			var found intermediaries.Finding
+			found, err = logic.persistence.GetArchivedFindingByReport(ctx, finding.ReportDistinguisher, finding.ReportLocator, organizationID)
+			if err == nil {
+				archived = &found
+				existing, err = logic.persistence.RestoreArchivedFinding(ctx, found.Identifier, organizationID)
+			}
+		}
+		if errors.Is(err, database.ErrNotFound) || (err == nil && existing.Deleted()) {
+			if precondition.Expects() {
+				return findingChange{}, database.ErrVersionMismatch
+			}
+			// A deleted finding that is reported again is created anew, only keeping its identifier
+			finding.Status = intermediaries.StatusOpen
+			finding.CreatedAt = now()
+			finding.UpdatedAt = finding.CreatedAt
+			created, err := logic.persistence.UpdateFinding(ctx, finding, 0, organizationID)
+			return findingChange{after: &created}, err
+		}
+		if err != nil {
+			return findingChange{}, err
+		}
+		if !precondition.Matches(existing.Version) {
+			return findingChange{}, database.ErrVersionMismatch
+		}
+		finding.Status = existing.Status
+		if existing.Status == intermediaries.StatusResolved {
+			// A resolved finding that is reported again has reappeared
+			finding.Status = intermediaries.StatusOpen
+		}
+		finding.CreatedAt = existing.CreatedAt
+		finding.UpdatedAt = existing.UpdatedAt
+		before := &existing
+		if archived != nil {
+			before = archived
+		}
+		if !findingChanged(existing, finding) {
+			// Nothing to store, and nothing to tell anyone about
+			return findingChange{before: before, after: &existing}, nil
+		}
+		finding.UpdatedAt = now()
+		// The finding is only replaced if it is still at the version it was read at, unless no version is expected
+		updated, err := logic.persistence.UpdateFinding(ctx, finding, precondition.ExpectedVersion(existing.Version), organizationID)
+		return findingChange{before: before, after: &updated}, err
+	})
+	if err != nil {
+		return intermediaries.Finding{}, versionMismatchAsAPIError(err)
+	}
+	return *change.after, nil
+}
+
+// UpdateFindingStatus sets the status of a finding, like when it has been resolved or its risk accepted.
+// The finding is only changed if it passes the precondition.
+func (logic ApplicationLogic) UpdateFindingStatus(ctx context.Context, identifier string, status intermediaries.FindingStatus, precondition intermediaries.VersionPrecondition, organizationID int) (intermediaries.Finding, error) {
+	if err := status.Validate(); err != nil {
+		return intermediaries.Finding{}, err
+	}
+	change, err := logic.storeFindingChange(ctx, func(ctx context.Context) (findingChange, error) {
+		existing, err := logic.getFinding(ctx, identifier, organizationID)
+		if err != nil {
+			return findingChange{}, err
+		}
+		if !precondition.Matches(existing.Version) {
+			return findingChange{}, database.ErrVersionMismatch
+		}
+		if existing.Status == status {
+			return findingChange{before: &existing, after: &existing}, nil
+		}
+		// The persistence checks the version again, in case the finding changed since it was read
+		updated, err := logic.persistence.UpdateFindingStatus(ctx, identifier, status, precondition.ExpectedVersion(existing.Version), organizationID)
+		return findingChange{before: &existing, after: &updated}, err
+	})
+	if err != nil {
+		return intermediaries.Finding{}, versionMismatchAsAPIError(err)
+	}
+	return *change.after, nil
 }
@@ -0,0 +1,248 @@
+package application_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Kaese72/finding-registry/event"
+	"github.com/Kaese72/finding-registry/internal/application"
+	"github.com/Kaese72/finding-registry/internal/database"
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
+	"github.com/Kaese72/riskie-lib/apierror"
+)
+
+// newApplication creates the application on an in-memory persistence, relaying its events to the returned channel
+func newApplication(t *testing.T) (application.ApplicationLogic, <-chan event.Event) {
+	return newApplicationOn(t, database.NewMemoryFindingsPersistence())
+}
+
+// newApplicationOn creates the application on the persistence, relaying its events to the returned channel
+func newApplicationOn(t *testing.T, persistence database.Persistence) (application.ApplicationLogic, <-chan event.Event) {
+	publisher := event.NewMemoryPublisher(event.MemoryConfig{})
+	events, unsubscribe := publisher.Subscribe()
+	logic := application.NewApplicationLogic(persistence, publisher)
+	ctx, cancel := context.WithCancel(context.Background())
+	go logic.RunOutboxRelay(ctx, 10*time.Millisecond)
+	t.Cleanup(func() {
+		cancel()
+		unsubscribe()
+		publisher.Close()
+	})
+	return logic, events
+}
+
+// expectEvents waits for the events of the given types to be published, in order
+func expectEvents(t *testing.T, events <-chan event.Event, expected ...event.EventType) {
+	t.Helper()
+	for _, eventType := range expected {
+		select {
+		case published := <-events:
+			if published.EventHeader().Type != eventType {
+				t.Fatalf("expected event %s, got %s", eventType, published.EventHeader().Type)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expected event %s, got none", eventType)
+		}
+	}
+	select {
+	case published := <-events:
+		t.Fatalf("expected no more events, got %s", published.EventHeader().Type)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func expectAPIErrorCode(t *testing.T, code int, err error) {
+	t.Helper()
+	apiError := apierror.APIError{}
+	if !errors.As(err, &apiError) {
+		t.Fatalf("expected an API error with code %d, got %v", code, err)
+	}
+	if apiError.Code != code {
+		t.Errorf("expected code %d, got %d", code, apiError.Code)
+	}
+}
+
+func newFinding() intermediaries.Finding {
+	return intermediaries.Finding{
+		Name:                "Open SSH",
+		ReportDistinguisher: intermediaries.ReportDistinguisher{Type: "scanner", Value: "nmap"},
+		ReportLocator:       intermediaries.ReportLocator{Type: intermediaries.TCP, Value: "10.0.0.1:22", Distinguisher: "dc1"},
+		Severity:            intermediaries.SeverityMedium,
+	}
+}
+
+func TestPostFinding(t *testing.T) {
+	ctx := context.Background()
+	logic, events := newApplication(t)
+
+	created, err := logic.PostFinding(ctx, newFinding(), intermediaries.VersionPrecondition{}, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if created.Identifier == "" || created.Status != intermediaries.StatusOpen || created.OrganizationId != 1 {
+		t.Errorf("expected an open finding of organization 1, got %+v", created)
+	}
+	if len(created.ImpliedReportLocators) == 0 {
+		t.Error("expected implied report locators to be calculated")
+	}
+	expectEvents(t, events, event.FindingCreatedType)
+
+	// Reporting the same finding again changes nothing
+	reported, err := logic.PostFinding(ctx, newFinding(), intermediaries.VersionPrecondition{}, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if reported.Identifier != created.Identifier || !reported.UpdatedAt.Equal(created.UpdatedAt) {
+		t.Errorf("expected the finding to be unchanged, got %+v", reported)
+	}
+	expectEvents(t, events)
+
+	changed := newFinding()
+	changed.Severity = intermediaries.SeverityCritical
+	reported, err = logic.PostFinding(ctx, changed, intermediaries.VersionPrecondition{}, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if reported.Identifier != created.Identifier || reported.Severity != intermediaries.SeverityCritical {
+		t.Errorf("expected the severity of the finding to change, got %+v", reported)
+	}
+	expectEvents(t, events, event.FindingUpdatedType)
+
+	// A resolved finding that is reported again is opened again
+	if _, err := logic.UpdateFindingStatus(ctx, created.Identifier, intermediaries.StatusResolved, intermediaries.VersionPrecondition{}, 1); err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEvents(t, events, event.FindingStatusChangedType)
+	reported, err = logic.PostFinding(ctx, changed, intermediaries.VersionPrecondition{}, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if reported.Status != intermediaries.StatusOpen {
+		t.Errorf("expected the finding to be opened again, got %s", reported.Status)
+	}
+	expectEvents(t, events, event.FindingStatusChangedType)
+}
+
+// concurrentChangePersistence changes every finding it reads by report, as if it was changed concurrently
+// between being read and being written
+type concurrentChangePersistence struct {
+	database.Persistence
+}
+
+func (persistence concurrentChangePersistence) GetFindingByReport(ctx context.Context, distinguisher intermediaries.ReportDistinguisher, locator intermediaries.ReportLocator, organizationID int) (intermediaries.Finding, error) {
+	finding, err := persistence.Persistence.GetFindingByReport(ctx, distinguisher, locator, organizationID)
+	if err != nil {
+		return finding, err
+	}
+	_, err = persistence.Persistence.UpdateFindingOwner(ctx, finding.Identifier, intermediaries.Owner{Team: "concurrent"}, organizationID)
+	return finding, err
+}
+
+func TestPostFindingConcurrentChange(t *testing.T) {
+	ctx := context.Background()
+	persistence := database.NewMemoryFindingsPersistence()
+	logic, events := newApplicationOn(t, persistence)
+	created, err := logic.PostFinding(ctx, newFinding(), intermediaries.VersionPrecondition{}, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEvents(t, events, event.FindingCreatedType)
+
+	// The finding is changed after the precondition is checked, which the version checked when it is written catches
+	racing, events := newApplicationOn(t, concurrentChangePersistence{Persistence: persistence})
+	changed := newFinding()
+	changed.Severity = intermediaries.SeverityCritical
+	_, err = racing.PostFinding(ctx, changed, intermediaries.ExpectVersion(created.Version), 1)
+	expectAPIErrorCode(t, http.StatusPreconditionFailed, err)
+	expectEvents(t, events)
+	findings, err := logic.ReadFindings(ctx, 1, intermediaries.FindingFilter{})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(findings) != 1 || findings[0].Severity != intermediaries.SeverityMedium {
+		t.Errorf("expected the finding to be left as it was, got %+v", findings)
+	}
+}
+
+func TestPostFindingInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(*intermediaries.Finding)
+	}{
+		{"MissingDistinguisherType", func(finding *intermediaries.Finding) { finding.ReportDistinguisher.Type = "" }},
+		{"MissingDistinguisherValue", func(finding *intermediaries.Finding) { finding.ReportDistinguisher.Value = "" }},
+		{"MissingLocatorType", func(finding *intermediaries.Finding) { finding.ReportLocator.Type = "" }},
+		{"MissingLocatorValue", func(finding *intermediaries.Finding) { finding.ReportLocator.Value = "" }},
+		{"InvalidSeverity", func(finding *intermediaries.Finding) { finding.Severity = "urgent" }},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logic, events := newApplication(t)
+			finding := newFinding()
+			test.change(&finding)
+			_, err := logic.PostFinding(context.Background(), finding, intermediaries.VersionPrecondition{}, 1)
+			expectAPIErrorCode(t, http.StatusBadRequest, err)
+			expectEvents(t, events)
+		})
+	}
+}
+
+func TestFindingsScopedByOrganization(t *testing.T) {
+	ctx := context.Background()
+	logic, _ := newApplication(t)
+	created, err := logic.PostFinding(ctx, newFinding(), intermediaries.VersionPrecondition{}, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	_, err = logic.ReadFinding(ctx, created.Identifier, 2)
+	expectAPIErrorCode(t, http.StatusNotFound, err)
+	_, err = logic.UpdateFindingStatus(ctx, created.Identifier, intermediaries.StatusResolved, intermediaries.VersionPrecondition{}, 2)
+	expectAPIErrorCode(t, http.StatusNotFound, err)
+	findings, err := logic.ReadFindings(ctx, 2, intermediaries.FindingFilter{})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(findings) != 0 {
+		t.Errorf("expected no findings of organization 2, got %d", len(findings))
+	}
+
+	// Reporting the same finding in organization 2 leaves the finding of organization 1 alone
+	reported, err := logic.PostFinding(ctx, newFinding(), intermediaries.VersionPrecondition{}, 2)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if reported.Identifier == created.Identifier || reported.OrganizationId != 2 {
+		t.Errorf("expected a finding of organization 2 of its own, got %+v", reported)
+	}
+
+	findings, err = logic.ReadFindings(ctx, 1, intermediaries.FindingFilter{})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(findings) != 1 || findings[0].Identifier != created.Identifier || findings[0].OrganizationId != 1 {
+		t.Errorf("expected the finding of organization 1, got %+v", findings)
+	}
+}
+
+func TestHealthChecks(t *testing.T) {
+	ctx := context.Background()
+	logic, _ := newApplication(t)
+	if err := logic.Health(ctx); err != nil {
+		t.Fatal(err.Error())
+	}
+	healthy := logic.WithHealthCheck(func() error { return nil })
+	if err := healthy.Health(ctx); err != nil {
+		t.Errorf("expected passing checks to be healthy, got %v", err)
+	}
+	if err := healthy.WithHealthCheck(func() error { return errors.New("unreachable") }).Health(ctx); err == nil {
+		t.Error("expected a failing check to be unhealthy")
+	}
+	// Adding a check does not change the application it was added to
+	if err := healthy.Health(ctx); err != nil {
+		t.Errorf("expected the application without the failing check to be healthy, got %v", err)
+	}
+}
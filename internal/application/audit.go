@@ -0,0 +1,168 @@
+package application
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
+	"github.com/Kaese72/organization-registry/authentication"
+	"github.com/Kaese72/riskie-lib/apierror"
+)
+
+// auditActorKey holds the actor of the context, as set by WithAuditActor
+type auditActorKey struct{}
+
+// WithAuditActor sets who is making changes through the context, and from where, for the audit log
+func WithAuditActor(ctx context.Context, actor intermediaries.AuditActor) context.Context {
+	return context.WithValue(ctx, auditActorKey{}, actor)
+}
+
+// auditActor is who is making changes through the context. The user is taken from the authenticated token
+// of the context unless set, so that changes of queued submissions are attributed as well.
+func auditActor(ctx context.Context) intermediaries.AuditActor {
+	actor, _ := ctx.Value(auditActorKey{}).(intermediaries.AuditActor)
+	if userID, ok := ctx.Value(authentication.UserIDKey).(float64); ok && actor.UserId == 0 {
+		actor.UserId = int(userID)
+	}
+	return actor
+}
+
+// auditField is a field of a finding as recorded in the audit log
+type auditField struct {
+	name  string
+	value interface{}
+}
+
+// auditFields are the fields of a finding recorded in the audit log. The event representation is used,
+// since that is what is published about findings.
+func auditFields(finding intermediaries.Finding) []auditField {
+	eventFinding := eventFindingFromIntermediary(finding)
+	return []auditField{
+		{"name", eventFinding.Name},
+		{"reportDistinguisher", eventFinding.ReportDistinguisher},
+		{"reportLocator", eventFinding.ReportLocator},
+		{"impliedReportLocators", eventFinding.ImpliedReportLocators},
+		{"owner", eventFinding.Owner},
+		{"severity", eventFinding.Severity},
+		{"status", eventFinding.Status},
+		{"deletedAt", finding.DeletedAt},
+		{"deletedBy", finding.DeletedBy},
+	}
+}
+
+// encodeAuditFields encodes the fields of a finding by name, or nothing if there is no finding
+func encodeAuditFields(finding *intermediaries.Finding) (map[string]string, error) {
+	encoded := map[string]string{}
+	if finding == nil {
+		return encoded, nil
+	}
+	for _, field := range auditFields(*finding) {
+		value, err := json.Marshal(field.value)
+		if err != nil {
+			return nil, err
+		}
+		encoded[field.name] = string(value)
+	}
+	return encoded, nil
+}
+
+// auditChanges lists the fields that differ between two snapshots of a finding, JSON encoded.
+// Fields of a finding that does not exist before or after are left empty.
+func auditChanges(before *intermediaries.Finding, after *intermediaries.Finding) ([]intermediaries.AuditChange, error) {
+	beforeFields, err := encodeAuditFields(before)
+	if err != nil {
+		return nil, err
+	}
+	afterFields, err := encodeAuditFields(after)
+	if err != nil {
+		return nil, err
+	}
+	changes := []intermediaries.AuditChange{}
+	for _, field := range auditFields(intermediaries.Finding{}) {
+		if beforeFields[field.name] != afterFields[field.name] {
+			changes = append(changes, intermediaries.AuditChange{Field: field.name, Before: beforeFields[field.name], After: afterFields[field.name]})
+		}
+	}
+	return changes, nil
+}
+
+// auditAction tells what kind of change the changes to a finding were, and false if nothing changed
+func auditAction(change findingChange, changes []intermediaries.AuditChange) (intermediaries.AuditAction, bool) {
+	switch {
+	case change.before == nil && change.after == nil:
+		return "", false
+	case change.imported:
+		// An import is recorded as a single entry, unless the finding already matched the export
+		return intermediaries.AuditImported, change.before != change.after
+	case change.before == nil:
+		return intermediaries.AuditCreated, true
+	case change.after == nil:
+		return intermediaries.AuditPurged, true
+	case change.after.Deleted() && !change.before.Deleted():
+		return intermediaries.AuditDeleted, true
+	case change.after.Archived() && !change.before.Archived():
+		return intermediaries.AuditArchived, true
+	case change.before.Archived() && !change.after.Archived():
+		return intermediaries.AuditRestored, true
+	case len(changes) == 0:
+		return "", false
+	case len(changes) == 1 && changes[0].Field == "status":
+		return intermediaries.AuditStatusChanged, true
+	}
+	return intermediaries.AuditUpdated, true
+}
+
+// auditFindingChange appends the change to the audit log of the organization of the finding, attributed to
+// the actor of the context. Changes that change nothing are not recorded.
+func (logic ApplicationLogic) auditFindingChange(ctx context.Context, change findingChange) error {
+	changes, err := auditChanges(change.before, change.after)
+	if err != nil {
+		return err
+	}
+	action, changed := auditAction(change, changes)
+	if !changed {
+		return nil
+	}
+	finding := change.after
+	if finding == nil {
+		finding = change.before
+	}
+	_, err = logic.persistence.AppendAuditEntry(ctx, intermediaries.AuditEntry{
+		FindingIdentifier: finding.Identifier,
+		Action:            action,
+		Actor:             auditActor(ctx),
+		Changes:           changes,
+		CreatedAt:         now(),
+	}, finding.OrganizationId)
+	return err
+}
+
+// ReadFindingAudit returns a page of the audit log of a finding, oldest first, starting after the entry with the
+// sequence, or at the first entry when it is 0. The log is kept after the finding is deleted for good.
+func (logic ApplicationLogic) ReadFindingAudit(ctx context.Context, identifier string, organizationID int, after int, limit int) ([]intermediaries.AuditEntry, error) {
+	entries, err := logic.ReadAuditEntries(ctx, organizationID, intermediaries.AuditFilter{FindingIdentifier: identifier}, after, limit)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 && after == 0 {
+		return nil, apierror.APIError{Code: http.StatusNotFound, WrappedError: fmt.Errorf("no audit entries of finding %s", identifier)}
+	}
+	return entries, nil
+}
+
+// ReadAuditEntries searches a page of the audit log of the organization, oldest first, starting after the entry
+// with the sequence, or at the first entry when it is 0
+func (logic ApplicationLogic) ReadAuditEntries(ctx context.Context, organizationID int, filter intermediaries.AuditFilter, after int, limit int) ([]intermediaries.AuditEntry, error) {
+	return logic.persistence.GetAuditEntriesAfter(ctx, filter, after, limit, organizationID)
+}
+
+// VerifyAudit checks that no entry of the audit log of the organization has been changed or removed
+func (logic ApplicationLogic) VerifyAudit(ctx context.Context, organizationID int) (intermediaries.AuditVerification, error) {
+	entries, err := logic.persistence.GetAuditEntries(ctx, organizationID)
+	if err != nil {
+		return intermediaries.AuditVerification{}, err
+	}
+	return intermediaries.VerifyAuditChain(entries), nil
+}
@@ -0,0 +1,101 @@
+package application_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Kaese72/finding-registry/internal/application"
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
+	"github.com/Kaese72/organization-registry/authentication"
+)
+
+func TestAuditLog(t *testing.T) {
+	logic, _ := newApplication(t)
+	ctx := application.WithAuditActor(context.Background(), intermediaries.AuditActor{UserId: 7, RequestId: "request", SourceIP: "192.0.2.1"})
+
+	created, err := logic.PostFinding(ctx, newFinding(), intermediaries.VersionPrecondition{}, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	// Reporting the same finding again changes nothing, and is not recorded
+	if _, err := logic.PostFinding(ctx, newFinding(), intermediaries.VersionPrecondition{}, 1); err != nil {
+		t.Fatal(err.Error())
+	}
+	// The user of the token is used when the actor has no user
+	tokenCtx := context.WithValue(context.Background(), authentication.UserIDKey, float64(8))
+	if _, err := logic.UpdateFindingStatus(tokenCtx, created.Identifier, intermediaries.StatusResolved, intermediaries.VersionPrecondition{}, 1); err != nil {
+		t.Fatal(err.Error())
+	}
+	updated := newFinding()
+	updated.Severity = intermediaries.SeverityHigh
+	if _, err := logic.PostFinding(ctx, updated, intermediaries.VersionPrecondition{}, 1); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := logic.DeleteFinding(ctx, created.Identifier, 7, intermediaries.VersionPrecondition{}, 1); err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := logic.PurgeFindings(context.Background(), time.Time{}, 1); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	entries, err := logic.ReadFindingAudit(ctx, created.Identifier, 1, 0, 100)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expected := []struct {
+		action intermediaries.AuditAction
+		userID int
+		fields []string
+	}{
+		{intermediaries.AuditCreated, 7, []string{"name", "reportDistinguisher", "reportLocator", "impliedReportLocators", "owner", "severity", "status", "deletedAt", "deletedBy"}},
+		{intermediaries.AuditStatusChanged, 8, []string{"status"}},
+		// Reporting a resolved finding again opens it
+		{intermediaries.AuditUpdated, 7, []string{"severity", "status"}},
+		{intermediaries.AuditDeleted, 7, []string{"deletedAt", "deletedBy"}},
+		{intermediaries.AuditPurged, 0, []string{"name", "reportDistinguisher", "reportLocator", "impliedReportLocators", "owner", "severity", "status", "deletedAt", "deletedBy"}},
+	}
+	if len(entries) != len(expected) {
+		t.Fatalf("expected %d entries, got %+v", len(expected), entries)
+	}
+	for index, entry := range entries {
+		if entry.Sequence != index+1 || entry.Action != expected[index].action || entry.Actor.UserId != expected[index].userID {
+			t.Errorf("expected entry %d to be %s by %d, got %+v", index+1, expected[index].action, expected[index].userID, entry)
+		}
+		fields := []string{}
+		for _, change := range entry.Changes {
+			fields = append(fields, change.Field)
+		}
+		if strings.Join(fields, ",") != strings.Join(expected[index].fields, ",") {
+			t.Errorf("expected entry %d to change %v, got %v", index+1, expected[index].fields, fields)
+		}
+	}
+	if entries[0].Actor.RequestId != "request" || entries[0].Actor.SourceIP != "192.0.2.1" {
+		t.Errorf("expected the actor of the context, got %+v", entries[0].Actor)
+	}
+	if entries[1].Changes[0].Before != `"open"` || entries[1].Changes[0].After != `"resolved"` {
+		t.Errorf("expected the status to change from open to resolved, got %+v", entries[1].Changes[0])
+	}
+	if entries[4].Changes[0].After != "" {
+		t.Errorf("expected nothing after the finding was purged, got %+v", entries[4].Changes[0])
+	}
+
+	verification, err := logic.VerifyAudit(ctx, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !verification.Valid() || verification.Entries != 5 {
+		t.Errorf("expected a valid chain of 5 entries, got %+v", verification)
+	}
+	entries, err = logic.ReadAuditEntries(ctx, 1, intermediaries.AuditFilter{UserId: 8}, 0, 100)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(entries) != 1 || entries[0].Action != intermediaries.AuditStatusChanged {
+		t.Errorf("expected the status change of user 8, got %+v", entries)
+	}
+	_, err = logic.ReadFindingAudit(ctx, created.Identifier, 2, 0, 100)
+	expectAPIErrorCode(t, http.StatusNotFound, err)
+}
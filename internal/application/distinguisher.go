@@ -0,0 +1,328 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Kaese72/finding-registry/internal/database"
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
+	"github.com/Kaese72/riskie-lib/apierror"
+	"github.com/Kaese72/riskie-lib/logging"
+)
+
+func (logic ApplicationLogic) ReadDistinguisherAliases(ctx context.Context, organizationID int) ([]intermediaries.DistinguisherAlias, error) {
+	return logic.persistence.GetDistinguisherAliases(ctx, organizationID)
+}
+
+// PutDistinguisherAlias creates or replaces an alias. Aliases only apply to findings reported after they are set,
+// use MergeDistinguishers to also move existing findings.
+func (logic ApplicationLogic) PutDistinguisherAlias(ctx context.Context, alias intermediaries.DistinguisherAlias, organizationID int) (intermediaries.DistinguisherAlias, error) {
+	if err := alias.Validate(); err != nil {
+		return intermediaries.DistinguisherAlias{}, err
+	}
+	// Aliases are resolved a single step, so chains of aliases are not allowed
+	aliases, err := logic.persistence.GetDistinguisherAliases(ctx, organizationID)
+	if err != nil {
+		return intermediaries.DistinguisherAlias{}, err
+	}
+	for _, existing := range aliases {
+		if existing.Alias == alias.Distinguisher {
+			return intermediaries.DistinguisherAlias{}, apierror.APIError{Code: http.StatusUnprocessableEntity, WrappedError: fmt.Errorf("%s is itself an alias of %s", alias.Distinguisher, existing.Distinguisher)}
+		}
+		if existing.Distinguisher == alias.Alias {
+			return intermediaries.DistinguisherAlias{}, apierror.APIError{Code: http.StatusUnprocessableEntity, WrappedError: fmt.Errorf("%s is the target of alias %s", alias.Alias, existing.Alias)}
+		}
+	}
+	return logic.persistence.SetDistinguisherAlias(ctx, alias, organizationID)
+}
+
+func (logic ApplicationLogic) DeleteDistinguisherAlias(ctx context.Context, alias string, organizationID int) error {
+	return notFoundAsAPIError(logic.persistence.DeleteDistinguisherAlias(ctx, alias, organizationID))
+}
+
+// resolveDistinguisher returns the canonical distinguisher for a possibly aliased distinguisher
+func (logic ApplicationLogic) resolveDistinguisher(ctx context.Context, distinguisher string, organizationID int) (string, error) {
+	alias, err := logic.persistence.GetDistinguisherAlias(ctx, distinguisher, organizationID)
+	if errors.Is(err, database.ErrNotFound) {
+		return distinguisher, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return alias.Distinguisher, nil
+}
+
+// mergeBatchSize is the number of findings changed in a single transaction when merging distinguishers, which
+// keeps the transactions of a merge of any size within the limits of the database
+const mergeBatchSize = 100
+
+// mergeStep is a change to a single finding planned by a merge of distinguishers
+type mergeStep struct {
+	apply        func(context.Context) error
+	rekeyed      bool
+	deduplicated bool
+}
+
+// MergeDistinguishers moves every finding of the organization reported on the from distinguisher to the into distinguisher.
+// When the same finding already exists on the into distinguisher, the finding on the from distinguisher is removed,
+// and its status is carried over if the finding on the into distinguisher is still open, so that triage is not lost.
+// Owners follow the ownership rules, so the kept finding has the owner the rules give it on the into distinguisher.
+// Archived findings are moved within the archive, and removed when the same finding exists on the into distinguisher.
+// from is then made an alias of into, so that future findings are merged as well.
+// Findings are changed in transactions of mergeBatchSize findings, and from is only made an alias once every finding
+// has been moved. A merge that fails part way keeps the batches that were applied, and merging again finishes it.
+func (logic ApplicationLogic) MergeDistinguishers(ctx context.Context, from string, into string, organizationID int) (intermediaries.DistinguisherMerge, error) {
+	result := intermediaries.DistinguisherMerge{From: from, Into: into}
+	if err := (intermediaries.DistinguisherAlias{Alias: from, Distinguisher: into}).Validate(); err != nil {
+		return result, err
+	}
+	into, err := logic.resolveDistinguisher(ctx, into, organizationID)
+	if err != nil {
+		return result, err
+	}
+	if into == from {
+		return result, apierror.APIError{Code: http.StatusUnprocessableEntity, WrappedError: fmt.Errorf("%s is already an alias of %s", into, from)}
+	}
+	result.Into = into
+	steps, err := logic.planDistinguisherMerge(ctx, from, into, organizationID)
+	if err != nil {
+		return result, err
+	}
+	for start := 0; start < len(steps); start += mergeBatchSize {
+		batch := steps[start:min(start+mergeBatchSize, len(steps))]
+		err := logic.persistence.WithTransaction(ctx, func(ctx context.Context) error {
+			for _, step := range batch {
+				if err := step.apply(ctx); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return result, err
+		}
+		for _, step := range batch {
+			if step.rekeyed {
+				result.Rekeyed++
+			}
+			if step.deduplicated {
+				result.Deduplicated++
+			}
+		}
+	}
+	err = logic.persistence.WithTransaction(ctx, func(ctx context.Context) error {
+		return logic.aliasMergedDistinguisher(ctx, from, into, organizationID)
+	})
+	return result, err
+}
+
+// planDistinguisherMerge plans the change of every finding merged from the from distinguisher into the into distinguisher
+func (logic ApplicationLogic) planDistinguisherMerge(ctx context.Context, from string, into string, organizationID int) ([]mergeStep, error) {
+	findings, err := logic.persistence.GetFindings(ctx, organizationID)
+	if err != nil {
+		return nil, err
+	}
+	archivedFindings, err := logic.persistence.GetArchivedFindings(ctx, organizationID)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := logic.persistence.GetOwnershipRules(ctx, organizationID)
+	if err != nil {
+		return nil, err
+	}
+	type findingKey struct {
+		distinguisher intermediaries.ReportDistinguisher
+		locator       intermediaries.ReportLocator
+	}
+	existing := map[findingKey]intermediaries.Finding{}
+	for _, finding := range findings {
+		existing[findingKey{finding.ReportDistinguisher, finding.ReportLocator}] = finding
+	}
+	existingArchived := map[findingKey]intermediaries.Finding{}
+	for _, finding := range archivedFindings {
+		existingArchived[findingKey{finding.ReportDistinguisher, finding.ReportLocator}] = finding
+	}
+	// Plan every change before applying any of them, so that a locator that is not valid on the
+	// into distinguisher (like a private IPv4 address on the global distinguisher) aborts the merge early
+	rekeyed := []intermediaries.Finding{}
+	// originals holds the rekeyed findings as they were before the merge
+	originals := []intermediaries.Finding{}
+	// duplicates are removed, and kept holds the finding on the into distinguisher each of them is merged into
+	duplicates := []intermediaries.Finding{}
+	kept := []intermediaries.Finding{}
+	// Deleted findings are purged rather than merged, so that they do not collide with the merged findings
+	purged := []intermediaries.Finding{}
+	// Archived findings are rekeyed in the archive, and purged when they could no longer be restored by a report
+	rekeyedArchived := []intermediaries.Finding{}
+	archivedOriginals := []intermediaries.Finding{}
+	purgedArchived := []intermediaries.Finding{}
+	archivedDuplicates := []intermediaries.Finding{}
+	for _, finding := range findings {
+		if finding.ReportLocator.Distinguisher != from {
+			continue
+		}
+		if finding.Deleted() {
+			purged = append(purged, finding)
+			continue
+		}
+		moved := finding
+		moved.ReportLocator.Distinguisher = into
+		if collision, collides := existing[findingKey{moved.ReportDistinguisher, moved.ReportLocator}]; collides {
+			if !collision.Deleted() {
+				duplicates = append(duplicates, finding)
+				kept = append(kept, collision)
+				continue
+			}
+			purged = append(purged, collision)
+		}
+		if collision, collides := existingArchived[findingKey{moved.ReportDistinguisher, moved.ReportLocator}]; collides {
+			// Reports match the moved finding before the archive, so the archived finding would never be restored
+			purgedArchived = append(purgedArchived, collision)
+		}
+		implied, err := moved.ReportLocator.Implied()
+		if err != nil {
+			return nil, err
+		}
+		moved.ImpliedReportLocators = implied
+		moved.Owner = intermediaries.ResolveOwner(rules, moved)
+		rekeyed = append(rekeyed, moved)
+		originals = append(originals, finding)
+		existing[findingKey{moved.ReportDistinguisher, moved.ReportLocator}] = moved
+	}
+	for _, finding := range archivedFindings {
+		if finding.ReportLocator.Distinguisher != from {
+			continue
+		}
+		moved := finding
+		moved.ReportLocator.Distinguisher = into
+		key := findingKey{moved.ReportDistinguisher, moved.ReportLocator}
+		if finding.Deleted() {
+			purgedArchived = append(purgedArchived, finding)
+			continue
+		}
+		collision, collides := existing[key]
+		if _, archivedCollides := existingArchived[key]; archivedCollides || (collides && !collision.Deleted()) {
+			// The same finding already exists on the into distinguisher, and is kept
+			archivedDuplicates = append(archivedDuplicates, finding)
+			continue
+		}
+		if collides {
+			purged = append(purged, collision)
+		}
+		implied, err := moved.ReportLocator.Implied()
+		if err != nil {
+			return nil, err
+		}
+		moved.ImpliedReportLocators = implied
+		moved.Owner = intermediaries.ResolveOwner(rules, moved)
+		rekeyedArchived = append(rekeyedArchived, moved)
+		archivedOriginals = append(archivedOriginals, finding)
+	}
+	steps := []mergeStep{}
+	for _, finding := range purged {
+		steps = append(steps, mergeStep{apply: func(ctx context.Context) error {
+			_, err := logic.storeFindingChange(ctx, func(ctx context.Context) (findingChange, error) {
+				return findingChange{before: &finding}, logic.persistence.DeleteFinding(ctx, finding.Identifier, organizationID)
+			})
+			return err
+		}})
+	}
+	for _, finding := range purgedArchived {
+		steps = append(steps, mergeStep{apply: func(ctx context.Context) error {
+			_, err := logic.storeFindingChange(ctx, func(ctx context.Context) (findingChange, error) {
+				return findingChange{before: &finding}, logic.persistence.DeleteArchivedFinding(ctx, finding.Identifier, organizationID)
+			})
+			return err
+		}})
+	}
+	for index, finding := range rekeyed {
+		before := originals[index]
+		steps = append(steps, mergeStep{rekeyed: true, apply: func(ctx context.Context) error {
+			_, err := logic.storeFindingChange(ctx, func(ctx context.Context) (findingChange, error) {
+				updated, err := logic.rekeyFinding(ctx, finding, organizationID)
+				return findingChange{before: &before, after: &updated}, err
+			})
+			return err
+		}})
+	}
+	for index, finding := range rekeyedArchived {
+		before := archivedOriginals[index]
+		steps = append(steps, mergeStep{rekeyed: true, apply: func(ctx context.Context) error {
+			_, err := logic.storeFindingChange(ctx, func(ctx context.Context) (findingChange, error) {
+				// Archived findings are rekeyed out of the archive, and archived again as they were
+				if _, err := logic.persistence.RestoreArchivedFinding(ctx, finding.Identifier, organizationID); err != nil {
+					return findingChange{}, err
+				}
+				updated, err := logic.rekeyFinding(ctx, finding, organizationID)
+				if err == nil {
+					updated, err = logic.persistence.ArchiveFinding(ctx, finding.Identifier, *before.ArchivedAt, organizationID)
+				}
+				return findingChange{before: &before, after: &updated}, err
+			})
+			return err
+		}})
+	}
+	for index, finding := range duplicates {
+		collision := kept[index]
+		steps = append(steps, mergeStep{deduplicated: true, apply: func(ctx context.Context) error {
+			if collision.Status == intermediaries.StatusOpen && finding.Status != intermediaries.StatusOpen {
+				_, err := logic.storeFindingChange(ctx, func(ctx context.Context) (findingChange, error) {
+					updated, err := logic.persistence.UpdateFindingStatus(ctx, collision.Identifier, finding.Status, 0, organizationID)
+					return findingChange{before: &collision, after: &updated}, err
+				})
+				if err != nil {
+					return err
+				}
+			}
+			_, err := logic.storeFindingChange(ctx, func(ctx context.Context) (findingChange, error) {
+				return findingChange{before: &finding}, logic.persistence.DeleteFinding(ctx, finding.Identifier, organizationID)
+			})
+			if err == nil {
+				logging.Info(ctx, "Removed duplicate finding when merging distinguishers", map[string]interface{}{"findingId": finding.Identifier, "into": collision.Identifier, "from": from})
+			}
+			return err
+		}})
+	}
+	for _, finding := range archivedDuplicates {
+		steps = append(steps, mergeStep{deduplicated: true, apply: func(ctx context.Context) error {
+			_, err := logic.storeFindingChange(ctx, func(ctx context.Context) (findingChange, error) {
+				return findingChange{before: &finding}, logic.persistence.DeleteArchivedFinding(ctx, finding.Identifier, organizationID)
+			})
+			if err == nil {
+				logging.Info(ctx, "Removed duplicate archived finding when merging distinguishers", map[string]interface{}{"findingId": finding.Identifier, "from": from})
+			}
+			return err
+		}})
+	}
+	return steps, nil
+}
+
+// aliasMergedDistinguisher makes from an alias of into once its findings have been merged
+func (logic ApplicationLogic) aliasMergedDistinguisher(ctx context.Context, from string, into string, organizationID int) error {
+	// Re-point aliases of the merged distinguisher, since aliases are not resolved in chains
+	aliases, err := logic.persistence.GetDistinguisherAliases(ctx, organizationID)
+	if err != nil {
+		return err
+	}
+	for _, alias := range aliases {
+		if alias.Distinguisher == from {
+			alias.Distinguisher = into
+			if _, err := logic.persistence.SetDistinguisherAlias(ctx, alias, organizationID); err != nil {
+				return err
+			}
+		}
+	}
+	_, err = logic.persistence.SetDistinguisherAlias(ctx, intermediaries.DistinguisherAlias{Alias: from, Distinguisher: into}, organizationID)
+	return err
+}
+
+// rekeyFinding moves the finding to the locators of the planned finding, and gives it the owner of the planned finding
+func (logic ApplicationLogic) rekeyFinding(ctx context.Context, planned intermediaries.Finding, organizationID int) (intermediaries.Finding, error) {
+	updated, err := logic.persistence.UpdateFindingLocators(ctx, planned.Identifier, planned.ReportLocator, planned.ImpliedReportLocators, organizationID)
+	if err == nil && updated.Owner != planned.Owner {
+		updated, err = logic.persistence.UpdateFindingOwner(ctx, planned.Identifier, planned.Owner, organizationID)
+	}
+	return updated, err
+}
@@ -0,0 +1,215 @@
+package application_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Kaese72/finding-registry/internal/application"
+	"github.com/Kaese72/finding-registry/internal/database"
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
+)
+
+// deleteFailingPersistence fails to delete findings for good
+type deleteFailingPersistence struct {
+	database.Persistence
+}
+
+func (persistence deleteFailingPersistence) DeleteFinding(ctx context.Context, identifier string, organizationID int) error {
+	return errors.New("failure")
+}
+
+// postFindingOn reports the finding with the locator value on the distinguisher
+func postFindingOn(t *testing.T, logic application.ApplicationLogic, value string, distinguisher string) intermediaries.Finding {
+	t.Helper()
+	finding := newFinding()
+	finding.ReportLocator.Value = value
+	finding.ReportLocator.Distinguisher = distinguisher
+	created, err := logic.PostFinding(context.Background(), finding, intermediaries.VersionPrecondition{}, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return created
+}
+
+func TestMergeDistinguishers(t *testing.T) {
+	ctx := context.Background()
+	persistence := database.NewMemoryFindingsPersistence()
+	logic, _ := newApplicationOn(t, persistence)
+	rekeyed := postFindingOn(t, logic, "10.0.0.1:22", "home")
+	duplicate := postFindingOn(t, logic, "10.0.0.2:22", "home")
+	if _, err := logic.UpdateFindingStatus(ctx, duplicate.Identifier, intermediaries.StatusAccepted, intermediaries.VersionPrecondition{}, 1); err != nil {
+		t.Fatal(err.Error())
+	}
+	kept := postFindingOn(t, logic, "10.0.0.2:22", "apartment")
+	tombstone := postFindingOn(t, logic, "10.0.0.3:22", "home")
+	if err := logic.DeleteFinding(ctx, tombstone.Identifier, 7, intermediaries.VersionPrecondition{}, 1); err != nil {
+		t.Fatal(err.Error())
+	}
+	archivedAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	archived := postFindingOn(t, logic, "10.0.0.4:22", "home")
+	archivedDuplicate := postFindingOn(t, logic, "10.0.0.5:22", "home")
+	postFindingOn(t, logic, "10.0.0.5:22", "apartment")
+	for _, finding := range []intermediaries.Finding{archived, archivedDuplicate} {
+		if _, err := persistence.ArchiveFinding(ctx, finding.Identifier, archivedAt, 1); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	if _, err := logic.PutDistinguisherAlias(ctx, intermediaries.DistinguisherAlias{Alias: "house", Distinguisher: "home"}, 1); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	result, err := logic.MergeDistinguishers(ctx, "home", "apartment", 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if result.Rekeyed != 2 || result.Deduplicated != 2 {
+		t.Errorf("expected two findings to be rekeyed and two deduplicated, got %+v", result)
+	}
+
+	found, err := logic.ReadFinding(ctx, rekeyed.Identifier, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if found.ReportLocator.Distinguisher != "apartment" || found.ImpliedReportLocators[0].Distinguisher != "apartment" {
+		t.Errorf("expected the finding to be moved to the into distinguisher, got %+v", found)
+	}
+	// The duplicate is removed, and its triage is carried over to the finding it was merged into
+	_, err = logic.ReadFinding(ctx, duplicate.Identifier, 1)
+	expectAPIErrorCode(t, http.StatusNotFound, err)
+	found, err = logic.ReadFinding(ctx, kept.Identifier, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if found.Status != intermediaries.StatusAccepted {
+		t.Errorf("expected the status of the duplicate to be carried over, got %s", found.Status)
+	}
+	// Archived findings are moved within the archive, unless the same finding exists on the into distinguisher
+	found, err = logic.ReadFinding(ctx, archived.Identifier, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if found.ReportLocator.Distinguisher != "apartment" || found.ArchivedAt == nil || !found.ArchivedAt.Equal(archivedAt) {
+		t.Errorf("expected the archived finding to be moved to the into distinguisher, got %+v", found)
+	}
+	_, err = logic.ReadFinding(ctx, archivedDuplicate.Identifier, 1)
+	expectAPIErrorCode(t, http.StatusNotFound, err)
+	// Tombstones on the from distinguisher are purged
+	deleted, err := logic.ReadFindings(ctx, 1, intermediaries.FindingFilter{Deleted: true})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(deleted) != 0 {
+		t.Errorf("expected the tombstone to be purged, got %+v", deleted)
+	}
+
+	aliases, err := logic.ReadDistinguisherAliases(ctx, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expected := map[string]string{"house": "apartment", "home": "apartment"}
+	if len(aliases) != len(expected) {
+		t.Errorf("expected aliases %v, got %+v", expected, aliases)
+	}
+	for _, alias := range aliases {
+		if expected[alias.Alias] != alias.Distinguisher {
+			t.Errorf("expected %s to be an alias of %s, got %s", alias.Alias, expected[alias.Alias], alias.Distinguisher)
+		}
+	}
+	// Findings reported on the merged distinguisher are merged as well
+	reported := postFindingOn(t, logic, "10.0.0.1:22", "home")
+	if reported.Identifier != rekeyed.Identifier {
+		t.Errorf("expected the report to update finding %s, got %s", rekeyed.Identifier, reported.Identifier)
+	}
+	restored := postFindingOn(t, logic, "10.0.0.4:22", "home")
+	if restored.Identifier != archived.Identifier || restored.Archived() {
+		t.Errorf("expected the report to restore archived finding %s, got %+v", archived.Identifier, restored)
+	}
+
+	_, err = logic.MergeDistinguishers(ctx, "apartment", "home", 1)
+	expectAPIErrorCode(t, http.StatusUnprocessableEntity, err)
+}
+
+func TestMergeDistinguishersRollsBack(t *testing.T) {
+	ctx := context.Background()
+	persistence := database.NewMemoryFindingsPersistence()
+	logic, _ := newApplicationOn(t, persistence)
+	rekeyed := postFindingOn(t, logic, "10.0.0.1:22", "home")
+	postFindingOn(t, logic, "10.0.0.2:22", "home")
+	postFindingOn(t, logic, "10.0.0.2:22", "apartment")
+
+	// Removing the duplicate fails after the other finding has been moved, which must be undone
+	failing, _ := newApplicationOn(t, deleteFailingPersistence{Persistence: persistence})
+	if _, err := failing.MergeDistinguishers(ctx, "home", "apartment", 1); err == nil {
+		t.Fatal("expected the merge to fail")
+	}
+	found, err := logic.ReadFinding(ctx, rekeyed.Identifier, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if found.ReportLocator.Distinguisher != "home" {
+		t.Errorf("expected the finding to be left on the from distinguisher, got %+v", found.ReportLocator)
+	}
+	aliases, err := logic.ReadDistinguisherAliases(ctx, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(aliases) != 0 {
+		t.Errorf("expected no alias to be set, got %+v", aliases)
+	}
+}
+
+func TestMergeDistinguishersResumes(t *testing.T) {
+	ctx := context.Background()
+	persistence := database.NewMemoryFindingsPersistence()
+	logic, _ := newApplicationOn(t, persistence)
+	// A hundred findings are moved in the first batch, and removing the duplicate in the second batch fails
+	for index := 0; index < 100; index++ {
+		finding := newFinding()
+		finding.ReportLocator.Value = fmt.Sprintf("10.0.1.%d:22", index)
+		finding.ReportLocator.Distinguisher = "home"
+		finding.Status = intermediaries.StatusOpen
+		if _, err := persistence.UpdateFinding(ctx, finding, 0, 1); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	duplicate := postFindingOn(t, logic, "10.0.0.2:22", "home")
+	postFindingOn(t, logic, "10.0.0.2:22", "apartment")
+
+	failing, _ := newApplicationOn(t, deleteFailingPersistence{Persistence: persistence})
+	result, err := failing.MergeDistinguishers(ctx, "home", "apartment", 1)
+	if err == nil {
+		t.Fatal("expected the merge to fail")
+	}
+	if result.Rekeyed != 100 || result.Deduplicated != 0 {
+		t.Errorf("expected the first batch to be applied, got %+v", result)
+	}
+	aliases, err := logic.ReadDistinguisherAliases(ctx, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(aliases) != 0 {
+		t.Errorf("expected no alias to be set before every finding is merged, got %+v", aliases)
+	}
+
+	// Merging again finishes the merge
+	result, err = logic.MergeDistinguishers(ctx, "home", "apartment", 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if result.Rekeyed != 0 || result.Deduplicated != 1 {
+		t.Errorf("expected only the duplicate to be left, got %+v", result)
+	}
+	_, err = logic.ReadFinding(ctx, duplicate.Identifier, 1)
+	expectAPIErrorCode(t, http.StatusNotFound, err)
+	aliases, err = logic.ReadDistinguisherAliases(ctx, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(aliases) != 1 || aliases[0].Alias != "home" || aliases[0].Distinguisher != "apartment" {
+		t.Errorf("expected home to be an alias of apartment, got %+v", aliases)
+	}
+}
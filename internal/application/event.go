@@ -0,0 +1,23 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/Kaese72/finding-registry/event"
+	"github.com/Kaese72/riskie-lib/apierror"
+)
+
+func (logic ApplicationLogic) ReadEventTypes(ctx context.Context) []event.EventType {
+	return event.EventTypes
+}
+
+// ReadEventSchema returns the JSON Schema document of an event type
+func (logic ApplicationLogic) ReadEventSchema(ctx context.Context, eventType event.EventType) ([]byte, error) {
+	schema, err := event.Schema(eventType)
+	if err != nil {
+		return nil, apierror.APIError{Code: http.StatusNotFound, WrappedError: fmt.Errorf("unknown event type: %s", eventType)}
+	}
+	return schema, nil
+}
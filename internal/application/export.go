@@ -0,0 +1,200 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/Kaese72/finding-registry/internal/database"
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
+)
+
+// exportPageSize is the number of findings, or of audit entries of a finding, read from the database at a time while exporting
+const exportPageSize = 100
+
+// ExportWriter writes an export as it is read, the header first and then a finding at a time
+type ExportWriter interface {
+	WriteHeader(intermediaries.ExportHeader) error
+	WriteFinding(intermediaries.ExportedFinding) error
+}
+
+// ExportReader reads an export a finding at a time. Next returns io.EOF after the last finding.
+type ExportReader interface {
+	Header() intermediaries.ExportHeader
+	Next() (intermediaries.ExportedFinding, error)
+}
+
+// ExportFindings writes every finding of the organization, deleted and archived findings included, together with
+// their audit history, to the writer. Findings are read a page at a time and written as they are read, so the
+// export is never held in memory. The first page is read before the header is written, so that nothing is
+// written if the findings can not be read at all.
+func (logic ApplicationLogic) ExportFindings(ctx context.Context, organizationID int, writer ExportWriter) error {
+	findings, err := logic.persistence.GetFindingsAfter(ctx, "", exportPageSize, organizationID)
+	if err != nil {
+		return err
+	}
+	err = writer.WriteHeader(intermediaries.ExportHeader{
+		Version:        intermediaries.ExportFormatVersion,
+		OrganizationId: organizationID,
+		ExportedAt:     now(),
+	})
+	if err != nil {
+		return err
+	}
+	if err := logic.exportFindingPages(ctx, findings, logic.persistence.GetFindingsAfter, organizationID, writer); err != nil {
+		return err
+	}
+	archived, err := logic.persistence.GetArchivedFindingsAfter(ctx, "", exportPageSize, organizationID)
+	if err != nil {
+		return err
+	}
+	return logic.exportFindingPages(ctx, archived, logic.persistence.GetArchivedFindingsAfter, organizationID, writer)
+}
+
+// exportFindingPages writes the page of findings, and every page read by next after it
+func (logic ApplicationLogic) exportFindingPages(ctx context.Context, findings []intermediaries.Finding, next func(context.Context, string, int, int) ([]intermediaries.Finding, error), organizationID int, writer ExportWriter) error {
+	for {
+		for index := range findings {
+			history, err := logic.findingHistory(ctx, findings[index].Identifier, organizationID)
+			if err != nil {
+				return err
+			}
+			if err := writer.WriteFinding(intermediaries.ExportedFinding{Finding: findings[index], History: history}); err != nil {
+				return err
+			}
+		}
+		if len(findings) < exportPageSize {
+			return nil
+		}
+		var err error
+		findings, err = next(ctx, findings[len(findings)-1].Identifier, exportPageSize, organizationID)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// findingHistory reads every audit entry of the finding, oldest first
+func (logic ApplicationLogic) findingHistory(ctx context.Context, identifier string, organizationID int) ([]intermediaries.AuditEntry, error) {
+	history := []intermediaries.AuditEntry{}
+	after := 0
+	for {
+		entries, err := logic.persistence.GetAuditEntriesAfter(ctx, intermediaries.AuditFilter{FindingIdentifier: identifier}, after, exportPageSize, organizationID)
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, entries...)
+		if len(entries) < exportPageSize {
+			return history, nil
+		}
+		after = entries[len(entries)-1].Sequence
+	}
+}
+
+// findingRestored checks if the existing finding already is the finding being imported
+func findingRestored(existing intermediaries.Finding, imported intermediaries.Finding) (bool, error) {
+	changes, err := auditChanges(&existing, &imported)
+	if err != nil {
+		return false, err
+	}
+	archivedRestored := existing.Archived() == imported.Archived() && (!imported.Archived() || existing.ArchivedAt.Equal(*imported.ArchivedAt))
+	return len(changes) == 0 && archivedRestored && existing.CreatedAt.Equal(imported.CreatedAt) && existing.UpdatedAt.Equal(imported.UpdatedAt), nil
+}
+
+// importFinding stores an imported finding in place of the existing finding, if any, and archives it if it was archived
+func (logic ApplicationLogic) importFinding(ctx context.Context, existing *intermediaries.Finding, imported intermediaries.Finding, organizationID int) (intermediaries.Finding, error) {
+	if existing != nil && existing.Archived() {
+		if _, err := logic.persistence.RestoreArchivedFinding(ctx, existing.Identifier, organizationID); err != nil {
+			return intermediaries.Finding{}, err
+		}
+	}
+	archivedAt := imported.ArchivedAt
+	imported.ArchivedAt = nil
+	stored, err := logic.persistence.UpdateFinding(ctx, imported, 0, organizationID)
+	if err != nil || archivedAt == nil {
+		return stored, err
+	}
+	return logic.persistence.ArchiveFinding(ctx, stored.Identifier, *archivedAt, organizationID)
+}
+
+// ImportFindings restores exported findings into the organization, which does not have to be the organization
+// they were exported from. Findings are validated and imported one at a time as they are read, so the findings
+// before an invalid one stay imported. Findings are matched with the findings of the organization by the report
+// distinguisher and locator they were reported on, and replaced when they differ, so importing the same export
+// again changes nothing, and importing a corrected export completes an import that failed part way.
+// The exported history is checked against its hashes but not restored, since anyone can compute them: every
+// finding the import creates or replaces is recorded as a single imported entry, attributed to the importing actor.
+func (logic ApplicationLogic) ImportFindings(ctx context.Context, reader ExportReader, organizationID int) (intermediaries.FindingImport, error) {
+	if err := reader.Header().Validate(); err != nil {
+		return intermediaries.FindingImport{}, err
+	}
+	result := intermediaries.FindingImport{}
+	for number := 1; ; number++ {
+		exported, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return result, nil
+		}
+		if err != nil {
+			return result, err
+		}
+		if err := exported.ValidateAt(number); err != nil {
+			return result, err
+		}
+		change, err := logic.importExportedFinding(ctx, exported, organizationID)
+		if err != nil {
+			return result, err
+		}
+		switch {
+		case change.before == nil:
+			result.Created++
+		case change.before == change.after:
+			result.Unchanged++
+		default:
+			result.Updated++
+		}
+	}
+}
+
+// importExportedFinding creates or replaces the finding matching the exported finding, unless it already matches
+func (logic ApplicationLogic) importExportedFinding(ctx context.Context, exported intermediaries.ExportedFinding, organizationID int) (findingChange, error) {
+	finding := exported.Finding
+	finding.Identifier = ""
+	finding.OrganizationId = organizationID
+	finding.CreatedAt = finding.CreatedAt.UTC().Truncate(time.Millisecond)
+	finding.UpdatedAt = finding.UpdatedAt.UTC().Truncate(time.Millisecond)
+	if finding.Deleted() {
+		deletedAt := finding.DeletedAt.UTC().Truncate(time.Millisecond)
+		finding.DeletedAt = &deletedAt
+	}
+	if finding.Archived() {
+		archivedAt := finding.ArchivedAt.UTC().Truncate(time.Millisecond)
+		finding.ArchivedAt = &archivedAt
+	}
+	// The finding is located like a reported finding, with the aliases and ownership rules of the importing
+	// organization, and the implied locators derived by this deployment, which may know more locator types
+	// than the exporting one
+	finding, err := logic.locateFinding(ctx, finding, organizationID)
+	if err != nil {
+		return findingChange{}, err
+	}
+	return logic.storeFindingChange(ctx, func(ctx context.Context) (findingChange, error) {
+		existing, err := logic.persistence.GetFindingByReport(ctx, finding.ReportDistinguisher, finding.ReportLocator, organizationID)
+		if errors.Is(err, database.ErrNotFound) {
+			existing, err = logic.persistence.GetArchivedFindingByReport(ctx, finding.ReportDistinguisher, finding.ReportLocator, organizationID)
+		}
+		if errors.Is(err, database.ErrNotFound) {
+			created, err := logic.importFinding(ctx, nil, finding, organizationID)
+			return findingChange{after: &created, imported: true}, err
+		}
+		if err != nil {
+			return findingChange{}, err
+		}
+		restored, err := findingRestored(existing, finding)
+		if err != nil || restored {
+			return findingChange{before: &existing, after: &existing, imported: true}, err
+		}
+		updated, err := logic.importFinding(ctx, &existing, finding, organizationID)
+		return findingChange{before: &existing, after: &updated, imported: true}, err
+	})
+}
@@ -0,0 +1,363 @@
+package application_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Kaese72/finding-registry/event"
+	"github.com/Kaese72/finding-registry/internal/application"
+	"github.com/Kaese72/finding-registry/internal/database"
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
+)
+
+// exportBuffer keeps an export in memory, as written by ExportFindings
+type exportBuffer struct {
+	Header   intermediaries.ExportHeader
+	Findings []intermediaries.ExportedFinding
+}
+
+func (buffer *exportBuffer) WriteHeader(header intermediaries.ExportHeader) error {
+	buffer.Header = header
+	return nil
+}
+
+func (buffer *exportBuffer) WriteFinding(exported intermediaries.ExportedFinding) error {
+	buffer.Findings = append(buffer.Findings, exported)
+	return nil
+}
+
+// reader reads the export back from its first finding
+func (buffer exportBuffer) reader() application.ExportReader {
+	return &exportBufferReader{buffer: buffer}
+}
+
+type exportBufferReader struct {
+	buffer exportBuffer
+	read   int
+}
+
+func (reader *exportBufferReader) Header() intermediaries.ExportHeader {
+	return reader.buffer.Header
+}
+
+func (reader *exportBufferReader) Next() (intermediaries.ExportedFinding, error) {
+	if reader.read == len(reader.buffer.Findings) {
+		return intermediaries.ExportedFinding{}, io.EOF
+	}
+	reader.read++
+	return reader.buffer.Findings[reader.read-1], nil
+}
+
+// exportFindings exports the findings of the organization into memory
+func exportFindings(t *testing.T, logic application.ApplicationLogic, organizationID int) exportBuffer {
+	t.Helper()
+	export := exportBuffer{}
+	if err := logic.ExportFindings(context.Background(), organizationID, &export); err != nil {
+		t.Fatal(err.Error())
+	}
+	return export
+}
+
+func TestExportImportFindings(t *testing.T) {
+	ctx := context.Background()
+	logic, events := newApplication(t)
+
+	resolved, err := logic.PostFinding(ctx, newFinding(), intermediaries.VersionPrecondition{}, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEvents(t, events, event.FindingCreatedType)
+	if _, err := logic.UpdateFindingStatus(ctx, resolved.Identifier, intermediaries.StatusResolved, intermediaries.VersionPrecondition{}, 1); err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEvents(t, events, event.FindingStatusChangedType)
+	deletedFinding := newFinding()
+	deletedFinding.ReportLocator.Value = "10.0.0.2:22"
+	deleted, err := logic.PostFinding(ctx, deletedFinding, intermediaries.VersionPrecondition{}, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEvents(t, events, event.FindingCreatedType)
+	if err := logic.DeleteFinding(ctx, deleted.Identifier, 7, intermediaries.VersionPrecondition{}, 1); err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEvents(t, events, event.FindingDeletedType)
+
+	export := exportFindings(t, logic, 1)
+	if export.Header.Version != intermediaries.ExportFormatVersion || export.Header.OrganizationId != 1 || len(export.Findings) != 2 {
+		t.Fatalf("expected an export of both findings of organization 1, got %+v", export)
+	}
+	for _, exported := range export.Findings {
+		if len(exported.History) != 2 {
+			t.Errorf("expected 2 history entries of %s, got %+v", exported.Finding.Identifier, exported.History)
+		}
+	}
+
+	importCtx := application.WithAuditActor(ctx, intermediaries.AuditActor{UserId: 9})
+	result, err := logic.ImportFindings(importCtx, export.reader(), 2)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if result != (intermediaries.FindingImport{Created: 2}) {
+		t.Errorf("expected both findings to be created, got %+v", result)
+	}
+	// The deleted finding is restored without telling anyone, as it is already gone
+	expectEvents(t, events, event.FindingCreatedType)
+
+	imported := exportFindings(t, logic, 2)
+	if len(imported.Findings) != 2 {
+		t.Fatalf("expected 2 findings in organization 2, got %+v", imported.Findings)
+	}
+	for _, exported := range imported.Findings {
+		finding := exported.Finding
+		if finding.OrganizationId != 2 || finding.Identifier == resolved.Identifier || finding.Identifier == deleted.Identifier {
+			t.Errorf("expected the finding to be created anew in organization 2, got %+v", finding)
+		}
+		switch finding.ReportLocator.Value {
+		case resolved.ReportLocator.Value:
+			if finding.Status != intermediaries.StatusResolved || !finding.CreatedAt.Equal(resolved.CreatedAt) || finding.Deleted() {
+				t.Errorf("expected the resolved finding to be restored, got %+v", finding)
+			}
+		case deleted.ReportLocator.Value:
+			if !finding.Deleted() || finding.DeletedBy != 7 {
+				t.Errorf("expected the deleted finding to be restored, got %+v", finding)
+			}
+		}
+	}
+
+	// The exported history is not restored, and every finding is recorded as imported by the importing user
+	entries, err := logic.ReadAuditEntries(ctx, 2, intermediaries.AuditFilter{}, 0, 100)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 audit entries in organization 2, got %+v", entries)
+	}
+	for _, entry := range entries {
+		if entry.Action != intermediaries.AuditImported || entry.Actor.UserId != 9 {
+			t.Errorf("expected the finding to be recorded as imported by user 9, got %+v", entry)
+		}
+	}
+	verification, err := logic.VerifyAudit(ctx, 2)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !verification.Valid() {
+		t.Errorf("expected the audit log of organization 2 to be valid, got %+v", verification)
+	}
+
+	// Importing the same export again changes nothing
+	result, err = logic.ImportFindings(importCtx, export.reader(), 2)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if result != (intermediaries.FindingImport{Unchanged: 2}) {
+		t.Errorf("expected both findings to be unchanged, got %+v", result)
+	}
+	expectEvents(t, events)
+	if entries, _ := logic.ReadAuditEntries(ctx, 2, intermediaries.AuditFilter{}, 0, 100); len(entries) != 2 {
+		t.Errorf("expected no more audit entries, got %d", len(entries))
+	}
+
+	// A finding that differs from the export is replaced
+	export.Findings[0].Finding.Severity = intermediaries.SeverityHigh
+	result, err = logic.ImportFindings(importCtx, export.reader(), 2)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if result != (intermediaries.FindingImport{Updated: 1, Unchanged: 1}) {
+		t.Errorf("expected one finding to be updated, got %+v", result)
+	}
+	expectEvents(t, events, event.FindingUpdatedType)
+	entries, err = logic.ReadAuditEntries(ctx, 2, intermediaries.AuditFilter{}, 2, 100)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(entries) != 1 || entries[0].Action != intermediaries.AuditImported || entries[0].Actor.UserId != 9 {
+		t.Errorf("expected the replaced finding to be recorded as imported, got %+v", entries)
+	}
+}
+
+func TestExportFindingsPages(t *testing.T) {
+	ctx := context.Background()
+	persistence := database.NewMemoryFindingsPersistence()
+	logic, _ := newApplicationOn(t, persistence)
+	// Findings are read a hundred at a time, so there is a full page of findings and one more, followed by the archive
+	stored := []intermediaries.Finding{}
+	for index := 0; index < 103; index++ {
+		finding := newFinding()
+		finding.ReportLocator.Value = fmt.Sprintf("10.0.%d.%d:22", index/256, index%256)
+		finding.Status = intermediaries.StatusOpen
+		finding.CreatedAt = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+		finding.UpdatedAt = finding.CreatedAt
+		created, err := persistence.UpdateFinding(ctx, finding, 0, 1)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		stored = append(stored, created)
+	}
+	for _, archived := range stored[:2] {
+		if _, err := persistence.ArchiveFinding(ctx, archived.Identifier, time.Date(2024, 3, 2, 12, 0, 0, 0, time.UTC), 1); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+
+	export := exportFindings(t, logic, 1)
+	if len(export.Findings) != len(stored) {
+		t.Fatalf("expected %d findings to be exported, got %d", len(stored), len(export.Findings))
+	}
+	expected := append(append([]intermediaries.Finding{}, stored[2:]...), stored[:2]...)
+	for index, exported := range export.Findings {
+		if exported.Finding.Identifier != expected[index].Identifier || exported.Finding.Archived() != (index >= 101) {
+			t.Fatalf("expected the findings in the order they were created followed by the archive, got %+v at %d", exported.Finding, index)
+		}
+	}
+}
+
+func TestImportFindingsInvalid(t *testing.T) {
+	ctx := context.Background()
+	logic, events := newApplication(t)
+	if _, err := logic.PostFinding(ctx, newFinding(), intermediaries.VersionPrecondition{}, 1); err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEvents(t, events, event.FindingCreatedType)
+	valid := exportFindings(t, logic, 1)
+
+	var tests = []struct {
+		name     string
+		change   func(*exportBuffer)
+		code     int
+		imported int
+	}{
+		{"unsupported version", func(export *exportBuffer) { export.Header.Version = intermediaries.ExportFormatVersion + 1 }, http.StatusUnprocessableEntity, 0},
+		{"invalid status", func(export *exportBuffer) { export.Findings[1].Finding.Status = "fixed" }, http.StatusBadRequest, 1},
+		{"invalid locator", func(export *exportBuffer) { export.Findings[1].Finding.ReportLocator.Value = "10.0.0.1" }, http.StatusBadRequest, 1},
+		{"changed history", func(export *exportBuffer) { export.Findings[1].History[0].Actor.UserId = 8 }, http.StatusUnprocessableEntity, 1},
+	}
+	for index, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The second finding is the invalid one, and the first is imported before it is read
+			organizationID := index + 2
+			export := valid
+			export.Findings = []intermediaries.ExportedFinding{valid.Findings[0], valid.Findings[0]}
+			export.Findings[1].History = append([]intermediaries.AuditEntry{}, valid.Findings[0].History...)
+			tt.change(&export)
+			result, err := logic.ImportFindings(ctx, export.reader(), organizationID)
+			expectAPIErrorCode(t, tt.code, err)
+			if result.Created != tt.imported {
+				t.Errorf("expected %d findings to be created, got %+v", tt.imported, result)
+			}
+			imported := exportFindings(t, logic, organizationID)
+			if len(imported.Findings) != tt.imported {
+				t.Errorf("expected %d findings to be imported, got %+v", tt.imported, imported.Findings)
+			}
+		})
+	}
+}
+
+func TestExportImportArchivedFindings(t *testing.T) {
+	ctx := context.Background()
+	persistence := database.NewMemoryFindingsPersistence()
+	logic, events := newApplicationOn(t, persistence)
+	created, err := logic.PostFinding(ctx, newFinding(), intermediaries.VersionPrecondition{}, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEvents(t, events, event.FindingCreatedType)
+	if _, err := logic.UpdateFindingStatus(ctx, created.Identifier, intermediaries.StatusResolved, intermediaries.VersionPrecondition{}, 1); err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEvents(t, events, event.FindingStatusChangedType)
+	archivedAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	if _, err := persistence.ArchiveFinding(ctx, created.Identifier, archivedAt, 1); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	export := exportFindings(t, logic, 1)
+	if len(export.Findings) != 1 || !export.Findings[0].Finding.Archived() {
+		t.Fatalf("expected the archived finding to be exported, got %+v", export.Findings)
+	}
+	result, err := logic.ImportFindings(ctx, export.reader(), 2)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if result != (intermediaries.FindingImport{Created: 1}) {
+		t.Errorf("expected the finding to be created, got %+v", result)
+	}
+	expectEvents(t, events, event.FindingCreatedType)
+	imported, err := persistence.GetArchivedFindings(ctx, 2)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(imported) != 1 || !imported[0].ArchivedAt.Equal(archivedAt) {
+		t.Errorf("expected the finding to be archived in organization 2, got %+v", imported)
+	}
+
+	// Importing the same export again changes nothing, while importing it as active restores it
+	result, err = logic.ImportFindings(ctx, export.reader(), 2)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if result != (intermediaries.FindingImport{Unchanged: 1}) {
+		t.Errorf("expected the finding to be unchanged, got %+v", result)
+	}
+	export.Findings[0].Finding.ArchivedAt = nil
+	result, err = logic.ImportFindings(ctx, export.reader(), 2)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if result != (intermediaries.FindingImport{Updated: 1}) {
+		t.Errorf("expected the finding to be updated, got %+v", result)
+	}
+	found, err := logic.ReadFinding(ctx, imported[0].Identifier, 2)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if found.Archived() {
+		t.Errorf("expected the finding to be restored from the archive, got %+v", found)
+	}
+}
+
+func TestImportFindingsAliasedDistinguisher(t *testing.T) {
+	ctx := context.Background()
+	logic, events := newApplication(t)
+	if _, err := logic.PostFinding(ctx, newFinding(), intermediaries.VersionPrecondition{}, 1); err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEvents(t, events, event.FindingCreatedType)
+	export := exportFindings(t, logic, 1)
+
+	// Organization 2 has merged the distinguisher of the exported finding into another, and already has the finding there
+	located := newFinding()
+	located.ReportLocator.Distinguisher = "dc2"
+	existing, err := logic.PostFinding(ctx, located, intermediaries.VersionPrecondition{}, 2)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEvents(t, events, event.FindingCreatedType)
+	if _, err := logic.PutDistinguisherAlias(ctx, intermediaries.DistinguisherAlias{Alias: "dc1", Distinguisher: "dc2"}, 2); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	result, err := logic.ImportFindings(ctx, export.reader(), 2)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if result != (intermediaries.FindingImport{Updated: 1}) {
+		t.Errorf("expected the finding under the distinguisher dc1 is an alias of to be updated, got %+v", result)
+	}
+	// Only the timestamps of the finding are restored, which is nothing to tell anyone about
+	expectEvents(t, events)
+	imported := exportFindings(t, logic, 2)
+	if len(imported.Findings) != 1 {
+		t.Fatalf("expected a single finding in organization 2, got %+v", imported.Findings)
+	}
+	finding := imported.Findings[0].Finding
+	if finding.Identifier != existing.Identifier || finding.ReportLocator.Distinguisher != "dc2" {
+		t.Errorf("expected the finding to be imported under dc2, got %+v", finding)
+	}
+}
@@ -0,0 +1,264 @@
+package application
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/Kaese72/finding-registry/event"
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
+	"github.com/Kaese72/riskie-lib/logging"
+)
+
+const (
+	// outboxBatchSize is the maximum number of events claimed by the relay at a time
+	outboxBatchSize = 100
+	// outboxLease is how long claimed events are hidden from other relays, and must be longer
+	// than it takes to publish a full batch
+	outboxLease = time.Minute
+	// outboxPublishTimeout bounds how long the relay waits for a single event to be confirmed
+	outboxPublishTimeout = 10 * time.Second
+	// outboxPruneInterval is how often the relay deletes events delivered longer ago than the stream retention
+	outboxPruneInterval = 10 * time.Minute
+)
+
+// findingChange is the outcome of a change to a single finding.
+// before is nil when the finding was created, and after is nil when it was deleted for good.
+// A finding marked as deleted is still there, as the tombstone after is.
+type findingChange struct {
+	before *intermediaries.Finding
+	after  *intermediaries.Finding
+	// imported tells that the change was made by importing an export
+	imported bool
+}
+
+// storeFindingChange applies a change to a finding and stores the resulting events in the outbox, atomically,
+// together with their webhook deliveries and the audit entry of the change. The events are published by the
+// outbox relay and the deliveries are attempted by the webhook dispatcher, so no event is lost if publishing
+// fails or the process stops.
+func (logic ApplicationLogic) storeFindingChange(ctx context.Context, change func(context.Context) (findingChange, error)) (findingChange, error) {
+	var changed findingChange
+	err := logic.persistence.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		changed, err = change(ctx)
+		if err != nil {
+			return err
+		}
+		if err := logic.auditFindingChange(ctx, changed); err != nil {
+			return err
+		}
+		outboxEvents := []intermediaries.OutboxEvent{}
+		for _, findingEvent := range findingChangeEvents(changed, now()) {
+			outboxEvent, err := outboxEventFromEvent(findingEvent)
+			if err != nil {
+				return err
+			}
+			if err := logic.persistence.InsertOutboxEvent(ctx, outboxEvent); err != nil {
+				return err
+			}
+			outboxEvents = append(outboxEvents, outboxEvent)
+		}
+		return logic.storeWebhookDeliveries(ctx, outboxEvents)
+	})
+	return changed, err
+}
+
+// findingChanged checks if storing after in place of before would change anything worth telling anyone about
+func findingChanged(before intermediaries.Finding, after intermediaries.Finding) bool {
+	return before.Status != after.Status || len(event.DiffFindings(eventFindingFromIntermediary(before), eventFindingFromIntermediary(after))) > 0
+}
+
+// findingChangeEvents describes a change to a finding as events. A change may result in both
+// a FindingUpdated and a FindingStatusChanged event, or no events at all when nothing changed.
+func findingChangeEvents(change findingChange, occurredAt time.Time) []event.Event {
+	switch {
+	case change.before == nil && change.after == nil:
+		return nil
+	case change.before == nil && change.after.Deleted():
+		// A deleted finding is only created when it is imported, and was never there to tell anyone about
+		return nil
+	case change.before == nil:
+		return []event.Event{event.FindingCreated{
+			Header:  event.NewHeader(intermediaries.NewEventID(), event.FindingCreatedType, change.after.OrganizationId, occurredAt),
+			Finding: eventFindingFromIntermediary(*change.after),
+		}}
+	case change.after == nil && change.before.Deleted():
+		// The deletion was published when the finding was marked as deleted
+		return nil
+	case change.after == nil || (change.after.Deleted() && !change.before.Deleted()):
+		return []event.Event{event.FindingDeleted{
+			Header:  event.NewHeader(intermediaries.NewEventID(), event.FindingDeletedType, change.before.OrganizationId, occurredAt),
+			Finding: eventFindingFromIntermediary(*change.before),
+		}}
+	}
+	events := []event.Event{}
+	after := eventFindingFromIntermediary(*change.after)
+	if changes := event.DiffFindings(eventFindingFromIntermediary(*change.before), after); len(changes) > 0 {
+		events = append(events, event.FindingUpdated{
+			Header:  event.NewHeader(intermediaries.NewEventID(), event.FindingUpdatedType, change.after.OrganizationId, occurredAt),
+			Finding: after,
+			Changes: changes,
+		})
+	}
+	if change.before.Status != change.after.Status {
+		events = append(events, event.FindingStatusChanged{
+			Header:         event.NewHeader(intermediaries.NewEventID(), event.FindingStatusChangedType, change.after.OrganizationId, occurredAt),
+			Finding:        after,
+			PreviousStatus: string(change.before.Status),
+			Status:         string(change.after.Status),
+		})
+	}
+	return events
+}
+
+func eventReportLocatorFromIntermediary(locator intermediaries.ReportLocator) event.ReportLocator {
+	return event.ReportLocator{
+		Type:          string(locator.Type),
+		Value:         locator.Value,
+		Distinguisher: locator.Distinguisher,
+	}
+}
+
+func eventFindingFromIntermediary(finding intermediaries.Finding) event.Finding {
+	implied := []event.ReportLocator{}
+	for index := range finding.ImpliedReportLocators {
+		implied = append(implied, eventReportLocatorFromIntermediary(finding.ImpliedReportLocators[index]))
+	}
+	return event.Finding{
+		ID:             finding.Identifier,
+		Name:           finding.Name,
+		OrganizationId: finding.OrganizationId,
+		ReportDistinguisher: event.ReportDistinguisher{
+			Type:  finding.ReportDistinguisher.Type,
+			Value: finding.ReportDistinguisher.Value,
+		},
+		ReportLocator:         eventReportLocatorFromIntermediary(finding.ReportLocator),
+		ImpliedReportLocators: implied,
+		Owner: event.Owner{
+			Team:    finding.Owner.Team,
+			Contact: finding.Owner.Contact,
+		},
+		Severity:  string(finding.Severity),
+		Status:    string(finding.Status),
+		CreatedAt: finding.CreatedAt,
+		UpdatedAt: finding.UpdatedAt,
+	}
+}
+
+func intermediaryReportLocatorFromEvent(locator event.ReportLocator) intermediaries.ReportLocator {
+	return intermediaries.ReportLocator{
+		Type:          intermediaries.ReportLocatorType(locator.Type),
+		Value:         locator.Value,
+		Distinguisher: locator.Distinguisher,
+	}
+}
+
+func intermediaryFindingFromEvent(finding event.Finding) intermediaries.Finding {
+	implied := []intermediaries.ReportLocator{}
+	for index := range finding.ImpliedReportLocators {
+		implied = append(implied, intermediaryReportLocatorFromEvent(finding.ImpliedReportLocators[index]))
+	}
+	return intermediaries.Finding{
+		Identifier:     finding.ID,
+		Name:           finding.Name,
+		OrganizationId: finding.OrganizationId,
+		ReportDistinguisher: intermediaries.ReportDistinguisher{
+			Type:  finding.ReportDistinguisher.Type,
+			Value: finding.ReportDistinguisher.Value,
+		},
+		ReportLocator:         intermediaryReportLocatorFromEvent(finding.ReportLocator),
+		ImpliedReportLocators: implied,
+		Owner: intermediaries.Owner{
+			Team:    finding.Owner.Team,
+			Contact: finding.Owner.Contact,
+		},
+		Severity:  intermediaries.Severity(finding.Severity),
+		Status:    intermediaries.FindingStatus(finding.Status),
+		CreatedAt: finding.CreatedAt,
+		UpdatedAt: finding.UpdatedAt,
+	}
+}
+
+func outboxEventFromEvent(findingEvent event.Event) (intermediaries.OutboxEvent, error) {
+	header := findingEvent.EventHeader()
+	payload, err := json.Marshal(findingEvent)
+	if err != nil {
+		return intermediaries.OutboxEvent{}, err
+	}
+	return intermediaries.OutboxEvent{
+		Identifier:     header.EventID,
+		OrganizationId: header.OrganizationId,
+		Type:           string(header.Type),
+		Payload:        payload,
+		CreatedAt:      header.OccurredAt,
+	}, nil
+}
+
+// RunOutboxRelay publishes events stored in the outbox until the context is cancelled.
+// Events are marked delivered once the broker has confirmed them, so every event is
+// delivered at least once, and consumers deduplicate on the event ID.
+// Delivered events are kept for the stream retention, and are then deleted by the relay.
+func (logic ApplicationLogic) RunOutboxRelay(ctx context.Context, interval time.Duration) {
+	logging.Info(ctx, "Started outbox relay")
+	pruned := time.Time{}
+	for {
+		if now().Sub(pruned) >= outboxPruneInterval {
+			if err := logic.pruneOutbox(ctx); err != nil {
+				logging.Error(ctx, "Failed to prune outbox events", map[string]interface{}{"error": err.Error()})
+			}
+			pruned = now()
+		}
+		relayed, err := logic.relayOutbox(ctx)
+		if err != nil {
+			logging.Error(ctx, "Failed to relay outbox events", map[string]interface{}{"error": err.Error()})
+		}
+		if err == nil && relayed == outboxBatchSize {
+			// There are likely more events waiting
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// pruneOutbox deletes the events that were delivered longer ago than streams can be resumed from
+func (logic ApplicationLogic) pruneOutbox(ctx context.Context) error {
+	deleted, err := logic.persistence.DeleteDeliveredOutboxEvents(ctx, now().Add(-StreamRetention))
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		logging.Info(ctx, "Pruned delivered outbox events", map[string]interface{}{"deleted": deleted})
+	}
+	return nil
+}
+
+// relayOutbox publishes a single batch of outbox events, and returns how many were published
+func (logic ApplicationLogic) relayOutbox(ctx context.Context) (int, error) {
+	outboxEvents, err := logic.persistence.ClaimOutboxEvents(ctx, outboxBatchSize, outboxLease)
+	if err != nil {
+		return 0, err
+	}
+	for index, outboxEvent := range outboxEvents {
+		decoded, err := event.DecodeEvent(event.EventType(outboxEvent.Type), outboxEvent.Payload)
+		if err != nil {
+			// Retrying will not help, so the event is marked delivered to not block the outbox
+			logging.Error(ctx, "Dropped undecodable outbox event", map[string]interface{}{"eventId": outboxEvent.Identifier, "error": err.Error()})
+		} else {
+			publishCtx, cancel := context.WithTimeout(ctx, outboxPublishTimeout)
+			err = logic.events.Publish(publishCtx, decoded)
+			cancel()
+			if err != nil {
+				// The remaining events are retried once their lease expires, keeping them in order
+				return index, err
+			}
+		}
+		if err := logic.persistence.MarkOutboxEventDelivered(ctx, outboxEvent.Identifier); err != nil {
+			return index, err
+		}
+	}
+	return len(outboxEvents), nil
+}
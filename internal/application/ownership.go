@@ -0,0 +1,104 @@
+package application
+
+import (
+	"context"
+
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
+)
+
+func (logic ApplicationLogic) ReadOwnershipRules(ctx context.Context, organizationID int) ([]intermediaries.OwnershipRule, error) {
+	rules, err := logic.persistence.GetOwnershipRules(ctx, organizationID)
+	if err != nil {
+		return nil, err
+	}
+	intermediaries.SortOwnershipRules(rules)
+	return rules, nil
+}
+
+func (logic ApplicationLogic) ReadOwnershipRule(ctx context.Context, identifier string, organizationID int) (intermediaries.OwnershipRule, error) {
+	rule, err := logic.persistence.GetOwnershipRule(ctx, identifier, organizationID)
+	return rule, notFoundAsAPIError(err)
+}
+
+// PostOwnershipRule creates a rule and applies it to the findings of the organization, in the same transaction,
+// so that the rule is not kept when applying it fails
+func (logic ApplicationLogic) PostOwnershipRule(ctx context.Context, rule intermediaries.OwnershipRule, organizationID int) (intermediaries.OwnershipRule, error) {
+	if err := rule.Validate(); err != nil {
+		return intermediaries.OwnershipRule{}, err
+	}
+	var resRule intermediaries.OwnershipRule
+	err := logic.persistence.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		resRule, err = logic.persistence.CreateOwnershipRule(ctx, rule, organizationID)
+		if err != nil {
+			return err
+		}
+		return logic.ReevaluateOwnership(ctx, organizationID)
+	})
+	if err != nil {
+		return intermediaries.OwnershipRule{}, err
+	}
+	return resRule, nil
+}
+
+// PutOwnershipRule changes a rule and applies it to the findings of the organization, in the same transaction
+func (logic ApplicationLogic) PutOwnershipRule(ctx context.Context, rule intermediaries.OwnershipRule, organizationID int) (intermediaries.OwnershipRule, error) {
+	if err := rule.Validate(); err != nil {
+		return intermediaries.OwnershipRule{}, err
+	}
+	var resRule intermediaries.OwnershipRule
+	err := logic.persistence.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		resRule, err = logic.persistence.UpdateOwnershipRule(ctx, rule, organizationID)
+		if err != nil {
+			return err
+		}
+		return logic.ReevaluateOwnership(ctx, organizationID)
+	})
+	if err != nil {
+		return intermediaries.OwnershipRule{}, notFoundAsAPIError(err)
+	}
+	return resRule, nil
+}
+
+// DeleteOwnershipRule deletes a rule and reassigns the findings it applied to, in the same transaction
+func (logic ApplicationLogic) DeleteOwnershipRule(ctx context.Context, identifier string, organizationID int) error {
+	err := logic.persistence.WithTransaction(ctx, func(ctx context.Context) error {
+		if err := logic.persistence.DeleteOwnershipRule(ctx, identifier, organizationID); err != nil {
+			return err
+		}
+		return logic.ReevaluateOwnership(ctx, organizationID)
+	})
+	return notFoundAsAPIError(err)
+}
+
+// ReevaluateOwnership applies the current ownership rules to every finding of the organization.
+// Findings whose owner changes are updated and published. Every finding is changed in the transaction of the
+// context if there is one, and in a transaction of its own otherwise.
+func (logic ApplicationLogic) ReevaluateOwnership(ctx context.Context, organizationID int) error {
+	rules, err := logic.persistence.GetOwnershipRules(ctx, organizationID)
+	if err != nil {
+		return err
+	}
+	findings, err := logic.persistence.GetFindings(ctx, organizationID)
+	if err != nil {
+		return err
+	}
+	for _, finding := range findings {
+		if finding.Deleted() {
+			continue
+		}
+		owner := intermediaries.ResolveOwner(rules, finding)
+		if owner == finding.Owner {
+			continue
+		}
+		_, err := logic.storeFindingChange(ctx, func(ctx context.Context) (findingChange, error) {
+			updated, err := logic.persistence.UpdateFindingOwner(ctx, finding.Identifier, owner, organizationID)
+			return findingChange{before: &finding, after: &updated}, err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package application_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Kaese72/finding-registry/event"
+	"github.com/Kaese72/finding-registry/internal/database"
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
+)
+
+// ownerFailingPersistence fails to change the owner of findings
+type ownerFailingPersistence struct {
+	database.Persistence
+}
+
+func (persistence ownerFailingPersistence) UpdateFindingOwner(ctx context.Context, identifier string, owner intermediaries.Owner, organizationID int) (intermediaries.Finding, error) {
+	return intermediaries.Finding{}, errors.New("failure")
+}
+
+func TestOwnershipRules(t *testing.T) {
+	ctx := context.Background()
+	logic, events := newApplication(t)
+	created, err := logic.PostFinding(ctx, newFinding(), intermediaries.VersionPrecondition{}, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEvents(t, events, event.FindingCreatedType)
+
+	rule, err := logic.PostOwnershipRule(ctx, intermediaries.OwnershipRule{
+		Name:               "Scanners",
+		DistinguisherTypes: []string{"scanner"},
+		Owner:              intermediaries.Owner{Team: "platform"},
+	}, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEvents(t, events, event.FindingUpdatedType)
+	found, err := logic.ReadFinding(ctx, created.Identifier, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if found.Owner.Team != "platform" {
+		t.Errorf("expected the finding to be owned by the rule, got %+v", found.Owner)
+	}
+
+	if err := logic.DeleteOwnershipRule(ctx, rule.Identifier, 1); err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEvents(t, events, event.FindingUpdatedType)
+	found, err = logic.ReadFinding(ctx, created.Identifier, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if found.Owner != (intermediaries.Owner{}) {
+		t.Errorf("expected the finding to have no owner, got %+v", found.Owner)
+	}
+}
+
+func TestOwnershipRuleRollsBack(t *testing.T) {
+	ctx := context.Background()
+	persistence := database.NewMemoryFindingsPersistence()
+	logic, events := newApplicationOn(t, persistence)
+	if _, err := logic.PostFinding(ctx, newFinding(), intermediaries.VersionPrecondition{}, 1); err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEvents(t, events, event.FindingCreatedType)
+
+	// The rule is not kept when it can not be applied, so that trying again does not create it twice
+	failing, _ := newApplicationOn(t, ownerFailingPersistence{Persistence: persistence})
+	_, err := failing.PostOwnershipRule(ctx, intermediaries.OwnershipRule{
+		Name:               "Scanners",
+		DistinguisherTypes: []string{"scanner"},
+		Owner:              intermediaries.Owner{Team: "platform"},
+	}, 1)
+	if err == nil {
+		t.Fatal("expected applying the rule to fail")
+	}
+	rules, err := logic.ReadOwnershipRules(ctx, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(rules) != 0 {
+		t.Errorf("expected the rule to be rolled back, got %+v", rules)
+	}
+	expectEvents(t, events)
+}
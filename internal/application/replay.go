@@ -0,0 +1,188 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Kaese72/finding-registry/event"
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
+	"github.com/Kaese72/riskie-lib/apierror"
+)
+
+const (
+	// DefaultReplayRate is the number of events republished per second, unless requested otherwise
+	DefaultReplayRate = 100
+	// maxReplayRate bounds the requested rate, so that a replay does not crowd out regular events
+	maxReplayRate = 1000
+	// replayProgressInterval is how often progress is reported during a replay
+	replayProgressInterval = time.Second
+	// replayRetention is how long a replay that has stopped can still be read
+	replayRetention = time.Hour
+)
+
+// replayRate is the rate of a replay, or an error if the requested rate is out of bounds
+func replayRate(rate int) (int, error) {
+	if rate == 0 {
+		return DefaultReplayRate, nil
+	}
+	if rate < 0 || rate > maxReplayRate {
+		return 0, apierror.APIError{Code: http.StatusBadRequest, WrappedError: fmt.Errorf("rate must be between 1 and %d", maxReplayRate)}
+	}
+	return rate, nil
+}
+
+// ReplayFindings republishes a snapshot event for every finding of the organization matching the filter,
+// at most rate events per second. Progress is reported regularly, and once more when the replay is done.
+// Snapshots are published directly to the event transport, and a replay that fails can be run again.
+func (logic ApplicationLogic) ReplayFindings(ctx context.Context, organizationID int, filter intermediaries.FindingFilter, rate int, progress func(intermediaries.ReplayProgress)) (intermediaries.ReplayProgress, error) {
+	rate, err := replayRate(rate)
+	if err != nil {
+		return intermediaries.ReplayProgress{}, err
+	}
+	findings, err := logic.ReadFindings(ctx, organizationID, filter)
+	if err != nil {
+		return intermediaries.ReplayProgress{}, err
+	}
+	state := intermediaries.ReplayProgress{Total: len(findings)}
+	progress(state)
+	throttle := time.NewTicker(time.Second / time.Duration(rate))
+	defer throttle.Stop()
+	lastReported := time.Now()
+	for index := range findings {
+		select {
+		case <-ctx.Done():
+			return state, ctx.Err()
+		case <-throttle.C:
+		}
+		snapshot := event.FindingSnapshot{
+			Header:  event.NewHeader(intermediaries.NewEventID(), event.FindingSnapshotType, organizationID, now()),
+			Finding: eventFindingFromIntermediary(findings[index]),
+		}
+		publishCtx, cancel := context.WithTimeout(ctx, outboxPublishTimeout)
+		err := logic.events.Publish(publishCtx, snapshot)
+		cancel()
+		if err != nil {
+			return state, err
+		}
+		state.Published++
+		if time.Since(lastReported) >= replayProgressInterval {
+			progress(state)
+			lastReported = time.Now()
+		}
+	}
+	state.Done = true
+	progress(state)
+	return state, nil
+}
+
+// replayRegistry keeps the replays run in the background by this instance, until they have been stopped for the replay retention
+type replayRegistry struct {
+	mutex   sync.Mutex
+	replays map[string]*backgroundReplay
+}
+
+type backgroundReplay struct {
+	replay    intermediaries.Replay
+	stoppedAt time.Time
+	cancel    context.CancelFunc
+}
+
+func newReplayRegistry() *replayRegistry {
+	return &replayRegistry{replays: map[string]*backgroundReplay{}}
+}
+
+// prune forgets the replays that stopped longer ago than the replay retention, and is called with the mutex held
+func (registry *replayRegistry) prune() {
+	for identifier, background := range registry.replays {
+		if !background.replay.Running() && now().Sub(background.stoppedAt) > replayRetention {
+			delete(registry.replays, identifier)
+		}
+	}
+}
+
+func (registry *replayRegistry) update(background *backgroundReplay, progress intermediaries.ReplayProgress) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	background.replay.Progress = progress
+	if !background.replay.Running() {
+		background.stoppedAt = now()
+	}
+}
+
+// get returns the replay of the organization, and is called with the mutex held
+func (registry *replayRegistry) get(identifier string, organizationID int) (*backgroundReplay, error) {
+	background, ok := registry.replays[identifier]
+	if !ok || background.replay.OrganizationId != organizationID {
+		return nil, apierror.APIError{Code: http.StatusNotFound, WrappedError: fmt.Errorf("replay %s not found", identifier)}
+	}
+	return background, nil
+}
+
+// StartReplay runs ReplayFindings in the background, and returns the replay to follow its progress with.
+// An organization only runs one replay at a time. Replays are run and kept by the instance they were started on,
+// and are forgotten when it stops.
+func (logic ApplicationLogic) StartReplay(ctx context.Context, organizationID int, filter intermediaries.FindingFilter, rate int) (intermediaries.Replay, error) {
+	if _, err := replayRate(rate); err != nil {
+		return intermediaries.Replay{}, err
+	}
+	registry := logic.replays
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	registry.prune()
+	for _, background := range registry.replays {
+		if background.replay.OrganizationId == organizationID && background.replay.Running() {
+			return intermediaries.Replay{}, apierror.APIError{Code: http.StatusConflict, WrappedError: fmt.Errorf("replay %s is already running", background.replay.Identifier)}
+		}
+	}
+	// The replay outlives the request starting it, and is stopped by CancelReplay
+	replayCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	background := &backgroundReplay{
+		replay: intermediaries.Replay{Identifier: intermediaries.NewEventID(), OrganizationId: organizationID, StartedAt: now()},
+		cancel: cancel,
+	}
+	registry.replays[background.replay.Identifier] = background
+	go func() {
+		defer cancel()
+		final, err := logic.ReplayFindings(replayCtx, organizationID, filter, rate, func(progress intermediaries.ReplayProgress) {
+			registry.update(background, progress)
+		})
+		if errors.Is(err, context.Canceled) {
+			err = errors.New("replay cancelled")
+		}
+		if err != nil {
+			final.Error = err.Error()
+			registry.update(background, final)
+		}
+	}()
+	return background.replay, nil
+}
+
+// ReadReplay returns a replay of the organization started on this instance
+func (logic ApplicationLogic) ReadReplay(ctx context.Context, identifier string, organizationID int) (intermediaries.Replay, error) {
+	registry := logic.replays
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	registry.prune()
+	background, err := registry.get(identifier, organizationID)
+	if err != nil {
+		return intermediaries.Replay{}, err
+	}
+	return background.replay, nil
+}
+
+// CancelReplay stops a replay of the organization started on this instance. The replay reports that it was cancelled once it has stopped.
+func (logic ApplicationLogic) CancelReplay(ctx context.Context, identifier string, organizationID int) error {
+	registry := logic.replays
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	background, err := registry.get(identifier, organizationID)
+	if err != nil {
+		return err
+	}
+	background.cancel()
+	return nil
+}
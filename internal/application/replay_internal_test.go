@@ -0,0 +1,84 @@
+package application_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Kaese72/finding-registry/event"
+	"github.com/Kaese72/finding-registry/internal/application"
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
+)
+
+// waitForReplay reads the replay until it has stopped
+func waitForReplay(t *testing.T, logic application.ApplicationLogic, identifier string) intermediaries.Replay {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		replay, err := logic.ReadReplay(context.Background(), identifier, 1)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if !replay.Running() {
+			return replay
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the replay to stop, got %+v", replay)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestStartReplay(t *testing.T) {
+	ctx := context.Background()
+	logic, events := newApplication(t)
+	postFindingOn(t, logic, "10.0.0.1:22", "dc1")
+	postFindingOn(t, logic, "10.0.0.2:22", "dc1")
+	expectEvents(t, events, event.FindingCreatedType, event.FindingCreatedType)
+
+	_, err := logic.StartReplay(ctx, 1, intermediaries.FindingFilter{}, 5000)
+	expectAPIErrorCode(t, http.StatusBadRequest, err)
+
+	replay, err := logic.StartReplay(ctx, 1, intermediaries.FindingFilter{}, 1000)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEvents(t, events, event.FindingSnapshotType, event.FindingSnapshotType)
+	stopped := waitForReplay(t, logic, replay.Identifier)
+	if stopped.Progress != (intermediaries.ReplayProgress{Total: 2, Published: 2, Done: true}) {
+		t.Errorf("expected every finding to be published, got %+v", stopped.Progress)
+	}
+	_, err = logic.ReadReplay(ctx, replay.Identifier, 2)
+	expectAPIErrorCode(t, http.StatusNotFound, err)
+}
+
+func TestCancelReplay(t *testing.T) {
+	ctx := context.Background()
+	logic, _ := newApplication(t)
+	postFindingOn(t, logic, "10.0.0.1:22", "dc1")
+	postFindingOn(t, logic, "10.0.0.2:22", "dc1")
+
+	replay, err := logic.StartReplay(ctx, 1, intermediaries.FindingFilter{}, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	// An organization only runs one replay at a time, while other organizations are not held up
+	_, err = logic.StartReplay(ctx, 1, intermediaries.FindingFilter{}, 1)
+	expectAPIErrorCode(t, http.StatusConflict, err)
+	if _, err := logic.StartReplay(ctx, 2, intermediaries.FindingFilter{}, 1); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	expectAPIErrorCode(t, http.StatusNotFound, logic.CancelReplay(ctx, replay.Identifier, 2))
+	if err := logic.CancelReplay(ctx, replay.Identifier, 1); err != nil {
+		t.Fatal(err.Error())
+	}
+	stopped := waitForReplay(t, logic, replay.Identifier)
+	if stopped.Progress.Done || stopped.Progress.Error == "" {
+		t.Errorf("expected the replay to report that it was cancelled, got %+v", stopped.Progress)
+	}
+	if _, err := logic.StartReplay(ctx, 1, intermediaries.FindingFilter{}, 1000); err != nil {
+		t.Errorf("expected a replay to start once the other one stopped, got %v", err)
+	}
+}
@@ -0,0 +1,234 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Kaese72/finding-registry/internal/database"
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
+	"github.com/Kaese72/riskie-lib/logging"
+)
+
+// DeleteFinding marks a finding as deleted by the user, and publishes its deletion. The finding is kept as a
+// tombstone until it is purged, and is created anew if it is reported again.
+// The finding is only deleted if it passes the precondition.
+func (logic ApplicationLogic) DeleteFinding(ctx context.Context, identifier string, deletedBy int, precondition intermediaries.VersionPrecondition, organizationID int) error {
+	_, err := logic.storeFindingChange(ctx, func(ctx context.Context) (findingChange, error) {
+		existing, err := logic.getFinding(ctx, identifier, organizationID)
+		if err != nil {
+			return findingChange{}, err
+		}
+		if !precondition.Matches(existing.Version) {
+			return findingChange{}, database.ErrVersionMismatch
+		}
+		deleted, err := logic.persistence.SoftDeleteFinding(ctx, identifier, deletedBy, precondition.ExpectedVersion(existing.Version), organizationID)
+		return findingChange{before: &existing, after: &deleted}, err
+	})
+	return versionMismatchAsAPIError(err)
+}
+
+// purgeFinding deletes a finding for good if it is still expired, and reports if it did
+func (logic ApplicationLogic) purgeFinding(ctx context.Context, identifier string, expired func(intermediaries.Finding) bool, organizationID int) (bool, error) {
+	purged := false
+	_, err := logic.storeFindingChange(ctx, func(ctx context.Context) (findingChange, error) {
+		// The finding is read again, since it may have been reported again or purged by another instance
+		existing, err := logic.persistence.GetFinding(ctx, identifier, organizationID)
+		if errors.Is(err, database.ErrNotFound) {
+			return findingChange{}, nil
+		}
+		if err != nil {
+			return findingChange{}, err
+		}
+		if !expired(existing) {
+			return findingChange{}, nil
+		}
+		if err := logic.persistence.DeleteFinding(ctx, identifier, organizationID); err != nil {
+			return findingChange{}, err
+		}
+		purged = true
+		return findingChange{before: &existing}, nil
+	})
+	return purged && err == nil, err
+}
+
+// purgeArchivedFinding deletes an archived finding for good if it is still expired, and reports if it did
+func (logic ApplicationLogic) purgeArchivedFinding(ctx context.Context, identifier string, expired func(intermediaries.Finding) bool, organizationID int) (bool, error) {
+	purged := false
+	_, err := logic.storeFindingChange(ctx, func(ctx context.Context) (findingChange, error) {
+		// The finding is read again, since it may have been restored or purged by another instance
+		existing, err := logic.persistence.GetArchivedFinding(ctx, identifier, organizationID)
+		if errors.Is(err, database.ErrNotFound) {
+			return findingChange{}, nil
+		}
+		if err != nil {
+			return findingChange{}, err
+		}
+		if !expired(existing) {
+			return findingChange{}, nil
+		}
+		if err := logic.persistence.DeleteArchivedFinding(ctx, identifier, organizationID); err != nil {
+			return findingChange{}, err
+		}
+		purged = true
+		return findingChange{before: &existing}, nil
+	})
+	return purged && err == nil, err
+}
+
+// PurgeFindings deletes the findings of the organization that were marked as deleted before deletedBefore for good,
+// or every deleted finding if deletedBefore is not set
+func (logic ApplicationLogic) PurgeFindings(ctx context.Context, deletedBefore time.Time, organizationID int) (intermediaries.FindingPurge, error) {
+	result := intermediaries.FindingPurge{}
+	findings, err := logic.persistence.GetFindings(ctx, organizationID)
+	if err != nil {
+		return result, err
+	}
+	expired := func(finding intermediaries.Finding) bool {
+		return finding.Deleted() && (deletedBefore.IsZero() || finding.DeletedAt.Before(deletedBefore))
+	}
+	for _, finding := range findings {
+		if !expired(finding) {
+			continue
+		}
+		purged, err := logic.purgeFinding(ctx, finding.Identifier, expired, organizationID)
+		if err != nil {
+			return result, err
+		}
+		if purged {
+			result.Purged++
+		}
+	}
+	return result, nil
+}
+
+// ReadRetentionPolicy returns the retention policy of the organization, which keeps everything forever if it is not set
+func (logic ApplicationLogic) ReadRetentionPolicy(ctx context.Context, organizationID int) (intermediaries.RetentionPolicy, error) {
+	policy, err := logic.persistence.GetRetentionPolicy(ctx, organizationID)
+	if errors.Is(err, database.ErrNotFound) {
+		return intermediaries.RetentionPolicy{OrganizationId: organizationID}, nil
+	}
+	return policy, err
+}
+
+func (logic ApplicationLogic) PutRetentionPolicy(ctx context.Context, policy intermediaries.RetentionPolicy, organizationID int) (intermediaries.RetentionPolicy, error) {
+	if err := policy.Validate(); err != nil {
+		return intermediaries.RetentionPolicy{}, err
+	}
+	return logic.persistence.SetRetentionPolicy(ctx, policy, organizationID)
+}
+
+// EnforceRetentionPolicy deletes the findings of the organization that the policy no longer keeps, for good,
+// archived findings included
+func (logic ApplicationLogic) EnforceRetentionPolicy(ctx context.Context, policy intermediaries.RetentionPolicy) (intermediaries.FindingPurge, error) {
+	result := intermediaries.FindingPurge{}
+	findings, err := logic.persistence.GetFindings(ctx, policy.OrganizationId)
+	if err != nil {
+		return result, err
+	}
+	at := now()
+	expired := func(finding intermediaries.Finding) bool {
+		return policy.Expired(finding, at)
+	}
+	for _, finding := range findings {
+		if !expired(finding) {
+			continue
+		}
+		purged, err := logic.purgeFinding(ctx, finding.Identifier, expired, policy.OrganizationId)
+		if err != nil {
+			return result, err
+		}
+		if purged {
+			result.Purged++
+		}
+	}
+	archived, err := logic.persistence.GetArchivedFindings(ctx, policy.OrganizationId)
+	if err != nil {
+		return result, err
+	}
+	for _, finding := range archived {
+		if !expired(finding) {
+			continue
+		}
+		purged, err := logic.purgeArchivedFinding(ctx, finding.Identifier, expired, policy.OrganizationId)
+		if err != nil {
+			return result, err
+		}
+		if purged {
+			result.Purged++
+		}
+	}
+	return result, nil
+}
+
+// ArchiveFindings moves the resolved findings of the organization that the policy no longer keeps among the
+// active findings to the archive. Archived findings can still be read, but are only listed when asked for.
+func (logic ApplicationLogic) ArchiveFindings(ctx context.Context, policy intermediaries.RetentionPolicy) (intermediaries.FindingArchive, error) {
+	result := intermediaries.FindingArchive{}
+	findings, err := logic.persistence.GetFindings(ctx, policy.OrganizationId)
+	if err != nil {
+		return result, err
+	}
+	at := now()
+	for _, finding := range findings {
+		if !policy.Archivable(finding, at) {
+			continue
+		}
+		change, err := logic.storeFindingChange(ctx, func(ctx context.Context) (findingChange, error) {
+			// The finding is read again, since it may have been reported again or archived by another instance
+			existing, err := logic.persistence.GetFinding(ctx, finding.Identifier, policy.OrganizationId)
+			if errors.Is(err, database.ErrNotFound) {
+				return findingChange{}, nil
+			}
+			if err != nil {
+				return findingChange{}, err
+			}
+			if !policy.Archivable(existing, at) {
+				return findingChange{}, nil
+			}
+			archived, err := logic.persistence.ArchiveFinding(ctx, finding.Identifier, at, policy.OrganizationId)
+			return findingChange{before: &existing, after: &archived}, err
+		})
+		if err != nil {
+			return result, err
+		}
+		if change.after != nil {
+			result.Archived++
+		}
+	}
+	return result, nil
+}
+
+// RunRetention archives and purges findings by the retention policy of every organization every interval, until the
+// context is done. Several instances may enforce the policies at the same time, since every finding is archived or
+// purged in a transaction of its own.
+func (logic ApplicationLogic) RunRetention(ctx context.Context, interval time.Duration) {
+	logging.Info(ctx, "Started retention job")
+	for {
+		policies, err := logic.persistence.GetRetentionPolicies(ctx)
+		if err != nil {
+			logging.Error(ctx, "Failed to read retention policies", map[string]interface{}{"error": err.Error()})
+		}
+		for _, policy := range policies {
+			archive, err := logic.ArchiveFindings(ctx, policy)
+			if err != nil {
+				logging.Error(ctx, "Failed to archive findings", map[string]interface{}{"organizationId": policy.OrganizationId, "error": err.Error()})
+			}
+			if archive.Archived > 0 {
+				logging.Info(ctx, "Archived resolved findings", map[string]interface{}{"organizationId": policy.OrganizationId, "archived": archive.Archived})
+			}
+			result, err := logic.EnforceRetentionPolicy(ctx, policy)
+			if err != nil {
+				logging.Error(ctx, "Failed to enforce retention policy", map[string]interface{}{"organizationId": policy.OrganizationId, "error": err.Error()})
+			}
+			if result.Purged > 0 {
+				logging.Info(ctx, "Purged findings past retention", map[string]interface{}{"organizationId": policy.OrganizationId, "purged": result.Purged})
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
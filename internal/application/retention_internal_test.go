@@ -0,0 +1,322 @@
+package application_test
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Kaese72/finding-registry/event"
+	"github.com/Kaese72/finding-registry/internal/database"
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
+)
+
+func TestDeleteFinding(t *testing.T) {
+	ctx := context.Background()
+	logic, events := newApplication(t)
+	created, err := logic.PostFinding(ctx, newFinding(), intermediaries.VersionPrecondition{}, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEvents(t, events, event.FindingCreatedType)
+
+	expectAPIErrorCode(t, http.StatusPreconditionFailed, logic.DeleteFinding(ctx, created.Identifier, 7, intermediaries.ExpectVersion(created.Version+1), 1))
+	expectAPIErrorCode(t, http.StatusNotFound, logic.DeleteFinding(ctx, created.Identifier, 7, intermediaries.VersionPrecondition{}, 2))
+	if err := logic.DeleteFinding(ctx, created.Identifier, 7, intermediaries.ExpectVersion(created.Version), 1); err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEvents(t, events, event.FindingDeletedType)
+
+	// The deleted finding is gone, except when asking for deleted findings
+	_, err = logic.ReadFinding(ctx, created.Identifier, 1)
+	expectAPIErrorCode(t, http.StatusNotFound, err)
+	_, err = logic.UpdateFindingStatus(ctx, created.Identifier, intermediaries.StatusResolved, intermediaries.VersionPrecondition{}, 1)
+	expectAPIErrorCode(t, http.StatusNotFound, err)
+	expectAPIErrorCode(t, http.StatusNotFound, logic.DeleteFinding(ctx, created.Identifier, 7, intermediaries.VersionPrecondition{}, 1))
+	findings, err := logic.ReadFindings(ctx, 1, intermediaries.FindingFilter{})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(findings) != 0 {
+		t.Errorf("expected no findings, got %d", len(findings))
+	}
+	findings, err = logic.ReadFindings(ctx, 1, intermediaries.FindingFilter{Deleted: true})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(findings) != 1 || findings[0].DeletedBy != 7 {
+		t.Errorf("expected the finding deleted by 7, got %+v", findings)
+	}
+	expectEvents(t, events)
+
+	// Reporting the finding again creates it anew
+	reported, err := logic.PostFinding(ctx, newFinding(), intermediaries.VersionPrecondition{}, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if reported.Identifier != created.Identifier || reported.Deleted() || !reported.CreatedAt.After(created.CreatedAt.Add(-time.Millisecond)) {
+		t.Errorf("expected the finding to be created anew, got %+v", reported)
+	}
+	expectEvents(t, events, event.FindingCreatedType)
+}
+
+func TestPurgeFindings(t *testing.T) {
+	ctx := context.Background()
+	logic, events := newApplication(t)
+	// Events stored in the same instant are published in any order, so each change is awaited on its own
+	first, err := logic.PostFinding(ctx, newFinding(), intermediaries.VersionPrecondition{}, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEvents(t, events, event.FindingCreatedType)
+	other := newFinding()
+	other.ReportLocator.Value = "10.0.0.2:22"
+	second, err := logic.PostFinding(ctx, other, intermediaries.VersionPrecondition{}, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEvents(t, events, event.FindingCreatedType)
+	kept := newFinding()
+	kept.ReportLocator.Value = "10.0.0.3:22"
+	if _, err := logic.PostFinding(ctx, kept, intermediaries.VersionPrecondition{}, 1); err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEvents(t, events, event.FindingCreatedType)
+	for _, finding := range []intermediaries.Finding{first, second} {
+		if err := logic.DeleteFinding(ctx, finding.Identifier, 7, intermediaries.VersionPrecondition{}, 1); err != nil {
+			t.Fatal(err.Error())
+		}
+		expectEvents(t, events, event.FindingDeletedType)
+	}
+
+	// Purging findings deleted before they were deleted purges nothing
+	purge, err := logic.PurgeFindings(ctx, first.CreatedAt, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if purge.Purged != 0 {
+		t.Errorf("expected nothing to be purged, got %d", purge.Purged)
+	}
+	purge, err = logic.PurgeFindings(ctx, time.Time{}, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if purge.Purged != 2 {
+		t.Errorf("expected 2 findings to be purged, got %d", purge.Purged)
+	}
+	// The deletions were published when the findings were deleted
+	expectEvents(t, events)
+
+	findings, err := logic.ReadFindings(ctx, 1, intermediaries.FindingFilter{Deleted: true})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(findings) != 0 {
+		t.Errorf("expected no deleted findings, got %d", len(findings))
+	}
+	findings, err = logic.ReadFindings(ctx, 1, intermediaries.FindingFilter{})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(findings) != 1 || findings[0].ReportLocator.Value != kept.ReportLocator.Value {
+		t.Errorf("expected only the finding that was not deleted, got %+v", findings)
+	}
+}
+
+func TestRetentionPolicy(t *testing.T) {
+	ctx := context.Background()
+	logic, _ := newApplication(t)
+	policy, err := logic.ReadRetentionPolicy(ctx, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if policy != (intermediaries.RetentionPolicy{OrganizationId: 1}) {
+		t.Errorf("expected findings to be kept forever without a policy, got %+v", policy)
+	}
+	_, err = logic.PutRetentionPolicy(ctx, intermediaries.RetentionPolicy{ResolvedDays: -1}, 1)
+	expectAPIErrorCode(t, http.StatusUnprocessableEntity, err)
+	if _, err := logic.PutRetentionPolicy(ctx, intermediaries.RetentionPolicy{ResolvedDays: 30, DeletedDays: 7}, 1); err != nil {
+		t.Fatal(err.Error())
+	}
+	policy, err = logic.ReadRetentionPolicy(ctx, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if policy != (intermediaries.RetentionPolicy{OrganizationId: 1, ResolvedDays: 30, DeletedDays: 7}) {
+		t.Errorf("expected the policy that was set, got %+v", policy)
+	}
+}
+
+func TestEnforceRetentionPolicy(t *testing.T) {
+	ctx := context.Background()
+	persistence := database.NewMemoryFindingsPersistence()
+	logic, events := newApplicationOn(t, persistence)
+	longAgo := time.Now().UTC().AddDate(0, 0, -100).Truncate(time.Millisecond)
+	store := func(value string, status intermediaries.FindingStatus, deletedAt *time.Time) intermediaries.Finding {
+		finding := newFinding()
+		finding.ReportLocator.Value = value
+		finding.Status = status
+		finding.CreatedAt = longAgo
+		finding.UpdatedAt = longAgo
+		finding.DeletedAt = deletedAt
+		stored, err := persistence.UpdateFinding(ctx, finding, 0, 1)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		return stored
+	}
+	store("10.0.0.1:22", intermediaries.StatusResolved, nil)
+	store("10.0.0.2:22", intermediaries.StatusOpen, nil)
+	store("10.0.0.3:22", intermediaries.StatusResolved, &longAgo)
+	recentFinding := newFinding()
+	recentFinding.ReportLocator.Value = "10.0.0.4:22"
+	recent, err := logic.PostFinding(ctx, recentFinding, intermediaries.VersionPrecondition{}, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEvents(t, events, event.FindingCreatedType)
+	if _, err := logic.UpdateFindingStatus(ctx, recent.Identifier, intermediaries.StatusResolved, intermediaries.VersionPrecondition{}, 1); err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEvents(t, events, event.FindingStatusChangedType)
+
+	purge, err := logic.EnforceRetentionPolicy(ctx, intermediaries.RetentionPolicy{OrganizationId: 1, ResolvedDays: 30, DeletedDays: 7})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if purge.Purged != 2 {
+		t.Errorf("expected 2 findings to be purged, got %d", purge.Purged)
+	}
+	// Only the deletion of the resolved finding is published, the deletion of the deleted one was published when it was deleted
+	expectEvents(t, events, event.FindingDeletedType)
+
+	findings, err := persistence.GetFindings(ctx, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	values := []string{}
+	for _, finding := range findings {
+		values = append(values, finding.ReportLocator.Value)
+	}
+	if len(values) != 2 || values[0] != "10.0.0.2:22" || values[1] != recent.ReportLocator.Value {
+		t.Errorf("expected the open and the recently resolved finding to be kept, got %v", values)
+	}
+}
+
+func TestArchiveFindings(t *testing.T) {
+	ctx := context.Background()
+	persistence := database.NewMemoryFindingsPersistence()
+	logic, events := newApplicationOn(t, persistence)
+	longAgo := time.Now().UTC().AddDate(0, 0, -100).Truncate(time.Millisecond)
+	// resolve reports and resolves a finding, and makes it seem like it was resolved long ago if old is set
+	resolve := func(value string, old bool) intermediaries.Finding {
+		finding := newFinding()
+		finding.ReportLocator.Value = value
+		created, err := logic.PostFinding(ctx, finding, intermediaries.VersionPrecondition{}, 1)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		expectEvents(t, events, event.FindingCreatedType)
+		resolved, err := logic.UpdateFindingStatus(ctx, created.Identifier, intermediaries.StatusResolved, intermediaries.VersionPrecondition{}, 1)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		expectEvents(t, events, event.FindingStatusChangedType)
+		if !old {
+			return resolved
+		}
+		resolved.CreatedAt = longAgo
+		resolved.UpdatedAt = longAgo
+		backdated, err := persistence.UpdateFinding(ctx, resolved, 0, 1)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		return backdated
+	}
+	reopened := resolve("10.0.0.1:22", true)
+	purged := resolve("10.0.0.2:22", true)
+	recent := resolve("10.0.0.3:22", false)
+
+	policy := intermediaries.RetentionPolicy{OrganizationId: 1, ResolvedDays: 90, ArchiveDays: 30}
+	archive, err := logic.ArchiveFindings(ctx, policy)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if archive.Archived != 2 {
+		t.Errorf("expected 2 findings to be archived, got %d", archive.Archived)
+	}
+	// Archiving changes nothing anyone is told about
+	expectEvents(t, events)
+	archive, err = logic.ArchiveFindings(ctx, policy)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if archive.Archived != 0 {
+		t.Errorf("expected nothing more to be archived, got %d", archive.Archived)
+	}
+
+	// Archived findings can be read, but not changed, and are only listed when asked for
+	found, err := logic.ReadFinding(ctx, reopened.Identifier, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !found.Archived() || found.Version != reopened.Version || !found.UpdatedAt.Equal(longAgo) {
+		t.Errorf("expected the finding to be archived as it was, got %+v", found)
+	}
+	_, err = logic.ReadFinding(ctx, reopened.Identifier, 2)
+	expectAPIErrorCode(t, http.StatusNotFound, err)
+	_, err = logic.UpdateFindingStatus(ctx, reopened.Identifier, intermediaries.StatusAccepted, intermediaries.VersionPrecondition{}, 1)
+	expectAPIErrorCode(t, http.StatusConflict, err)
+	expectAPIErrorCode(t, http.StatusConflict, logic.DeleteFinding(ctx, reopened.Identifier, 7, intermediaries.VersionPrecondition{}, 1))
+	findings, err := logic.ReadFindings(ctx, 1, intermediaries.FindingFilter{})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(findings) != 1 || findings[0].Identifier != recent.Identifier {
+		t.Errorf("expected only the recently resolved finding, got %+v", findings)
+	}
+	findings, err = logic.ReadFindings(ctx, 1, intermediaries.FindingFilter{IncludeArchived: true})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(findings) != 3 {
+		t.Errorf("expected every finding, got %d", len(findings))
+	}
+
+	// Reporting an archived finding again restores it, and it has reappeared
+	finding := newFinding()
+	finding.ReportLocator.Value = reopened.ReportLocator.Value
+	reported, err := logic.PostFinding(ctx, finding, intermediaries.VersionPrecondition{}, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if reported.Identifier != reopened.Identifier || reported.Archived() || reported.Status != intermediaries.StatusOpen {
+		t.Errorf("expected the archived finding to be reopened, got %+v", reported)
+	}
+	expectEvents(t, events, event.FindingStatusChangedType)
+	entries, err := logic.ReadFindingAudit(ctx, reopened.Identifier, 1, 0, 100)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	actions := []intermediaries.AuditAction{}
+	for _, entry := range entries {
+		actions = append(actions, entry.Action)
+	}
+	expected := []intermediaries.AuditAction{intermediaries.AuditCreated, intermediaries.AuditStatusChanged, intermediaries.AuditArchived, intermediaries.AuditRestored}
+	if !reflect.DeepEqual(expected, actions) {
+		t.Errorf("expected audit actions %v, got %v", expected, actions)
+	}
+
+	// Archived findings are still deleted once they expire
+	purge, err := logic.EnforceRetentionPolicy(ctx, policy)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if purge.Purged != 1 {
+		t.Errorf("expected the archived finding to be purged, got %d", purge.Purged)
+	}
+	expectEvents(t, events, event.FindingDeletedType)
+	_, err = logic.ReadFinding(ctx, purged.Identifier, 1)
+	expectAPIErrorCode(t, http.StatusNotFound, err)
+}
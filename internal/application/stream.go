@@ -0,0 +1,131 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Kaese72/finding-registry/event"
+	"github.com/Kaese72/finding-registry/internal/database"
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
+	"github.com/Kaese72/riskie-lib/apierror"
+)
+
+const (
+	// StreamRetention is how far back a stream can be resumed
+	StreamRetention = time.Hour
+	// streamBatchSize is the maximum number of events read from the outbox per poll
+	streamBatchSize = 100
+)
+
+// StreamConfig configures the finding streams served by the instance
+type StreamConfig struct {
+	// SettleDelay holds events back from streams, so that changes committed slightly out of order are still streamed.
+	// Streams follow the outbox by when changes were made, so a change committed more than the delay after it was made,
+	// by a slow transaction or by an instance whose clock is behind the others by more than the delay, is passed by
+	// every stream and never streamed.
+	SettleDelay time.Duration
+	// MaxConnections is the maximum number of streams served by the instance at a time
+	MaxConnections int
+	// MaxConnectionsPerOrganization is the maximum number of streams of a single organization served by the instance at a time
+	MaxConnectionsPerOrganization int
+}
+
+func (config StreamConfig) withDefaults() StreamConfig {
+	if config.SettleDelay <= 0 {
+		config.SettleDelay = 2 * time.Second
+	}
+	if config.MaxConnections <= 0 {
+		config.MaxConnections = 1000
+	}
+	if config.MaxConnectionsPerOrganization <= 0 {
+		config.MaxConnectionsPerOrganization = 20
+	}
+	return config
+}
+
+// streamRegistry counts the streams served by the instance
+type streamRegistry struct {
+	lock           sync.Mutex
+	total          int
+	byOrganization map[int]int
+}
+
+func newStreamRegistry() *streamRegistry {
+	return &streamRegistry{byOrganization: map[int]int{}}
+}
+
+// WithStreamConfig returns the application serving finding streams as configured
+func (logic ApplicationLogic) WithStreamConfig(config StreamConfig) ApplicationLogic {
+	logic.stream = config.withDefaults()
+	return logic
+}
+
+// OpenFindingStream counts a stream of the organization against the limits of the instance, and returns the function
+// to call when the stream is closed. Streams over the limits are refused with a 429 API Error.
+func (logic ApplicationLogic) OpenFindingStream(organizationID int) (func(), error) {
+	registry := logic.streams
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+	if registry.total >= logic.stream.MaxConnections || registry.byOrganization[organizationID] >= logic.stream.MaxConnectionsPerOrganization {
+		return nil, apierror.APIError{Code: http.StatusTooManyRequests, WrappedError: errors.New("too many streams")}
+	}
+	registry.total++
+	registry.byOrganization[organizationID]++
+	closed := sync.Once{}
+	return func() {
+		closed.Do(func() {
+			registry.lock.Lock()
+			defer registry.lock.Unlock()
+			registry.total--
+			registry.byOrganization[organizationID]--
+			if registry.byOrganization[organizationID] == 0 {
+				delete(registry.byOrganization, organizationID)
+			}
+		})
+	}, nil
+}
+
+// FindingEventCursor is where a stream resumes after the event with the given identifier.
+// If the event is not known, or older than the stream retention, the stream starts from now and resumed is false.
+func (logic ApplicationLogic) FindingEventCursor(ctx context.Context, lastEventID string, organizationID int) (intermediaries.OutboxCursor, bool, error) {
+	start := intermediaries.OutboxCursor{CreatedAt: now().Add(-logic.stream.SettleDelay)}
+	if lastEventID == "" {
+		return start, false, nil
+	}
+	lastEvent, err := logic.persistence.GetOutboxEvent(ctx, lastEventID, organizationID)
+	if errors.Is(err, database.ErrNotFound) {
+		return start, false, nil
+	}
+	if err != nil {
+		return intermediaries.OutboxCursor{}, false, err
+	}
+	if lastEvent.CreatedAt.Before(now().Add(-StreamRetention)) {
+		return start, false, nil
+	}
+	return lastEvent.Cursor(), true, nil
+}
+
+// PollFindingEvents returns the events of the organization after the cursor about findings matching the filter,
+// together with the cursor to poll from next
+func (logic ApplicationLogic) PollFindingEvents(ctx context.Context, cursor intermediaries.OutboxCursor, filter intermediaries.FindingFilter, organizationID int) ([]intermediaries.OutboxEvent, intermediaries.OutboxCursor, error) {
+	outboxEvents, err := logic.persistence.GetOutboxEventsAfter(ctx, cursor, now().Add(-logic.stream.SettleDelay), streamBatchSize, organizationID)
+	if err != nil {
+		return nil, cursor, err
+	}
+	matching := []intermediaries.OutboxEvent{}
+	for _, outboxEvent := range outboxEvents {
+		cursor = outboxEvent.Cursor()
+		decoded, err := event.DecodeEvent(event.EventType(outboxEvent.Type), outboxEvent.Payload)
+		if err != nil {
+			// Undecodable events are dropped by the relay as well
+			continue
+		}
+		if filter.Matches(intermediaryFindingFromEvent(decoded.EventFinding())) {
+			matching = append(matching, outboxEvent)
+		}
+	}
+	return matching, cursor, nil
+}
@@ -0,0 +1,33 @@
+package application_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/Kaese72/finding-registry/internal/application"
+)
+
+func TestOpenFindingStream(t *testing.T) {
+	logic, _ := newApplication(t)
+	logic = logic.WithStreamConfig(application.StreamConfig{MaxConnections: 2, MaxConnectionsPerOrganization: 1})
+	release, err := logic.OpenFindingStream(1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	_, err = logic.OpenFindingStream(1)
+	expectAPIErrorCode(t, http.StatusTooManyRequests, err)
+	if _, err := logic.OpenFindingStream(2); err != nil {
+		t.Fatal(err.Error())
+	}
+	_, err = logic.OpenFindingStream(3)
+	expectAPIErrorCode(t, http.StatusTooManyRequests, err)
+
+	// A closed stream frees its place once, however often it is released
+	release()
+	release()
+	if _, err := logic.OpenFindingStream(3); err != nil {
+		t.Fatal(err.Error())
+	}
+	_, err = logic.OpenFindingStream(1)
+	expectAPIErrorCode(t, http.StatusTooManyRequests, err)
+}
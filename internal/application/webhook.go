@@ -0,0 +1,303 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Kaese72/finding-registry/event"
+	"github.com/Kaese72/finding-registry/internal/database"
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
+	"github.com/Kaese72/finding-registry/internal/webhook"
+	"github.com/Kaese72/riskie-lib/apierror"
+	"github.com/Kaese72/riskie-lib/logging"
+)
+
+const (
+	// webhookPruneInterval is how often the dispatcher deletes deliveries older than the delivery retention
+	webhookPruneInterval = 10 * time.Minute
+)
+
+// WebhookConfig configures how deliveries are attempted
+type WebhookConfig struct {
+	// Interval is how often the dispatcher looks for due deliveries
+	Interval time.Duration
+	// Timeout bounds a single delivery attempt
+	Timeout time.Duration
+	// MaxAttempts is the number of attempts at a delivery before it is given up
+	MaxAttempts int
+	// MinBackoff and MaxBackoff bound the exponential backoff between attempts at a delivery
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// DisableAfter is the number of consecutive failed attempts after which a subscription is disabled
+	DisableAfter int
+	// AllowPrivateNetworks allows deliveries to loopback, private and link-local addresses, which are refused otherwise
+	AllowPrivateNetworks bool
+	// Concurrency is the maximum number of deliveries attempted at the same time
+	Concurrency int
+	// DeliveryRetention is how long deliveries are kept in the delivery log once they are no longer pending
+	DeliveryRetention time.Duration
+}
+
+func (config WebhookConfig) withDefaults() WebhookConfig {
+	if config.Interval <= 0 {
+		config.Interval = time.Second
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = 8
+	}
+	if config.MinBackoff <= 0 {
+		config.MinBackoff = 10 * time.Second
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = time.Hour
+	}
+	if config.DisableAfter <= 0 {
+		config.DisableAfter = 20
+	}
+	if config.Concurrency <= 0 {
+		config.Concurrency = 10
+	}
+	if config.DeliveryRetention <= 0 {
+		config.DeliveryRetention = 7 * 24 * time.Hour
+	}
+	return config
+}
+
+func validateWebhookSubscription(subscription intermediaries.WebhookSubscription) error {
+	if err := subscription.Validate(); err != nil {
+		return err
+	}
+	for _, eventType := range subscription.EventTypes {
+		if _, err := event.Schema(event.EventType(eventType)); err != nil {
+			return apierror.APIError{Code: http.StatusUnprocessableEntity, WrappedError: fmt.Errorf("unknown event type: %s", eventType)}
+		}
+	}
+	return nil
+}
+
+func (logic ApplicationLogic) ReadWebhookSubscriptions(ctx context.Context, organizationID int) ([]intermediaries.WebhookSubscription, error) {
+	return logic.persistence.GetWebhookSubscriptions(ctx, organizationID)
+}
+
+func (logic ApplicationLogic) ReadWebhookSubscription(ctx context.Context, identifier string, organizationID int) (intermediaries.WebhookSubscription, error) {
+	subscription, err := logic.persistence.GetWebhookSubscription(ctx, identifier, organizationID)
+	return subscription, notFoundAsAPIError(err)
+}
+
+// PostWebhookSubscription creates an enabled subscription. A secret is generated unless one is given.
+func (logic ApplicationLogic) PostWebhookSubscription(ctx context.Context, subscription intermediaries.WebhookSubscription, organizationID int) (intermediaries.WebhookSubscription, error) {
+	if err := validateWebhookSubscription(subscription); err != nil {
+		return intermediaries.WebhookSubscription{}, err
+	}
+	if subscription.Secret == "" {
+		subscription.Secret = intermediaries.NewWebhookSecret()
+	}
+	subscription.Enabled = true
+	subscription.ConsecutiveFailures = 0
+	subscription.CreatedAt = now()
+	subscription.UpdatedAt = subscription.CreatedAt
+	return logic.persistence.CreateWebhookSubscription(ctx, subscription, organizationID)
+}
+
+// PutWebhookSubscription replaces a subscription. The secret is kept unless a new one is given,
+// and enabling a subscription forgets about its earlier failures.
+func (logic ApplicationLogic) PutWebhookSubscription(ctx context.Context, subscription intermediaries.WebhookSubscription, organizationID int) (intermediaries.WebhookSubscription, error) {
+	if err := validateWebhookSubscription(subscription); err != nil {
+		return intermediaries.WebhookSubscription{}, err
+	}
+	existing, err := logic.persistence.GetWebhookSubscription(ctx, subscription.Identifier, organizationID)
+	if err != nil {
+		return intermediaries.WebhookSubscription{}, notFoundAsAPIError(err)
+	}
+	if subscription.Secret == "" {
+		subscription.Secret = existing.Secret
+	}
+	subscription.ConsecutiveFailures = existing.ConsecutiveFailures
+	if subscription.Enabled {
+		subscription.ConsecutiveFailures = 0
+	}
+	subscription.CreatedAt = existing.CreatedAt
+	subscription.UpdatedAt = now()
+	updated, err := logic.persistence.UpdateWebhookSubscription(ctx, subscription, organizationID)
+	return updated, notFoundAsAPIError(err)
+}
+
+func (logic ApplicationLogic) DeleteWebhookSubscription(ctx context.Context, identifier string, organizationID int) error {
+	return notFoundAsAPIError(logic.persistence.DeleteWebhookSubscription(ctx, identifier, organizationID))
+}
+
+// ReadWebhookDeliveries lists up to limit deliveries of the subscription before the cursor, most recent first.
+// The zero cursor lists from the most recent delivery.
+func (logic ApplicationLogic) ReadWebhookDeliveries(ctx context.Context, subscriptionID string, before intermediaries.WebhookDeliveryCursor, limit int, organizationID int) ([]intermediaries.WebhookDelivery, error) {
+	if _, err := logic.persistence.GetWebhookSubscription(ctx, subscriptionID, organizationID); err != nil {
+		return nil, notFoundAsAPIError(err)
+	}
+	return logic.persistence.GetWebhookDeliveries(ctx, subscriptionID, before, limit, organizationID)
+}
+
+// storeWebhookDeliveries stores a pending delivery of the outbox events for every subscription of the organization subscribing to them
+func (logic ApplicationLogic) storeWebhookDeliveries(ctx context.Context, outboxEvents []intermediaries.OutboxEvent) error {
+	if len(outboxEvents) == 0 {
+		return nil
+	}
+	subscriptions, err := logic.persistence.GetWebhookSubscriptions(ctx, outboxEvents[0].OrganizationId)
+	if err != nil {
+		return err
+	}
+	for _, outboxEvent := range outboxEvents {
+		for _, subscription := range subscriptions {
+			if !subscription.Subscribes(outboxEvent.Type) {
+				continue
+			}
+			err := logic.persistence.InsertWebhookDelivery(ctx, intermediaries.WebhookDelivery{
+				Identifier:     intermediaries.NewEventID(),
+				SubscriptionId: subscription.Identifier,
+				OrganizationId: outboxEvent.OrganizationId,
+				EventId:        outboxEvent.Identifier,
+				EventType:      outboxEvent.Type,
+				Payload:        outboxEvent.Payload,
+				Status:         intermediaries.DeliveryPending,
+				NextAttemptAt:  outboxEvent.CreatedAt,
+				CreatedAt:      outboxEvent.CreatedAt,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// RunWebhookDispatcher attempts due webhook deliveries until the context is cancelled. Up to the configured
+// concurrency of deliveries are attempted at the same time, so that a slow endpoint does not hold up the others.
+// Deliveries are kept for the delivery retention once they are no longer pending, and are then deleted by the dispatcher.
+func (logic ApplicationLogic) RunWebhookDispatcher(ctx context.Context, config WebhookConfig) {
+	config = config.withDefaults()
+	client := webhook.NewClient(config.Timeout, config.AllowPrivateNetworks)
+	// Deliveries are only claimed when there is a free slot to attempt them in, so the lease only has to outlast a single attempt
+	lease := config.Timeout + time.Minute
+	slots := make(chan struct{}, config.Concurrency)
+	attempts := sync.WaitGroup{}
+	defer attempts.Wait()
+	logging.Info(ctx, "Started webhook dispatcher")
+	pruned := time.Time{}
+	for {
+		if now().Sub(pruned) >= webhookPruneInterval {
+			if err := logic.pruneWebhookDeliveries(ctx, config); err != nil {
+				logging.Error(ctx, "Failed to prune webhook deliveries", map[string]interface{}{"error": err.Error()})
+			}
+			pruned = now()
+		}
+		// Wait for a slot to free up, and claim as many deliveries as there are free slots.
+		// Only the dispatcher takes slots, so the free slots can not be taken before the deliveries are started.
+		select {
+		case <-ctx.Done():
+			return
+		case slots <- struct{}{}:
+		}
+		free := cap(slots) - len(slots) + 1
+		deliveries, err := logic.persistence.ClaimWebhookDeliveries(ctx, free, lease)
+		if err != nil {
+			logging.Error(ctx, "Failed to claim webhook deliveries", map[string]interface{}{"error": err.Error()})
+		}
+		if len(deliveries) == 0 {
+			<-slots
+		}
+		for index, delivery := range deliveries {
+			if index > 0 {
+				slots <- struct{}{}
+			}
+			attempts.Add(1)
+			go func(delivery intermediaries.WebhookDelivery) {
+				defer attempts.Done()
+				defer func() { <-slots }()
+				if err := logic.attemptWebhookDelivery(ctx, client, config, delivery); err != nil {
+					logging.Error(ctx, "Failed to record webhook delivery", map[string]interface{}{"deliveryId": delivery.Identifier, "error": err.Error()})
+				}
+			}(delivery)
+		}
+		if err == nil && len(deliveries) == free {
+			// There are likely more deliveries waiting
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(config.Interval):
+		}
+	}
+}
+
+// pruneWebhookDeliveries deletes the deliveries that are no longer pending and are older than the delivery retention
+func (logic ApplicationLogic) pruneWebhookDeliveries(ctx context.Context, config WebhookConfig) error {
+	deleted, err := logic.persistence.DeleteWebhookDeliveries(ctx, now().Add(-config.DeliveryRetention))
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		logging.Info(ctx, "Pruned webhook deliveries", map[string]interface{}{"deleted": deleted})
+	}
+	return nil
+}
+
+// attemptWebhookDelivery attempts a single delivery and records the outcome, on the delivery and on the health of its subscription
+func (logic ApplicationLogic) attemptWebhookDelivery(ctx context.Context, client *http.Client, config WebhookConfig, delivery intermediaries.WebhookDelivery) error {
+	subscription, err := logic.persistence.GetWebhookSubscription(ctx, delivery.SubscriptionId, delivery.OrganizationId)
+	if errors.Is(err, database.ErrNotFound) {
+		// The deliveries of a deleted subscription are deleted with it, but one may have been claimed just before
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !subscription.Enabled {
+		delivery.Status = intermediaries.DeliveryFailed
+		delivery.LastError = "subscription disabled"
+		return logic.persistence.UpdateWebhookDelivery(ctx, delivery)
+	}
+	attemptedAt := time.Now().UTC()
+	statusCode, postErr := webhook.Post(ctx, client, webhook.Delivery{
+		URL:        subscription.URL,
+		Secret:     subscription.Secret,
+		DeliveryID: delivery.Identifier,
+		EventType:  delivery.EventType,
+		Payload:    delivery.Payload,
+	}, attemptedAt)
+	delivery.Attempts++
+	delivery.LastAttemptAt = &attemptedAt
+	delivery.LastStatusCode = statusCode
+	delivery.LastError = ""
+	if postErr == nil {
+		delivery.Status = intermediaries.DeliverySucceeded
+		if err := logic.persistence.UpdateWebhookDelivery(ctx, delivery); err != nil {
+			return err
+		}
+		return logic.persistence.RecordWebhookSuccess(ctx, subscription.Identifier, subscription.OrganizationId)
+	}
+	delivery.LastError = postErr.Error()
+	if delivery.Attempts >= config.MaxAttempts {
+		delivery.Status = intermediaries.DeliveryFailed
+	} else {
+		delivery.NextAttemptAt = attemptedAt.Add(webhook.Backoff(delivery.Attempts, config.MinBackoff, config.MaxBackoff))
+	}
+	if err := logic.persistence.UpdateWebhookDelivery(ctx, delivery); err != nil {
+		return err
+	}
+	// Failures are counted by the database, so that concurrent failures of the subscription are all counted
+	subscription, err = logic.persistence.RecordWebhookFailure(ctx, subscription.Identifier, config.DisableAfter, subscription.OrganizationId)
+	if err != nil {
+		return err
+	}
+	if subscription.ConsecutiveFailures == config.DisableAfter {
+		// Only the failure that reaches the limit disables the subscription
+		logging.Info(ctx, "Disabled failing webhook subscription", map[string]interface{}{"subscriptionId": subscription.Identifier, "organizationId": subscription.OrganizationId, "failures": subscription.ConsecutiveFailures})
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+package application_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Kaese72/finding-registry/internal/application"
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
+	"github.com/Kaese72/finding-registry/internal/webhook"
+)
+
+// runDispatcher runs the webhook dispatcher until the test ends, delivering to the loopback receivers of the tests
+func runDispatcher(t *testing.T, logic application.ApplicationLogic, config application.WebhookConfig) {
+	config.AllowPrivateNetworks = true
+	config.Interval = 10 * time.Millisecond
+	config.Timeout = time.Second
+	config.MinBackoff = 10 * time.Millisecond
+	config.MaxBackoff = 10 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		logic.RunWebhookDispatcher(ctx, config)
+		close(stopped)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-stopped
+	})
+}
+
+// subscribe creates a subscription to created findings, delivered to the URL
+func subscribe(t *testing.T, logic application.ApplicationLogic, url string) intermediaries.WebhookSubscription {
+	t.Helper()
+	subscription, err := logic.PostWebhookSubscription(context.Background(), intermediaries.WebhookSubscription{URL: url, EventTypes: []string{"finding.created"}}, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return subscription
+}
+
+// awaitDeliveries waits for every delivery of the subscription to be done, and returns them most recent first
+func awaitDeliveries(t *testing.T, logic application.ApplicationLogic, subscriptionID string, expected int) []intermediaries.WebhookDelivery {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		deliveries, err := logic.ReadWebhookDeliveries(context.Background(), subscriptionID, intermediaries.WebhookDeliveryCursor{}, 100, 1)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		done := 0
+		for _, delivery := range deliveries {
+			if delivery.Status != intermediaries.DeliveryPending {
+				done++
+			}
+		}
+		if done == expected {
+			return deliveries
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d deliveries to be done, got %+v", expected, deliveries)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWebhookDispatcherDelivers(t *testing.T) {
+	logic, _ := newApplication(t)
+	received := make(chan error, 1)
+	var subscription intermediaries.WebhookSubscription
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- webhook.Verify(subscription.Secret, r.Header, body, time.Minute, time.Now())
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+	subscription = subscribe(t, logic, receiver.URL)
+	runDispatcher(t, logic, application.WebhookConfig{})
+
+	postFindingOn(t, logic, "10.0.0.1:22", "home")
+	select {
+	case err := <-received:
+		if err != nil {
+			t.Errorf("expected a signed delivery, got %s", err.Error())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a delivery, got none")
+	}
+	deliveries := awaitDeliveries(t, logic, subscription.Identifier, 1)
+	if deliveries[0].Status != intermediaries.DeliverySucceeded || deliveries[0].Attempts != 1 || deliveries[0].LastStatusCode != http.StatusNoContent {
+		t.Errorf("expected the delivery to succeed at the first attempt, got %+v", deliveries[0])
+	}
+}
+
+func TestWebhookDispatcherRetries(t *testing.T) {
+	logic, _ := newApplication(t)
+	requests := atomic.Int32{}
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+	subscription := subscribe(t, logic, receiver.URL)
+	runDispatcher(t, logic, application.WebhookConfig{})
+
+	postFindingOn(t, logic, "10.0.0.1:22", "home")
+	deliveries := awaitDeliveries(t, logic, subscription.Identifier, 1)
+	if deliveries[0].Status != intermediaries.DeliverySucceeded || deliveries[0].Attempts != 2 {
+		t.Errorf("expected the delivery to succeed at the second attempt, got %+v", deliveries[0])
+	}
+	found, err := logic.ReadWebhookSubscription(context.Background(), subscription.Identifier, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if found.ConsecutiveFailures != 0 {
+		t.Errorf("expected the failure to be forgotten after a successful delivery, got %d", found.ConsecutiveFailures)
+	}
+}
+
+func TestWebhookDispatcherGivesUp(t *testing.T) {
+	logic, _ := newApplication(t)
+	requests := atomic.Int32{}
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer receiver.Close()
+	subscription := subscribe(t, logic, receiver.URL)
+	runDispatcher(t, logic, application.WebhookConfig{MaxAttempts: 2, DisableAfter: 3})
+
+	// The first delivery is attempted twice, and the subscription is disabled at the third failure in a row
+	postFindingOn(t, logic, "10.0.0.1:22", "home")
+	deliveries := awaitDeliveries(t, logic, subscription.Identifier, 1)
+	if deliveries[0].Status != intermediaries.DeliveryFailed || deliveries[0].Attempts != 2 || deliveries[0].LastStatusCode != http.StatusInternalServerError {
+		t.Errorf("expected the delivery to fail after two attempts, got %+v", deliveries[0])
+	}
+	postFindingOn(t, logic, "10.0.0.2:22", "home")
+	awaitDeliveries(t, logic, subscription.Identifier, 2)
+	found, err := logic.ReadWebhookSubscription(context.Background(), subscription.Identifier, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if found.Enabled || found.ConsecutiveFailures != 3 {
+		t.Errorf("expected the subscription to be disabled after three failures, got %+v", found)
+	}
+	if requests.Load() != 3 {
+		t.Errorf("expected no attempt after the subscription was disabled, got %d attempts", requests.Load())
+	}
+}
+
+func TestWebhookDispatcherFailsDeliveriesOfDisabledSubscriptions(t *testing.T) {
+	ctx := context.Background()
+	logic, _ := newApplication(t)
+	requests := atomic.Int32{}
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+	subscription := subscribe(t, logic, receiver.URL)
+
+	// The delivery is stored before the subscription is disabled
+	postFindingOn(t, logic, "10.0.0.1:22", "home")
+	subscription.Enabled = false
+	if _, err := logic.PutWebhookSubscription(ctx, subscription, 1); err != nil {
+		t.Fatal(err.Error())
+	}
+	runDispatcher(t, logic, application.WebhookConfig{})
+	deliveries := awaitDeliveries(t, logic, subscription.Identifier, 1)
+	if deliveries[0].Status != intermediaries.DeliveryFailed || deliveries[0].LastError != "subscription disabled" || deliveries[0].Attempts != 0 {
+		t.Errorf("expected the delivery to fail without being attempted, got %+v", deliveries[0])
+	}
+	if requests.Load() != 0 {
+		t.Errorf("expected no attempt, got %d", requests.Load())
+	}
+}
+
+func TestWebhookDispatcherLimitsConcurrency(t *testing.T) {
+	logic, _ := newApplication(t)
+	arrived := make(chan struct{}, 3)
+	release := make(chan struct{})
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		arrived <- struct{}{}
+		<-release
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+	subscription := subscribe(t, logic, receiver.URL)
+	postFindingOn(t, logic, "10.0.0.1:22", "home")
+	postFindingOn(t, logic, "10.0.0.2:22", "home")
+	postFindingOn(t, logic, "10.0.0.3:22", "home")
+	runDispatcher(t, logic, application.WebhookConfig{Concurrency: 2})
+
+	// Two deliveries are attempted at the same time, and the third waits for one of them to finish
+	for index := 0; index < 2; index++ {
+		select {
+		case <-arrived:
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected deliveries to be attempted at the same time")
+		}
+	}
+	select {
+	case <-arrived:
+		t.Error("expected the third delivery to wait for a free slot")
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(release)
+	awaitDeliveries(t, logic, subscription.Identifier, 3)
+}
@@ -0,0 +1,582 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
+	bolt "go.etcd.io/bbolt"
+)
+
+type BoltConfig struct {
+	// Path is the database file, which is created if it does not exist
+	Path string
+}
+
+// boltFindingsPersistence keeps everything in a single bbolt file, for deployments without a database server.
+// Records are stored as JSON by identifier, and looked up through index buckets whose keys are made of the
+// indexed values, so that a prefix scan finds every matching record in order.
+type boltFindingsPersistence struct {
+	db *bolt.DB
+}
+
+var (
+	boltFindings                     = []byte("findings")
+	boltFindingsByReport             = []byte("findingsByReport")
+	boltFindingsByOrganization       = []byte("findingsByOrganization")
+	boltFindingsByLocator            = []byte("findingsByLocator")
+	boltArchivedFindings             = []byte("archivedFindings")
+	boltArchivedFindingsByReport     = []byte("archivedFindingsByReport")
+	boltArchivedFindingsByOrg        = []byte("archivedFindingsByOrganization")
+	boltOwnershipRules               = []byte("ownershipRules")
+	boltOwnershipRulesByOrganization = []byte("ownershipRulesByOrganization")
+	boltDistinguisherAliases         = []byte("distinguisherAliases")
+	boltOutbox                       = []byte("outbox")
+	boltOutboxUndelivered            = []byte("outboxUndelivered")
+	boltOutboxByOrganization         = []byte("outboxByOrganization")
+	boltWebhookSubscriptions         = []byte("webhookSubscriptions")
+	boltWebhookSubscriptionsByOrg    = []byte("webhookSubscriptionsByOrganization")
+	boltWebhookDeliveries            = []byte("webhookDeliveries")
+	boltWebhookDeliveriesPending     = []byte("webhookDeliveriesPending")
+	boltWebhookDeliveriesBySub       = []byte("webhookDeliveriesBySubscription")
+	boltRetentionPolicies            = []byte("retentionPolicies")
+	boltAuditEntries                 = []byte("auditEntries")
+	boltAuditEntriesByFinding        = []byte("auditEntriesByFinding")
+)
+
+var boltBuckets = [][]byte{
+	boltFindings, boltFindingsByReport, boltFindingsByOrganization, boltFindingsByLocator,
+	boltArchivedFindings, boltArchivedFindingsByReport, boltArchivedFindingsByOrg,
+	boltOwnershipRules, boltOwnershipRulesByOrganization,
+	boltDistinguisherAliases,
+	boltOutbox, boltOutboxUndelivered, boltOutboxByOrganization,
+	boltWebhookSubscriptions, boltWebhookSubscriptionsByOrg, boltWebhookDeliveries, boltWebhookDeliveriesPending, boltWebhookDeliveriesBySub,
+	boltRetentionPolicies,
+	boltAuditEntries, boltAuditEntriesByFinding,
+}
+
+// boltIndexes are the index buckets that are built from the records when they are created, since they are missing
+// from files written before they were introduced
+var boltIndexes = []struct {
+	bucket []byte
+	build  func(*bolt.Tx) error
+}{
+	{boltFindingsByLocator, reindexBoltFindingLocators},
+	{boltAuditEntriesByFinding, indexBoltAuditEntries},
+}
+
+// boltTransactionKey holds the writable transaction of the context
+type boltTransactionKey struct{}
+
+func NewBoltFindingsPersistence(config BoltConfig) (boltFindingsPersistence, error) {
+	// The file is locked by a single process at a time, so a second instance fails instead of waiting forever
+	db, err := bolt.Open(config.Path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return boltFindingsPersistence{}, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		builds := []func(*bolt.Tx) error{}
+		for _, index := range boltIndexes {
+			if tx.Bucket(index.bucket) == nil {
+				builds = append(builds, index.build)
+			}
+		}
+		for _, bucket := range boltBuckets {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		for _, build := range builds {
+			if err := build(tx); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return boltFindingsPersistence{}, err
+	}
+	return boltFindingsPersistence{db: db}, nil
+}
+
+// reindexBoltFindingLocators indexes every finding by the locators it is on. Findings used to be indexed by their
+// implied locators only, in an index that is no longer used.
+func reindexBoltFindingLocators(tx *bolt.Tx) error {
+	if err := tx.DeleteBucket([]byte("findingsByImpliedLocator")); err != nil && !errors.Is(err, bolt.ErrBucketNotFound) {
+		return err
+	}
+	index := tx.Bucket(boltFindingsByLocator)
+	return tx.Bucket(boltFindings).ForEach(func(key []byte, value []byte) error {
+		stored := boltFinding{}
+		if err := json.Unmarshal(value, &stored); err != nil {
+			return err
+		}
+		finding := stored.toIntermediary()
+		for _, locator := range boltFindingLocators(finding) {
+			if err := index.Put(boltKey(boltLocatorKey(finding.OrganizationId, locator), key), nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Close releases the database file
+func (persistence boltFindingsPersistence) Close() error {
+	return persistence.db.Close()
+}
+
+// WithTransaction runs the function in a single writable transaction. bbolt allows one writable transaction
+// at a time, so transactions are serializable.
+func (persistence boltFindingsPersistence) WithTransaction(ctx context.Context, fn func(context.Context) error) error {
+	if _, ok := ctx.Value(boltTransactionKey{}).(*bolt.Tx); ok {
+		return fn(ctx)
+	}
+	return persistence.db.Update(func(tx *bolt.Tx) error {
+		return fn(context.WithValue(ctx, boltTransactionKey{}, tx))
+	})
+}
+
+// view reads within the transaction of the context, or a read-only transaction of its own
+func (persistence boltFindingsPersistence) view(ctx context.Context, fn func(*bolt.Tx) error) error {
+	if tx, ok := ctx.Value(boltTransactionKey{}).(*bolt.Tx); ok {
+		return fn(tx)
+	}
+	return persistence.db.View(fn)
+}
+
+// update writes within the transaction of the context, or a writable transaction of its own
+func (persistence boltFindingsPersistence) update(ctx context.Context, fn func(*bolt.Tx) error) error {
+	if tx, ok := ctx.Value(boltTransactionKey{}).(*bolt.Tx); ok {
+		return fn(tx)
+	}
+	return persistence.db.Update(fn)
+}
+
+// boltKey joins the parts of an index key. The separator sorts before every other byte,
+// so that keys sharing a prefix of whole parts are kept together in order.
+func boltKey(parts ...[]byte) []byte {
+	return bytes.Join(parts, []byte{0})
+}
+
+// boltOrganization is the key part of an organization
+func boltOrganization(organizationID int) []byte {
+	return []byte(strconv.Itoa(organizationID))
+}
+
+// boltTime is the key part of a time, which sorts like the times do for every time from year 1
+func boltTime(t time.Time) []byte {
+	key := make([]byte, 12)
+	// Seconds are counted from year 1 rather than 1970, so that the zero time is not negative
+	binary.BigEndian.PutUint64(key, uint64(t.Unix()+62135596800))
+	binary.BigEndian.PutUint32(key[8:], uint32(t.Nanosecond()))
+	return key
+}
+
+// boltPrefixScan calls fn with the key of every entry of the bucket starting with the prefix, in key order,
+// until fn returns false. The bucket may not be modified during the scan.
+func boltPrefixScan(bucket *bolt.Bucket, prefix []byte, fn func(key []byte, value []byte) bool) {
+	cursor := bucket.Cursor()
+	for key, value := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, value = cursor.Next() {
+		if !fn(key, value) {
+			return
+		}
+	}
+}
+
+// boltIdentifierSuffix is the last part of an index key, which is the identifier of the indexed record
+func boltIdentifierSuffix(key []byte) string {
+	return string(key[bytes.LastIndexByte(key, 0)+1:])
+}
+
+// boltGet decodes the record with the identifier, or returns ErrNotFound
+func boltGet(bucket *bolt.Bucket, identifier string, record interface{}) error {
+	encoded := bucket.Get([]byte(identifier))
+	if encoded == nil {
+		return ErrNotFound
+	}
+	return json.Unmarshal(encoded, record)
+}
+
+func boltPut(bucket *bolt.Bucket, identifier string, record interface{}) error {
+	encoded, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return bucket.Put([]byte(identifier), encoded)
+}
+
+type boltReportLocator struct {
+	Type          string `json:"type"`
+	Value         string `json:"value"`
+	Distinguisher string `json:"distinguisher"`
+}
+
+func (locator boltReportLocator) toIntermediary() intermediaries.ReportLocator {
+	return intermediaries.ReportLocator{
+		Type:          intermediaries.ReportLocatorType(locator.Type),
+		Value:         locator.Value,
+		Distinguisher: locator.Distinguisher,
+	}
+}
+
+func boltReportLocatorFromIntermediary(intermediary intermediaries.ReportLocator) boltReportLocator {
+	return boltReportLocator{
+		Type:          string(intermediary.Type),
+		Value:         intermediary.Value,
+		Distinguisher: intermediary.Distinguisher,
+	}
+}
+
+type boltFinding struct {
+	Identifier               string              `json:"id"`
+	Name                     string              `json:"name"`
+	OrganizationId           int                 `json:"organizationId"`
+	ReportDistinguisherType  string              `json:"reportDistinguisherType"`
+	ReportDistinguisherValue string              `json:"reportDistinguisherValue"`
+	ReportLocator            boltReportLocator   `json:"reportLocator"`
+	ImpliedReportLocators    []boltReportLocator `json:"impliedReportLocators"`
+	OwnerTeam                string              `json:"ownerTeam"`
+	OwnerContact             string              `json:"ownerContact"`
+	Severity                 string              `json:"severity"`
+	Status                   string              `json:"status"`
+	CreatedAt                time.Time           `json:"createdAt"`
+	UpdatedAt                time.Time           `json:"updatedAt"`
+	Version                  int                 `json:"version"`
+	DeletedAt                *time.Time          `json:"deletedAt"`
+	DeletedBy                int                 `json:"deletedBy"`
+	ArchivedAt               *time.Time          `json:"archivedAt,omitempty"`
+}
+
+func (finding boltFinding) toIntermediary() intermediaries.Finding {
+	implied := []intermediaries.ReportLocator{}
+	for index := range finding.ImpliedReportLocators {
+		implied = append(implied, finding.ImpliedReportLocators[index].toIntermediary())
+	}
+	return intermediaries.Finding{
+		Identifier:            finding.Identifier,
+		Name:                  finding.Name,
+		OrganizationId:        finding.OrganizationId,
+		ReportDistinguisher:   intermediaries.ReportDistinguisher{Type: finding.ReportDistinguisherType, Value: finding.ReportDistinguisherValue},
+		ReportLocator:         finding.ReportLocator.toIntermediary(),
+		ImpliedReportLocators: implied,
+		Owner:                 intermediaries.Owner{Team: finding.OwnerTeam, Contact: finding.OwnerContact},
+		Severity:              intermediaries.Severity(finding.Severity),
+		Status:                intermediaries.FindingStatus(finding.Status),
+		CreatedAt:             finding.CreatedAt,
+		UpdatedAt:             finding.UpdatedAt,
+		Version:               finding.Version,
+		DeletedAt:             finding.DeletedAt,
+		DeletedBy:             finding.DeletedBy,
+		ArchivedAt:            finding.ArchivedAt,
+	}
+}
+
+func boltFindingFromIntermediary(intermediary intermediaries.Finding) boltFinding {
+	implied := []boltReportLocator{}
+	for index := range intermediary.ImpliedReportLocators {
+		implied = append(implied, boltReportLocatorFromIntermediary(intermediary.ImpliedReportLocators[index]))
+	}
+	return boltFinding{
+		Identifier:               intermediary.Identifier,
+		Name:                     intermediary.Name,
+		OrganizationId:           intermediary.OrganizationId,
+		ReportDistinguisherType:  intermediary.ReportDistinguisher.Type,
+		ReportDistinguisherValue: intermediary.ReportDistinguisher.Value,
+		ReportLocator:            boltReportLocatorFromIntermediary(intermediary.ReportLocator),
+		ImpliedReportLocators:    implied,
+		OwnerTeam:                intermediary.Owner.Team,
+		OwnerContact:             intermediary.Owner.Contact,
+		Severity:                 string(intermediary.Severity),
+		Status:                   string(intermediary.Status),
+		CreatedAt:                intermediary.CreatedAt,
+		UpdatedAt:                intermediary.UpdatedAt,
+		Version:                  intermediary.Version,
+		DeletedAt:                intermediary.DeletedAt,
+		DeletedBy:                intermediary.DeletedBy,
+		ArchivedAt:               intermediary.ArchivedAt,
+	}
+}
+
+// boltReportKey is the key of a finding in the report index, unique per organization, report distinguisher and report locator
+func boltReportKey(organizationID int, distinguisher intermediaries.ReportDistinguisher, locator intermediaries.ReportLocator) []byte {
+	return boltKey(boltOrganization(organizationID), []byte(distinguisher.Type), []byte(distinguisher.Value), []byte(locator.Type), []byte(locator.Value), []byte(locator.Distinguisher))
+}
+
+// boltLocatorKey is the prefix of the keys of the findings of the organization reported on, or implying, the locator
+// in the locator index
+func boltLocatorKey(organizationID int, locator intermediaries.ReportLocator) []byte {
+	return boltKey(boltOrganization(organizationID), []byte(locator.Type), []byte(locator.Value), []byte(locator.Distinguisher))
+}
+
+// boltFindingLocators are the locators a finding is indexed by in the locator index
+func boltFindingLocators(finding intermediaries.Finding) []intermediaries.ReportLocator {
+	return append([]intermediaries.ReportLocator{finding.ReportLocator}, finding.ImpliedReportLocators...)
+}
+
+// putFinding stores the finding and indexes it, replacing the finding as it was before
+func putFinding(tx *bolt.Tx, finding intermediaries.Finding) error {
+	if err := deleteFindingIndexes(tx, finding.Identifier); err != nil {
+		return err
+	}
+	if err := boltPut(tx.Bucket(boltFindings), finding.Identifier, boltFindingFromIntermediary(finding)); err != nil {
+		return err
+	}
+	identifier := []byte(finding.Identifier)
+	if err := tx.Bucket(boltFindingsByReport).Put(boltReportKey(finding.OrganizationId, finding.ReportDistinguisher, finding.ReportLocator), identifier); err != nil {
+		return err
+	}
+	if err := tx.Bucket(boltFindingsByOrganization).Put(boltKey(boltOrganization(finding.OrganizationId), identifier), nil); err != nil {
+		return err
+	}
+	for _, locator := range boltFindingLocators(finding) {
+		if err := tx.Bucket(boltFindingsByLocator).Put(boltKey(boltLocatorKey(finding.OrganizationId, locator), identifier), nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteFindingIndexes removes the finding with the identifier from every index, if it is stored
+func deleteFindingIndexes(tx *bolt.Tx, identifier string) error {
+	stored := boltFinding{}
+	err := boltGet(tx.Bucket(boltFindings), identifier, &stored)
+	if err == ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	finding := stored.toIntermediary()
+	if err := tx.Bucket(boltFindingsByReport).Delete(boltReportKey(finding.OrganizationId, finding.ReportDistinguisher, finding.ReportLocator)); err != nil {
+		return err
+	}
+	if err := tx.Bucket(boltFindingsByOrganization).Delete(boltKey(boltOrganization(finding.OrganizationId), []byte(identifier))); err != nil {
+		return err
+	}
+	for _, locator := range boltFindingLocators(finding) {
+		if err := tx.Bucket(boltFindingsByLocator).Delete(boltKey(boltLocatorKey(finding.OrganizationId, locator), []byte(identifier))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getFinding reads the finding with the identifier, if it belongs to the organization
+func getFinding(tx *bolt.Tx, identifier string, organizationID int) (intermediaries.Finding, error) {
+	stored := boltFinding{}
+	if err := boltGet(tx.Bucket(boltFindings), identifier, &stored); err != nil {
+		return intermediaries.Finding{}, err
+	}
+	if stored.OrganizationId != organizationID {
+		return intermediaries.Finding{}, ErrNotFound
+	}
+	return stored.toIntermediary(), nil
+}
+
+func (persistence boltFindingsPersistence) UpdateFinding(ctx context.Context, findingI intermediaries.Finding, expectedVersion int, organizationID int) (intermediaries.Finding, error) {
+	findingI.OrganizationId = organizationID
+	err := persistence.update(ctx, func(tx *bolt.Tx) error {
+		existing := tx.Bucket(boltFindingsByReport).Get(boltReportKey(organizationID, findingI.ReportDistinguisher, findingI.ReportLocator))
+		if existing == nil {
+			if expectedVersion != 0 {
+				return ErrVersionMismatch
+			}
+			findingI.Identifier = newIdentifier()
+			findingI.Version = 1
+			return putFinding(tx, findingI)
+		}
+		stored, err := getFinding(tx, string(existing), organizationID)
+		if err != nil {
+			return err
+		}
+		if expectedVersion != 0 && stored.Version != expectedVersion {
+			return ErrVersionMismatch
+		}
+		findingI.Identifier = stored.Identifier
+		findingI.Version = stored.Version + 1
+		return putFinding(tx, findingI)
+	})
+	if err != nil {
+		return intermediaries.Finding{}, err
+	}
+	return boltFindingFromIntermediary(findingI).toIntermediary(), nil
+}
+
+func (persistence boltFindingsPersistence) GetFinding(ctx context.Context, identifier string, organizationID int) (intermediaries.Finding, error) {
+	var findingR intermediaries.Finding
+	err := persistence.view(ctx, func(tx *bolt.Tx) error {
+		var err error
+		findingR, err = getFinding(tx, identifier, organizationID)
+		return err
+	})
+	return findingR, err
+}
+
+func (persistence boltFindingsPersistence) GetFindings(ctx context.Context, organizationID int) ([]intermediaries.Finding, error) {
+	findingIs := []intermediaries.Finding{}
+	err := persistence.view(ctx, func(tx *bolt.Tx) error {
+		var err error
+		boltPrefixScan(tx.Bucket(boltFindingsByOrganization), boltKey(boltOrganization(organizationID), nil), func(key []byte, _ []byte) bool {
+			var finding intermediaries.Finding
+			finding, err = getFinding(tx, boltIdentifierSuffix(key), organizationID)
+			findingIs = append(findingIs, finding)
+			return err == nil
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return findingIs, nil
+}
+
+func (persistence boltFindingsPersistence) GetFindingsAfter(ctx context.Context, after string, limit int, organizationID int) ([]intermediaries.Finding, error) {
+	return persistence.findingsAfter(ctx, boltFindingsByOrganization, getFinding, after, limit, organizationID)
+}
+
+// findingsAfter pages through the findings indexed by organization in the bucket, which are read with get
+func (persistence boltFindingsPersistence) findingsAfter(ctx context.Context, bucket []byte, get func(*bolt.Tx, string, int) (intermediaries.Finding, error), after string, limit int, organizationID int) ([]intermediaries.Finding, error) {
+	findingIs := []intermediaries.Finding{}
+	err := persistence.view(ctx, func(tx *bolt.Tx) error {
+		prefix := boltKey(boltOrganization(organizationID), nil)
+		cursor := tx.Bucket(bucket).Cursor()
+		for key, _ := cursor.Seek(append(prefix, after...)); key != nil && bytes.HasPrefix(key, prefix) && len(findingIs) < limit; key, _ = cursor.Next() {
+			identifier := boltIdentifierSuffix(key)
+			if identifier == after {
+				continue
+			}
+			finding, err := get(tx, identifier, organizationID)
+			if err != nil {
+				return err
+			}
+			findingIs = append(findingIs, finding)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return findingIs, nil
+}
+
+func (persistence boltFindingsPersistence) GetFindingsByLocatorType(ctx context.Context, locatorType intermediaries.ReportLocatorType, organizationID int) ([]intermediaries.Finding, error) {
+	findingIs := []intermediaries.Finding{}
+	err := persistence.view(ctx, func(tx *bolt.Tx) error {
+		// A finding is indexed once for every locator it is on, ordered by the locators
+		identifiers := map[string]bool{}
+		boltPrefixScan(tx.Bucket(boltFindingsByLocator), boltKey(boltOrganization(organizationID), []byte(locatorType), nil), func(key []byte, _ []byte) bool {
+			identifiers[boltIdentifierSuffix(key)] = true
+			return true
+		})
+		sorted := []string{}
+		for identifier := range identifiers {
+			sorted = append(sorted, identifier)
+		}
+		sort.Strings(sorted)
+		for _, identifier := range sorted {
+			finding, err := getFinding(tx, identifier, organizationID)
+			if err != nil {
+				return err
+			}
+			findingIs = append(findingIs, finding)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return findingIs, nil
+}
+
+func (persistence boltFindingsPersistence) GetFindingByReport(ctx context.Context, distinguisher intermediaries.ReportDistinguisher, locator intermediaries.ReportLocator, organizationID int) (intermediaries.Finding, error) {
+	var findingR intermediaries.Finding
+	err := persistence.view(ctx, func(tx *bolt.Tx) error {
+		identifier := tx.Bucket(boltFindingsByReport).Get(boltReportKey(organizationID, distinguisher, locator))
+		if identifier == nil {
+			return ErrNotFound
+		}
+		var err error
+		findingR, err = getFinding(tx, string(identifier), organizationID)
+		return err
+	})
+	return findingR, err
+}
+
+// updateFinding changes a single finding of the organization, unless change fails
+func (persistence boltFindingsPersistence) updateFinding(ctx context.Context, identifier string, organizationID int, change func(*intermediaries.Finding) error) (intermediaries.Finding, error) {
+	var findingR intermediaries.Finding
+	err := persistence.update(ctx, func(tx *bolt.Tx) error {
+		var err error
+		findingR, err = getFinding(tx, identifier, organizationID)
+		if err != nil {
+			return err
+		}
+		if err := change(&findingR); err != nil {
+			return err
+		}
+		findingR.UpdatedAt = now()
+		findingR.Version++
+		return putFinding(tx, findingR)
+	})
+	if err != nil {
+		return intermediaries.Finding{}, err
+	}
+	return findingR, nil
+}
+
+func (persistence boltFindingsPersistence) UpdateFindingStatus(ctx context.Context, identifier string, status intermediaries.FindingStatus, expectedVersion int, organizationID int) (intermediaries.Finding, error) {
+	return persistence.updateFinding(ctx, identifier, organizationID, func(finding *intermediaries.Finding) error {
+		if expectedVersion != 0 && finding.Version != expectedVersion {
+			return ErrVersionMismatch
+		}
+		finding.Status = status
+		return nil
+	})
+}
+
+func (persistence boltFindingsPersistence) UpdateFindingOwner(ctx context.Context, identifier string, owner intermediaries.Owner, organizationID int) (intermediaries.Finding, error) {
+	return persistence.updateFinding(ctx, identifier, organizationID, func(finding *intermediaries.Finding) error {
+		finding.Owner = owner
+		return nil
+	})
+}
+
+func (persistence boltFindingsPersistence) UpdateFindingLocators(ctx context.Context, identifier string, locator intermediaries.ReportLocator, implied []intermediaries.ReportLocator, organizationID int) (intermediaries.Finding, error) {
+	return persistence.updateFinding(ctx, identifier, organizationID, func(finding *intermediaries.Finding) error {
+		finding.ReportLocator = locator
+		finding.ImpliedReportLocators = append([]intermediaries.ReportLocator{}, implied...)
+		return nil
+	})
+}
+
+func (persistence boltFindingsPersistence) SoftDeleteFinding(ctx context.Context, identifier string, deletedBy int, expectedVersion int, organizationID int) (intermediaries.Finding, error) {
+	return persistence.updateFinding(ctx, identifier, organizationID, func(finding *intermediaries.Finding) error {
+		if expectedVersion != 0 && finding.Version != expectedVersion {
+			return ErrVersionMismatch
+		}
+		deletedAt := now()
+		finding.DeletedAt = &deletedAt
+		finding.DeletedBy = deletedBy
+		return nil
+	})
+}
+
+func (persistence boltFindingsPersistence) DeleteFinding(ctx context.Context, identifier string, organizationID int) error {
+	return persistence.update(ctx, func(tx *bolt.Tx) error {
+		if _, err := getFinding(tx, identifier, organizationID); err != nil {
+			return err
+		}
+		if err := deleteFindingIndexes(tx, identifier); err != nil {
+			return err
+		}
+		return tx.Bucket(boltFindings).Delete([]byte(identifier))
+	})
+}
@@ -0,0 +1,147 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
+	bolt "go.etcd.io/bbolt"
+)
+
+// putArchivedFinding stores the archived finding and indexes it. Archived findings are never changed, only moved.
+func putArchivedFinding(tx *bolt.Tx, finding intermediaries.Finding) error {
+	if err := boltPut(tx.Bucket(boltArchivedFindings), finding.Identifier, boltFindingFromIntermediary(finding)); err != nil {
+		return err
+	}
+	identifier := []byte(finding.Identifier)
+	if err := tx.Bucket(boltArchivedFindingsByReport).Put(boltReportKey(finding.OrganizationId, finding.ReportDistinguisher, finding.ReportLocator), identifier); err != nil {
+		return err
+	}
+	return tx.Bucket(boltArchivedFindingsByOrg).Put(boltKey(boltOrganization(finding.OrganizationId), identifier), nil)
+}
+
+// deleteArchivedFinding removes the archived finding and its indexes
+func deleteArchivedFinding(tx *bolt.Tx, finding intermediaries.Finding) error {
+	if err := tx.Bucket(boltArchivedFindingsByReport).Delete(boltReportKey(finding.OrganizationId, finding.ReportDistinguisher, finding.ReportLocator)); err != nil {
+		return err
+	}
+	if err := tx.Bucket(boltArchivedFindingsByOrg).Delete(boltKey(boltOrganization(finding.OrganizationId), []byte(finding.Identifier))); err != nil {
+		return err
+	}
+	return tx.Bucket(boltArchivedFindings).Delete([]byte(finding.Identifier))
+}
+
+// getArchivedFinding reads the archived finding with the identifier, if it belongs to the organization
+func getArchivedFinding(tx *bolt.Tx, identifier string, organizationID int) (intermediaries.Finding, error) {
+	stored := boltFinding{}
+	if err := boltGet(tx.Bucket(boltArchivedFindings), identifier, &stored); err != nil {
+		return intermediaries.Finding{}, err
+	}
+	if stored.OrganizationId != organizationID {
+		return intermediaries.Finding{}, ErrNotFound
+	}
+	return stored.toIntermediary(), nil
+}
+
+func (persistence boltFindingsPersistence) ArchiveFinding(ctx context.Context, identifier string, archivedAt time.Time, organizationID int) (intermediaries.Finding, error) {
+	var findingR intermediaries.Finding
+	err := persistence.update(ctx, func(tx *bolt.Tx) error {
+		var err error
+		findingR, err = getFinding(tx, identifier, organizationID)
+		if err != nil {
+			return err
+		}
+		if err := deleteFindingIndexes(tx, identifier); err != nil {
+			return err
+		}
+		if err := tx.Bucket(boltFindings).Delete([]byte(identifier)); err != nil {
+			return err
+		}
+		archivedAt = archivedAt.UTC().Truncate(time.Millisecond)
+		findingR.ArchivedAt = &archivedAt
+		return putArchivedFinding(tx, findingR)
+	})
+	if err != nil {
+		return intermediaries.Finding{}, err
+	}
+	return findingR, nil
+}
+
+func (persistence boltFindingsPersistence) RestoreArchivedFinding(ctx context.Context, identifier string, organizationID int) (intermediaries.Finding, error) {
+	var findingR intermediaries.Finding
+	err := persistence.update(ctx, func(tx *bolt.Tx) error {
+		var err error
+		findingR, err = getArchivedFinding(tx, identifier, organizationID)
+		if err != nil {
+			return err
+		}
+		if tx.Bucket(boltFindingsByReport).Get(boltReportKey(organizationID, findingR.ReportDistinguisher, findingR.ReportLocator)) != nil {
+			return ErrDuplicate
+		}
+		if err := deleteArchivedFinding(tx, findingR); err != nil {
+			return err
+		}
+		findingR.ArchivedAt = nil
+		return putFinding(tx, findingR)
+	})
+	if err != nil {
+		return intermediaries.Finding{}, err
+	}
+	return findingR, nil
+}
+
+func (persistence boltFindingsPersistence) GetArchivedFinding(ctx context.Context, identifier string, organizationID int) (intermediaries.Finding, error) {
+	var findingR intermediaries.Finding
+	err := persistence.view(ctx, func(tx *bolt.Tx) error {
+		var err error
+		findingR, err = getArchivedFinding(tx, identifier, organizationID)
+		return err
+	})
+	return findingR, err
+}
+
+func (persistence boltFindingsPersistence) GetArchivedFindings(ctx context.Context, organizationID int) ([]intermediaries.Finding, error) {
+	findingIs := []intermediaries.Finding{}
+	err := persistence.view(ctx, func(tx *bolt.Tx) error {
+		var err error
+		boltPrefixScan(tx.Bucket(boltArchivedFindingsByOrg), boltKey(boltOrganization(organizationID), nil), func(key []byte, _ []byte) bool {
+			var finding intermediaries.Finding
+			finding, err = getArchivedFinding(tx, boltIdentifierSuffix(key), organizationID)
+			findingIs = append(findingIs, finding)
+			return err == nil
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return findingIs, nil
+}
+
+func (persistence boltFindingsPersistence) GetArchivedFindingsAfter(ctx context.Context, after string, limit int, organizationID int) ([]intermediaries.Finding, error) {
+	return persistence.findingsAfter(ctx, boltArchivedFindingsByOrg, getArchivedFinding, after, limit, organizationID)
+}
+
+func (persistence boltFindingsPersistence) GetArchivedFindingByReport(ctx context.Context, distinguisher intermediaries.ReportDistinguisher, locator intermediaries.ReportLocator, organizationID int) (intermediaries.Finding, error) {
+	var findingR intermediaries.Finding
+	err := persistence.view(ctx, func(tx *bolt.Tx) error {
+		identifier := tx.Bucket(boltArchivedFindingsByReport).Get(boltReportKey(organizationID, distinguisher, locator))
+		if identifier == nil {
+			return ErrNotFound
+		}
+		var err error
+		findingR, err = getArchivedFinding(tx, string(identifier), organizationID)
+		return err
+	})
+	return findingR, err
+}
+
+func (persistence boltFindingsPersistence) DeleteArchivedFinding(ctx context.Context, identifier string, organizationID int) error {
+	return persistence.update(ctx, func(tx *bolt.Tx) error {
+		finding, err := getArchivedFinding(tx, identifier, organizationID)
+		if err != nil {
+			return err
+		}
+		return deleteArchivedFinding(tx, finding)
+	})
+}
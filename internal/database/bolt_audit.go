@@ -0,0 +1,187 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
+	bolt "go.etcd.io/bbolt"
+)
+
+type boltAuditChange struct {
+	Field  string `json:"field"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+type boltAuditEntry struct {
+	OrganizationId    int               `json:"organizationId"`
+	Sequence          int               `json:"sequence"`
+	FindingIdentifier string            `json:"findingId"`
+	Action            string            `json:"action"`
+	UserId            int               `json:"userId"`
+	RequestId         string            `json:"requestId"`
+	SourceIP          string            `json:"sourceIP"`
+	Changes           []boltAuditChange `json:"changes"`
+	CreatedAt         time.Time         `json:"createdAt"`
+	PreviousHash      string            `json:"previousHash"`
+	Hash              string            `json:"hash"`
+}
+
+func (entry boltAuditEntry) toIntermediary() intermediaries.AuditEntry {
+	changes := []intermediaries.AuditChange{}
+	for _, change := range entry.Changes {
+		changes = append(changes, intermediaries.AuditChange{Field: change.Field, Before: change.Before, After: change.After})
+	}
+	return intermediaries.AuditEntry{
+		OrganizationId:    entry.OrganizationId,
+		Sequence:          entry.Sequence,
+		FindingIdentifier: entry.FindingIdentifier,
+		Action:            intermediaries.AuditAction(entry.Action),
+		Actor: intermediaries.AuditActor{
+			UserId:    entry.UserId,
+			RequestId: entry.RequestId,
+			SourceIP:  entry.SourceIP,
+		},
+		Changes:      changes,
+		CreatedAt:    entry.CreatedAt.UTC(),
+		PreviousHash: entry.PreviousHash,
+		Hash:         entry.Hash,
+	}
+}
+
+func boltAuditEntryFromIntermediary(intermediary intermediaries.AuditEntry) boltAuditEntry {
+	changes := []boltAuditChange{}
+	for _, change := range intermediary.Changes {
+		changes = append(changes, boltAuditChange{Field: change.Field, Before: change.Before, After: change.After})
+	}
+	return boltAuditEntry{
+		OrganizationId:    intermediary.OrganizationId,
+		Sequence:          intermediary.Sequence,
+		FindingIdentifier: intermediary.FindingIdentifier,
+		Action:            string(intermediary.Action),
+		UserId:            intermediary.Actor.UserId,
+		RequestId:         intermediary.Actor.RequestId,
+		SourceIP:          intermediary.Actor.SourceIP,
+		Changes:           changes,
+		CreatedAt:         intermediary.CreatedAt,
+		PreviousHash:      intermediary.PreviousHash,
+		Hash:              intermediary.Hash,
+	}
+}
+
+// boltSequence is the key part of a sequence, which sorts like the sequences do
+func boltSequence(sequence int) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(sequence))
+	return key
+}
+
+// boltAuditFindingKey is the key of an entry of the finding in the index of entries by finding,
+// which ends in the sequence of the entry
+func boltAuditFindingKey(organizationID int, findingIdentifier string, sequence int) []byte {
+	return boltKey(boltOrganization(organizationID), []byte(findingIdentifier), boltSequence(sequence))
+}
+
+// indexBoltAuditEntries indexes every audit entry by its finding
+func indexBoltAuditEntries(tx *bolt.Tx) error {
+	index := tx.Bucket(boltAuditEntriesByFinding)
+	return tx.Bucket(boltAuditEntries).ForEach(func(_ []byte, value []byte) error {
+		stored := boltAuditEntry{}
+		if err := json.Unmarshal(value, &stored); err != nil {
+			return err
+		}
+		return index.Put(boltAuditFindingKey(stored.OrganizationId, stored.FindingIdentifier, stored.Sequence), nil)
+	})
+}
+
+func (persistence boltFindingsPersistence) AppendAuditEntry(ctx context.Context, entry intermediaries.AuditEntry, organizationID int) (intermediaries.AuditEntry, error) {
+	entry.OrganizationId = organizationID
+	err := persistence.update(ctx, func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltAuditEntries)
+		prefix := boltKey(boltOrganization(organizationID), nil)
+		var previous *intermediaries.AuditEntry
+		// The last entry of the organization is right before where an entry with the largest sequence would be
+		cursor := bucket.Cursor()
+		key, value := cursor.Seek(boltKey(boltOrganization(organizationID), bytes.Repeat([]byte{0xff}, 9)))
+		if key == nil {
+			key, value = cursor.Last()
+		} else {
+			key, value = cursor.Prev()
+		}
+		if key != nil && bytes.HasPrefix(key, prefix) {
+			last := boltAuditEntry{}
+			if err := json.Unmarshal(value, &last); err != nil {
+				return err
+			}
+			lastI := last.toIntermediary()
+			previous = &lastI
+		}
+		entry = entry.Chain(previous)
+		encoded, err := json.Marshal(boltAuditEntryFromIntermediary(entry))
+		if err != nil {
+			return err
+		}
+		if err := bucket.Put(boltKey(boltOrganization(organizationID), boltSequence(entry.Sequence)), encoded); err != nil {
+			return err
+		}
+		return tx.Bucket(boltAuditEntriesByFinding).Put(boltAuditFindingKey(organizationID, entry.FindingIdentifier, entry.Sequence), nil)
+	})
+	if err != nil {
+		return intermediaries.AuditEntry{}, err
+	}
+	return entry, nil
+}
+
+func (persistence boltFindingsPersistence) GetAuditEntries(ctx context.Context, organizationID int) ([]intermediaries.AuditEntry, error) {
+	entries := []intermediaries.AuditEntry{}
+	err := persistence.view(ctx, func(tx *bolt.Tx) error {
+		var err error
+		boltPrefixScan(tx.Bucket(boltAuditEntries), boltKey(boltOrganization(organizationID), nil), func(_ []byte, value []byte) bool {
+			stored := boltAuditEntry{}
+			if err = json.Unmarshal(value, &stored); err != nil {
+				return false
+			}
+			entries = append(entries, stored.toIntermediary())
+			return true
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (persistence boltFindingsPersistence) GetAuditEntriesAfter(ctx context.Context, filter intermediaries.AuditFilter, after int, limit int, organizationID int) ([]intermediaries.AuditEntry, error) {
+	entries := []intermediaries.AuditEntry{}
+	err := persistence.view(ctx, func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltAuditEntries)
+		// The entries of a finding are found by the index of entries by finding, and others by scanning the entries
+		scanned, prefix := bucket, boltKey(boltOrganization(organizationID), nil)
+		if filter.FindingIdentifier != "" {
+			scanned, prefix = tx.Bucket(boltAuditEntriesByFinding), boltKey(boltOrganization(organizationID), []byte(filter.FindingIdentifier), nil)
+		}
+		cursor := scanned.Cursor()
+		for key, value := cursor.Seek(append(prefix, boltSequence(after+1)...)); key != nil && bytes.HasPrefix(key, prefix) && len(entries) < limit; key, value = cursor.Next() {
+			if filter.FindingIdentifier != "" {
+				value = bucket.Get(boltKey(boltOrganization(organizationID), key[len(prefix):]))
+			}
+			stored := boltAuditEntry{}
+			if err := json.Unmarshal(value, &stored); err != nil {
+				return err
+			}
+			if entry := stored.toIntermediary(); filter.Matches(entry) {
+				entries = append(entries, entry)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
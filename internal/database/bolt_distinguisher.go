@@ -0,0 +1,87 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
+	bolt "go.etcd.io/bbolt"
+)
+
+type boltDistinguisherAlias struct {
+	OrganizationId int    `json:"organizationId"`
+	Alias          string `json:"alias"`
+	Distinguisher  string `json:"distinguisher"`
+}
+
+func (alias boltDistinguisherAlias) toIntermediary() intermediaries.DistinguisherAlias {
+	return intermediaries.DistinguisherAlias{
+		OrganizationId: alias.OrganizationId,
+		Alias:          alias.Alias,
+		Distinguisher:  alias.Distinguisher,
+	}
+}
+
+func boltDistinguisherAliasFromIntermediary(intermediary intermediaries.DistinguisherAlias) boltDistinguisherAlias {
+	return boltDistinguisherAlias{
+		OrganizationId: intermediary.OrganizationId,
+		Alias:          intermediary.Alias,
+		Distinguisher:  intermediary.Distinguisher,
+	}
+}
+
+// boltAliasKey is the key of an alias, which is unique within its organization
+func boltAliasKey(alias string, organizationID int) string {
+	return string(boltKey(boltOrganization(organizationID), []byte(alias)))
+}
+
+func (persistence boltFindingsPersistence) GetDistinguisherAlias(ctx context.Context, alias string, organizationID int) (intermediaries.DistinguisherAlias, error) {
+	stored := boltDistinguisherAlias{}
+	err := persistence.view(ctx, func(tx *bolt.Tx) error {
+		return boltGet(tx.Bucket(boltDistinguisherAliases), boltAliasKey(alias, organizationID), &stored)
+	})
+	if err != nil {
+		return intermediaries.DistinguisherAlias{}, err
+	}
+	return stored.toIntermediary(), nil
+}
+
+func (persistence boltFindingsPersistence) GetDistinguisherAliases(ctx context.Context, organizationID int) ([]intermediaries.DistinguisherAlias, error) {
+	aliasIs := []intermediaries.DistinguisherAlias{}
+	err := persistence.view(ctx, func(tx *bolt.Tx) error {
+		var err error
+		boltPrefixScan(tx.Bucket(boltDistinguisherAliases), boltKey(boltOrganization(organizationID), nil), func(_ []byte, value []byte) bool {
+			stored := boltDistinguisherAlias{}
+			err = json.Unmarshal(value, &stored)
+			aliasIs = append(aliasIs, stored.toIntermediary())
+			return err == nil
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return aliasIs, nil
+}
+
+func (persistence boltFindingsPersistence) SetDistinguisherAlias(ctx context.Context, aliasI intermediaries.DistinguisherAlias, organizationID int) (intermediaries.DistinguisherAlias, error) {
+	aliasI.OrganizationId = organizationID
+	err := persistence.update(ctx, func(tx *bolt.Tx) error {
+		return boltPut(tx.Bucket(boltDistinguisherAliases), boltAliasKey(aliasI.Alias, organizationID), boltDistinguisherAliasFromIntermediary(aliasI))
+	})
+	if err != nil {
+		return intermediaries.DistinguisherAlias{}, err
+	}
+	return aliasI, nil
+}
+
+func (persistence boltFindingsPersistence) DeleteDistinguisherAlias(ctx context.Context, alias string, organizationID int) error {
+	return persistence.update(ctx, func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltDistinguisherAliases)
+		key := []byte(boltAliasKey(alias, organizationID))
+		if bucket.Get(key) == nil {
+			return ErrNotFound
+		}
+		return bucket.Delete(key)
+	})
+}
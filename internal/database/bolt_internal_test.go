@@ -0,0 +1,84 @@
+package database_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/Kaese72/finding-registry/internal/database"
+	"github.com/Kaese72/finding-registry/internal/database/databasetest"
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestBoltPersistence(t *testing.T) {
+	databasetest.Run(t, func(t *testing.T) database.Persistence {
+		persistence, err := database.NewBoltFindingsPersistence(database.BoltConfig{Path: filepath.Join(t.TempDir(), "finding-registry.db")})
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		t.Cleanup(func() { persistence.Close() })
+		return persistence
+	})
+}
+
+func TestBoltPersistenceBuildsIndexes(t *testing.T) {
+	ctx := context.Background()
+	config := database.BoltConfig{Path: filepath.Join(t.TempDir(), "finding-registry.db")}
+	persistence, err := database.NewBoltFindingsPersistence(config)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	finding, err := persistence.UpdateFinding(ctx, intermediaries.Finding{
+		ReportDistinguisher: intermediaries.ReportDistinguisher{Type: "scanner", Value: "nmap"},
+		ReportLocator:       intermediaries.ReportLocator{Type: "TCP", Value: "10.0.0.1:22", Distinguisher: "dc1"},
+		ImpliedReportLocators: []intermediaries.ReportLocator{
+			{Type: "IPv4", Value: "10.0.0.1", Distinguisher: "dc1"},
+		},
+	}, 0, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := persistence.AppendAuditEntry(ctx, intermediaries.AuditEntry{FindingIdentifier: finding.Identifier, Action: intermediaries.AuditCreated}, 1); err != nil {
+		t.Fatal(err.Error())
+	}
+	persistence.Close()
+
+	// A file written before the indexes were introduced has none of them
+	db, err := bolt.Open(config.Path, 0600, nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range []string{"findingsByLocator", "auditEntriesByFinding"} {
+			if err := tx.DeleteBucket([]byte(bucket)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	db.Close()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	persistence, err = database.NewBoltFindingsPersistence(config)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer persistence.Close()
+	findings, err := persistence.GetFindingsByLocatorType(ctx, "IPv4", 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(findings) != 1 || findings[0].Identifier != finding.Identifier {
+		t.Errorf("expected the finding to be found by its implied locator, got %+v", findings)
+	}
+	entries, err := persistence.GetAuditEntriesAfter(ctx, intermediaries.AuditFilter{FindingIdentifier: finding.Identifier}, 0, 10, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected the entry to be found by its finding, got %+v", entries)
+	}
+}
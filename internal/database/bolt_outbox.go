@@ -0,0 +1,197 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
+	bolt "go.etcd.io/bbolt"
+)
+
+type boltOutboxEvent struct {
+	Identifier     string     `json:"id"`
+	OrganizationId int        `json:"organizationId"`
+	Type           string     `json:"type"`
+	Payload        []byte     `json:"payload"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	DeliveredAt    *time.Time `json:"deliveredAt"`
+	LockedUntil    *time.Time `json:"lockedUntil"`
+}
+
+func (outboxEvent boltOutboxEvent) toIntermediary() intermediaries.OutboxEvent {
+	return intermediaries.OutboxEvent{
+		Identifier:     outboxEvent.Identifier,
+		OrganizationId: outboxEvent.OrganizationId,
+		Type:           outboxEvent.Type,
+		Payload:        append([]byte{}, outboxEvent.Payload...),
+		CreatedAt:      outboxEvent.CreatedAt,
+		DeliveredAt:    outboxEvent.DeliveredAt,
+	}
+}
+
+func boltOutboxEventFromIntermediary(intermediary intermediaries.OutboxEvent) boltOutboxEvent {
+	return boltOutboxEvent{
+		Identifier:     intermediary.Identifier,
+		OrganizationId: intermediary.OrganizationId,
+		Type:           intermediary.Type,
+		Payload:        append([]byte{}, intermediary.Payload...),
+		CreatedAt:      intermediary.CreatedAt,
+		DeliveredAt:    intermediary.DeliveredAt,
+	}
+}
+
+// boltCursorKey is the key part of a position in the outbox, which sorts like the cursors do
+func boltCursorKey(cursor intermediaries.OutboxCursor) []byte {
+	return boltKey(boltTime(cursor.CreatedAt), []byte(cursor.Identifier))
+}
+
+func (persistence boltFindingsPersistence) InsertOutboxEvent(ctx context.Context, outboxEvent intermediaries.OutboxEvent) error {
+	return persistence.update(ctx, func(tx *bolt.Tx) error {
+		if tx.Bucket(boltOutbox).Get([]byte(outboxEvent.Identifier)) != nil {
+			return ErrDuplicate
+		}
+		if err := boltPut(tx.Bucket(boltOutbox), outboxEvent.Identifier, boltOutboxEventFromIntermediary(outboxEvent)); err != nil {
+			return err
+		}
+		cursorKey := boltCursorKey(outboxEvent.Cursor())
+		if outboxEvent.DeliveredAt == nil {
+			if err := tx.Bucket(boltOutboxUndelivered).Put(cursorKey, nil); err != nil {
+				return err
+			}
+		}
+		return tx.Bucket(boltOutboxByOrganization).Put(boltKey(boltOrganization(outboxEvent.OrganizationId), cursorKey), nil)
+	})
+}
+
+func (persistence boltFindingsPersistence) ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]intermediaries.OutboxEvent, error) {
+	claimed := []intermediaries.OutboxEvent{}
+	err := persistence.update(ctx, func(tx *bolt.Tx) error {
+		now := time.Now().UTC()
+		lockedUntil := now.Add(lease)
+		outbox := tx.Bucket(boltOutbox)
+		stored := []boltOutboxEvent{}
+		var err error
+		boltPrefixScan(tx.Bucket(boltOutboxUndelivered), nil, func(key []byte, _ []byte) bool {
+			if len(stored) >= limit {
+				return false
+			}
+			outboxEvent := boltOutboxEvent{}
+			if err = boltGet(outbox, boltIdentifierSuffix(key), &outboxEvent); err != nil {
+				return false
+			}
+			if outboxEvent.LockedUntil == nil || outboxEvent.LockedUntil.Before(now) {
+				stored = append(stored, outboxEvent)
+			}
+			return true
+		})
+		if err != nil {
+			return err
+		}
+		for _, outboxEvent := range stored {
+			outboxEvent.LockedUntil = &lockedUntil
+			if err := boltPut(outbox, outboxEvent.Identifier, outboxEvent); err != nil {
+				return err
+			}
+			claimed = append(claimed, outboxEvent.toIntermediary())
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return claimed, nil
+}
+
+func (persistence boltFindingsPersistence) MarkOutboxEventDelivered(ctx context.Context, identifier string) error {
+	return persistence.update(ctx, func(tx *bolt.Tx) error {
+		outboxEvent := boltOutboxEvent{}
+		if err := boltGet(tx.Bucket(boltOutbox), identifier, &outboxEvent); err != nil {
+			return err
+		}
+		deliveredAt := now()
+		outboxEvent.DeliveredAt = &deliveredAt
+		outboxEvent.LockedUntil = nil
+		if err := tx.Bucket(boltOutboxUndelivered).Delete(boltCursorKey(outboxEvent.toIntermediary().Cursor())); err != nil {
+			return err
+		}
+		return boltPut(tx.Bucket(boltOutbox), identifier, outboxEvent)
+	})
+}
+
+// DeleteDeliveredOutboxEvents scans the whole outbox, since delivered events are not indexed. It is only run now and then,
+// and the outbox only holds the events of the stream retention.
+func (persistence boltFindingsPersistence) DeleteDeliveredOutboxEvents(ctx context.Context, before time.Time) (int, error) {
+	deleted := 0
+	err := persistence.update(ctx, func(tx *bolt.Tx) error {
+		expired := []boltOutboxEvent{}
+		err := tx.Bucket(boltOutbox).ForEach(func(_ []byte, value []byte) error {
+			outboxEvent := boltOutboxEvent{}
+			if err := json.Unmarshal(value, &outboxEvent); err != nil {
+				return err
+			}
+			if outboxEvent.DeliveredAt != nil && outboxEvent.DeliveredAt.Before(before) {
+				expired = append(expired, outboxEvent)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, outboxEvent := range expired {
+			cursorKey := boltCursorKey(outboxEvent.toIntermediary().Cursor())
+			if err := tx.Bucket(boltOutboxByOrganization).Delete(boltKey(boltOrganization(outboxEvent.OrganizationId), cursorKey)); err != nil {
+				return err
+			}
+			if err := tx.Bucket(boltOutbox).Delete([]byte(outboxEvent.Identifier)); err != nil {
+				return err
+			}
+		}
+		deleted = len(expired)
+		return nil
+	})
+	return deleted, err
+}
+
+func (persistence boltFindingsPersistence) GetOutboxEvent(ctx context.Context, identifier string, organizationID int) (intermediaries.OutboxEvent, error) {
+	outboxEvent := boltOutboxEvent{}
+	err := persistence.view(ctx, func(tx *bolt.Tx) error {
+		return boltGet(tx.Bucket(boltOutbox), identifier, &outboxEvent)
+	})
+	if err != nil {
+		return intermediaries.OutboxEvent{}, err
+	}
+	if outboxEvent.OrganizationId != organizationID {
+		return intermediaries.OutboxEvent{}, ErrNotFound
+	}
+	return outboxEvent.toIntermediary(), nil
+}
+
+func (persistence boltFindingsPersistence) GetOutboxEventsAfter(ctx context.Context, cursor intermediaries.OutboxCursor, until time.Time, limit int, organizationID int) ([]intermediaries.OutboxEvent, error) {
+	outboxEventIs := []intermediaries.OutboxEvent{}
+	err := persistence.view(ctx, func(tx *bolt.Tx) error {
+		outbox := tx.Bucket(boltOutbox)
+		prefix := boltKey(boltOrganization(organizationID), nil)
+		after := boltKey(boltOrganization(organizationID), boltCursorKey(cursor))
+		indexCursor := tx.Bucket(boltOutboxByOrganization).Cursor()
+		for key, _ := indexCursor.Seek(after); key != nil && bytes.HasPrefix(key, prefix) && len(outboxEventIs) < limit; key, _ = indexCursor.Next() {
+			if bytes.Equal(key, after) {
+				continue
+			}
+			outboxEvent := boltOutboxEvent{}
+			if err := boltGet(outbox, boltIdentifierSuffix(key), &outboxEvent); err != nil {
+				return err
+			}
+			if outboxEvent.CreatedAt.After(until) {
+				break
+			}
+			outboxEventIs = append(outboxEventIs, outboxEvent.toIntermediary())
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return outboxEventIs, nil
+}
@@ -0,0 +1,147 @@
+package database
+
+import (
+	"context"
+
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
+	bolt "go.etcd.io/bbolt"
+)
+
+type boltLocatorPattern struct {
+	Type          string `json:"type"`
+	Value         string `json:"value"`
+	Distinguisher string `json:"distinguisher"`
+}
+
+type boltOwnershipRule struct {
+	Identifier         string               `json:"id"`
+	OrganizationId     int                  `json:"organizationId"`
+	Name               string               `json:"name"`
+	Priority           int                  `json:"priority"`
+	LocatorPatterns    []boltLocatorPattern `json:"locatorPatterns"`
+	DistinguisherTypes []string             `json:"distinguisherTypes"`
+	OwnerTeam          string               `json:"ownerTeam"`
+	OwnerContact       string               `json:"ownerContact"`
+}
+
+func (rule boltOwnershipRule) toIntermediary() intermediaries.OwnershipRule {
+	patterns := []intermediaries.LocatorPattern{}
+	for _, pattern := range rule.LocatorPatterns {
+		patterns = append(patterns, intermediaries.LocatorPattern{
+			Type:          intermediaries.ReportLocatorType(pattern.Type),
+			Value:         pattern.Value,
+			Distinguisher: pattern.Distinguisher,
+		})
+	}
+	return intermediaries.OwnershipRule{
+		Identifier:         rule.Identifier,
+		OrganizationId:     rule.OrganizationId,
+		Name:               rule.Name,
+		Priority:           rule.Priority,
+		LocatorPatterns:    patterns,
+		DistinguisherTypes: append([]string{}, rule.DistinguisherTypes...),
+		Owner:              intermediaries.Owner{Team: rule.OwnerTeam, Contact: rule.OwnerContact},
+	}
+}
+
+func boltOwnershipRuleFromIntermediary(intermediary intermediaries.OwnershipRule) boltOwnershipRule {
+	patterns := []boltLocatorPattern{}
+	for _, pattern := range intermediary.LocatorPatterns {
+		patterns = append(patterns, boltLocatorPattern{
+			Type:          string(pattern.Type),
+			Value:         pattern.Value,
+			Distinguisher: pattern.Distinguisher,
+		})
+	}
+	return boltOwnershipRule{
+		Identifier:         intermediary.Identifier,
+		OrganizationId:     intermediary.OrganizationId,
+		Name:               intermediary.Name,
+		Priority:           intermediary.Priority,
+		LocatorPatterns:    patterns,
+		DistinguisherTypes: append([]string{}, intermediary.DistinguisherTypes...),
+		OwnerTeam:          intermediary.Owner.Team,
+		OwnerContact:       intermediary.Owner.Contact,
+	}
+}
+
+// getOwnershipRule reads the ownership rule with the identifier, if it belongs to the organization
+func getOwnershipRule(tx *bolt.Tx, identifier string, organizationID int) (intermediaries.OwnershipRule, error) {
+	stored := boltOwnershipRule{}
+	if err := boltGet(tx.Bucket(boltOwnershipRules), identifier, &stored); err != nil {
+		return intermediaries.OwnershipRule{}, err
+	}
+	if stored.OrganizationId != organizationID {
+		return intermediaries.OwnershipRule{}, ErrNotFound
+	}
+	return stored.toIntermediary(), nil
+}
+
+func (persistence boltFindingsPersistence) CreateOwnershipRule(ctx context.Context, ruleI intermediaries.OwnershipRule, organizationID int) (intermediaries.OwnershipRule, error) {
+	ruleI.Identifier = newIdentifier()
+	ruleI.OrganizationId = organizationID
+	err := persistence.update(ctx, func(tx *bolt.Tx) error {
+		if err := boltPut(tx.Bucket(boltOwnershipRules), ruleI.Identifier, boltOwnershipRuleFromIntermediary(ruleI)); err != nil {
+			return err
+		}
+		return tx.Bucket(boltOwnershipRulesByOrganization).Put(boltKey(boltOrganization(organizationID), []byte(ruleI.Identifier)), nil)
+	})
+	if err != nil {
+		return intermediaries.OwnershipRule{}, err
+	}
+	return boltOwnershipRuleFromIntermediary(ruleI).toIntermediary(), nil
+}
+
+func (persistence boltFindingsPersistence) GetOwnershipRule(ctx context.Context, identifier string, organizationID int) (intermediaries.OwnershipRule, error) {
+	var ruleR intermediaries.OwnershipRule
+	err := persistence.view(ctx, func(tx *bolt.Tx) error {
+		var err error
+		ruleR, err = getOwnershipRule(tx, identifier, organizationID)
+		return err
+	})
+	return ruleR, err
+}
+
+func (persistence boltFindingsPersistence) GetOwnershipRules(ctx context.Context, organizationID int) ([]intermediaries.OwnershipRule, error) {
+	ruleIs := []intermediaries.OwnershipRule{}
+	err := persistence.view(ctx, func(tx *bolt.Tx) error {
+		var err error
+		boltPrefixScan(tx.Bucket(boltOwnershipRulesByOrganization), boltKey(boltOrganization(organizationID), nil), func(key []byte, _ []byte) bool {
+			var rule intermediaries.OwnershipRule
+			rule, err = getOwnershipRule(tx, boltIdentifierSuffix(key), organizationID)
+			ruleIs = append(ruleIs, rule)
+			return err == nil
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ruleIs, nil
+}
+
+func (persistence boltFindingsPersistence) UpdateOwnershipRule(ctx context.Context, ruleI intermediaries.OwnershipRule, organizationID int) (intermediaries.OwnershipRule, error) {
+	ruleI.OrganizationId = organizationID
+	err := persistence.update(ctx, func(tx *bolt.Tx) error {
+		if _, err := getOwnershipRule(tx, ruleI.Identifier, organizationID); err != nil {
+			return err
+		}
+		return boltPut(tx.Bucket(boltOwnershipRules), ruleI.Identifier, boltOwnershipRuleFromIntermediary(ruleI))
+	})
+	if err != nil {
+		return intermediaries.OwnershipRule{}, err
+	}
+	return boltOwnershipRuleFromIntermediary(ruleI).toIntermediary(), nil
+}
+
+func (persistence boltFindingsPersistence) DeleteOwnershipRule(ctx context.Context, identifier string, organizationID int) error {
+	return persistence.update(ctx, func(tx *bolt.Tx) error {
+		if _, err := getOwnershipRule(tx, identifier, organizationID); err != nil {
+			return err
+		}
+		if err := tx.Bucket(boltOwnershipRulesByOrganization).Delete(boltKey(boltOrganization(organizationID), []byte(identifier))); err != nil {
+			return err
+		}
+		return tx.Bucket(boltOwnershipRules).Delete([]byte(identifier))
+	})
+}
@@ -0,0 +1,77 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
+	bolt "go.etcd.io/bbolt"
+)
+
+type boltRetentionPolicy struct {
+	OrganizationId int `json:"organizationId"`
+	ResolvedDays   int `json:"resolvedDays"`
+	DeletedDays    int `json:"deletedDays"`
+	ArchiveDays    int `json:"archiveDays"`
+}
+
+func (policy boltRetentionPolicy) toIntermediary() intermediaries.RetentionPolicy {
+	return intermediaries.RetentionPolicy{
+		OrganizationId: policy.OrganizationId,
+		ResolvedDays:   policy.ResolvedDays,
+		DeletedDays:    policy.DeletedDays,
+		ArchiveDays:    policy.ArchiveDays,
+	}
+}
+
+func boltRetentionPolicyFromIntermediary(intermediary intermediaries.RetentionPolicy) boltRetentionPolicy {
+	return boltRetentionPolicy{
+		OrganizationId: intermediary.OrganizationId,
+		ResolvedDays:   intermediary.ResolvedDays,
+		DeletedDays:    intermediary.DeletedDays,
+		ArchiveDays:    intermediary.ArchiveDays,
+	}
+}
+
+func (persistence boltFindingsPersistence) GetRetentionPolicy(ctx context.Context, organizationID int) (intermediaries.RetentionPolicy, error) {
+	stored := boltRetentionPolicy{}
+	err := persistence.view(ctx, func(tx *bolt.Tx) error {
+		return boltGet(tx.Bucket(boltRetentionPolicies), string(boltOrganization(organizationID)), &stored)
+	})
+	if err != nil {
+		return intermediaries.RetentionPolicy{}, err
+	}
+	return stored.toIntermediary(), nil
+}
+
+func (persistence boltFindingsPersistence) GetRetentionPolicies(ctx context.Context) ([]intermediaries.RetentionPolicy, error) {
+	policies := []intermediaries.RetentionPolicy{}
+	err := persistence.view(ctx, func(tx *bolt.Tx) error {
+		return tx.Bucket(boltRetentionPolicies).ForEach(func(_ []byte, value []byte) error {
+			stored := boltRetentionPolicy{}
+			if err := json.Unmarshal(value, &stored); err != nil {
+				return err
+			}
+			policies = append(policies, stored.toIntermediary())
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Organizations are keyed as text, which does not sort like the numbers do
+	sort.Slice(policies, func(i, j int) bool { return policies[i].OrganizationId < policies[j].OrganizationId })
+	return policies, nil
+}
+
+func (persistence boltFindingsPersistence) SetRetentionPolicy(ctx context.Context, policy intermediaries.RetentionPolicy, organizationID int) (intermediaries.RetentionPolicy, error) {
+	policy.OrganizationId = organizationID
+	err := persistence.update(ctx, func(tx *bolt.Tx) error {
+		return boltPut(tx.Bucket(boltRetentionPolicies), string(boltOrganization(organizationID)), boltRetentionPolicyFromIntermediary(policy))
+	})
+	if err != nil {
+		return intermediaries.RetentionPolicy{}, err
+	}
+	return policy, nil
+}
@@ -0,0 +1,388 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
+	bolt "go.etcd.io/bbolt"
+)
+
+type boltWebhookSubscription struct {
+	Identifier          string    `json:"id"`
+	OrganizationId      int       `json:"organizationId"`
+	URL                 string    `json:"url"`
+	Secret              string    `json:"secret"`
+	EventTypes          []string  `json:"eventTypes"`
+	Enabled             bool      `json:"enabled"`
+	ConsecutiveFailures int       `json:"consecutiveFailures"`
+	CreatedAt           time.Time `json:"createdAt"`
+	UpdatedAt           time.Time `json:"updatedAt"`
+}
+
+func (subscription boltWebhookSubscription) toIntermediary() intermediaries.WebhookSubscription {
+	return intermediaries.WebhookSubscription{
+		Identifier:          subscription.Identifier,
+		OrganizationId:      subscription.OrganizationId,
+		URL:                 subscription.URL,
+		Secret:              subscription.Secret,
+		EventTypes:          append([]string{}, subscription.EventTypes...),
+		Enabled:             subscription.Enabled,
+		ConsecutiveFailures: subscription.ConsecutiveFailures,
+		CreatedAt:           subscription.CreatedAt,
+		UpdatedAt:           subscription.UpdatedAt,
+	}
+}
+
+func boltWebhookSubscriptionFromIntermediary(intermediary intermediaries.WebhookSubscription) boltWebhookSubscription {
+	return boltWebhookSubscription{
+		Identifier:          intermediary.Identifier,
+		OrganizationId:      intermediary.OrganizationId,
+		URL:                 intermediary.URL,
+		Secret:              intermediary.Secret,
+		EventTypes:          append([]string{}, intermediary.EventTypes...),
+		Enabled:             intermediary.Enabled,
+		ConsecutiveFailures: intermediary.ConsecutiveFailures,
+		CreatedAt:           intermediary.CreatedAt,
+		UpdatedAt:           intermediary.UpdatedAt,
+	}
+}
+
+type boltWebhookDelivery struct {
+	Identifier     string     `json:"id"`
+	SubscriptionId string     `json:"subscriptionId"`
+	OrganizationId int        `json:"organizationId"`
+	EventId        string     `json:"eventId"`
+	EventType      string     `json:"eventType"`
+	Payload        []byte     `json:"payload"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  time.Time  `json:"nextAttemptAt"`
+	LastAttemptAt  *time.Time `json:"lastAttemptAt"`
+	LastStatusCode int        `json:"lastStatusCode"`
+	LastError      string     `json:"lastError"`
+	CreatedAt      time.Time  `json:"createdAt"`
+}
+
+func (delivery boltWebhookDelivery) toIntermediary() intermediaries.WebhookDelivery {
+	return intermediaries.WebhookDelivery{
+		Identifier:     delivery.Identifier,
+		SubscriptionId: delivery.SubscriptionId,
+		OrganizationId: delivery.OrganizationId,
+		EventId:        delivery.EventId,
+		EventType:      delivery.EventType,
+		Payload:        append([]byte{}, delivery.Payload...),
+		Status:         intermediaries.WebhookDeliveryStatus(delivery.Status),
+		Attempts:       delivery.Attempts,
+		NextAttemptAt:  delivery.NextAttemptAt,
+		LastAttemptAt:  delivery.LastAttemptAt,
+		LastStatusCode: delivery.LastStatusCode,
+		LastError:      delivery.LastError,
+		CreatedAt:      delivery.CreatedAt,
+	}
+}
+
+func boltWebhookDeliveryFromIntermediary(intermediary intermediaries.WebhookDelivery) boltWebhookDelivery {
+	return boltWebhookDelivery{
+		Identifier:     intermediary.Identifier,
+		SubscriptionId: intermediary.SubscriptionId,
+		OrganizationId: intermediary.OrganizationId,
+		EventId:        intermediary.EventId,
+		EventType:      intermediary.EventType,
+		Payload:        append([]byte{}, intermediary.Payload...),
+		Status:         string(intermediary.Status),
+		Attempts:       intermediary.Attempts,
+		NextAttemptAt:  intermediary.NextAttemptAt,
+		LastAttemptAt:  intermediary.LastAttemptAt,
+		LastStatusCode: intermediary.LastStatusCode,
+		LastError:      intermediary.LastError,
+		CreatedAt:      intermediary.CreatedAt,
+	}
+}
+
+// getWebhookSubscription reads the subscription with the identifier, if it belongs to the organization
+func getWebhookSubscription(tx *bolt.Tx, identifier string, organizationID int) (intermediaries.WebhookSubscription, error) {
+	stored := boltWebhookSubscription{}
+	if err := boltGet(tx.Bucket(boltWebhookSubscriptions), identifier, &stored); err != nil {
+		return intermediaries.WebhookSubscription{}, err
+	}
+	if stored.OrganizationId != organizationID {
+		return intermediaries.WebhookSubscription{}, ErrNotFound
+	}
+	return stored.toIntermediary(), nil
+}
+
+// boltSubscriptionKey is the prefix of the keys of the deliveries of the subscription in the subscription index
+func boltSubscriptionKey(subscriptionID string, organizationID int) []byte {
+	return boltKey(boltOrganization(organizationID), []byte(subscriptionID))
+}
+
+// putWebhookDelivery stores the delivery and indexes it, replacing the delivery as it was before.
+// Only pending deliveries are in the pending index, ordered by when they are next attempted.
+func putWebhookDelivery(tx *bolt.Tx, delivery intermediaries.WebhookDelivery) error {
+	if err := deleteWebhookDeliveryIndexes(tx, delivery.Identifier); err != nil {
+		return err
+	}
+	if err := boltPut(tx.Bucket(boltWebhookDeliveries), delivery.Identifier, boltWebhookDeliveryFromIntermediary(delivery)); err != nil {
+		return err
+	}
+	identifier := []byte(delivery.Identifier)
+	if delivery.Status == intermediaries.DeliveryPending {
+		if err := tx.Bucket(boltWebhookDeliveriesPending).Put(boltKey(boltTime(delivery.NextAttemptAt), identifier), nil); err != nil {
+			return err
+		}
+	}
+	return tx.Bucket(boltWebhookDeliveriesBySub).Put(boltKey(boltSubscriptionKey(delivery.SubscriptionId, delivery.OrganizationId), boltTime(delivery.CreatedAt), identifier), nil)
+}
+
+// deleteWebhookDeliveryIndexes removes the delivery with the identifier from every index, if it is stored
+func deleteWebhookDeliveryIndexes(tx *bolt.Tx, identifier string) error {
+	stored := boltWebhookDelivery{}
+	err := boltGet(tx.Bucket(boltWebhookDeliveries), identifier, &stored)
+	if err == ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := tx.Bucket(boltWebhookDeliveriesPending).Delete(boltKey(boltTime(stored.NextAttemptAt), []byte(identifier))); err != nil {
+		return err
+	}
+	return tx.Bucket(boltWebhookDeliveriesBySub).Delete(boltKey(boltSubscriptionKey(stored.SubscriptionId, stored.OrganizationId), boltTime(stored.CreatedAt), []byte(identifier)))
+}
+
+func (persistence boltFindingsPersistence) CreateWebhookSubscription(ctx context.Context, subscriptionI intermediaries.WebhookSubscription, organizationID int) (intermediaries.WebhookSubscription, error) {
+	subscriptionI.Identifier = newIdentifier()
+	subscriptionI.OrganizationId = organizationID
+	err := persistence.update(ctx, func(tx *bolt.Tx) error {
+		if err := boltPut(tx.Bucket(boltWebhookSubscriptions), subscriptionI.Identifier, boltWebhookSubscriptionFromIntermediary(subscriptionI)); err != nil {
+			return err
+		}
+		return tx.Bucket(boltWebhookSubscriptionsByOrg).Put(boltKey(boltOrganization(organizationID), []byte(subscriptionI.Identifier)), nil)
+	})
+	if err != nil {
+		return intermediaries.WebhookSubscription{}, err
+	}
+	return boltWebhookSubscriptionFromIntermediary(subscriptionI).toIntermediary(), nil
+}
+
+func (persistence boltFindingsPersistence) GetWebhookSubscription(ctx context.Context, identifier string, organizationID int) (intermediaries.WebhookSubscription, error) {
+	var subscriptionR intermediaries.WebhookSubscription
+	err := persistence.view(ctx, func(tx *bolt.Tx) error {
+		var err error
+		subscriptionR, err = getWebhookSubscription(tx, identifier, organizationID)
+		return err
+	})
+	return subscriptionR, err
+}
+
+func (persistence boltFindingsPersistence) GetWebhookSubscriptions(ctx context.Context, organizationID int) ([]intermediaries.WebhookSubscription, error) {
+	subscriptionIs := []intermediaries.WebhookSubscription{}
+	err := persistence.view(ctx, func(tx *bolt.Tx) error {
+		var err error
+		boltPrefixScan(tx.Bucket(boltWebhookSubscriptionsByOrg), boltKey(boltOrganization(organizationID), nil), func(key []byte, _ []byte) bool {
+			var subscription intermediaries.WebhookSubscription
+			subscription, err = getWebhookSubscription(tx, boltIdentifierSuffix(key), organizationID)
+			subscriptionIs = append(subscriptionIs, subscription)
+			return err == nil
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return subscriptionIs, nil
+}
+
+func (persistence boltFindingsPersistence) UpdateWebhookSubscription(ctx context.Context, subscriptionI intermediaries.WebhookSubscription, organizationID int) (intermediaries.WebhookSubscription, error) {
+	subscriptionI.OrganizationId = organizationID
+	err := persistence.update(ctx, func(tx *bolt.Tx) error {
+		if _, err := getWebhookSubscription(tx, subscriptionI.Identifier, organizationID); err != nil {
+			return err
+		}
+		return boltPut(tx.Bucket(boltWebhookSubscriptions), subscriptionI.Identifier, boltWebhookSubscriptionFromIntermediary(subscriptionI))
+	})
+	if err != nil {
+		return intermediaries.WebhookSubscription{}, err
+	}
+	return boltWebhookSubscriptionFromIntermediary(subscriptionI).toIntermediary(), nil
+}
+
+func (persistence boltFindingsPersistence) RecordWebhookSuccess(ctx context.Context, identifier string, organizationID int) error {
+	_, err := persistence.updateWebhookSubscriptionHealth(ctx, identifier, organizationID, func(subscription *intermediaries.WebhookSubscription) {
+		subscription.ConsecutiveFailures = 0
+	})
+	return err
+}
+
+func (persistence boltFindingsPersistence) RecordWebhookFailure(ctx context.Context, identifier string, disableAfter int, organizationID int) (intermediaries.WebhookSubscription, error) {
+	return persistence.updateWebhookSubscriptionHealth(ctx, identifier, organizationID, func(subscription *intermediaries.WebhookSubscription) {
+		subscription.ConsecutiveFailures++
+		subscription.Enabled = subscription.Enabled && subscription.ConsecutiveFailures < disableAfter
+	})
+}
+
+// updateWebhookSubscriptionHealth changes the health of a subscription of the organization within a single update,
+// which bolt runs one at a time
+func (persistence boltFindingsPersistence) updateWebhookSubscriptionHealth(ctx context.Context, identifier string, organizationID int, update func(*intermediaries.WebhookSubscription)) (intermediaries.WebhookSubscription, error) {
+	var subscriptionR intermediaries.WebhookSubscription
+	err := persistence.update(ctx, func(tx *bolt.Tx) error {
+		var err error
+		subscriptionR, err = getWebhookSubscription(tx, identifier, organizationID)
+		if err != nil {
+			return err
+		}
+		update(&subscriptionR)
+		return boltPut(tx.Bucket(boltWebhookSubscriptions), identifier, boltWebhookSubscriptionFromIntermediary(subscriptionR))
+	})
+	if err != nil {
+		return intermediaries.WebhookSubscription{}, err
+	}
+	return subscriptionR, nil
+}
+
+func (persistence boltFindingsPersistence) DeleteWebhookSubscription(ctx context.Context, identifier string, organizationID int) error {
+	return persistence.update(ctx, func(tx *bolt.Tx) error {
+		if _, err := getWebhookSubscription(tx, identifier, organizationID); err != nil {
+			return err
+		}
+		deliveryIDs := []string{}
+		boltPrefixScan(tx.Bucket(boltWebhookDeliveriesBySub), boltKey(boltSubscriptionKey(identifier, organizationID), nil), func(key []byte, _ []byte) bool {
+			deliveryIDs = append(deliveryIDs, boltIdentifierSuffix(key))
+			return true
+		})
+		for _, deliveryID := range deliveryIDs {
+			if err := deleteWebhookDeliveryIndexes(tx, deliveryID); err != nil {
+				return err
+			}
+			if err := tx.Bucket(boltWebhookDeliveries).Delete([]byte(deliveryID)); err != nil {
+				return err
+			}
+		}
+		if err := tx.Bucket(boltWebhookSubscriptionsByOrg).Delete(boltKey(boltOrganization(organizationID), []byte(identifier))); err != nil {
+			return err
+		}
+		return tx.Bucket(boltWebhookSubscriptions).Delete([]byte(identifier))
+	})
+}
+
+func (persistence boltFindingsPersistence) InsertWebhookDelivery(ctx context.Context, delivery intermediaries.WebhookDelivery) error {
+	return persistence.update(ctx, func(tx *bolt.Tx) error {
+		if tx.Bucket(boltWebhookDeliveries).Get([]byte(delivery.Identifier)) != nil {
+			return ErrDuplicate
+		}
+		return putWebhookDelivery(tx, delivery)
+	})
+}
+
+func (persistence boltFindingsPersistence) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]intermediaries.WebhookDelivery, error) {
+	claimed := []intermediaries.WebhookDelivery{}
+	err := persistence.update(ctx, func(tx *bolt.Tx) error {
+		now := time.Now().UTC()
+		deliveries := tx.Bucket(boltWebhookDeliveries)
+		var err error
+		boltPrefixScan(tx.Bucket(boltWebhookDeliveriesPending), nil, func(key []byte, _ []byte) bool {
+			if len(claimed) >= limit {
+				return false
+			}
+			stored := boltWebhookDelivery{}
+			if err = boltGet(deliveries, boltIdentifierSuffix(key), &stored); err != nil {
+				return false
+			}
+			if stored.NextAttemptAt.After(now) {
+				return false
+			}
+			claimed = append(claimed, stored.toIntermediary())
+			return true
+		})
+		if err != nil {
+			return err
+		}
+		for _, delivery := range claimed {
+			// The delivery is returned as it was before the claim, like the MongoDB persistence does
+			delivery.NextAttemptAt = now.Add(lease)
+			if err := putWebhookDelivery(tx, delivery); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return claimed, nil
+}
+
+func (persistence boltFindingsPersistence) UpdateWebhookDelivery(ctx context.Context, delivery intermediaries.WebhookDelivery) error {
+	return persistence.update(ctx, func(tx *bolt.Tx) error {
+		if tx.Bucket(boltWebhookDeliveries).Get([]byte(delivery.Identifier)) == nil {
+			return ErrNotFound
+		}
+		return putWebhookDelivery(tx, delivery)
+	})
+}
+
+func (persistence boltFindingsPersistence) GetWebhookDeliveries(ctx context.Context, subscriptionID string, before intermediaries.WebhookDeliveryCursor, limit int, organizationID int) ([]intermediaries.WebhookDelivery, error) {
+	deliveryIs := []intermediaries.WebhookDelivery{}
+	err := persistence.view(ctx, func(tx *bolt.Tx) error {
+		deliveries := tx.Bucket(boltWebhookDeliveries)
+		prefix := boltKey(boltSubscriptionKey(subscriptionID, organizationID), nil)
+		// The index is ordered oldest first, so it is scanned backwards from the cursor, or from after every time
+		seek := boltKey(boltSubscriptionKey(subscriptionID, organizationID), []byte{0xff})
+		if !before.CreatedAt.IsZero() {
+			seek = boltKey(boltSubscriptionKey(subscriptionID, organizationID), boltTime(before.CreatedAt), []byte(before.Identifier))
+		}
+		indexCursor := tx.Bucket(boltWebhookDeliveriesBySub).Cursor()
+		key, _ := indexCursor.Seek(seek)
+		if key == nil {
+			key, _ = indexCursor.Last()
+		} else {
+			key, _ = indexCursor.Prev()
+		}
+		for ; key != nil && bytes.HasPrefix(key, prefix) && len(deliveryIs) < limit; key, _ = indexCursor.Prev() {
+			stored := boltWebhookDelivery{}
+			if err := boltGet(deliveries, boltIdentifierSuffix(key), &stored); err != nil {
+				return err
+			}
+			deliveryIs = append(deliveryIs, stored.toIntermediary())
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return deliveryIs, nil
+}
+
+func (persistence boltFindingsPersistence) DeleteWebhookDeliveries(ctx context.Context, before time.Time) (int, error) {
+	deleted := 0
+	err := persistence.update(ctx, func(tx *bolt.Tx) error {
+		expired := []string{}
+		err := tx.Bucket(boltWebhookDeliveries).ForEach(func(key []byte, value []byte) error {
+			stored := boltWebhookDelivery{}
+			if err := json.Unmarshal(value, &stored); err != nil {
+				return err
+			}
+			if intermediaries.WebhookDeliveryStatus(stored.Status) != intermediaries.DeliveryPending && stored.CreatedAt.Before(before) {
+				expired = append(expired, string(key))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, identifier := range expired {
+			if err := deleteWebhookDeliveryIndexes(tx, identifier); err != nil {
+				return err
+			}
+			if err := tx.Bucket(boltWebhookDeliveries).Delete([]byte(identifier)); err != nil {
+				return err
+			}
+		}
+		deleted = len(expired)
+		return nil
+	})
+	return deleted, err
+}
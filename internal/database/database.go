@@ -2,12 +2,213 @@ package database
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"time"
 
 	"github.com/Kaese72/finding-registry/internal/intermediaries"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// ErrNotFound is returned when the requested entity does not exist within the organization
+var ErrNotFound = errors.New("not found")
+
+// ErrVersionMismatch is returned when changing an entity that is no longer at the version the change was based on
+var ErrVersionMismatch = errors.New("version mismatch")
+
+// ErrDuplicate is returned when inserting an entity with the identifier of an entity that already exists
+var ErrDuplicate = errors.New("duplicate")
+
+// newIdentifier generates identifiers formatted like those generated by MongoDB, which are ordered by creation,
+// for the backends that do not generate identifiers of their own
+func newIdentifier() string {
+	return primitive.NewObjectID().Hex()
+}
+
+// now is the current time, at the millisecond precision of MongoDB
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Millisecond)
+}
+
+type Backend string
+
+const (
+	BackendMongoDB  Backend = "mongodb"
+	BackendPostgres Backend = "postgres"
+	BackendMemory   Backend = "memory"
+	BackendBolt     Backend = "bolt"
+)
+
+// Config selects the persistence backend and configures it
+type Config struct {
+	Backend  Backend
+	MongoDB  MongoDBConfig
+	Postgres PostgresConfig
+	Bolt     BoltConfig
+}
+
+// Setup connects the configured backend
+func Setup(config Config) (Persistence, error) {
+	switch config.Backend {
+	case BackendMongoDB, "":
+		return NewMongoFindingsPersistence(config.MongoDB)
+	case BackendPostgres:
+		return NewPostgresFindingsPersistence(config.Postgres)
+	case BackendMemory:
+		return NewMemoryFindingsPersistence(), nil
+	case BackendBolt:
+		return NewBoltFindingsPersistence(config.Bolt)
+	default:
+		return nil, fmt.Errorf("unknown database backend: %s", config.Backend)
+	}
+}
+
+// Migrate brings the schema of the configured backend up to date. Backends also migrate when they are set up,
+// so this is only needed to migrate ahead of starting the service, eg. as a step of a deployment.
+func Migrate(ctx context.Context, config Config) error {
+	switch config.Backend {
+	case BackendMongoDB, "":
+		client, err := mongo.Connect(ctx, options.Client().ApplyURI(config.MongoDB.ConnectionString))
+		if err != nil {
+			return err
+		}
+		defer client.Disconnect(context.Background())
+		return migrateMongo(ctx, client.Database(config.MongoDB.DbName))
+	case BackendPostgres:
+		pool, err := pgxpool.New(ctx, config.Postgres.ConnectionString)
+		if err != nil {
+			return err
+		}
+		defer pool.Close()
+		return migratePostgres(ctx, pool)
+	case BackendBolt:
+		// The buckets are created when the file is opened
+		persistence, err := NewBoltFindingsPersistence(config.Bolt)
+		if err != nil {
+			return err
+		}
+		return persistence.Close()
+	case BackendMemory:
+		return nil
+	default:
+		return fmt.Errorf("unknown database backend: %s", config.Backend)
+	}
+}
+
+// Persistence stores the entities of every organization. Methods taking an organization only read and write
+// entities of that organization, which the conformance test suite verifies for every backend. The outbox,
+// webhook delivery and retention policy methods without one are for the relays and the retention job,
+// which work across organizations.
 type Persistence interface {
-	UpdateFinding(context.Context, intermediaries.Finding, int) (intermediaries.Finding, error)
+	// WithTransaction runs the function so that every change it makes through the context it is given
+	// is applied together, or not at all. A transaction started within the function is part of it.
+	WithTransaction(context.Context, func(context.Context) error) error
+
+	// UpdateFinding creates or replaces the finding reported on the same report distinguisher and locator,
+	// which brings back a deleted finding unless the finding is deleted as well. With an expected version other
+	// than 0 it only replaces the finding at that version, and returns ErrVersionMismatch without creating
+	// anything if there is no finding at that version.
+	UpdateFinding(context.Context, intermediaries.Finding, int, int) (intermediaries.Finding, error)
+	// GetFinding and the other reads of findings include deleted findings, which are told apart by their DeletedAt
 	GetFinding(context.Context, string, int) (intermediaries.Finding, error)
 	GetFindings(context.Context, int) ([]intermediaries.Finding, error)
+	// GetFindingsAfter lists up to limit findings of the organization created after the finding with the identifier,
+	// or from the first one if the identifier is empty, in the order they were created
+	GetFindingsAfter(context.Context, string, int, int) ([]intermediaries.Finding, error)
+	// GetFindingsByLocatorType lists the findings reported on, or implying, a locator of the type, in the order they were created
+	GetFindingsByLocatorType(context.Context, intermediaries.ReportLocatorType, int) ([]intermediaries.Finding, error)
+	// GetFindingByReport looks up a finding by the report distinguisher and locator it was reported on
+	GetFindingByReport(context.Context, intermediaries.ReportDistinguisher, intermediaries.ReportLocator, int) (intermediaries.Finding, error)
+	// UpdateFindingStatus sets the status of a finding at the expected version, or at any version if it is 0,
+	// and returns ErrVersionMismatch if the finding is at another version
+	UpdateFindingStatus(context.Context, string, intermediaries.FindingStatus, int, int) (intermediaries.Finding, error)
+	// UpdateFindingOwner sets the owner of a single finding, leaving everything else untouched
+	UpdateFindingOwner(context.Context, string, intermediaries.Owner, int) (intermediaries.Finding, error)
+	// UpdateFindingLocators moves a single finding to another report locator, leaving everything else untouched
+	UpdateFindingLocators(context.Context, string, intermediaries.ReportLocator, []intermediaries.ReportLocator, int) (intermediaries.Finding, error)
+	// SoftDeleteFinding marks a finding as deleted by the user, keeping it as a tombstone, with the same
+	// version check as UpdateFindingStatus
+	SoftDeleteFinding(context.Context, string, int, int, int) (intermediaries.Finding, error)
+	// DeleteFinding deletes a finding for good, whether it is marked as deleted or not
+	DeleteFinding(context.Context, string, int) error
+
+	// ArchiveFinding moves a finding out of the findings into the archive, archived at the time, keeping everything else.
+	// Archived findings are not returned by the reads of findings, but by the reads of archived findings.
+	ArchiveFinding(context.Context, string, time.Time, int) (intermediaries.Finding, error)
+	// RestoreArchivedFinding moves an archived finding back into the findings
+	RestoreArchivedFinding(context.Context, string, int) (intermediaries.Finding, error)
+	GetArchivedFinding(context.Context, string, int) (intermediaries.Finding, error)
+	GetArchivedFindings(context.Context, int) ([]intermediaries.Finding, error)
+	// GetArchivedFindingsAfter pages through the archived findings like GetFindingsAfter does through the findings
+	GetArchivedFindingsAfter(context.Context, string, int, int) ([]intermediaries.Finding, error)
+	// GetArchivedFindingByReport looks up an archived finding by the report distinguisher and locator it was reported on
+	GetArchivedFindingByReport(context.Context, intermediaries.ReportDistinguisher, intermediaries.ReportLocator, int) (intermediaries.Finding, error)
+	// DeleteArchivedFinding deletes an archived finding for good
+	DeleteArchivedFinding(context.Context, string, int) error
+
+	// GetRetentionPolicy returns ErrNotFound if the organization has not set a retention policy
+	GetRetentionPolicy(context.Context, int) (intermediaries.RetentionPolicy, error)
+	// GetRetentionPolicies lists the retention policies of every organization, for the retention job
+	GetRetentionPolicies(context.Context) ([]intermediaries.RetentionPolicy, error)
+	// SetRetentionPolicy creates or replaces the retention policy of the organization
+	SetRetentionPolicy(context.Context, intermediaries.RetentionPolicy, int) (intermediaries.RetentionPolicy, error)
+
+	// AppendAuditEntry chains the entry after the last entry of the organization and stores it. Entries are never
+	// changed or deleted, and concurrent appends are ordered so that the chain does not fork.
+	AppendAuditEntry(context.Context, intermediaries.AuditEntry, int) (intermediaries.AuditEntry, error)
+	// GetAuditEntries lists every entry of the organization in sequence order
+	GetAuditEntries(context.Context, int) ([]intermediaries.AuditEntry, error)
+	// GetAuditEntriesAfter lists up to limit entries of the organization that match the filter and come after the
+	// sequence, in sequence order
+	GetAuditEntriesAfter(context.Context, intermediaries.AuditFilter, int, int, int) ([]intermediaries.AuditEntry, error)
+
+	CreateOwnershipRule(context.Context, intermediaries.OwnershipRule, int) (intermediaries.OwnershipRule, error)
+	GetOwnershipRule(context.Context, string, int) (intermediaries.OwnershipRule, error)
+	GetOwnershipRules(context.Context, int) ([]intermediaries.OwnershipRule, error)
+	UpdateOwnershipRule(context.Context, intermediaries.OwnershipRule, int) (intermediaries.OwnershipRule, error)
+	DeleteOwnershipRule(context.Context, string, int) error
+
+	GetDistinguisherAlias(context.Context, string, int) (intermediaries.DistinguisherAlias, error)
+	GetDistinguisherAliases(context.Context, int) ([]intermediaries.DistinguisherAlias, error)
+	// SetDistinguisherAlias creates or replaces the alias
+	SetDistinguisherAlias(context.Context, intermediaries.DistinguisherAlias, int) (intermediaries.DistinguisherAlias, error)
+	DeleteDistinguisherAlias(context.Context, string, int) error
+
+	InsertOutboxEvent(context.Context, intermediaries.OutboxEvent) error
+	// ClaimOutboxEvents returns up to limit undelivered events, oldest first, and hides them from
+	// other claims for the lease duration so that concurrent relays do not publish the same events
+	ClaimOutboxEvents(context.Context, int, time.Duration) ([]intermediaries.OutboxEvent, error)
+	MarkOutboxEventDelivered(context.Context, string) error
+	// DeleteDeliveredOutboxEvents deletes the events delivered before the time, and returns how many were deleted
+	DeleteDeliveredOutboxEvents(context.Context, time.Time) (int, error)
+	GetOutboxEvent(context.Context, string, int) (intermediaries.OutboxEvent, error)
+	// GetOutboxEventsAfter lists up to limit events of the organization after the cursor, and created at or before until, in cursor order
+	GetOutboxEventsAfter(context.Context, intermediaries.OutboxCursor, time.Time, int, int) ([]intermediaries.OutboxEvent, error)
+
+	CreateWebhookSubscription(context.Context, intermediaries.WebhookSubscription, int) (intermediaries.WebhookSubscription, error)
+	GetWebhookSubscription(context.Context, string, int) (intermediaries.WebhookSubscription, error)
+	GetWebhookSubscriptions(context.Context, int) ([]intermediaries.WebhookSubscription, error)
+	UpdateWebhookSubscription(context.Context, intermediaries.WebhookSubscription, int) (intermediaries.WebhookSubscription, error)
+	// RecordWebhookSuccess forgets the failed delivery attempts of the subscription, leaving everything else untouched
+	RecordWebhookSuccess(context.Context, string, int) error
+	// RecordWebhookFailure counts a failed delivery attempt of the subscription, and disables it once it has failed
+	// the given number of times in a row. The count is incremented and checked in a single atomic update, so
+	// concurrent failures are all counted, and it returns the subscription as updated.
+	RecordWebhookFailure(context.Context, string, int, int) (intermediaries.WebhookSubscription, error)
+	// DeleteWebhookSubscription deletes the subscription together with its deliveries
+	DeleteWebhookSubscription(context.Context, string, int) error
+
+	InsertWebhookDelivery(context.Context, intermediaries.WebhookDelivery) error
+	// ClaimWebhookDeliveries returns up to limit pending deliveries that are due, and postpones
+	// their next attempt by the lease duration so that concurrent dispatchers do not deliver them twice
+	ClaimWebhookDeliveries(context.Context, int, time.Duration) ([]intermediaries.WebhookDelivery, error)
+	UpdateWebhookDelivery(context.Context, intermediaries.WebhookDelivery) error
+	// GetWebhookDeliveries lists up to limit deliveries of a subscription before the cursor, most recent first
+	GetWebhookDeliveries(context.Context, string, intermediaries.WebhookDeliveryCursor, int, int) ([]intermediaries.WebhookDelivery, error)
+	// DeleteWebhookDeliveries deletes the deliveries that are no longer pending and were created before the time,
+	// and returns how many were deleted
+	DeleteWebhookDeliveries(context.Context, time.Time) (int, error)
 }
@@ -0,0 +1,1478 @@
+// Package databasetest is the conformance test suite every database.Persistence backend must pass,
+// so that the application behaves the same on each of them
+package databasetest
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Kaese72/finding-registry/internal/database"
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
+)
+
+// NewPersistence creates an empty persistence for a single test
+type NewPersistence func(t *testing.T) database.Persistence
+
+// unknownIdentifier is formatted like a generated identifier, but never generated
+const unknownIdentifier = "000000000000000000000000"
+
+// Run runs the conformance test suite against the backend created by newPersistence
+func Run(t *testing.T, newPersistence NewPersistence) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, persistence database.Persistence)
+	}{
+		{"UpdateFindingUpserts", testUpdateFindingUpserts},
+		{"GetFindingScopedByOrganization", testGetFindingScopedByOrganization},
+		{"GetFindingsByLocatorType", testGetFindingsByLocatorType},
+		{"GetFindingsAfter", testGetFindingsAfter},
+		{"UpdateFindingScopedByOrganization", testUpdateFindingScopedByOrganization},
+		{"TenantIsolation", testTenantIsolation},
+		{"UpdateFindingFields", testUpdateFindingFields},
+		{"FindingVersions", testFindingVersions},
+		{"UpdateFindingAtVersion", testUpdateFindingAtVersion},
+		{"DeleteFinding", testDeleteFinding},
+		{"SoftDeleteFinding", testSoftDeleteFinding},
+		{"RetentionPolicies", testRetentionPolicies},
+		{"ArchivedFindings", testArchivedFindings},
+		{"AuditEntries", testAuditEntries},
+		{"AuditEntriesRollBack", testAuditEntriesRollBack},
+		{"GetAuditEntriesAfter", testGetAuditEntriesAfter},
+		{"TransactionCommits", testTransactionCommits},
+		{"TransactionRollsBack", testTransactionRollsBack},
+		{"NestedTransactionRollsBack", testNestedTransactionRollsBack},
+		{"OwnershipRules", testOwnershipRules},
+		{"DistinguisherAliases", testDistinguisherAliases},
+		{"ClaimOutboxEvents", testClaimOutboxEvents},
+		{"GetOutboxEventsAfter", testGetOutboxEventsAfter},
+		{"DeleteDeliveredOutboxEvents", testDeleteDeliveredOutboxEvents},
+		{"WebhookSubscriptions", testWebhookSubscriptions},
+		{"RecordWebhookFailuresConcurrently", testRecordWebhookFailuresConcurrently},
+		{"WebhookDeliveries", testWebhookDeliveries},
+		{"GetWebhookDeliveriesBefore", testGetWebhookDeliveriesBefore},
+		{"DeleteWebhookDeliveries", testDeleteWebhookDeliveries},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.test(t, newPersistence(t))
+		})
+	}
+}
+
+// at is a time at the millisecond precision every backend stores
+func at(minutes int) time.Time {
+	return time.Date(2024, 3, 1, 12, minutes, 0, 0, time.UTC)
+}
+
+func newFinding(name string, value string) intermediaries.Finding {
+	return intermediaries.Finding{
+		Name:                "Finding " + name,
+		ReportDistinguisher: intermediaries.ReportDistinguisher{Type: "scanner", Value: name},
+		ReportLocator:       intermediaries.ReportLocator{Type: "IPv4", Value: value, Distinguisher: intermediaries.GlobalDistinguisher},
+		ImpliedReportLocators: []intermediaries.ReportLocator{
+			{Type: "IPv4", Value: value, Distinguisher: intermediaries.GlobalDistinguisher},
+		},
+		Owner:     intermediaries.Owner{Team: "platform", Contact: "platform@example.com"},
+		Severity:  intermediaries.SeverityHigh,
+		Status:    intermediaries.StatusOpen,
+		CreatedAt: at(0),
+		UpdatedAt: at(0),
+	}
+}
+
+func mustUpdateFinding(t *testing.T, persistence database.Persistence, finding intermediaries.Finding, organizationID int) intermediaries.Finding {
+	t.Helper()
+	stored, err := persistence.UpdateFinding(context.Background(), finding, 0, organizationID)
+	if err != nil {
+		t.Fatalf("failed to store finding: %s", err.Error())
+	}
+	return stored
+}
+
+func expectNotFound(t *testing.T, err error) {
+	t.Helper()
+	if !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func expectEqual(t *testing.T, expected interface{}, actual interface{}) {
+	t.Helper()
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected %+v, got %+v", expected, actual)
+	}
+}
+
+func testUpdateFindingUpserts(t *testing.T, persistence database.Persistence) {
+	ctx := context.Background()
+	created := mustUpdateFinding(t, persistence, newFinding("a", "10.0.0.1"), 1)
+	if created.Identifier == "" {
+		t.Fatal("expected an identifier to be generated")
+	}
+	if created.OrganizationId != 1 {
+		t.Errorf("expected organization 1, got %d", created.OrganizationId)
+	}
+	if created.Version != 1 {
+		t.Errorf("expected version 1, got %d", created.Version)
+	}
+
+	// The same distinguisher and locator is the same finding
+	changed := newFinding("a", "10.0.0.1")
+	changed.Name = "Renamed"
+	changed.UpdatedAt = at(1)
+	updated := mustUpdateFinding(t, persistence, changed, 1)
+	changed.Identifier = created.Identifier
+	changed.OrganizationId = 1
+	changed.Version = 2
+	expectEqual(t, changed, updated)
+
+	// Another locator is another finding
+	other := mustUpdateFinding(t, persistence, newFinding("a", "10.0.0.2"), 1)
+	if other.Identifier == created.Identifier {
+		t.Error("expected another locator to create another finding")
+	}
+
+	findings, err := persistence.GetFindings(ctx, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, []intermediaries.Finding{updated, other}, findings)
+
+	found, err := persistence.GetFindingByReport(ctx, changed.ReportDistinguisher, changed.ReportLocator, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, updated, found)
+}
+
+func testGetFindingScopedByOrganization(t *testing.T, persistence database.Persistence) {
+	ctx := context.Background()
+	finding := mustUpdateFinding(t, persistence, newFinding("a", "10.0.0.1"), 1)
+
+	found, err := persistence.GetFinding(ctx, finding.Identifier, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, finding, found)
+
+	_, err = persistence.GetFinding(ctx, finding.Identifier, 2)
+	expectNotFound(t, err)
+	_, err = persistence.GetFinding(ctx, unknownIdentifier, 1)
+	expectNotFound(t, err)
+	_, err = persistence.GetFinding(ctx, "not-an-identifier", 1)
+	expectNotFound(t, err)
+	_, err = persistence.GetFindingByReport(ctx, finding.ReportDistinguisher, finding.ReportLocator, 2)
+	expectNotFound(t, err)
+
+	findings, err := persistence.GetFindings(ctx, 2)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, []intermediaries.Finding{}, findings)
+}
+
+func testGetFindingsByLocatorType(t *testing.T, persistence database.Persistence) {
+	ctx := context.Background()
+	implying := newFinding("a", "10.0.0.1")
+	implying.ImpliedReportLocators = append(implying.ImpliedReportLocators,
+		intermediaries.ReportLocator{Type: "TCP", Value: "10.0.0.1:22", Distinguisher: intermediaries.GlobalDistinguisher},
+		intermediaries.ReportLocator{Type: "TCP", Value: "10.0.0.1:80", Distinguisher: intermediaries.GlobalDistinguisher},
+	)
+	implying = mustUpdateFinding(t, persistence, implying, 1)
+	reported := newFinding("b", "10.0.0.2")
+	reported.ReportLocator = intermediaries.ReportLocator{Type: "TCP", Value: "10.0.0.2:22", Distinguisher: intermediaries.GlobalDistinguisher}
+	reported.ImpliedReportLocators = nil
+	other := mustUpdateFinding(t, persistence, reported, 2)
+	reported = mustUpdateFinding(t, persistence, reported, 1)
+	neither := mustUpdateFinding(t, persistence, newFinding("c", "10.0.0.3"), 1)
+
+	// A finding is found once, whether the type is its report locator or one or more of its implied locators
+	findings, err := persistence.GetFindingsByLocatorType(ctx, "TCP", 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, []intermediaries.Finding{implying, reported}, findings)
+	findings, err = persistence.GetFindingsByLocatorType(ctx, "IPv4", 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, []intermediaries.Finding{implying, neither}, findings)
+
+	// Changed locators are found by their new types only
+	locator := intermediaries.ReportLocator{Type: "HTTP", Value: "http://10.0.0.2/", Distinguisher: intermediaries.GlobalDistinguisher}
+	changed, err := persistence.UpdateFindingLocators(ctx, reported.Identifier, locator, []intermediaries.ReportLocator{locator}, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	findings, err = persistence.GetFindingsByLocatorType(ctx, "TCP", 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, []intermediaries.Finding{implying}, findings)
+	findings, err = persistence.GetFindingsByLocatorType(ctx, "HTTP", 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, []intermediaries.Finding{changed}, findings)
+
+	// Other organizations have their own findings
+	findings, err = persistence.GetFindingsByLocatorType(ctx, "TCP", 2)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, []intermediaries.Finding{other}, findings)
+	findings, err = persistence.GetFindingsByLocatorType(ctx, "HTTP", 2)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, []intermediaries.Finding{}, findings)
+}
+
+func testGetFindingsAfter(t *testing.T, persistence database.Persistence) {
+	ctx := context.Background()
+	other := mustUpdateFinding(t, persistence, newFinding("d", "10.0.0.4"), 2)
+	first := mustUpdateFinding(t, persistence, newFinding("a", "10.0.0.1"), 1)
+	archived := mustUpdateFinding(t, persistence, newFinding("b", "10.0.0.2"), 1)
+	last := mustUpdateFinding(t, persistence, newFinding("c", "10.0.0.3"), 1)
+	archived, err := persistence.ArchiveFinding(ctx, archived.Identifier, at(5), 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// Pages follow each other from the last finding of the previous page
+	tests := []struct {
+		name     string
+		after    string
+		limit    int
+		expected []intermediaries.Finding
+	}{
+		{"FirstPage", "", 1, []intermediaries.Finding{first}},
+		{"NextPage", first.Identifier, 1, []intermediaries.Finding{last}},
+		{"LastPage", last.Identifier, 1, []intermediaries.Finding{}},
+		{"AfterArchived", archived.Identifier, 10, []intermediaries.Finding{last}},
+		{"Every", "", 10, []intermediaries.Finding{first, last}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			findings, err := persistence.GetFindingsAfter(ctx, test.after, test.limit, 1)
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			expectEqual(t, test.expected, findings)
+		})
+	}
+
+	// Archived findings are paged through the same way
+	findings, err := persistence.GetArchivedFindingsAfter(ctx, "", 10, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, []intermediaries.Finding{archived}, findings)
+	findings, err = persistence.GetArchivedFindingsAfter(ctx, archived.Identifier, 10, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, []intermediaries.Finding{}, findings)
+
+	// Other organizations have their own findings
+	findings, err = persistence.GetFindingsAfter(ctx, "", 10, 2)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, []intermediaries.Finding{other}, findings)
+	findings, err = persistence.GetArchivedFindingsAfter(ctx, "", 10, 2)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, []intermediaries.Finding{}, findings)
+}
+
+func testUpdateFindingFields(t *testing.T, persistence database.Persistence) {
+	ctx := context.Background()
+	finding := mustUpdateFinding(t, persistence, newFinding("a", "10.0.0.1"), 1)
+
+	updated, err := persistence.UpdateFindingStatus(ctx, finding.Identifier, intermediaries.StatusResolved, 0, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if updated.Status != intermediaries.StatusResolved {
+		t.Errorf("expected status %s, got %s", intermediaries.StatusResolved, updated.Status)
+	}
+	if !updated.UpdatedAt.After(finding.UpdatedAt) {
+		t.Error("expected the update time to be set")
+	}
+
+	owner := intermediaries.Owner{Team: "security", Contact: "security@example.com"}
+	updated, err = persistence.UpdateFindingOwner(ctx, finding.Identifier, owner, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, owner, updated.Owner)
+	expectEqual(t, intermediaries.StatusResolved, updated.Status)
+
+	locator := intermediaries.ReportLocator{Type: "IPv4", Value: "10.0.0.1", Distinguisher: "dc1"}
+	updated, err = persistence.UpdateFindingLocators(ctx, finding.Identifier, locator, []intermediaries.ReportLocator{locator}, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, locator, updated.ReportLocator)
+	expectEqual(t, []intermediaries.ReportLocator{locator}, updated.ImpliedReportLocators)
+	expectEqual(t, owner, updated.Owner)
+	expectEqual(t, finding.Name, updated.Name)
+
+	found, err := persistence.GetFinding(ctx, finding.Identifier, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, updated, found)
+
+	_, err = persistence.UpdateFindingStatus(ctx, finding.Identifier, intermediaries.StatusOpen, 0, 2)
+	expectNotFound(t, err)
+	_, err = persistence.UpdateFindingOwner(ctx, finding.Identifier, owner, 2)
+	expectNotFound(t, err)
+	_, err = persistence.UpdateFindingLocators(ctx, unknownIdentifier, locator, nil, 1)
+	expectNotFound(t, err)
+}
+
+func testFindingVersions(t *testing.T, persistence database.Persistence) {
+	ctx := context.Background()
+	finding := mustUpdateFinding(t, persistence, newFinding("a", "10.0.0.1"), 1)
+	finding = mustUpdateFinding(t, persistence, newFinding("a", "10.0.0.1"), 1)
+	if finding.Version != 2 {
+		t.Fatalf("expected version 2, got %d", finding.Version)
+	}
+
+	// Changing a finding at another version than expected changes nothing
+	for _, expectedVersion := range []int{1, 3} {
+		_, err := persistence.UpdateFindingStatus(ctx, finding.Identifier, intermediaries.StatusResolved, expectedVersion, 1)
+		if !errors.Is(err, database.ErrVersionMismatch) {
+			t.Errorf("expected ErrVersionMismatch for version %d, got %v", expectedVersion, err)
+		}
+	}
+	found, err := persistence.GetFinding(ctx, finding.Identifier, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, finding, found)
+
+	updated, err := persistence.UpdateFindingStatus(ctx, finding.Identifier, intermediaries.StatusResolved, 2, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, intermediaries.StatusResolved, updated.Status)
+	expectEqual(t, 3, updated.Version)
+
+	// Not expecting any version in particular always changes the finding
+	updated, err = persistence.UpdateFindingStatus(ctx, finding.Identifier, intermediaries.StatusOpen, 0, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, 4, updated.Version)
+	updated, err = persistence.UpdateFindingOwner(ctx, finding.Identifier, intermediaries.Owner{Team: "security"}, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, 5, updated.Version)
+	updated, err = persistence.UpdateFindingLocators(ctx, finding.Identifier, finding.ReportLocator, finding.ImpliedReportLocators, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, 6, updated.Version)
+
+	// A finding that does not exist, or belongs to another organization, is not found at any version
+	_, err = persistence.UpdateFindingStatus(ctx, unknownIdentifier, intermediaries.StatusResolved, 1, 1)
+	expectNotFound(t, err)
+	_, err = persistence.UpdateFindingStatus(ctx, finding.Identifier, intermediaries.StatusResolved, 1, 2)
+	expectNotFound(t, err)
+}
+
+func testUpdateFindingAtVersion(t *testing.T, persistence database.Persistence) {
+	ctx := context.Background()
+	finding := mustUpdateFinding(t, persistence, newFinding("a", "10.0.0.1"), 1)
+
+	// Replacing a finding at another version than expected changes nothing
+	changed := newFinding("a", "10.0.0.1")
+	changed.Name = "Renamed"
+	_, err := persistence.UpdateFinding(ctx, changed, 2, 1)
+	if !errors.Is(err, database.ErrVersionMismatch) {
+		t.Errorf("expected ErrVersionMismatch, got %v", err)
+	}
+	found, err := persistence.GetFinding(ctx, finding.Identifier, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, finding, found)
+
+	updated, err := persistence.UpdateFinding(ctx, changed, 1, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if updated.Identifier != finding.Identifier || updated.Name != "Renamed" || updated.Version != 2 {
+		t.Errorf("expected the finding to be replaced at version 2, got %+v", updated)
+	}
+
+	// A finding that does not exist, or belongs to another organization, is not created when a version is expected
+	for _, organizationID := range []int{1, 2} {
+		_, err = persistence.UpdateFinding(ctx, newFinding("a", "10.0.0.2"), 1, organizationID)
+		if !errors.Is(err, database.ErrVersionMismatch) {
+			t.Errorf("expected ErrVersionMismatch, got %v", err)
+		}
+	}
+	_, err = persistence.UpdateFinding(ctx, changed, 2, 2)
+	if !errors.Is(err, database.ErrVersionMismatch) {
+		t.Errorf("expected ErrVersionMismatch in organization 2, got %v", err)
+	}
+	for organizationID, expected := range map[int]int{1: 1, 2: 0} {
+		findings, err := persistence.GetFindings(ctx, organizationID)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if len(findings) != expected {
+			t.Errorf("expected %d findings in organization %d, got %+v", expected, organizationID, findings)
+		}
+	}
+}
+
+func testDeleteFinding(t *testing.T, persistence database.Persistence) {
+	ctx := context.Background()
+	finding := mustUpdateFinding(t, persistence, newFinding("a", "10.0.0.1"), 1)
+
+	expectNotFound(t, persistence.DeleteFinding(ctx, finding.Identifier, 2))
+	if err := persistence.DeleteFinding(ctx, finding.Identifier, 1); err != nil {
+		t.Fatal(err.Error())
+	}
+	_, err := persistence.GetFinding(ctx, finding.Identifier, 1)
+	expectNotFound(t, err)
+	expectNotFound(t, persistence.DeleteFinding(ctx, finding.Identifier, 1))
+}
+
+func testTransactionCommits(t *testing.T, persistence database.Persistence) {
+	ctx := context.Background()
+	var created intermediaries.Finding
+	err := persistence.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		created, err = persistence.UpdateFinding(ctx, newFinding("a", "10.0.0.1"), 0, 1)
+		if err != nil {
+			return err
+		}
+		// Changes are visible within the transaction
+		_, err = persistence.GetFinding(ctx, created.Identifier, 1)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := persistence.GetFinding(ctx, created.Identifier, 1); err != nil {
+		t.Errorf("expected the committed finding to be stored, got %s", err.Error())
+	}
+}
+
+// testTransactionRollsBack requires a backend with transaction support, like a MongoDB replica set
+func testTransactionRollsBack(t *testing.T, persistence database.Persistence) {
+	ctx := context.Background()
+	failure := errors.New("failure")
+	stored := intermediaries.Finding{}
+	err := persistence.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		if stored, err = persistence.UpdateFinding(ctx, newFinding("a", "10.0.0.1"), 0, 1); err != nil {
+			return err
+		}
+		return persistence.InsertOutboxEvent(ctx, intermediaries.OutboxEvent{Identifier: "event-1", OrganizationId: 1, Type: "finding.created", Payload: []byte("{}"), CreatedAt: at(0)})
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	err = persistence.WithTransaction(ctx, func(ctx context.Context) error {
+		// The new finding is stored and then changed, and the stored finding is deleted
+		for range 2 {
+			if _, err := persistence.UpdateFinding(ctx, newFinding("b", "10.0.0.2"), 0, 1); err != nil {
+				return err
+			}
+		}
+		if err := persistence.DeleteFinding(ctx, stored.Identifier, 1); err != nil {
+			return err
+		}
+		if err := persistence.MarkOutboxEventDelivered(ctx, "event-1"); err != nil {
+			return err
+		}
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("expected the error of the transaction, got %v", err)
+	}
+	findings, err := persistence.GetFindings(ctx, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, []intermediaries.Finding{stored}, findings)
+	outboxEvent, err := persistence.GetOutboxEvent(ctx, "event-1", 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if outboxEvent.DeliveredAt != nil {
+		t.Error("expected the rolled back delivery to not be stored")
+	}
+}
+
+// testNestedTransactionRollsBack requires a backend with transaction support, like a MongoDB replica set
+func testNestedTransactionRollsBack(t *testing.T, persistence database.Persistence) {
+	ctx := context.Background()
+	failure := errors.New("failure")
+	err := persistence.WithTransaction(ctx, func(ctx context.Context) error {
+		// A transaction within a transaction is part of it, and is rolled back with it
+		err := persistence.WithTransaction(ctx, func(ctx context.Context) error {
+			_, err := persistence.UpdateFinding(ctx, newFinding("a", "10.0.0.1"), 0, 1)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("expected the error of the transaction, got %v", err)
+	}
+	findings, err := persistence.GetFindings(ctx, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(findings) != 0 {
+		t.Errorf("expected the rolled back finding to not be stored, got %d findings", len(findings))
+	}
+}
+
+func testOwnershipRules(t *testing.T, persistence database.Persistence) {
+	ctx := context.Background()
+	rule := intermediaries.OwnershipRule{
+		Name:               "Web",
+		Priority:           1,
+		LocatorPatterns:    []intermediaries.LocatorPattern{{Type: "HTTP", Value: "https://*.example.com/", Distinguisher: "*"}},
+		DistinguisherTypes: []string{"scanner"},
+		Owner:              intermediaries.Owner{Team: "web", Contact: "web@example.com"},
+	}
+	created, err := persistence.CreateOwnershipRule(ctx, rule, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if created.Identifier == "" {
+		t.Fatal("expected an identifier to be generated")
+	}
+	rule.Identifier = created.Identifier
+	rule.OrganizationId = 1
+	expectEqual(t, rule, created)
+
+	other, err := persistence.CreateOwnershipRule(ctx, rule, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if other.Identifier == created.Identifier {
+		t.Error("expected every rule to have its own identifier")
+	}
+
+	rule.Name = "Web shop"
+	rule.Priority = 2
+	updated, err := persistence.UpdateOwnershipRule(ctx, rule, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, rule, updated)
+	found, err := persistence.GetOwnershipRule(ctx, rule.Identifier, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, rule, found)
+
+	rules, err := persistence.GetOwnershipRules(ctx, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, []intermediaries.OwnershipRule{rule, other}, rules)
+
+	_, err = persistence.GetOwnershipRule(ctx, rule.Identifier, 2)
+	expectNotFound(t, err)
+	_, err = persistence.UpdateOwnershipRule(ctx, rule, 2)
+	expectNotFound(t, err)
+	expectNotFound(t, persistence.DeleteOwnershipRule(ctx, rule.Identifier, 2))
+	rules, err = persistence.GetOwnershipRules(ctx, 2)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, []intermediaries.OwnershipRule{}, rules)
+
+	if err := persistence.DeleteOwnershipRule(ctx, rule.Identifier, 1); err != nil {
+		t.Fatal(err.Error())
+	}
+	_, err = persistence.GetOwnershipRule(ctx, rule.Identifier, 1)
+	expectNotFound(t, err)
+}
+
+func testDistinguisherAliases(t *testing.T, persistence database.Persistence) {
+	ctx := context.Background()
+	for _, alias := range []intermediaries.DistinguisherAlias{
+		{Alias: "site-1", Distinguisher: "office"},
+		{Alias: "home-lan", Distinguisher: "office"},
+		// Setting an alias again replaces it
+		{Alias: "home-lan", Distinguisher: "apartment"},
+	} {
+		set, err := persistence.SetDistinguisherAlias(ctx, alias, 1)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		alias.OrganizationId = 1
+		expectEqual(t, alias, set)
+	}
+
+	aliases, err := persistence.GetDistinguisherAliases(ctx, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, []intermediaries.DistinguisherAlias{
+		{OrganizationId: 1, Alias: "home-lan", Distinguisher: "apartment"},
+		{OrganizationId: 1, Alias: "site-1", Distinguisher: "office"},
+	}, aliases)
+
+	_, err = persistence.GetDistinguisherAlias(ctx, "home-lan", 2)
+	expectNotFound(t, err)
+	expectNotFound(t, persistence.DeleteDistinguisherAlias(ctx, "home-lan", 2))
+
+	if err := persistence.DeleteDistinguisherAlias(ctx, "home-lan", 1); err != nil {
+		t.Fatal(err.Error())
+	}
+	_, err = persistence.GetDistinguisherAlias(ctx, "home-lan", 1)
+	expectNotFound(t, err)
+	expectNotFound(t, persistence.DeleteDistinguisherAlias(ctx, "home-lan", 1))
+}
+
+func newOutboxEvent(identifier string, organizationID int, createdAt time.Time) intermediaries.OutboxEvent {
+	return intermediaries.OutboxEvent{
+		Identifier:     identifier,
+		OrganizationId: organizationID,
+		Type:           "finding.created",
+		Payload:        []byte(`{"eventId":"` + identifier + `"}`),
+		CreatedAt:      createdAt,
+	}
+}
+
+func outboxEventIdentifiers(outboxEvents []intermediaries.OutboxEvent) []string {
+	identifiers := []string{}
+	for _, outboxEvent := range outboxEvents {
+		identifiers = append(identifiers, outboxEvent.Identifier)
+	}
+	return identifiers
+}
+
+func testClaimOutboxEvents(t *testing.T, persistence database.Persistence) {
+	ctx := context.Background()
+	for _, outboxEvent := range []intermediaries.OutboxEvent{
+		newOutboxEvent("event-3", 1, at(3)),
+		newOutboxEvent("event-1", 1, at(1)),
+		newOutboxEvent("event-2", 2, at(2)),
+	} {
+		if err := persistence.InsertOutboxEvent(ctx, outboxEvent); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	if err := persistence.InsertOutboxEvent(ctx, newOutboxEvent("event-1", 1, at(1))); !errors.Is(err, database.ErrDuplicate) {
+		t.Errorf("expected ErrDuplicate, got %v", err)
+	}
+
+	// Events of every organization are claimed, oldest first
+	claimed, err := persistence.ClaimOutboxEvents(ctx, 2, time.Minute)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, []intermediaries.OutboxEvent{newOutboxEvent("event-1", 1, at(1)), newOutboxEvent("event-2", 2, at(2))}, claimed)
+
+	// Claimed events are hidden from other claims until the lease expires
+	claimed, err = persistence.ClaimOutboxEvents(ctx, 10, time.Millisecond)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, []string{"event-3"}, outboxEventIdentifiers(claimed))
+	time.Sleep(10 * time.Millisecond)
+	claimed, err = persistence.ClaimOutboxEvents(ctx, 10, time.Minute)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, []string{"event-3"}, outboxEventIdentifiers(claimed))
+
+	// Delivered events are never claimed again
+	if err := persistence.MarkOutboxEventDelivered(ctx, "event-3"); err != nil {
+		t.Fatal(err.Error())
+	}
+	outboxEvent, err := persistence.GetOutboxEvent(ctx, "event-3", 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if outboxEvent.DeliveredAt == nil {
+		t.Error("expected the event to be marked delivered")
+	}
+	expectNotFound(t, persistence.MarkOutboxEventDelivered(ctx, "event-4"))
+}
+
+func testDeleteDeliveredOutboxEvents(t *testing.T, persistence database.Persistence) {
+	ctx := context.Background()
+	for _, outboxEvent := range []intermediaries.OutboxEvent{
+		newOutboxEvent("event-1", 1, at(1)),
+		newOutboxEvent("event-2", 2, at(2)),
+		newOutboxEvent("event-3", 1, at(3)),
+	} {
+		if err := persistence.InsertOutboxEvent(ctx, outboxEvent); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	for _, identifier := range []string{"event-1", "event-2"} {
+		if err := persistence.MarkOutboxEventDelivered(ctx, identifier); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+
+	// Events delivered after the time are kept
+	deleted, err := persistence.DeleteDeliveredOutboxEvents(ctx, time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, 0, deleted)
+
+	// Delivered events of every organization are deleted, and undelivered events are kept
+	deleted, err = persistence.DeleteDeliveredOutboxEvents(ctx, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, 2, deleted)
+	_, err = persistence.GetOutboxEvent(ctx, "event-1", 1)
+	expectNotFound(t, err)
+	outboxEvents, err := persistence.GetOutboxEventsAfter(ctx, intermediaries.OutboxCursor{}, at(3), 10, 2)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, []string{}, outboxEventIdentifiers(outboxEvents))
+	claimed, err := persistence.ClaimOutboxEvents(ctx, 10, time.Minute)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, []string{"event-3"}, outboxEventIdentifiers(claimed))
+}
+
+func testGetOutboxEventsAfter(t *testing.T, persistence database.Persistence) {
+	ctx := context.Background()
+	for _, outboxEvent := range []intermediaries.OutboxEvent{
+		newOutboxEvent("event-b", 1, at(1)),
+		newOutboxEvent("event-a", 1, at(1)),
+		newOutboxEvent("event-c", 1, at(2)),
+		newOutboxEvent("event-d", 2, at(2)),
+		newOutboxEvent("event-e", 1, at(3)),
+	} {
+		if err := persistence.InsertOutboxEvent(ctx, outboxEvent); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	tests := []struct {
+		name     string
+		cursor   intermediaries.OutboxCursor
+		until    time.Time
+		limit    int
+		expected []string
+	}{
+		{"FromStart", intermediaries.OutboxCursor{}, at(3), 10, []string{"event-a", "event-b", "event-c", "event-e"}},
+		{"Limit", intermediaries.OutboxCursor{}, at(3), 2, []string{"event-a", "event-b"}},
+		{"AfterIdentifier", intermediaries.OutboxCursor{CreatedAt: at(1), Identifier: "event-a"}, at(3), 10, []string{"event-b", "event-c", "event-e"}},
+		{"AfterTime", intermediaries.OutboxCursor{CreatedAt: at(1), Identifier: "event-b"}, at(3), 10, []string{"event-c", "event-e"}},
+		{"Until", intermediaries.OutboxCursor{}, at(2), 10, []string{"event-a", "event-b", "event-c"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			outboxEvents, err := persistence.GetOutboxEventsAfter(ctx, test.cursor, test.until, test.limit, 1)
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			expectEqual(t, test.expected, outboxEventIdentifiers(outboxEvents))
+		})
+	}
+
+	outboxEvent, err := persistence.GetOutboxEvent(ctx, "event-a", 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, newOutboxEvent("event-a", 1, at(1)), outboxEvent)
+	_, err = persistence.GetOutboxEvent(ctx, "event-a", 2)
+	expectNotFound(t, err)
+}
+
+func testWebhookSubscriptions(t *testing.T, persistence database.Persistence) {
+	ctx := context.Background()
+	subscription := intermediaries.WebhookSubscription{
+		URL:        "https://hooks.example.com/findings",
+		Secret:     "secret",
+		EventTypes: []string{"finding.created"},
+		Enabled:    true,
+		CreatedAt:  at(0),
+		UpdatedAt:  at(0),
+	}
+	created, err := persistence.CreateWebhookSubscription(ctx, subscription, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if created.Identifier == "" {
+		t.Fatal("expected an identifier to be generated")
+	}
+	subscription.Identifier = created.Identifier
+	subscription.OrganizationId = 1
+	expectEqual(t, subscription, created)
+
+	subscription.URL = "https://hooks.example.com/other"
+	subscription.UpdatedAt = at(1)
+	updated, err := persistence.UpdateWebhookSubscription(ctx, subscription, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, subscription, updated)
+
+	for failures := 1; failures <= 3; failures++ {
+		failed, err := persistence.RecordWebhookFailure(ctx, subscription.Identifier, 3, 1)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		subscription.ConsecutiveFailures = failures
+		subscription.Enabled = failures < 3
+		expectEqual(t, subscription, failed)
+	}
+	found, err := persistence.GetWebhookSubscription(ctx, subscription.Identifier, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, subscription, found)
+	subscriptions, err := persistence.GetWebhookSubscriptions(ctx, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, []intermediaries.WebhookSubscription{subscription}, subscriptions)
+
+	// A success forgets the failures, but leaves a disabled subscription disabled
+	if err := persistence.RecordWebhookSuccess(ctx, subscription.Identifier, 1); err != nil {
+		t.Fatal(err.Error())
+	}
+	subscription.ConsecutiveFailures = 0
+	found, err = persistence.GetWebhookSubscription(ctx, subscription.Identifier, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, subscription, found)
+
+	_, err = persistence.GetWebhookSubscription(ctx, subscription.Identifier, 2)
+	expectNotFound(t, err)
+	_, err = persistence.UpdateWebhookSubscription(ctx, subscription, 2)
+	expectNotFound(t, err)
+	_, err = persistence.RecordWebhookFailure(ctx, subscription.Identifier, 3, 2)
+	expectNotFound(t, err)
+	expectNotFound(t, persistence.RecordWebhookSuccess(ctx, subscription.Identifier, 2))
+	expectNotFound(t, persistence.DeleteWebhookSubscription(ctx, subscription.Identifier, 2))
+	subscriptions, err = persistence.GetWebhookSubscriptions(ctx, 2)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, []intermediaries.WebhookSubscription{}, subscriptions)
+}
+
+func testRecordWebhookFailuresConcurrently(t *testing.T, persistence database.Persistence) {
+	ctx := context.Background()
+	const disableAfter = 10
+	subscription, err := persistence.CreateWebhookSubscription(ctx, intermediaries.WebhookSubscription{
+		URL:        "https://hooks.example.com/findings",
+		EventTypes: []string{"finding.created"},
+		Enabled:    true,
+		CreatedAt:  at(0),
+		UpdatedAt:  at(0),
+	}, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// Failures recorded at the same time are all counted, and only the one reaching the limit disables the subscription
+	record := func(count int) []intermediaries.WebhookSubscription {
+		t.Helper()
+		recorded := make([]intermediaries.WebhookSubscription, count)
+		errs := make([]error, count)
+		wait := sync.WaitGroup{}
+		for index := 0; index < count; index++ {
+			wait.Add(1)
+			go func() {
+				defer wait.Done()
+				recorded[index], errs[index] = persistence.RecordWebhookFailure(ctx, subscription.Identifier, disableAfter, 1)
+			}()
+		}
+		wait.Wait()
+		if err := errors.Join(errs...); err != nil {
+			t.Fatal(err.Error())
+		}
+		return recorded
+	}
+	for _, recorded := range record(disableAfter - 1) {
+		if !recorded.Enabled {
+			t.Errorf("expected the subscription to be enabled before %d failures, got %+v", disableAfter, recorded)
+		}
+	}
+	found, err := persistence.GetWebhookSubscription(ctx, subscription.Identifier, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !found.Enabled || found.ConsecutiveFailures != disableAfter-1 {
+		t.Fatalf("expected %d failures of the enabled subscription, got %+v", disableAfter-1, found)
+	}
+	disabling := 0
+	for _, recorded := range record(disableAfter) {
+		if recorded.ConsecutiveFailures == disableAfter {
+			disabling++
+		}
+		if recorded.Enabled {
+			t.Errorf("expected the subscription to be disabled after %d failures, got %+v", disableAfter, recorded)
+		}
+	}
+	if disabling != 1 {
+		t.Errorf("expected a single failure to reach the limit, got %d", disabling)
+	}
+	found, err = persistence.GetWebhookSubscription(ctx, subscription.Identifier, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if found.Enabled || found.ConsecutiveFailures != 2*disableAfter-1 {
+		t.Errorf("expected %d failures of the disabled subscription, got %+v", 2*disableAfter-1, found)
+	}
+}
+
+func testWebhookDeliveries(t *testing.T, persistence database.Persistence) {
+	ctx := context.Background()
+	subscription, err := persistence.CreateWebhookSubscription(ctx, intermediaries.WebhookSubscription{URL: "https://hooks.example.com/findings", Enabled: true}, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	newDelivery := func(identifier string, nextAttemptAt time.Time, createdAt time.Time) intermediaries.WebhookDelivery {
+		return intermediaries.WebhookDelivery{
+			Identifier:     identifier,
+			SubscriptionId: subscription.Identifier,
+			OrganizationId: 1,
+			EventId:        "event-" + identifier,
+			EventType:      "finding.created",
+			Payload:        []byte("{}"),
+			Status:         intermediaries.DeliveryPending,
+			NextAttemptAt:  nextAttemptAt,
+			CreatedAt:      createdAt,
+		}
+	}
+	due := newDelivery("delivery-1", at(0), at(0))
+	later := newDelivery("delivery-2", time.Now().UTC().Add(time.Hour).Truncate(time.Millisecond), at(1))
+	for _, delivery := range []intermediaries.WebhookDelivery{due, later} {
+		if err := persistence.InsertWebhookDelivery(ctx, delivery); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	if err := persistence.InsertWebhookDelivery(ctx, due); !errors.Is(err, database.ErrDuplicate) {
+		t.Errorf("expected ErrDuplicate, got %v", err)
+	}
+
+	// Only deliveries that are due are claimed, and their next attempt is postponed by the lease
+	claimed, err := persistence.ClaimWebhookDeliveries(ctx, 10, time.Minute)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, []intermediaries.WebhookDelivery{due}, claimed)
+	claimed, err = persistence.ClaimWebhookDeliveries(ctx, 10, time.Minute)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, []intermediaries.WebhookDelivery{}, claimed)
+
+	attemptedAt := at(2)
+	due.Status = intermediaries.DeliverySucceeded
+	due.Attempts = 1
+	due.LastAttemptAt = &attemptedAt
+	due.LastStatusCode = 204
+	if err := persistence.UpdateWebhookDelivery(ctx, due); err != nil {
+		t.Fatal(err.Error())
+	}
+	expectNotFound(t, persistence.UpdateWebhookDelivery(ctx, newDelivery("delivery-3", at(0), at(0))))
+
+	// The most recent delivery is listed first
+	deliveries, err := persistence.GetWebhookDeliveries(ctx, subscription.Identifier, intermediaries.WebhookDeliveryCursor{}, 10, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, []intermediaries.WebhookDelivery{later, due}, deliveries)
+	deliveries, err = persistence.GetWebhookDeliveries(ctx, subscription.Identifier, intermediaries.WebhookDeliveryCursor{}, 10, 2)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, []intermediaries.WebhookDelivery{}, deliveries)
+
+	// Deleting a subscription deletes its deliveries
+	if err := persistence.DeleteWebhookSubscription(ctx, subscription.Identifier, 1); err != nil {
+		t.Fatal(err.Error())
+	}
+	deliveries, err = persistence.GetWebhookDeliveries(ctx, subscription.Identifier, intermediaries.WebhookDeliveryCursor{}, 10, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, []intermediaries.WebhookDelivery{}, deliveries)
+}
+
+func webhookDeliveryIdentifiers(deliveries []intermediaries.WebhookDelivery) []string {
+	identifiers := []string{}
+	for _, delivery := range deliveries {
+		identifiers = append(identifiers, delivery.Identifier)
+	}
+	return identifiers
+}
+
+// insertWebhookDeliveries stores a delivery to the subscription for every identifier, created at the same index of createdAt
+func insertWebhookDeliveries(t *testing.T, persistence database.Persistence, subscription intermediaries.WebhookSubscription, identifiers []string, createdAt []time.Time, status intermediaries.WebhookDeliveryStatus) {
+	t.Helper()
+	for index, identifier := range identifiers {
+		err := persistence.InsertWebhookDelivery(context.Background(), intermediaries.WebhookDelivery{
+			Identifier:     identifier,
+			SubscriptionId: subscription.Identifier,
+			OrganizationId: subscription.OrganizationId,
+			EventId:        "event-" + identifier,
+			EventType:      "finding.created",
+			Payload:        []byte("{}"),
+			Status:         status,
+			NextAttemptAt:  createdAt[index],
+			CreatedAt:      createdAt[index],
+		})
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+}
+
+func testGetWebhookDeliveriesBefore(t *testing.T, persistence database.Persistence) {
+	ctx := context.Background()
+	subscription, err := persistence.CreateWebhookSubscription(ctx, intermediaries.WebhookSubscription{URL: "https://hooks.example.com/findings", Enabled: true}, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	other, err := persistence.CreateWebhookSubscription(ctx, intermediaries.WebhookSubscription{URL: "https://hooks.example.com/other", Enabled: true}, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	insertWebhookDeliveries(t, persistence, subscription, []string{"delivery-b", "delivery-a", "delivery-c", "delivery-e"}, []time.Time{at(1), at(1), at(2), at(3)}, intermediaries.DeliverySucceeded)
+	insertWebhookDeliveries(t, persistence, other, []string{"delivery-d"}, []time.Time{at(2)}, intermediaries.DeliverySucceeded)
+	tests := []struct {
+		name     string
+		cursor   intermediaries.WebhookDeliveryCursor
+		limit    int
+		expected []string
+	}{
+		{"FromMostRecent", intermediaries.WebhookDeliveryCursor{}, 10, []string{"delivery-e", "delivery-c", "delivery-b", "delivery-a"}},
+		{"Limit", intermediaries.WebhookDeliveryCursor{}, 2, []string{"delivery-e", "delivery-c"}},
+		{"BeforeIdentifier", intermediaries.WebhookDeliveryCursor{CreatedAt: at(1), Identifier: "delivery-b"}, 10, []string{"delivery-a"}},
+		{"BeforeTime", intermediaries.WebhookDeliveryCursor{CreatedAt: at(2), Identifier: "delivery-c"}, 10, []string{"delivery-b", "delivery-a"}},
+		{"BeforeEvery", intermediaries.WebhookDeliveryCursor{CreatedAt: at(1), Identifier: "delivery-a"}, 10, []string{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			deliveries, err := persistence.GetWebhookDeliveries(ctx, subscription.Identifier, test.cursor, test.limit, 1)
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			expectEqual(t, test.expected, webhookDeliveryIdentifiers(deliveries))
+		})
+	}
+}
+
+func testDeleteWebhookDeliveries(t *testing.T, persistence database.Persistence) {
+	ctx := context.Background()
+	subscription, err := persistence.CreateWebhookSubscription(ctx, intermediaries.WebhookSubscription{URL: "https://hooks.example.com/findings", Enabled: true}, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	other, err := persistence.CreateWebhookSubscription(ctx, intermediaries.WebhookSubscription{URL: "https://hooks.example.com/findings", Enabled: true}, 2)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	insertWebhookDeliveries(t, persistence, subscription, []string{"delivery-1", "delivery-3"}, []time.Time{at(1), at(3)}, intermediaries.DeliverySucceeded)
+	insertWebhookDeliveries(t, persistence, subscription, []string{"delivery-2"}, []time.Time{at(1)}, intermediaries.DeliveryPending)
+	insertWebhookDeliveries(t, persistence, other, []string{"delivery-4"}, []time.Time{at(2)}, intermediaries.DeliveryFailed)
+
+	// Deliveries of every organization that are no longer pending are deleted, and pending deliveries are kept
+	deleted, err := persistence.DeleteWebhookDeliveries(ctx, at(3))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, 2, deleted)
+	deliveries, err := persistence.GetWebhookDeliveries(ctx, subscription.Identifier, intermediaries.WebhookDeliveryCursor{}, 10, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, []string{"delivery-3", "delivery-2"}, webhookDeliveryIdentifiers(deliveries))
+	deliveries, err = persistence.GetWebhookDeliveries(ctx, other.Identifier, intermediaries.WebhookDeliveryCursor{}, 10, 2)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, []string{}, webhookDeliveryIdentifiers(deliveries))
+	claimed, err := persistence.ClaimWebhookDeliveries(ctx, 10, time.Minute)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, []string{"delivery-2"}, webhookDeliveryIdentifiers(claimed))
+}
+
+func testSoftDeleteFinding(t *testing.T, persistence database.Persistence) {
+	ctx := context.Background()
+	finding := mustUpdateFinding(t, persistence, newFinding("a", "10.0.0.1"), 1)
+
+	_, err := persistence.SoftDeleteFinding(ctx, finding.Identifier, 7, 2, 1)
+	if !errors.Is(err, database.ErrVersionMismatch) {
+		t.Errorf("expected ErrVersionMismatch, got %v", err)
+	}
+	_, err = persistence.SoftDeleteFinding(ctx, finding.Identifier, 7, 0, 2)
+	expectNotFound(t, err)
+	_, err = persistence.SoftDeleteFinding(ctx, unknownIdentifier, 7, 0, 1)
+	expectNotFound(t, err)
+
+	deleted, err := persistence.SoftDeleteFinding(ctx, finding.Identifier, 7, 1, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !deleted.Deleted() || deleted.DeletedBy != 7 || deleted.Version != 2 {
+		t.Errorf("expected the finding to be deleted by 7 at version 2, got %+v", deleted)
+	}
+	if deleted.DeletedAt.Before(finding.UpdatedAt) {
+		t.Errorf("expected the finding to be deleted after it was stored, got %s", deleted.DeletedAt)
+	}
+
+	// The tombstone is read like any other finding
+	found, err := persistence.GetFinding(ctx, finding.Identifier, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, deleted, found)
+	found, err = persistence.GetFindingByReport(ctx, finding.ReportDistinguisher, finding.ReportLocator, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, deleted, found)
+	findings, err := persistence.GetFindings(ctx, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, []intermediaries.Finding{deleted}, findings)
+
+	// Storing the finding again brings it back
+	restored := mustUpdateFinding(t, persistence, newFinding("a", "10.0.0.1"), 1)
+	if restored.Identifier != finding.Identifier || restored.Deleted() || restored.DeletedBy != 0 || restored.Version != 3 {
+		t.Errorf("expected the finding to be brought back at version 3, got %+v", restored)
+	}
+
+	// A tombstone is deleted for good like any other finding
+	if _, err := persistence.SoftDeleteFinding(ctx, finding.Identifier, 7, 0, 1); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := persistence.DeleteFinding(ctx, finding.Identifier, 1); err != nil {
+		t.Fatal(err.Error())
+	}
+	_, err = persistence.GetFinding(ctx, finding.Identifier, 1)
+	expectNotFound(t, err)
+}
+
+func testRetentionPolicies(t *testing.T, persistence database.Persistence) {
+	ctx := context.Background()
+	_, err := persistence.GetRetentionPolicy(ctx, 1)
+	expectNotFound(t, err)
+	policies, err := persistence.GetRetentionPolicies(ctx)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, []intermediaries.RetentionPolicy{}, policies)
+
+	first, err := persistence.SetRetentionPolicy(ctx, intermediaries.RetentionPolicy{OrganizationId: 3, ResolvedDays: 30, DeletedDays: 7}, 10)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, intermediaries.RetentionPolicy{OrganizationId: 10, ResolvedDays: 30, DeletedDays: 7}, first)
+	second, err := persistence.SetRetentionPolicy(ctx, intermediaries.RetentionPolicy{DeletedDays: 1}, 2)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	found, err := persistence.GetRetentionPolicy(ctx, 10)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, first, found)
+	policies, err = persistence.GetRetentionPolicies(ctx)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, []intermediaries.RetentionPolicy{second, first}, policies)
+
+	// Setting the policy again replaces it
+	replaced, err := persistence.SetRetentionPolicy(ctx, intermediaries.RetentionPolicy{ResolvedDays: 90}, 10)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	found, err = persistence.GetRetentionPolicy(ctx, 10)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, replaced, found)
+	expectEqual(t, 0, found.DeletedDays)
+
+	archiving, err := persistence.SetRetentionPolicy(ctx, intermediaries.RetentionPolicy{ResolvedDays: 90, ArchiveDays: 30}, 10)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	found, err = persistence.GetRetentionPolicy(ctx, 10)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, archiving, found)
+	expectEqual(t, 30, found.ArchiveDays)
+}
+
+func testArchivedFindings(t *testing.T, persistence database.Persistence) {
+	ctx := context.Background()
+	resolved := newFinding("a", "10.0.0.1")
+	resolved.Status = intermediaries.StatusResolved
+	resolved.ImpliedReportLocators = append(resolved.ImpliedReportLocators, intermediaries.ReportLocator{Type: "hostname", Value: "host-a", Distinguisher: intermediaries.GlobalDistinguisher})
+	finding := mustUpdateFinding(t, persistence, resolved, 1)
+	active := mustUpdateFinding(t, persistence, newFinding("b", "10.0.0.2"), 1)
+
+	archived, err := persistence.ArchiveFinding(ctx, finding.Identifier, at(5), 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expected := finding
+	archivedAt := at(5)
+	expected.ArchivedAt = &archivedAt
+	expectEqual(t, expected, archived)
+
+	// The archived finding is no longer among the active findings
+	_, err = persistence.GetFinding(ctx, finding.Identifier, 1)
+	expectNotFound(t, err)
+	_, err = persistence.GetFindingByReport(ctx, finding.ReportDistinguisher, finding.ReportLocator, 1)
+	expectNotFound(t, err)
+	findings, err := persistence.GetFindings(ctx, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, []intermediaries.Finding{active}, findings)
+
+	found, err := persistence.GetArchivedFinding(ctx, finding.Identifier, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, archived, found)
+	found, err = persistence.GetArchivedFindingByReport(ctx, finding.ReportDistinguisher, finding.ReportLocator, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, archived, found)
+	archivedFindings, err := persistence.GetArchivedFindings(ctx, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, []intermediaries.Finding{archived}, archivedFindings)
+
+	// Archiving or reading it as another organization finds nothing
+	_, err = persistence.ArchiveFinding(ctx, active.Identifier, at(5), 2)
+	expectNotFound(t, err)
+	_, err = persistence.GetArchivedFinding(ctx, finding.Identifier, 2)
+	expectNotFound(t, err)
+	_, err = persistence.RestoreArchivedFinding(ctx, finding.Identifier, 2)
+	expectNotFound(t, err)
+	expectNotFound(t, persistence.DeleteArchivedFinding(ctx, finding.Identifier, 2))
+	_, err = persistence.ArchiveFinding(ctx, finding.Identifier, at(6), 1)
+	expectNotFound(t, err)
+
+	// Restoring the finding makes it active again, as it was
+	restored, err := persistence.RestoreArchivedFinding(ctx, finding.Identifier, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, finding, restored)
+	_, err = persistence.GetArchivedFinding(ctx, finding.Identifier, 1)
+	expectNotFound(t, err)
+	found, err = persistence.GetFinding(ctx, finding.Identifier, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, finding, found)
+
+	// A finding can not be restored over an active finding reported on the same report
+	if _, err := persistence.ArchiveFinding(ctx, finding.Identifier, at(7), 1); err != nil {
+		t.Fatal(err.Error())
+	}
+	mustUpdateFinding(t, persistence, newFinding("a", "10.0.0.1"), 1)
+	_, err = persistence.RestoreArchivedFinding(ctx, finding.Identifier, 1)
+	if !errors.Is(err, database.ErrDuplicate) {
+		t.Errorf("expected ErrDuplicate, got %v", err)
+	}
+
+	if err := persistence.DeleteArchivedFinding(ctx, finding.Identifier, 1); err != nil {
+		t.Fatal(err.Error())
+	}
+	_, err = persistence.GetArchivedFinding(ctx, finding.Identifier, 1)
+	expectNotFound(t, err)
+	expectNotFound(t, persistence.DeleteArchivedFinding(ctx, finding.Identifier, 1))
+}
+
+func newAuditEntry(findingIdentifier string, action intermediaries.AuditAction, minutes int) intermediaries.AuditEntry {
+	return intermediaries.AuditEntry{
+		FindingIdentifier: findingIdentifier,
+		Action:            action,
+		Actor:             intermediaries.AuditActor{UserId: 7, RequestId: "request", SourceIP: "192.0.2.1"},
+		Changes: []intermediaries.AuditChange{
+			{Field: "status", Before: `"open"`, After: `"resolved"`},
+			{Field: "severity", Before: `"low"`, After: `"high"`},
+		},
+		CreatedAt: at(minutes),
+	}
+}
+
+func testAuditEntries(t *testing.T, persistence database.Persistence) {
+	ctx := context.Background()
+	entries, err := persistence.GetAuditEntries(ctx, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, []intermediaries.AuditEntry{}, entries)
+
+	first, err := persistence.AppendAuditEntry(ctx, newAuditEntry("first", intermediaries.AuditCreated, 1), 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, 1, first.OrganizationId)
+	expectEqual(t, 1, first.Sequence)
+	expectEqual(t, "", first.PreviousHash)
+	// Every organization has a chain of its own
+	other, err := persistence.AppendAuditEntry(ctx, newAuditEntry("other", intermediaries.AuditCreated, 2), 10)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, 1, other.Sequence)
+	second, err := persistence.AppendAuditEntry(ctx, intermediaries.AuditEntry{FindingIdentifier: "first", Action: intermediaries.AuditPurged, CreatedAt: at(3)}, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, 2, second.Sequence)
+	expectEqual(t, first.Hash, second.PreviousHash)
+
+	entries, err = persistence.GetAuditEntries(ctx, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	second.Changes = []intermediaries.AuditChange{}
+	expectEqual(t, []intermediaries.AuditEntry{first, second}, entries)
+	expectEqual(t, intermediaries.AuditVerification{Entries: 2}, intermediaries.VerifyAuditChain(entries))
+	entries, err = persistence.GetAuditEntries(ctx, 10)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, []intermediaries.AuditEntry{other}, entries)
+}
+
+func auditSequences(entries []intermediaries.AuditEntry) []int {
+	sequences := []int{}
+	for _, entry := range entries {
+		sequences = append(sequences, entry.Sequence)
+	}
+	return sequences
+}
+
+func testGetAuditEntriesAfter(t *testing.T, persistence database.Persistence) {
+	ctx := context.Background()
+	appended := []intermediaries.AuditEntry{}
+	for _, entry := range []intermediaries.AuditEntry{
+		newAuditEntry("finding-a", intermediaries.AuditCreated, 1),
+		newAuditEntry("finding-b", intermediaries.AuditCreated, 2),
+		newAuditEntry("finding-a", intermediaries.AuditStatusChanged, 3),
+		newAuditEntry("finding-a", intermediaries.AuditDeleted, 4),
+	} {
+		if entry.Action == intermediaries.AuditStatusChanged {
+			entry.Actor.UserId = 8
+		}
+		stored, err := persistence.AppendAuditEntry(ctx, entry, 1)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		appended = append(appended, stored)
+	}
+	if _, err := persistence.AppendAuditEntry(ctx, newAuditEntry("finding-a", intermediaries.AuditCreated, 1), 10); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	tests := []struct {
+		name     string
+		filter   intermediaries.AuditFilter
+		after    int
+		limit    int
+		expected []int
+	}{
+		{"Every", intermediaries.AuditFilter{}, 0, 10, []int{1, 2, 3, 4}},
+		{"Limit", intermediaries.AuditFilter{}, 0, 2, []int{1, 2}},
+		{"After", intermediaries.AuditFilter{}, 2, 10, []int{3, 4}},
+		{"AfterEvery", intermediaries.AuditFilter{}, 4, 10, []int{}},
+		{"Finding", intermediaries.AuditFilter{FindingIdentifier: "finding-a"}, 0, 10, []int{1, 3, 4}},
+		{"FindingAfter", intermediaries.AuditFilter{FindingIdentifier: "finding-a"}, 1, 1, []int{3}},
+		{"UnknownFinding", intermediaries.AuditFilter{FindingIdentifier: "finding-c"}, 0, 10, []int{}},
+		{"User", intermediaries.AuditFilter{UserId: 8}, 0, 10, []int{3}},
+		{"Actions", intermediaries.AuditFilter{Actions: []intermediaries.AuditAction{intermediaries.AuditCreated, intermediaries.AuditDeleted}}, 0, 10, []int{1, 2, 4}},
+		{"Since", intermediaries.AuditFilter{Since: at(3)}, 0, 10, []int{3, 4}},
+		{"Until", intermediaries.AuditFilter{Until: at(2)}, 0, 10, []int{1}},
+		{"EveryCriteria", intermediaries.AuditFilter{FindingIdentifier: "finding-a", Actions: []intermediaries.AuditAction{intermediaries.AuditDeleted}, Since: at(2), Until: at(5)}, 0, 10, []int{4}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			entries, err := persistence.GetAuditEntriesAfter(ctx, test.filter, test.after, test.limit, 1)
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			expectEqual(t, test.expected, auditSequences(entries))
+		})
+	}
+
+	// Entries are read whole, with the changes of their own only
+	entries, err := persistence.GetAuditEntriesAfter(ctx, intermediaries.AuditFilter{FindingIdentifier: "finding-a"}, 0, 10, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, []intermediaries.AuditEntry{appended[0], appended[2], appended[3]}, entries)
+	entries, err = persistence.GetAuditEntriesAfter(ctx, intermediaries.AuditFilter{}, 0, 10, 10)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, []int{1}, auditSequences(entries))
+}
+
+func testAuditEntriesRollBack(t *testing.T, persistence database.Persistence) {
+	ctx := context.Background()
+	first, err := persistence.AppendAuditEntry(ctx, newAuditEntry("first", intermediaries.AuditCreated, 1), 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	failure := errors.New("failure")
+	err = persistence.WithTransaction(ctx, func(ctx context.Context) error {
+		if _, err := persistence.AppendAuditEntry(ctx, newAuditEntry("first", intermediaries.AuditUpdated, 2), 1); err != nil {
+			return err
+		}
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("expected the error of the transaction, got %v", err)
+	}
+	// The entry of the failed transaction is not part of the chain, and the next entry takes its place
+	second, err := persistence.AppendAuditEntry(ctx, newAuditEntry("first", intermediaries.AuditDeleted, 3), 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, 2, second.Sequence)
+	entries, err := persistence.GetAuditEntries(ctx, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, []intermediaries.AuditEntry{first, second}, entries)
+}
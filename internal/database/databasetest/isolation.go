@@ -0,0 +1,226 @@
+package databasetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Kaese72/finding-registry/internal/database"
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
+)
+
+// organizationState is everything an organization can read through the persistence
+type organizationState struct {
+	findings             []intermediaries.Finding
+	archivedFindings     []intermediaries.Finding
+	ownershipRules       []intermediaries.OwnershipRule
+	distinguisherAliases []intermediaries.DistinguisherAlias
+	outboxEvents         []intermediaries.OutboxEvent
+	webhookSubscriptions []intermediaries.WebhookSubscription
+	webhookDeliveries    map[string][]intermediaries.WebhookDelivery
+	auditEntries         []intermediaries.AuditEntry
+}
+
+func readOrganizationState(t *testing.T, persistence database.Persistence, organizationID int) organizationState {
+	t.Helper()
+	ctx := context.Background()
+	state := organizationState{webhookDeliveries: map[string][]intermediaries.WebhookDelivery{}}
+	var err error
+	if state.findings, err = persistence.GetFindings(ctx, organizationID); err != nil {
+		t.Fatal(err.Error())
+	}
+	if state.archivedFindings, err = persistence.GetArchivedFindings(ctx, organizationID); err != nil {
+		t.Fatal(err.Error())
+	}
+	if state.ownershipRules, err = persistence.GetOwnershipRules(ctx, organizationID); err != nil {
+		t.Fatal(err.Error())
+	}
+	if state.distinguisherAliases, err = persistence.GetDistinguisherAliases(ctx, organizationID); err != nil {
+		t.Fatal(err.Error())
+	}
+	if state.outboxEvents, err = persistence.GetOutboxEventsAfter(ctx, intermediaries.OutboxCursor{}, at(59), 100, organizationID); err != nil {
+		t.Fatal(err.Error())
+	}
+	if state.webhookSubscriptions, err = persistence.GetWebhookSubscriptions(ctx, organizationID); err != nil {
+		t.Fatal(err.Error())
+	}
+	for _, subscription := range state.webhookSubscriptions {
+		if state.webhookDeliveries[subscription.Identifier], err = persistence.GetWebhookDeliveries(ctx, subscription.Identifier, intermediaries.WebhookDeliveryCursor{}, 100, organizationID); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	if state.auditEntries, err = persistence.GetAuditEntries(ctx, organizationID); err != nil {
+		t.Fatal(err.Error())
+	}
+	return state
+}
+
+func testUpdateFindingScopedByOrganization(t *testing.T, persistence database.Persistence) {
+	ctx := context.Background()
+	finding := mustUpdateFinding(t, persistence, newFinding("a", "10.0.0.1"), 1)
+
+	// Another organization reporting the same distinguisher and locator has a finding of its own
+	reported := newFinding("a", "10.0.0.1")
+	reported.Name = "Reported by organization 2"
+	other := mustUpdateFinding(t, persistence, reported, 2)
+	if other.Identifier == finding.Identifier {
+		t.Fatal("expected another organization to get a finding of its own")
+	}
+	if other.OrganizationId != 2 {
+		t.Errorf("expected organization 2, got %d", other.OrganizationId)
+	}
+
+	found, err := persistence.GetFinding(ctx, finding.Identifier, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, finding, found)
+	found, err = persistence.GetFindingByReport(ctx, reported.ReportDistinguisher, reported.ReportLocator, 2)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, other, found)
+}
+
+// testTenantIsolation calls every method taking an organization as another organization,
+// and expects nothing of the first organization to be read or changed
+func testTenantIsolation(t *testing.T, persistence database.Persistence) {
+	ctx := context.Background()
+	finding := mustUpdateFinding(t, persistence, newFinding("a", "10.0.0.1"), 1)
+	archivable := newFinding("b", "10.0.0.2")
+	archivable.Status = intermediaries.StatusResolved
+	archived, err := persistence.ArchiveFinding(ctx, mustUpdateFinding(t, persistence, archivable, 1).Identifier, at(1), 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	rule, err := persistence.CreateOwnershipRule(ctx, intermediaries.OwnershipRule{
+		Name:               "Scanners",
+		DistinguisherTypes: []string{"scanner"},
+		Owner:              intermediaries.Owner{Team: "platform"},
+	}, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	alias, err := persistence.SetDistinguisherAlias(ctx, intermediaries.DistinguisherAlias{Alias: "site-1", Distinguisher: "office"}, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	outboxEvent := newOutboxEvent("event-1", 1, at(1))
+	if err := persistence.InsertOutboxEvent(ctx, outboxEvent); err != nil {
+		t.Fatal(err.Error())
+	}
+	subscription, err := persistence.CreateWebhookSubscription(ctx, intermediaries.WebhookSubscription{URL: "https://hooks.example.com/findings", Enabled: true, CreatedAt: at(0), UpdatedAt: at(0)}, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	delivery := intermediaries.WebhookDelivery{
+		Identifier:     "delivery-1",
+		SubscriptionId: subscription.Identifier,
+		OrganizationId: 1,
+		EventId:        outboxEvent.Identifier,
+		EventType:      outboxEvent.Type,
+		Payload:        []byte("{}"),
+		Status:         intermediaries.DeliveryPending,
+		NextAttemptAt:  time.Now().UTC().Add(time.Hour).Truncate(time.Millisecond),
+		CreatedAt:      at(1),
+	}
+	if err := persistence.InsertWebhookDelivery(ctx, delivery); err != nil {
+		t.Fatal(err.Error())
+	}
+	policy, err := persistence.SetRetentionPolicy(ctx, intermediaries.RetentionPolicy{ResolvedDays: 30}, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := persistence.AppendAuditEntry(ctx, newAuditEntry(finding.Identifier, intermediaries.AuditCreated, 1), 1); err != nil {
+		t.Fatal(err.Error())
+	}
+	before := readOrganizationState(t, persistence, 1)
+
+	// Reading as organization 2 finds nothing of organization 1
+	_, err = persistence.GetFinding(ctx, finding.Identifier, 2)
+	expectNotFound(t, err)
+	_, err = persistence.GetFindingByReport(ctx, finding.ReportDistinguisher, finding.ReportLocator, 2)
+	expectNotFound(t, err)
+	_, err = persistence.GetArchivedFinding(ctx, archived.Identifier, 2)
+	expectNotFound(t, err)
+	_, err = persistence.GetArchivedFindingByReport(ctx, archived.ReportDistinguisher, archived.ReportLocator, 2)
+	expectNotFound(t, err)
+	_, err = persistence.GetOwnershipRule(ctx, rule.Identifier, 2)
+	expectNotFound(t, err)
+	_, err = persistence.GetDistinguisherAlias(ctx, alias.Alias, 2)
+	expectNotFound(t, err)
+	_, err = persistence.GetOutboxEvent(ctx, outboxEvent.Identifier, 2)
+	expectNotFound(t, err)
+	_, err = persistence.GetWebhookSubscription(ctx, subscription.Identifier, 2)
+	expectNotFound(t, err)
+	_, err = persistence.GetRetentionPolicy(ctx, 2)
+	expectNotFound(t, err)
+	expectEqual(t, organizationState{
+		findings:             []intermediaries.Finding{},
+		archivedFindings:     []intermediaries.Finding{},
+		ownershipRules:       []intermediaries.OwnershipRule{},
+		distinguisherAliases: []intermediaries.DistinguisherAlias{},
+		outboxEvents:         []intermediaries.OutboxEvent{},
+		webhookSubscriptions: []intermediaries.WebhookSubscription{},
+		webhookDeliveries:    map[string][]intermediaries.WebhookDelivery{},
+		auditEntries:         []intermediaries.AuditEntry{},
+	}, readOrganizationState(t, persistence, 2))
+	deliveries, err := persistence.GetWebhookDeliveries(ctx, subscription.Identifier, intermediaries.WebhookDeliveryCursor{}, 10, 2)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, []intermediaries.WebhookDelivery{}, deliveries)
+
+	// Changing the entities of organization 1 as organization 2 fails
+	_, err = persistence.UpdateFindingStatus(ctx, finding.Identifier, intermediaries.StatusResolved, 0, 2)
+	expectNotFound(t, err)
+	_, err = persistence.UpdateFindingOwner(ctx, finding.Identifier, intermediaries.Owner{Team: "intruder"}, 2)
+	expectNotFound(t, err)
+	_, err = persistence.UpdateFindingLocators(ctx, finding.Identifier, finding.ReportLocator, nil, 2)
+	expectNotFound(t, err)
+	_, err = persistence.SoftDeleteFinding(ctx, finding.Identifier, 7, 0, 2)
+	expectNotFound(t, err)
+	expectNotFound(t, persistence.DeleteFinding(ctx, finding.Identifier, 2))
+	_, err = persistence.ArchiveFinding(ctx, finding.Identifier, at(2), 2)
+	expectNotFound(t, err)
+	_, err = persistence.RestoreArchivedFinding(ctx, archived.Identifier, 2)
+	expectNotFound(t, err)
+	expectNotFound(t, persistence.DeleteArchivedFinding(ctx, archived.Identifier, 2))
+	intruding := rule
+	intruding.Owner = intermediaries.Owner{Team: "intruder"}
+	_, err = persistence.UpdateOwnershipRule(ctx, intruding, 2)
+	expectNotFound(t, err)
+	expectNotFound(t, persistence.DeleteOwnershipRule(ctx, rule.Identifier, 2))
+	expectNotFound(t, persistence.DeleteDistinguisherAlias(ctx, alias.Alias, 2))
+	_, err = persistence.UpdateWebhookSubscription(ctx, subscription, 2)
+	expectNotFound(t, err)
+	_, err = persistence.RecordWebhookFailure(ctx, subscription.Identifier, 5, 2)
+	expectNotFound(t, err)
+	expectNotFound(t, persistence.RecordWebhookSuccess(ctx, subscription.Identifier, 2))
+	expectNotFound(t, persistence.DeleteWebhookSubscription(ctx, subscription.Identifier, 2))
+
+	// Creating entities with the same keys as organization 2 leaves those of organization 1 alone
+	mustUpdateFinding(t, persistence, newFinding("a", "10.0.0.1"), 2)
+	if _, err := persistence.SetDistinguisherAlias(ctx, intermediaries.DistinguisherAlias{Alias: alias.Alias, Distinguisher: "intruder"}, 2); err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := persistence.CreateOwnershipRule(ctx, rule, 2); err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := persistence.CreateWebhookSubscription(ctx, subscription, 2); err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := persistence.SetRetentionPolicy(ctx, intermediaries.RetentionPolicy{ResolvedDays: 1}, 2); err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := persistence.AppendAuditEntry(ctx, newAuditEntry(finding.Identifier, intermediaries.AuditUpdated, 2), 2); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	expectEqual(t, before, readOrganizationState(t, persistence, 1))
+	found, err := persistence.GetRetentionPolicy(ctx, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectEqual(t, policy, found)
+}
@@ -0,0 +1,307 @@
+package database
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
+)
+
+// memoryState is everything stored by the in-memory persistence. Stored values are never modified in place,
+// and are only changed with memorySet and memoryDelete, so that transactions can undo them.
+type memoryState struct {
+	findings             map[string]intermediaries.Finding
+	archivedFindings     map[string]intermediaries.Finding
+	ownershipRules       map[string]intermediaries.OwnershipRule
+	distinguisherAliases map[memoryAliasKey]intermediaries.DistinguisherAlias
+	outbox               map[string]memoryOutboxEvent
+	webhookSubscriptions map[string]intermediaries.WebhookSubscription
+	webhookDeliveries    map[string]intermediaries.WebhookDelivery
+	retentionPolicies    map[int]intermediaries.RetentionPolicy
+	auditEntries         map[memoryAuditKey]intermediaries.AuditEntry
+	// auditSequences is the sequence of the last audit entry of every organization
+	auditSequences map[int]int
+}
+
+func newMemoryState() memoryState {
+	return memoryState{
+		findings:             map[string]intermediaries.Finding{},
+		archivedFindings:     map[string]intermediaries.Finding{},
+		ownershipRules:       map[string]intermediaries.OwnershipRule{},
+		distinguisherAliases: map[memoryAliasKey]intermediaries.DistinguisherAlias{},
+		outbox:               map[string]memoryOutboxEvent{},
+		webhookSubscriptions: map[string]intermediaries.WebhookSubscription{},
+		webhookDeliveries:    map[string]intermediaries.WebhookDelivery{},
+		retentionPolicies:    map[int]intermediaries.RetentionPolicy{},
+		auditEntries:         map[memoryAuditKey]intermediaries.AuditEntry{},
+		auditSequences:       map[int]int{},
+	}
+}
+
+type memoryStore struct {
+	mu    sync.Mutex
+	state memoryState
+	// undo holds a function restoring every value changed by the running transaction, in the order they were changed,
+	// and is nil outside of transactions
+	undo []func()
+}
+
+// memorySet stores the value under the key of one of the maps of the state, so that the running transaction can undo it
+func memorySet[K comparable, V any](store *memoryStore, values map[K]V, key K, value V) {
+	store.recordUndo(undoMemoryChange(values, key))
+	values[key] = value
+}
+
+// memoryDelete deletes the key from one of the maps of the state, so that the running transaction can undo it
+func memoryDelete[K comparable, V any](store *memoryStore, values map[K]V, key K) {
+	store.recordUndo(undoMemoryChange(values, key))
+	delete(values, key)
+}
+
+// undoMemoryChange returns the function restoring the key of the map to what it is now
+func undoMemoryChange[K comparable, V any](values map[K]V, key K) func() {
+	previous, existed := values[key]
+	return func() {
+		if existed {
+			values[key] = previous
+		} else {
+			delete(values, key)
+		}
+	}
+}
+
+// recordUndo remembers how to undo a change, if it is made by a transaction. The lock of the store is held by
+// the transaction while it runs, so every change made while there is a transaction is made by it.
+func (store *memoryStore) recordUndo(undo func()) {
+	if store.undo != nil {
+		store.undo = append(store.undo, undo)
+	}
+}
+
+// memoryTransactionKey marks the context of a transaction, and holds the store the transaction is on
+type memoryTransactionKey struct{}
+
+// memoryFindingsPersistence keeps everything in memory, and is meant for tests and local development.
+// It behaves like the MongoDB persistence, but nothing is kept when the process stops.
+type memoryFindingsPersistence struct {
+	store *memoryStore
+}
+
+func NewMemoryFindingsPersistence() memoryFindingsPersistence {
+	return memoryFindingsPersistence{store: &memoryStore{state: newMemoryState()}}
+}
+
+// lock locks the store, unless the context is of a transaction already holding the lock
+func (persistence memoryFindingsPersistence) lock(ctx context.Context) func() {
+	if ctx.Value(memoryTransactionKey{}) == persistence.store {
+		return func() {}
+	}
+	persistence.store.mu.Lock()
+	return persistence.store.mu.Unlock
+}
+
+// WithTransaction holds the lock of the store while the function runs, so transactions are serializable,
+// and undoes the changes made by the transaction if it fails
+func (persistence memoryFindingsPersistence) WithTransaction(ctx context.Context, fn func(context.Context) error) error {
+	if ctx.Value(memoryTransactionKey{}) == persistence.store {
+		return fn(ctx)
+	}
+	store := persistence.store
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.undo = []func(){}
+	defer func() { store.undo = nil }()
+	if err := fn(context.WithValue(ctx, memoryTransactionKey{}, store)); err != nil {
+		for index := len(store.undo) - 1; index >= 0; index-- {
+			store.undo[index]()
+		}
+		return err
+	}
+	return nil
+}
+
+func cloneReportLocators(locators []intermediaries.ReportLocator) []intermediaries.ReportLocator {
+	return append([]intermediaries.ReportLocator{}, locators...)
+}
+
+func cloneFinding(finding intermediaries.Finding) intermediaries.Finding {
+	finding.ImpliedReportLocators = cloneReportLocators(finding.ImpliedReportLocators)
+	return finding
+}
+
+// sortedFindings lists the findings of the organization in the order they were created
+func (state memoryState) sortedFindings(organizationID int) []intermediaries.Finding {
+	return sortFindings(state.findings, organizationID)
+}
+
+// sortFindings lists the findings of the organization among the findings in the order they were created
+func sortFindings(all map[string]intermediaries.Finding, organizationID int) []intermediaries.Finding {
+	findings := []intermediaries.Finding{}
+	for _, finding := range all {
+		if finding.OrganizationId == organizationID {
+			findings = append(findings, cloneFinding(finding))
+		}
+	}
+	sort.Slice(findings, func(i, j int) bool { return findings[i].Identifier < findings[j].Identifier })
+	return findings
+}
+
+func (persistence memoryFindingsPersistence) UpdateFinding(ctx context.Context, findingI intermediaries.Finding, expectedVersion int, organizationID int) (intermediaries.Finding, error) {
+	defer persistence.lock(ctx)()
+	state := persistence.store.state
+	findingI = cloneFinding(findingI)
+	findingI.OrganizationId = organizationID
+	for identifier, existing := range state.findings {
+		if existing.OrganizationId == organizationID && existing.ReportDistinguisher == findingI.ReportDistinguisher && existing.ReportLocator == findingI.ReportLocator {
+			if expectedVersion != 0 && existing.Version != expectedVersion {
+				return intermediaries.Finding{}, ErrVersionMismatch
+			}
+			findingI.Identifier = identifier
+			findingI.Version = existing.Version + 1
+			break
+		}
+	}
+	if findingI.Identifier == "" {
+		if expectedVersion != 0 {
+			return intermediaries.Finding{}, ErrVersionMismatch
+		}
+		findingI.Identifier = newIdentifier()
+		findingI.Version = 1
+	}
+	memorySet(persistence.store, state.findings, findingI.Identifier, findingI)
+	return cloneFinding(findingI), nil
+}
+
+func (persistence memoryFindingsPersistence) GetFinding(ctx context.Context, identifier string, organizationID int) (intermediaries.Finding, error) {
+	defer persistence.lock(ctx)()
+	finding, ok := persistence.store.state.findings[identifier]
+	if !ok || finding.OrganizationId != organizationID {
+		return intermediaries.Finding{}, ErrNotFound
+	}
+	return cloneFinding(finding), nil
+}
+
+func (persistence memoryFindingsPersistence) GetFindings(ctx context.Context, organizationID int) ([]intermediaries.Finding, error) {
+	defer persistence.lock(ctx)()
+	return persistence.store.state.sortedFindings(organizationID), nil
+}
+
+func (persistence memoryFindingsPersistence) GetFindingsAfter(ctx context.Context, after string, limit int, organizationID int) ([]intermediaries.Finding, error) {
+	defer persistence.lock(ctx)()
+	return findingsAfter(persistence.store.state.sortedFindings(organizationID), after, limit), nil
+}
+
+// findingsAfter pages through findings sorted in the order they were created
+func findingsAfter(findings []intermediaries.Finding, after string, limit int) []intermediaries.Finding {
+	page := []intermediaries.Finding{}
+	for _, finding := range findings {
+		if len(page) == limit {
+			break
+		}
+		if finding.Identifier > after {
+			page = append(page, finding)
+		}
+	}
+	return page
+}
+
+func (persistence memoryFindingsPersistence) GetFindingsByLocatorType(ctx context.Context, locatorType intermediaries.ReportLocatorType, organizationID int) ([]intermediaries.Finding, error) {
+	defer persistence.lock(ctx)()
+	findings := []intermediaries.Finding{}
+	for _, finding := range persistence.store.state.sortedFindings(organizationID) {
+		if findingOnLocatorType(finding, locatorType) {
+			findings = append(findings, finding)
+		}
+	}
+	return findings, nil
+}
+
+// findingOnLocatorType checks if the finding is reported on, or implies, a locator of the type
+func findingOnLocatorType(finding intermediaries.Finding, locatorType intermediaries.ReportLocatorType) bool {
+	if finding.ReportLocator.Type == locatorType {
+		return true
+	}
+	for _, implied := range finding.ImpliedReportLocators {
+		if implied.Type == locatorType {
+			return true
+		}
+	}
+	return false
+}
+
+func (persistence memoryFindingsPersistence) GetFindingByReport(ctx context.Context, distinguisher intermediaries.ReportDistinguisher, locator intermediaries.ReportLocator, organizationID int) (intermediaries.Finding, error) {
+	defer persistence.lock(ctx)()
+	for _, finding := range persistence.store.state.sortedFindings(organizationID) {
+		if finding.ReportDistinguisher == distinguisher && finding.ReportLocator == locator {
+			return finding, nil
+		}
+	}
+	return intermediaries.Finding{}, ErrNotFound
+}
+
+// updateFinding changes a single finding of the organization, unless change fails
+func (persistence memoryFindingsPersistence) updateFinding(ctx context.Context, identifier string, organizationID int, change func(*intermediaries.Finding) error) (intermediaries.Finding, error) {
+	defer persistence.lock(ctx)()
+	state := persistence.store.state
+	finding, ok := state.findings[identifier]
+	if !ok || finding.OrganizationId != organizationID {
+		return intermediaries.Finding{}, ErrNotFound
+	}
+	finding = cloneFinding(finding)
+	if err := change(&finding); err != nil {
+		return intermediaries.Finding{}, err
+	}
+	finding.UpdatedAt = now()
+	finding.Version++
+	memorySet(persistence.store, state.findings, identifier, finding)
+	return cloneFinding(finding), nil
+}
+
+func (persistence memoryFindingsPersistence) UpdateFindingStatus(ctx context.Context, identifier string, status intermediaries.FindingStatus, expectedVersion int, organizationID int) (intermediaries.Finding, error) {
+	return persistence.updateFinding(ctx, identifier, organizationID, func(finding *intermediaries.Finding) error {
+		if expectedVersion != 0 && finding.Version != expectedVersion {
+			return ErrVersionMismatch
+		}
+		finding.Status = status
+		return nil
+	})
+}
+
+func (persistence memoryFindingsPersistence) UpdateFindingOwner(ctx context.Context, identifier string, owner intermediaries.Owner, organizationID int) (intermediaries.Finding, error) {
+	return persistence.updateFinding(ctx, identifier, organizationID, func(finding *intermediaries.Finding) error {
+		finding.Owner = owner
+		return nil
+	})
+}
+
+func (persistence memoryFindingsPersistence) UpdateFindingLocators(ctx context.Context, identifier string, locator intermediaries.ReportLocator, implied []intermediaries.ReportLocator, organizationID int) (intermediaries.Finding, error) {
+	return persistence.updateFinding(ctx, identifier, organizationID, func(finding *intermediaries.Finding) error {
+		finding.ReportLocator = locator
+		finding.ImpliedReportLocators = cloneReportLocators(implied)
+		return nil
+	})
+}
+
+func (persistence memoryFindingsPersistence) SoftDeleteFinding(ctx context.Context, identifier string, deletedBy int, expectedVersion int, organizationID int) (intermediaries.Finding, error) {
+	return persistence.updateFinding(ctx, identifier, organizationID, func(finding *intermediaries.Finding) error {
+		if expectedVersion != 0 && finding.Version != expectedVersion {
+			return ErrVersionMismatch
+		}
+		deletedAt := now()
+		finding.DeletedAt = &deletedAt
+		finding.DeletedBy = deletedBy
+		return nil
+	})
+}
+
+func (persistence memoryFindingsPersistence) DeleteFinding(ctx context.Context, identifier string, organizationID int) error {
+	defer persistence.lock(ctx)()
+	state := persistence.store.state
+	finding, ok := state.findings[identifier]
+	if !ok || finding.OrganizationId != organizationID {
+		return ErrNotFound
+	}
+	memoryDelete(persistence.store, state.findings, identifier)
+	return nil
+}
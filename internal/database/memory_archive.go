@@ -0,0 +1,82 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
+)
+
+func (persistence memoryFindingsPersistence) ArchiveFinding(ctx context.Context, identifier string, archivedAt time.Time, organizationID int) (intermediaries.Finding, error) {
+	defer persistence.lock(ctx)()
+	state := persistence.store.state
+	finding, ok := state.findings[identifier]
+	if !ok || finding.OrganizationId != organizationID {
+		return intermediaries.Finding{}, ErrNotFound
+	}
+	finding = cloneFinding(finding)
+	archivedAt = archivedAt.UTC().Truncate(time.Millisecond)
+	finding.ArchivedAt = &archivedAt
+	memoryDelete(persistence.store, state.findings, identifier)
+	memorySet(persistence.store, state.archivedFindings, identifier, finding)
+	return cloneFinding(finding), nil
+}
+
+func (persistence memoryFindingsPersistence) RestoreArchivedFinding(ctx context.Context, identifier string, organizationID int) (intermediaries.Finding, error) {
+	defer persistence.lock(ctx)()
+	state := persistence.store.state
+	finding, ok := state.archivedFindings[identifier]
+	if !ok || finding.OrganizationId != organizationID {
+		return intermediaries.Finding{}, ErrNotFound
+	}
+	for _, existing := range state.findings {
+		if existing.OrganizationId == organizationID && existing.ReportDistinguisher == finding.ReportDistinguisher && existing.ReportLocator == finding.ReportLocator {
+			return intermediaries.Finding{}, ErrDuplicate
+		}
+	}
+	finding = cloneFinding(finding)
+	finding.ArchivedAt = nil
+	memoryDelete(persistence.store, state.archivedFindings, identifier)
+	memorySet(persistence.store, state.findings, identifier, finding)
+	return cloneFinding(finding), nil
+}
+
+func (persistence memoryFindingsPersistence) GetArchivedFinding(ctx context.Context, identifier string, organizationID int) (intermediaries.Finding, error) {
+	defer persistence.lock(ctx)()
+	finding, ok := persistence.store.state.archivedFindings[identifier]
+	if !ok || finding.OrganizationId != organizationID {
+		return intermediaries.Finding{}, ErrNotFound
+	}
+	return cloneFinding(finding), nil
+}
+
+func (persistence memoryFindingsPersistence) GetArchivedFindings(ctx context.Context, organizationID int) ([]intermediaries.Finding, error) {
+	defer persistence.lock(ctx)()
+	return sortFindings(persistence.store.state.archivedFindings, organizationID), nil
+}
+
+func (persistence memoryFindingsPersistence) GetArchivedFindingsAfter(ctx context.Context, after string, limit int, organizationID int) ([]intermediaries.Finding, error) {
+	defer persistence.lock(ctx)()
+	return findingsAfter(sortFindings(persistence.store.state.archivedFindings, organizationID), after, limit), nil
+}
+
+func (persistence memoryFindingsPersistence) GetArchivedFindingByReport(ctx context.Context, distinguisher intermediaries.ReportDistinguisher, locator intermediaries.ReportLocator, organizationID int) (intermediaries.Finding, error) {
+	defer persistence.lock(ctx)()
+	for _, finding := range sortFindings(persistence.store.state.archivedFindings, organizationID) {
+		if finding.ReportDistinguisher == distinguisher && finding.ReportLocator == locator {
+			return finding, nil
+		}
+	}
+	return intermediaries.Finding{}, ErrNotFound
+}
+
+func (persistence memoryFindingsPersistence) DeleteArchivedFinding(ctx context.Context, identifier string, organizationID int) error {
+	defer persistence.lock(ctx)()
+	state := persistence.store.state
+	finding, ok := state.archivedFindings[identifier]
+	if !ok || finding.OrganizationId != organizationID {
+		return ErrNotFound
+	}
+	memoryDelete(persistence.store, state.archivedFindings, identifier)
+	return nil
+}
@@ -0,0 +1,54 @@
+package database
+
+import (
+	"context"
+
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
+)
+
+type memoryAuditKey struct {
+	organizationID int
+	sequence       int
+}
+
+func cloneAuditEntry(entry intermediaries.AuditEntry) intermediaries.AuditEntry {
+	entry.Changes = append([]intermediaries.AuditChange{}, entry.Changes...)
+	return entry
+}
+
+func (persistence memoryFindingsPersistence) AppendAuditEntry(ctx context.Context, entry intermediaries.AuditEntry, organizationID int) (intermediaries.AuditEntry, error) {
+	defer persistence.lock(ctx)()
+	state := persistence.store.state
+	entry = cloneAuditEntry(entry)
+	entry.OrganizationId = organizationID
+	var previous *intermediaries.AuditEntry
+	if last, ok := state.auditEntries[memoryAuditKey{organizationID, state.auditSequences[organizationID]}]; ok {
+		previous = &last
+	}
+	entry = entry.Chain(previous)
+	memorySet(persistence.store, state.auditEntries, memoryAuditKey{organizationID, entry.Sequence}, entry)
+	memorySet(persistence.store, state.auditSequences, organizationID, entry.Sequence)
+	return cloneAuditEntry(entry), nil
+}
+
+func (persistence memoryFindingsPersistence) GetAuditEntries(ctx context.Context, organizationID int) ([]intermediaries.AuditEntry, error) {
+	defer persistence.lock(ctx)()
+	state := persistence.store.state
+	entries := []intermediaries.AuditEntry{}
+	for sequence := 1; sequence <= state.auditSequences[organizationID]; sequence++ {
+		entries = append(entries, cloneAuditEntry(state.auditEntries[memoryAuditKey{organizationID, sequence}]))
+	}
+	return entries, nil
+}
+
+func (persistence memoryFindingsPersistence) GetAuditEntriesAfter(ctx context.Context, filter intermediaries.AuditFilter, after int, limit int, organizationID int) ([]intermediaries.AuditEntry, error) {
+	defer persistence.lock(ctx)()
+	state := persistence.store.state
+	entries := []intermediaries.AuditEntry{}
+	for sequence := after + 1; sequence <= state.auditSequences[organizationID] && len(entries) < limit; sequence++ {
+		if entry := state.auditEntries[memoryAuditKey{organizationID, sequence}]; filter.Matches(entry) {
+			entries = append(entries, cloneAuditEntry(entry))
+		}
+	}
+	return entries, nil
+}
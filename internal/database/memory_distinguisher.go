@@ -0,0 +1,53 @@
+package database
+
+import (
+	"context"
+	"sort"
+
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
+)
+
+// memoryAliasKey identifies an alias, which is unique within its organization
+type memoryAliasKey struct {
+	organizationID int
+	alias          string
+}
+
+func (persistence memoryFindingsPersistence) GetDistinguisherAlias(ctx context.Context, alias string, organizationID int) (intermediaries.DistinguisherAlias, error) {
+	defer persistence.lock(ctx)()
+	aliasI, ok := persistence.store.state.distinguisherAliases[memoryAliasKey{organizationID: organizationID, alias: alias}]
+	if !ok {
+		return intermediaries.DistinguisherAlias{}, ErrNotFound
+	}
+	return aliasI, nil
+}
+
+func (persistence memoryFindingsPersistence) GetDistinguisherAliases(ctx context.Context, organizationID int) ([]intermediaries.DistinguisherAlias, error) {
+	defer persistence.lock(ctx)()
+	aliasIs := []intermediaries.DistinguisherAlias{}
+	for key, aliasI := range persistence.store.state.distinguisherAliases {
+		if key.organizationID == organizationID {
+			aliasIs = append(aliasIs, aliasI)
+		}
+	}
+	sort.Slice(aliasIs, func(i, j int) bool { return aliasIs[i].Alias < aliasIs[j].Alias })
+	return aliasIs, nil
+}
+
+func (persistence memoryFindingsPersistence) SetDistinguisherAlias(ctx context.Context, aliasI intermediaries.DistinguisherAlias, organizationID int) (intermediaries.DistinguisherAlias, error) {
+	defer persistence.lock(ctx)()
+	aliasI.OrganizationId = organizationID
+	memorySet(persistence.store, persistence.store.state.distinguisherAliases, memoryAliasKey{organizationID: organizationID, alias: aliasI.Alias}, aliasI)
+	return aliasI, nil
+}
+
+func (persistence memoryFindingsPersistence) DeleteDistinguisherAlias(ctx context.Context, alias string, organizationID int) error {
+	defer persistence.lock(ctx)()
+	state := persistence.store.state
+	key := memoryAliasKey{organizationID: organizationID, alias: alias}
+	if _, ok := state.distinguisherAliases[key]; !ok {
+		return ErrNotFound
+	}
+	memoryDelete(persistence.store, state.distinguisherAliases, key)
+	return nil
+}
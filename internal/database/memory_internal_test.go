@@ -0,0 +1,14 @@
+package database_test
+
+import (
+	"testing"
+
+	"github.com/Kaese72/finding-registry/internal/database"
+	"github.com/Kaese72/finding-registry/internal/database/databasetest"
+)
+
+func TestMemoryPersistence(t *testing.T) {
+	databasetest.Run(t, func(t *testing.T) database.Persistence {
+		return database.NewMemoryFindingsPersistence()
+	})
+}
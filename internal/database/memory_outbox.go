@@ -0,0 +1,124 @@
+package database
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
+)
+
+type memoryOutboxEvent struct {
+	event       intermediaries.OutboxEvent
+	lockedUntil *time.Time
+}
+
+func cloneOutboxEvent(outboxEvent intermediaries.OutboxEvent) intermediaries.OutboxEvent {
+	outboxEvent.Payload = append([]byte{}, outboxEvent.Payload...)
+	if outboxEvent.DeliveredAt != nil {
+		deliveredAt := *outboxEvent.DeliveredAt
+		outboxEvent.DeliveredAt = &deliveredAt
+	}
+	return outboxEvent
+}
+
+// outboxCursorLess orders outbox events like the cursors of the outbox
+func outboxCursorLess(a intermediaries.OutboxCursor, b intermediaries.OutboxCursor) bool {
+	if !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.Before(b.CreatedAt)
+	}
+	return a.Identifier < b.Identifier
+}
+
+// sortedOutbox lists every outbox event in cursor order
+func (state memoryState) sortedOutbox() []memoryOutboxEvent {
+	outboxEvents := []memoryOutboxEvent{}
+	for _, outboxEvent := range state.outbox {
+		outboxEvents = append(outboxEvents, outboxEvent)
+	}
+	sort.Slice(outboxEvents, func(i, j int) bool {
+		return outboxCursorLess(outboxEvents[i].event.Cursor(), outboxEvents[j].event.Cursor())
+	})
+	return outboxEvents
+}
+
+func (persistence memoryFindingsPersistence) InsertOutboxEvent(ctx context.Context, outboxEvent intermediaries.OutboxEvent) error {
+	defer persistence.lock(ctx)()
+	state := persistence.store.state
+	if _, ok := state.outbox[outboxEvent.Identifier]; ok {
+		return ErrDuplicate
+	}
+	memorySet(persistence.store, state.outbox, outboxEvent.Identifier, memoryOutboxEvent{event: cloneOutboxEvent(outboxEvent)})
+	return nil
+}
+
+func (persistence memoryFindingsPersistence) ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]intermediaries.OutboxEvent, error) {
+	defer persistence.lock(ctx)()
+	state := persistence.store.state
+	now := time.Now().UTC()
+	lockedUntil := now.Add(lease)
+	claimed := []intermediaries.OutboxEvent{}
+	for _, outboxEvent := range state.sortedOutbox() {
+		if len(claimed) >= limit {
+			break
+		}
+		if outboxEvent.event.DeliveredAt != nil || (outboxEvent.lockedUntil != nil && !outboxEvent.lockedUntil.Before(now)) {
+			continue
+		}
+		outboxEvent.lockedUntil = &lockedUntil
+		memorySet(persistence.store, state.outbox, outboxEvent.event.Identifier, outboxEvent)
+		claimed = append(claimed, cloneOutboxEvent(outboxEvent.event))
+	}
+	return claimed, nil
+}
+
+func (persistence memoryFindingsPersistence) MarkOutboxEventDelivered(ctx context.Context, identifier string) error {
+	defer persistence.lock(ctx)()
+	state := persistence.store.state
+	outboxEvent, ok := state.outbox[identifier]
+	if !ok {
+		return ErrNotFound
+	}
+	deliveredAt := now()
+	outboxEvent.event.DeliveredAt = &deliveredAt
+	outboxEvent.lockedUntil = nil
+	memorySet(persistence.store, state.outbox, identifier, outboxEvent)
+	return nil
+}
+
+func (persistence memoryFindingsPersistence) DeleteDeliveredOutboxEvents(ctx context.Context, before time.Time) (int, error) {
+	defer persistence.lock(ctx)()
+	state := persistence.store.state
+	deleted := 0
+	for identifier, outboxEvent := range state.outbox {
+		if outboxEvent.event.DeliveredAt != nil && outboxEvent.event.DeliveredAt.Before(before) {
+			memoryDelete(persistence.store, state.outbox, identifier)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (persistence memoryFindingsPersistence) GetOutboxEvent(ctx context.Context, identifier string, organizationID int) (intermediaries.OutboxEvent, error) {
+	defer persistence.lock(ctx)()
+	outboxEvent, ok := persistence.store.state.outbox[identifier]
+	if !ok || outboxEvent.event.OrganizationId != organizationID {
+		return intermediaries.OutboxEvent{}, ErrNotFound
+	}
+	return cloneOutboxEvent(outboxEvent.event), nil
+}
+
+func (persistence memoryFindingsPersistence) GetOutboxEventsAfter(ctx context.Context, cursor intermediaries.OutboxCursor, until time.Time, limit int, organizationID int) ([]intermediaries.OutboxEvent, error) {
+	defer persistence.lock(ctx)()
+	outboxEventIs := []intermediaries.OutboxEvent{}
+	for _, outboxEvent := range persistence.store.state.sortedOutbox() {
+		if len(outboxEventIs) >= limit {
+			break
+		}
+		if outboxEvent.event.OrganizationId != organizationID || outboxEvent.event.CreatedAt.After(until) || !outboxCursorLess(cursor, outboxEvent.event.Cursor()) {
+			continue
+		}
+		outboxEventIs = append(outboxEventIs, cloneOutboxEvent(outboxEvent.event))
+	}
+	return outboxEventIs, nil
+}
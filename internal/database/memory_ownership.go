@@ -0,0 +1,68 @@
+package database
+
+import (
+	"context"
+	"sort"
+
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
+)
+
+func cloneOwnershipRule(rule intermediaries.OwnershipRule) intermediaries.OwnershipRule {
+	rule.LocatorPatterns = append([]intermediaries.LocatorPattern{}, rule.LocatorPatterns...)
+	rule.DistinguisherTypes = append([]string{}, rule.DistinguisherTypes...)
+	return rule
+}
+
+func (persistence memoryFindingsPersistence) CreateOwnershipRule(ctx context.Context, ruleI intermediaries.OwnershipRule, organizationID int) (intermediaries.OwnershipRule, error) {
+	defer persistence.lock(ctx)()
+	ruleI = cloneOwnershipRule(ruleI)
+	ruleI.Identifier = newIdentifier()
+	ruleI.OrganizationId = organizationID
+	memorySet(persistence.store, persistence.store.state.ownershipRules, ruleI.Identifier, ruleI)
+	return cloneOwnershipRule(ruleI), nil
+}
+
+func (persistence memoryFindingsPersistence) GetOwnershipRule(ctx context.Context, identifier string, organizationID int) (intermediaries.OwnershipRule, error) {
+	defer persistence.lock(ctx)()
+	rule, ok := persistence.store.state.ownershipRules[identifier]
+	if !ok || rule.OrganizationId != organizationID {
+		return intermediaries.OwnershipRule{}, ErrNotFound
+	}
+	return cloneOwnershipRule(rule), nil
+}
+
+func (persistence memoryFindingsPersistence) GetOwnershipRules(ctx context.Context, organizationID int) ([]intermediaries.OwnershipRule, error) {
+	defer persistence.lock(ctx)()
+	rules := []intermediaries.OwnershipRule{}
+	for _, rule := range persistence.store.state.ownershipRules {
+		if rule.OrganizationId == organizationID {
+			rules = append(rules, cloneOwnershipRule(rule))
+		}
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Identifier < rules[j].Identifier })
+	return rules, nil
+}
+
+func (persistence memoryFindingsPersistence) UpdateOwnershipRule(ctx context.Context, ruleI intermediaries.OwnershipRule, organizationID int) (intermediaries.OwnershipRule, error) {
+	defer persistence.lock(ctx)()
+	state := persistence.store.state
+	existing, ok := state.ownershipRules[ruleI.Identifier]
+	if !ok || existing.OrganizationId != organizationID {
+		return intermediaries.OwnershipRule{}, ErrNotFound
+	}
+	ruleI = cloneOwnershipRule(ruleI)
+	ruleI.OrganizationId = organizationID
+	memorySet(persistence.store, state.ownershipRules, ruleI.Identifier, ruleI)
+	return cloneOwnershipRule(ruleI), nil
+}
+
+func (persistence memoryFindingsPersistence) DeleteOwnershipRule(ctx context.Context, identifier string, organizationID int) error {
+	defer persistence.lock(ctx)()
+	state := persistence.store.state
+	rule, ok := state.ownershipRules[identifier]
+	if !ok || rule.OrganizationId != organizationID {
+		return ErrNotFound
+	}
+	memoryDelete(persistence.store, state.ownershipRules, identifier)
+	return nil
+}
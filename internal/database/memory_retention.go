@@ -0,0 +1,34 @@
+package database
+
+import (
+	"context"
+	"sort"
+
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
+)
+
+func (persistence memoryFindingsPersistence) GetRetentionPolicy(ctx context.Context, organizationID int) (intermediaries.RetentionPolicy, error) {
+	defer persistence.lock(ctx)()
+	policy, ok := persistence.store.state.retentionPolicies[organizationID]
+	if !ok {
+		return intermediaries.RetentionPolicy{}, ErrNotFound
+	}
+	return policy, nil
+}
+
+func (persistence memoryFindingsPersistence) GetRetentionPolicies(ctx context.Context) ([]intermediaries.RetentionPolicy, error) {
+	defer persistence.lock(ctx)()
+	policies := []intermediaries.RetentionPolicy{}
+	for _, policy := range persistence.store.state.retentionPolicies {
+		policies = append(policies, policy)
+	}
+	sort.Slice(policies, func(i, j int) bool { return policies[i].OrganizationId < policies[j].OrganizationId })
+	return policies, nil
+}
+
+func (persistence memoryFindingsPersistence) SetRetentionPolicy(ctx context.Context, policy intermediaries.RetentionPolicy, organizationID int) (intermediaries.RetentionPolicy, error) {
+	defer persistence.lock(ctx)()
+	policy.OrganizationId = organizationID
+	memorySet(persistence.store, persistence.store.state.retentionPolicies, organizationID, policy)
+	return policy, nil
+}
@@ -0,0 +1,195 @@
+package database
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
+)
+
+func cloneWebhookSubscription(subscription intermediaries.WebhookSubscription) intermediaries.WebhookSubscription {
+	subscription.EventTypes = append([]string{}, subscription.EventTypes...)
+	return subscription
+}
+
+func cloneWebhookDelivery(delivery intermediaries.WebhookDelivery) intermediaries.WebhookDelivery {
+	delivery.Payload = append([]byte{}, delivery.Payload...)
+	if delivery.LastAttemptAt != nil {
+		lastAttemptAt := *delivery.LastAttemptAt
+		delivery.LastAttemptAt = &lastAttemptAt
+	}
+	return delivery
+}
+
+func (persistence memoryFindingsPersistence) CreateWebhookSubscription(ctx context.Context, subscriptionI intermediaries.WebhookSubscription, organizationID int) (intermediaries.WebhookSubscription, error) {
+	defer persistence.lock(ctx)()
+	subscriptionI = cloneWebhookSubscription(subscriptionI)
+	subscriptionI.Identifier = newIdentifier()
+	subscriptionI.OrganizationId = organizationID
+	memorySet(persistence.store, persistence.store.state.webhookSubscriptions, subscriptionI.Identifier, subscriptionI)
+	return cloneWebhookSubscription(subscriptionI), nil
+}
+
+func (persistence memoryFindingsPersistence) GetWebhookSubscription(ctx context.Context, identifier string, organizationID int) (intermediaries.WebhookSubscription, error) {
+	defer persistence.lock(ctx)()
+	subscription, ok := persistence.store.state.webhookSubscriptions[identifier]
+	if !ok || subscription.OrganizationId != organizationID {
+		return intermediaries.WebhookSubscription{}, ErrNotFound
+	}
+	return cloneWebhookSubscription(subscription), nil
+}
+
+func (persistence memoryFindingsPersistence) GetWebhookSubscriptions(ctx context.Context, organizationID int) ([]intermediaries.WebhookSubscription, error) {
+	defer persistence.lock(ctx)()
+	subscriptionIs := []intermediaries.WebhookSubscription{}
+	for _, subscription := range persistence.store.state.webhookSubscriptions {
+		if subscription.OrganizationId == organizationID {
+			subscriptionIs = append(subscriptionIs, cloneWebhookSubscription(subscription))
+		}
+	}
+	sort.Slice(subscriptionIs, func(i, j int) bool { return subscriptionIs[i].Identifier < subscriptionIs[j].Identifier })
+	return subscriptionIs, nil
+}
+
+func (persistence memoryFindingsPersistence) UpdateWebhookSubscription(ctx context.Context, subscriptionI intermediaries.WebhookSubscription, organizationID int) (intermediaries.WebhookSubscription, error) {
+	defer persistence.lock(ctx)()
+	state := persistence.store.state
+	existing, ok := state.webhookSubscriptions[subscriptionI.Identifier]
+	if !ok || existing.OrganizationId != organizationID {
+		return intermediaries.WebhookSubscription{}, ErrNotFound
+	}
+	subscriptionI = cloneWebhookSubscription(subscriptionI)
+	subscriptionI.OrganizationId = organizationID
+	memorySet(persistence.store, state.webhookSubscriptions, subscriptionI.Identifier, subscriptionI)
+	return cloneWebhookSubscription(subscriptionI), nil
+}
+
+func (persistence memoryFindingsPersistence) RecordWebhookSuccess(ctx context.Context, identifier string, organizationID int) error {
+	_, err := persistence.updateWebhookSubscriptionHealth(ctx, identifier, organizationID, func(subscription *intermediaries.WebhookSubscription) {
+		subscription.ConsecutiveFailures = 0
+	})
+	return err
+}
+
+func (persistence memoryFindingsPersistence) RecordWebhookFailure(ctx context.Context, identifier string, disableAfter int, organizationID int) (intermediaries.WebhookSubscription, error) {
+	return persistence.updateWebhookSubscriptionHealth(ctx, identifier, organizationID, func(subscription *intermediaries.WebhookSubscription) {
+		subscription.ConsecutiveFailures++
+		subscription.Enabled = subscription.Enabled && subscription.ConsecutiveFailures < disableAfter
+	})
+}
+
+// updateWebhookSubscriptionHealth changes the health of a subscription of the organization while holding the lock
+func (persistence memoryFindingsPersistence) updateWebhookSubscriptionHealth(ctx context.Context, identifier string, organizationID int, update func(*intermediaries.WebhookSubscription)) (intermediaries.WebhookSubscription, error) {
+	defer persistence.lock(ctx)()
+	state := persistence.store.state
+	subscription, ok := state.webhookSubscriptions[identifier]
+	if !ok || subscription.OrganizationId != organizationID {
+		return intermediaries.WebhookSubscription{}, ErrNotFound
+	}
+	subscription = cloneWebhookSubscription(subscription)
+	update(&subscription)
+	memorySet(persistence.store, state.webhookSubscriptions, identifier, subscription)
+	return cloneWebhookSubscription(subscription), nil
+}
+
+func (persistence memoryFindingsPersistence) DeleteWebhookSubscription(ctx context.Context, identifier string, organizationID int) error {
+	defer persistence.lock(ctx)()
+	state := persistence.store.state
+	subscription, ok := state.webhookSubscriptions[identifier]
+	if !ok || subscription.OrganizationId != organizationID {
+		return ErrNotFound
+	}
+	memoryDelete(persistence.store, state.webhookSubscriptions, identifier)
+	for deliveryID, delivery := range state.webhookDeliveries {
+		if delivery.SubscriptionId == identifier && delivery.OrganizationId == organizationID {
+			memoryDelete(persistence.store, state.webhookDeliveries, deliveryID)
+		}
+	}
+	return nil
+}
+
+func (persistence memoryFindingsPersistence) InsertWebhookDelivery(ctx context.Context, delivery intermediaries.WebhookDelivery) error {
+	defer persistence.lock(ctx)()
+	state := persistence.store.state
+	if _, ok := state.webhookDeliveries[delivery.Identifier]; ok {
+		return ErrDuplicate
+	}
+	memorySet(persistence.store, state.webhookDeliveries, delivery.Identifier, cloneWebhookDelivery(delivery))
+	return nil
+}
+
+func (persistence memoryFindingsPersistence) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]intermediaries.WebhookDelivery, error) {
+	defer persistence.lock(ctx)()
+	state := persistence.store.state
+	now := time.Now().UTC()
+	due := []intermediaries.WebhookDelivery{}
+	for _, delivery := range state.webhookDeliveries {
+		if delivery.Status == intermediaries.DeliveryPending && !delivery.NextAttemptAt.After(now) {
+			due = append(due, delivery)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].NextAttemptAt.Before(due[j].NextAttemptAt) })
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	claimed := []intermediaries.WebhookDelivery{}
+	for _, delivery := range due {
+		// The delivery is returned as it was before the claim, like the MongoDB persistence does
+		claimed = append(claimed, cloneWebhookDelivery(delivery))
+		delivery = cloneWebhookDelivery(delivery)
+		delivery.NextAttemptAt = now.Add(lease)
+		memorySet(persistence.store, state.webhookDeliveries, delivery.Identifier, delivery)
+	}
+	return claimed, nil
+}
+
+func (persistence memoryFindingsPersistence) UpdateWebhookDelivery(ctx context.Context, delivery intermediaries.WebhookDelivery) error {
+	defer persistence.lock(ctx)()
+	state := persistence.store.state
+	if _, ok := state.webhookDeliveries[delivery.Identifier]; !ok {
+		return ErrNotFound
+	}
+	memorySet(persistence.store, state.webhookDeliveries, delivery.Identifier, cloneWebhookDelivery(delivery))
+	return nil
+}
+
+// webhookDeliveryCursorLess orders deliveries like the cursors of the deliveries of a subscription
+func webhookDeliveryCursorLess(a intermediaries.WebhookDeliveryCursor, b intermediaries.WebhookDeliveryCursor) bool {
+	if !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.Before(b.CreatedAt)
+	}
+	return a.Identifier < b.Identifier
+}
+
+func (persistence memoryFindingsPersistence) GetWebhookDeliveries(ctx context.Context, subscriptionID string, before intermediaries.WebhookDeliveryCursor, limit int, organizationID int) ([]intermediaries.WebhookDelivery, error) {
+	defer persistence.lock(ctx)()
+	deliveryIs := []intermediaries.WebhookDelivery{}
+	for _, delivery := range persistence.store.state.webhookDeliveries {
+		if delivery.SubscriptionId != subscriptionID || delivery.OrganizationId != organizationID {
+			continue
+		}
+		if !before.CreatedAt.IsZero() && !webhookDeliveryCursorLess(delivery.Cursor(), before) {
+			continue
+		}
+		deliveryIs = append(deliveryIs, cloneWebhookDelivery(delivery))
+	}
+	sort.Slice(deliveryIs, func(i, j int) bool { return webhookDeliveryCursorLess(deliveryIs[j].Cursor(), deliveryIs[i].Cursor()) })
+	if len(deliveryIs) > limit {
+		deliveryIs = deliveryIs[:limit]
+	}
+	return deliveryIs, nil
+}
+
+func (persistence memoryFindingsPersistence) DeleteWebhookDeliveries(ctx context.Context, before time.Time) (int, error) {
+	defer persistence.lock(ctx)()
+	state := persistence.store.state
+	deleted := 0
+	for identifier, delivery := range state.webhookDeliveries {
+		if delivery.Status != intermediaries.DeliveryPending && delivery.CreatedAt.Before(before) {
+			memoryDelete(persistence.store, state.webhookDeliveries, identifier)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
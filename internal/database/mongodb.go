@@ -2,8 +2,11 @@ package database
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"github.com/Kaese72/finding-registry/internal/intermediaries"
+	"github.com/Kaese72/riskie-lib/logging"
 	"go.elastic.co/apm/module/apmmongo/v2"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -14,11 +17,15 @@ import (
 type MongoDBConfig struct {
 	ConnectionString string
 	DbName           string
+	// AllowStandalone runs on a standalone server, where findings and their events are not stored atomically
+	AllowStandalone bool
 }
 
 type mongoFindingsPersistence struct {
 	mongoClient *mongo.Client
 	dbName      string
+	// transactions is only supported by replica sets and sharded clusters
+	transactions bool
 }
 
 type ReportLocator struct {
@@ -62,6 +69,25 @@ func ReportDistinguisherFromIntermediary(intermediary intermediaries.ReportDisti
 	}
 }
 
+type Owner struct {
+	Team    string `bson:"team"`
+	Contact string `bson:"contact"`
+}
+
+func (owner Owner) toIntermediary() intermediaries.Owner {
+	return intermediaries.Owner{
+		Team:    owner.Team,
+		Contact: owner.Contact,
+	}
+}
+
+func OwnerFromIntermediary(intermediary intermediaries.Owner) Owner {
+	return Owner{
+		Team:    intermediary.Team,
+		Contact: intermediary.Contact,
+	}
+}
+
 type Finding struct {
 	Identifier            string              `bson:"_id,omitempty"`
 	Name                  string              `bson:"name"`
@@ -69,6 +95,18 @@ type Finding struct {
 	ReportDistinguisher   ReportDistinguisher `bson:"reportDistinguisher"`
 	ReportLocator         ReportLocator       `bson:"reportLocator"`
 	ImpliedReportLocators []ReportLocator     `bson:"impliedReportLocators"`
+	Owner                 Owner               `bson:"owner"`
+	Severity              string              `bson:"severity"`
+	Status                string              `bson:"status"`
+	CreatedAt             time.Time           `bson:"createdAt"`
+	UpdatedAt             time.Time           `bson:"updatedAt"`
+	// Version is only ever incremented by the updates, and left out of them when not set
+	Version int `bson:"version,omitempty"`
+	// DeletedAt is always stored, so that storing a finding that is not deleted over a deleted one brings it back
+	DeletedAt *time.Time `bson:"deletedAt"`
+	DeletedBy int        `bson:"deletedBy"`
+	// ArchivedAt is only stored on findings in the archive
+	ArchivedAt *time.Time `bson:"archivedAt,omitempty"`
 }
 
 func (finding Finding) toIntermediary() intermediaries.Finding {
@@ -83,6 +121,15 @@ func (finding Finding) toIntermediary() intermediaries.Finding {
 		ReportDistinguisher:   finding.ReportDistinguisher.toIntermediary(),
 		ReportLocator:         finding.ReportLocator.toIntermediary(),
 		ImpliedReportLocators: implied,
+		Owner:                 finding.Owner.toIntermediary(),
+		Severity:              intermediaries.Severity(finding.Severity),
+		Status:                intermediaries.FindingStatus(finding.Status),
+		CreatedAt:             finding.CreatedAt,
+		UpdatedAt:             finding.UpdatedAt,
+		Version:               finding.Version,
+		DeletedAt:             finding.DeletedAt,
+		DeletedBy:             finding.DeletedBy,
+		ArchivedAt:            finding.ArchivedAt,
 	}
 }
 
@@ -98,6 +145,15 @@ func findingFromIntermediary(intermediary intermediaries.Finding) Finding {
 		ReportDistinguisher:   ReportDistinguisherFromIntermediary(intermediary.ReportDistinguisher),
 		ReportLocator:         ReportLocatorFromIntermediary(intermediary.ReportLocator),
 		ImpliedReportLocators: reportLocators,
+		Owner:                 OwnerFromIntermediary(intermediary.Owner),
+		Severity:              string(intermediary.Severity),
+		Status:                string(intermediary.Status),
+		CreatedAt:             intermediary.CreatedAt,
+		UpdatedAt:             intermediary.UpdatedAt,
+		Version:               intermediary.Version,
+		DeletedAt:             intermediary.DeletedAt,
+		DeletedBy:             intermediary.DeletedBy,
+		ArchivedAt:            intermediary.ArchivedAt,
 	}
 }
 
@@ -111,29 +167,87 @@ func NewMongoFindingsPersistence(config MongoDBConfig) (mongoFindingsPersistence
 		return mongoFindingsPersistence{}, err
 	}
 
+	hello := struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}{}
+	if err := mongoClient.Database("admin").RunCommand(context.Background(), bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
+		return mongoFindingsPersistence{}, err
+	}
+	transactions := hello.SetName != "" || hello.Msg == "isdbgrid"
+	if !transactions {
+		if !config.AllowStandalone {
+			mongoClient.Disconnect(context.Background())
+			return mongoFindingsPersistence{}, errors.New("MongoDB is a standalone server without transaction support, connect to a replica set or allow standalone servers")
+		}
+		logging.Error(context.Background(), "MongoDB is a standalone server without transaction support, findings and their events will not be stored atomically")
+	}
+
+	if err := migrateMongo(context.Background(), mongoClient.Database(config.DbName)); err != nil {
+		mongoClient.Disconnect(context.Background())
+		return mongoFindingsPersistence{}, err
+	}
+
 	return mongoFindingsPersistence{
-		mongoClient: mongoClient,
-		dbName:      config.DbName,
+		mongoClient:  mongoClient,
+		dbName:       config.DbName,
+		transactions: transactions,
 	}, nil
 }
 
+func (persistence mongoFindingsPersistence) WithTransaction(ctx context.Context, fn func(context.Context) error) error {
+	if !persistence.transactions || mongo.SessionFromContext(ctx) != nil {
+		// Changes made within a transaction are part of it
+		return fn(ctx)
+	}
+	session, err := persistence.mongoClient.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+	_, err = session.WithTransaction(ctx, func(sessionCtx mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sessionCtx)
+	})
+	return err
+}
+
 func (persistence mongoFindingsPersistence) findingCollection() *mongo.Collection {
 	return persistence.mongoClient.Database(persistence.dbName).Collection("findings")
 }
 
-func (persistence mongoFindingsPersistence) UpdateFinding(ctx context.Context, findingI intermediaries.Finding, organizationID int) (intermediaries.Finding, error) {
+func (persistence mongoFindingsPersistence) UpdateFinding(ctx context.Context, findingI intermediaries.Finding, expectedVersion int, organizationID int) (intermediaries.Finding, error) {
 	findingI.OrganizationId = organizationID
 	findingC := persistence.findingCollection()
 	findingR := Finding{}
 	mongoFinding := findingFromIntermediary(findingI)
-	err := findingC.FindOneAndUpdate(ctx, bson.D{
-		bson.E{Key: "reportDistinguisher", Value: findingI.ReportDistinguisher},
-		primitive.E{Key: "reportLocator", Value: mongoFinding.ReportLocator},
-	},
-		bson.M{"$set": mongoFinding},
-		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
-	).Decode(&findingR)
-
+	// The version is incremented instead, which starts inserted findings at 1
+	mongoFinding.Version = 0
+	// The filter is the unique index of findings, which keeps organizations from upserting each other's findings
+	filter := bson.D{
+		{Key: "organizationId", Value: organizationID},
+		{Key: "reportDistinguisher", Value: mongoFinding.ReportDistinguisher},
+		{Key: "reportLocator", Value: mongoFinding.ReportLocator},
+	}
+	if expectedVersion != 0 {
+		// Checking the version in the filter makes the check and the update a single atomic operation,
+		// and a finding at another version is not upserted in its place
+		filter = append(filter, bson.E{Key: "version", Value: expectedVersion})
+	}
+	upsert := func() error {
+		return findingC.FindOneAndUpdate(ctx,
+			filter,
+			bson.M{"$set": mongoFinding, "$inc": bson.M{"version": 1}},
+			options.FindOneAndUpdate().SetUpsert(expectedVersion == 0).SetReturnDocument(options.After),
+		).Decode(&findingR)
+	}
+	err := upsert()
+	if mongo.IsDuplicateKeyError(err) {
+		// A concurrent upsert inserted the finding first, which is updated instead
+		err = upsert()
+	}
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return intermediaries.Finding{}, ErrVersionMismatch
+	}
 	return findingR.toIntermediary(), err
 }
 
@@ -142,9 +256,133 @@ func (persistence mongoFindingsPersistence) GetFinding(ctx context.Context, iden
 	objID, _ := primitive.ObjectIDFromHex(identifier)
 	findingR := Finding{}
 	err := findinfC.FindOne(ctx, bson.D{{Key: "_id", Value: objID}, {Key: "organizationId", Value: organizationID}}).Decode(&findingR)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return intermediaries.Finding{}, ErrNotFound
+	}
+	return findingR.toIntermediary(), err
+}
+
+func (persistence mongoFindingsPersistence) GetFindingsByLocatorType(ctx context.Context, locatorType intermediaries.ReportLocatorType, organizationID int) ([]intermediaries.Finding, error) {
+	cursor, err := persistence.findingCollection().Find(ctx,
+		bson.D{
+			{Key: "organizationId", Value: organizationID},
+			{Key: "$or", Value: bson.A{
+				bson.D{{Key: "reportLocator.type", Value: string(locatorType)}},
+				bson.D{{Key: "impliedReportLocators.type", Value: string(locatorType)}},
+			}},
+		},
+		options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	findingIs := []intermediaries.Finding{}
+	for cursor.Next(ctx) {
+		findingR := Finding{}
+		if err := cursor.Decode(&findingR); err != nil {
+			return nil, err
+		}
+		findingIs = append(findingIs, findingR.toIntermediary())
+	}
+	return findingIs, cursor.Err()
+}
+
+func (persistence mongoFindingsPersistence) GetFindingByReport(ctx context.Context, distinguisher intermediaries.ReportDistinguisher, locator intermediaries.ReportLocator, organizationID int) (intermediaries.Finding, error) {
+	findingR := Finding{}
+	err := persistence.findingCollection().FindOne(ctx, bson.D{
+		{Key: "organizationId", Value: organizationID},
+		{Key: "reportDistinguisher", Value: ReportDistinguisherFromIntermediary(distinguisher)},
+		{Key: "reportLocator", Value: ReportLocatorFromIntermediary(locator)},
+	}).Decode(&findingR)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return intermediaries.Finding{}, ErrNotFound
+	}
+	return findingR.toIntermediary(), err
+}
+
+func (persistence mongoFindingsPersistence) UpdateFindingStatus(ctx context.Context, identifier string, status intermediaries.FindingStatus, expectedVersion int, organizationID int) (intermediaries.Finding, error) {
+	return persistence.updateFindingAtVersion(ctx, identifier, bson.M{"status": string(status), "updatedAt": time.Now().UTC()}, expectedVersion, organizationID)
+}
+
+func (persistence mongoFindingsPersistence) SoftDeleteFinding(ctx context.Context, identifier string, deletedBy int, expectedVersion int, organizationID int) (intermediaries.Finding, error) {
+	deletedAt := now()
+	return persistence.updateFindingAtVersion(ctx, identifier, bson.M{"deletedAt": deletedAt, "deletedBy": deletedBy, "updatedAt": deletedAt}, expectedVersion, organizationID)
+}
+
+// updateFindingAtVersion sets the fields of a finding at the expected version, or at any version if it is 0
+func (persistence mongoFindingsPersistence) updateFindingAtVersion(ctx context.Context, identifier string, set bson.M, expectedVersion int, organizationID int) (intermediaries.Finding, error) {
+	findingC := persistence.findingCollection()
+	objID, _ := primitive.ObjectIDFromHex(identifier)
+	filter := bson.D{{Key: "_id", Value: objID}, {Key: "organizationId", Value: organizationID}}
+	if expectedVersion != 0 {
+		// Checking the version in the filter makes the check and the update a single atomic operation
+		filter = append(filter, bson.E{Key: "version", Value: expectedVersion})
+	}
+	findingR := Finding{}
+	err := findingC.FindOneAndUpdate(ctx,
+		filter,
+		bson.M{"$set": set, "$inc": bson.M{"version": 1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&findingR)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		if expectedVersion != 0 {
+			// Nothing matched either because there is no such finding, or because it is at another version
+			if _, err := persistence.GetFinding(ctx, identifier, organizationID); err == nil {
+				return intermediaries.Finding{}, ErrVersionMismatch
+			}
+		}
+		return intermediaries.Finding{}, ErrNotFound
+	}
 	return findingR.toIntermediary(), err
 }
 
+func (persistence mongoFindingsPersistence) UpdateFindingOwner(ctx context.Context, identifier string, owner intermediaries.Owner, organizationID int) (intermediaries.Finding, error) {
+	findingC := persistence.findingCollection()
+	objID, _ := primitive.ObjectIDFromHex(identifier)
+	findingR := Finding{}
+	err := findingC.FindOneAndUpdate(ctx,
+		bson.D{{Key: "_id", Value: objID}, {Key: "organizationId", Value: organizationID}},
+		bson.M{"$set": bson.M{"owner": OwnerFromIntermediary(owner), "updatedAt": time.Now().UTC()}, "$inc": bson.M{"version": 1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&findingR)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return intermediaries.Finding{}, ErrNotFound
+	}
+	return findingR.toIntermediary(), err
+}
+
+func (persistence mongoFindingsPersistence) UpdateFindingLocators(ctx context.Context, identifier string, locator intermediaries.ReportLocator, implied []intermediaries.ReportLocator, organizationID int) (intermediaries.Finding, error) {
+	findingC := persistence.findingCollection()
+	objID, _ := primitive.ObjectIDFromHex(identifier)
+	impliedLocators := []ReportLocator{}
+	for index := range implied {
+		impliedLocators = append(impliedLocators, ReportLocatorFromIntermediary(implied[index]))
+	}
+	findingR := Finding{}
+	err := findingC.FindOneAndUpdate(ctx,
+		bson.D{{Key: "_id", Value: objID}, {Key: "organizationId", Value: organizationID}},
+		bson.M{"$set": bson.M{"reportLocator": ReportLocatorFromIntermediary(locator), "impliedReportLocators": impliedLocators, "updatedAt": time.Now().UTC()}, "$inc": bson.M{"version": 1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&findingR)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return intermediaries.Finding{}, ErrNotFound
+	}
+	return findingR.toIntermediary(), err
+}
+
+func (persistence mongoFindingsPersistence) DeleteFinding(ctx context.Context, identifier string, organizationID int) error {
+	objID, _ := primitive.ObjectIDFromHex(identifier)
+	result, err := persistence.findingCollection().DeleteOne(ctx, bson.D{{Key: "_id", Value: objID}, {Key: "organizationId", Value: organizationID}})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
 func (persistence mongoFindingsPersistence) GetFindings(ctx context.Context, organizationID int) ([]intermediaries.Finding, error) {
 	findinfC := persistence.findingCollection()
 	findingIs := []intermediaries.Finding{}
@@ -162,3 +400,33 @@ func (persistence mongoFindingsPersistence) GetFindings(ctx context.Context, org
 	}
 	return findingIs, err
 }
+
+func (persistence mongoFindingsPersistence) GetFindingsAfter(ctx context.Context, after string, limit int, organizationID int) ([]intermediaries.Finding, error) {
+	return findMongoFindingsAfter(ctx, persistence.findingCollection(), after, limit, organizationID)
+}
+
+// findMongoFindingsAfter pages through the findings of the organization in the collection, ordered by identifier
+func findMongoFindingsAfter(ctx context.Context, collection *mongo.Collection, after string, limit int, organizationID int) ([]intermediaries.Finding, error) {
+	filter := bson.D{{Key: "organizationId", Value: organizationID}}
+	if after != "" {
+		objID, err := primitive.ObjectIDFromHex(after)
+		if err != nil {
+			return nil, err
+		}
+		filter = append(filter, bson.E{Key: "_id", Value: bson.D{{Key: "$gt", Value: objID}}})
+	}
+	cursor, err := collection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(int64(limit)))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	findingIs := []intermediaries.Finding{}
+	for cursor.Next(ctx) {
+		findingR := Finding{}
+		if err := cursor.Decode(&findingR); err != nil {
+			return nil, err
+		}
+		findingIs = append(findingIs, findingR.toIntermediary())
+	}
+	return findingIs, cursor.Err()
+}
@@ -0,0 +1,123 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (persistence mongoFindingsPersistence) archivedFindingCollection() *mongo.Collection {
+	return persistence.mongoClient.Database(persistence.dbName).Collection("archivedFindings")
+}
+
+// moveFinding moves the document of a finding of the organization from one collection to the other, changed by change.
+// The document is copied before it is removed, and the copy replaces any copy of an earlier attempt, so that the
+// finding is never lost, even when not moved in a transaction.
+func (persistence mongoFindingsPersistence) moveFinding(ctx context.Context, from *mongo.Collection, to *mongo.Collection, identifier string, organizationID int, change bson.M) (intermediaries.Finding, error) {
+	objID, _ := primitive.ObjectIDFromHex(identifier)
+	filter := bson.D{{Key: "_id", Value: objID}, {Key: "organizationId", Value: organizationID}}
+	// The document is moved as it is stored, so that nothing is lost in translation
+	document := bson.M{}
+	err := from.FindOne(ctx, filter).Decode(&document)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return intermediaries.Finding{}, ErrNotFound
+	}
+	if err != nil {
+		return intermediaries.Finding{}, err
+	}
+	for key, value := range change {
+		if value == nil {
+			delete(document, key)
+		} else {
+			document[key] = value
+		}
+	}
+	if _, err := to.ReplaceOne(ctx, bson.D{{Key: "_id", Value: objID}}, document, options.Replace().SetUpsert(true)); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return intermediaries.Finding{}, ErrDuplicate
+		}
+		return intermediaries.Finding{}, err
+	}
+	if _, err := from.DeleteOne(ctx, filter); err != nil {
+		return intermediaries.Finding{}, err
+	}
+	findingR := Finding{}
+	if err := to.FindOne(ctx, filter).Decode(&findingR); err != nil {
+		return intermediaries.Finding{}, err
+	}
+	return findingR.toIntermediary(), nil
+}
+
+func (persistence mongoFindingsPersistence) ArchiveFinding(ctx context.Context, identifier string, archivedAt time.Time, organizationID int) (intermediaries.Finding, error) {
+	return persistence.moveFinding(ctx, persistence.findingCollection(), persistence.archivedFindingCollection(), identifier, organizationID,
+		bson.M{"archivedAt": archivedAt.UTC().Truncate(time.Millisecond)},
+	)
+}
+
+func (persistence mongoFindingsPersistence) RestoreArchivedFinding(ctx context.Context, identifier string, organizationID int) (intermediaries.Finding, error) {
+	return persistence.moveFinding(ctx, persistence.archivedFindingCollection(), persistence.findingCollection(), identifier, organizationID,
+		bson.M{"archivedAt": nil},
+	)
+}
+
+func (persistence mongoFindingsPersistence) GetArchivedFinding(ctx context.Context, identifier string, organizationID int) (intermediaries.Finding, error) {
+	objID, _ := primitive.ObjectIDFromHex(identifier)
+	findingR := Finding{}
+	err := persistence.archivedFindingCollection().FindOne(ctx, bson.D{{Key: "_id", Value: objID}, {Key: "organizationId", Value: organizationID}}).Decode(&findingR)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return intermediaries.Finding{}, ErrNotFound
+	}
+	return findingR.toIntermediary(), err
+}
+
+func (persistence mongoFindingsPersistence) GetArchivedFindings(ctx context.Context, organizationID int) ([]intermediaries.Finding, error) {
+	cursor, err := persistence.archivedFindingCollection().Find(ctx, bson.D{{Key: "organizationId", Value: organizationID}}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	findingIs := []intermediaries.Finding{}
+	for cursor.Next(ctx) {
+		findingR := Finding{}
+		if err := cursor.Decode(&findingR); err != nil {
+			return nil, err
+		}
+		findingIs = append(findingIs, findingR.toIntermediary())
+	}
+	return findingIs, cursor.Err()
+}
+
+func (persistence mongoFindingsPersistence) GetArchivedFindingsAfter(ctx context.Context, after string, limit int, organizationID int) ([]intermediaries.Finding, error) {
+	return findMongoFindingsAfter(ctx, persistence.archivedFindingCollection(), after, limit, organizationID)
+}
+
+func (persistence mongoFindingsPersistence) GetArchivedFindingByReport(ctx context.Context, distinguisher intermediaries.ReportDistinguisher, locator intermediaries.ReportLocator, organizationID int) (intermediaries.Finding, error) {
+	findingR := Finding{}
+	err := persistence.archivedFindingCollection().FindOne(ctx, bson.D{
+		{Key: "organizationId", Value: organizationID},
+		{Key: "reportDistinguisher", Value: ReportDistinguisherFromIntermediary(distinguisher)},
+		{Key: "reportLocator", Value: ReportLocatorFromIntermediary(locator)},
+	}).Decode(&findingR)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return intermediaries.Finding{}, ErrNotFound
+	}
+	return findingR.toIntermediary(), err
+}
+
+func (persistence mongoFindingsPersistence) DeleteArchivedFinding(ctx context.Context, identifier string, organizationID int) error {
+	objID, _ := primitive.ObjectIDFromHex(identifier)
+	result, err := persistence.archivedFindingCollection().DeleteOne(ctx, bson.D{{Key: "_id", Value: objID}, {Key: "organizationId", Value: organizationID}})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
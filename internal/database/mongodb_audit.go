@@ -0,0 +1,172 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type AuditChange struct {
+	Field  string `bson:"field"`
+	Before string `bson:"before"`
+	After  string `bson:"after"`
+}
+
+// AuditEntry is stored with the organization and sequence as its identifier, so that two entries
+// can not take the same place in the chain
+type AuditEntry struct {
+	Identifier        string        `bson:"_id"`
+	OrganizationId    int           `bson:"organizationId"`
+	Sequence          int           `bson:"sequence"`
+	FindingIdentifier string        `bson:"findingId"`
+	Action            string        `bson:"action"`
+	UserId            int           `bson:"userId"`
+	RequestId         string        `bson:"requestId"`
+	SourceIP          string        `bson:"sourceIP"`
+	Changes           []AuditChange `bson:"changes"`
+	CreatedAt         time.Time     `bson:"createdAt"`
+	PreviousHash      string        `bson:"previousHash"`
+	Hash              string        `bson:"hash"`
+}
+
+func (entry AuditEntry) toIntermediary() intermediaries.AuditEntry {
+	changes := []intermediaries.AuditChange{}
+	for _, change := range entry.Changes {
+		changes = append(changes, intermediaries.AuditChange{Field: change.Field, Before: change.Before, After: change.After})
+	}
+	return intermediaries.AuditEntry{
+		OrganizationId:    entry.OrganizationId,
+		Sequence:          entry.Sequence,
+		FindingIdentifier: entry.FindingIdentifier,
+		Action:            intermediaries.AuditAction(entry.Action),
+		Actor: intermediaries.AuditActor{
+			UserId:    entry.UserId,
+			RequestId: entry.RequestId,
+			SourceIP:  entry.SourceIP,
+		},
+		Changes:      changes,
+		CreatedAt:    entry.CreatedAt.UTC(),
+		PreviousHash: entry.PreviousHash,
+		Hash:         entry.Hash,
+	}
+}
+
+func auditEntryFromIntermediary(intermediary intermediaries.AuditEntry) AuditEntry {
+	changes := []AuditChange{}
+	for _, change := range intermediary.Changes {
+		changes = append(changes, AuditChange{Field: change.Field, Before: change.Before, After: change.After})
+	}
+	return AuditEntry{
+		Identifier:        fmt.Sprintf("%d:%d", intermediary.OrganizationId, intermediary.Sequence),
+		OrganizationId:    intermediary.OrganizationId,
+		Sequence:          intermediary.Sequence,
+		FindingIdentifier: intermediary.FindingIdentifier,
+		Action:            string(intermediary.Action),
+		UserId:            intermediary.Actor.UserId,
+		RequestId:         intermediary.Actor.RequestId,
+		SourceIP:          intermediary.Actor.SourceIP,
+		Changes:           changes,
+		CreatedAt:         intermediary.CreatedAt,
+		PreviousHash:      intermediary.PreviousHash,
+		Hash:              intermediary.Hash,
+	}
+}
+
+func (persistence mongoFindingsPersistence) auditCollection() *mongo.Collection {
+	return persistence.mongoClient.Database(persistence.dbName).Collection("auditEntries")
+}
+
+// mongoAuditAttempts is how many times an entry is chained again after another instance appended first
+const mongoAuditAttempts = 10
+
+func (persistence mongoFindingsPersistence) AppendAuditEntry(ctx context.Context, entry intermediaries.AuditEntry, organizationID int) (intermediaries.AuditEntry, error) {
+	entry.OrganizationId = organizationID
+	for attempt := 0; attempt < mongoAuditAttempts; attempt++ {
+		var previous *intermediaries.AuditEntry
+		last := AuditEntry{}
+		err := persistence.auditCollection().FindOne(ctx,
+			bson.D{{Key: "organizationId", Value: organizationID}},
+			options.FindOne().SetSort(bson.D{{Key: "sequence", Value: -1}}),
+		).Decode(&last)
+		if err == nil {
+			lastI := last.toIntermediary()
+			previous = &lastI
+		} else if !errors.Is(err, mongo.ErrNoDocuments) {
+			return intermediaries.AuditEntry{}, err
+		}
+		chained := entry.Chain(previous)
+		_, err = persistence.auditCollection().InsertOne(ctx, auditEntryFromIntermediary(chained))
+		if err == nil {
+			return chained, nil
+		}
+		// Within a transaction a concurrent append is a write conflict, and the whole transaction is retried instead
+		if !mongo.IsDuplicateKeyError(err) {
+			return intermediaries.AuditEntry{}, err
+		}
+	}
+	return intermediaries.AuditEntry{}, ErrDuplicate
+}
+
+func (persistence mongoFindingsPersistence) GetAuditEntries(ctx context.Context, organizationID int) ([]intermediaries.AuditEntry, error) {
+	return persistence.findAuditEntries(ctx,
+		bson.D{{Key: "organizationId", Value: organizationID}},
+		options.Find().SetSort(bson.D{{Key: "sequence", Value: 1}}),
+	)
+}
+
+func (persistence mongoFindingsPersistence) GetAuditEntriesAfter(ctx context.Context, filter intermediaries.AuditFilter, after int, limit int, organizationID int) ([]intermediaries.AuditEntry, error) {
+	query := bson.D{
+		{Key: "organizationId", Value: organizationID},
+		{Key: "sequence", Value: bson.D{{Key: "$gt", Value: after}}},
+	}
+	if filter.FindingIdentifier != "" {
+		query = append(query, bson.E{Key: "findingId", Value: filter.FindingIdentifier})
+	}
+	if filter.UserId != 0 {
+		query = append(query, bson.E{Key: "userId", Value: filter.UserId})
+	}
+	if len(filter.Actions) > 0 {
+		actions := bson.A{}
+		for _, action := range filter.Actions {
+			actions = append(actions, string(action))
+		}
+		query = append(query, bson.E{Key: "action", Value: bson.D{{Key: "$in", Value: actions}}})
+	}
+	createdAt := bson.D{}
+	if !filter.Since.IsZero() {
+		createdAt = append(createdAt, bson.E{Key: "$gte", Value: filter.Since})
+	}
+	if !filter.Until.IsZero() {
+		createdAt = append(createdAt, bson.E{Key: "$lt", Value: filter.Until})
+	}
+	if len(createdAt) > 0 {
+		query = append(query, bson.E{Key: "createdAt", Value: createdAt})
+	}
+	return persistence.findAuditEntries(ctx, query,
+		options.Find().SetSort(bson.D{{Key: "sequence", Value: 1}}).SetLimit(int64(limit)),
+	)
+}
+
+// findAuditEntries reads the entries matching the query
+func (persistence mongoFindingsPersistence) findAuditEntries(ctx context.Context, query bson.D, opts *options.FindOptions) ([]intermediaries.AuditEntry, error) {
+	cursor, err := persistence.auditCollection().Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	entries := []intermediaries.AuditEntry{}
+	for cursor.Next(ctx) {
+		entryR := AuditEntry{}
+		if err := cursor.Decode(&entryR); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entryR.toIntermediary())
+	}
+	return entries, cursor.Err()
+}
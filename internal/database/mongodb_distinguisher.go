@@ -0,0 +1,85 @@
+package database
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type DistinguisherAlias struct {
+	OrganizationId int    `bson:"organizationId"`
+	Alias          string `bson:"alias"`
+	Distinguisher  string `bson:"distinguisher"`
+}
+
+func (alias DistinguisherAlias) toIntermediary() intermediaries.DistinguisherAlias {
+	return intermediaries.DistinguisherAlias{
+		OrganizationId: alias.OrganizationId,
+		Alias:          alias.Alias,
+		Distinguisher:  alias.Distinguisher,
+	}
+}
+
+func distinguisherAliasFromIntermediary(intermediary intermediaries.DistinguisherAlias) DistinguisherAlias {
+	return DistinguisherAlias{
+		OrganizationId: intermediary.OrganizationId,
+		Alias:          intermediary.Alias,
+		Distinguisher:  intermediary.Distinguisher,
+	}
+}
+
+func (persistence mongoFindingsPersistence) distinguisherAliasCollection() *mongo.Collection {
+	return persistence.mongoClient.Database(persistence.dbName).Collection("distinguisherAliases")
+}
+
+func (persistence mongoFindingsPersistence) GetDistinguisherAlias(ctx context.Context, alias string, organizationID int) (intermediaries.DistinguisherAlias, error) {
+	aliasR := DistinguisherAlias{}
+	err := persistence.distinguisherAliasCollection().FindOne(ctx, bson.D{{Key: "organizationId", Value: organizationID}, {Key: "alias", Value: alias}}).Decode(&aliasR)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return intermediaries.DistinguisherAlias{}, ErrNotFound
+	}
+	return aliasR.toIntermediary(), err
+}
+
+func (persistence mongoFindingsPersistence) GetDistinguisherAliases(ctx context.Context, organizationID int) ([]intermediaries.DistinguisherAlias, error) {
+	cursor, err := persistence.distinguisherAliasCollection().Find(ctx, bson.D{{Key: "organizationId", Value: organizationID}}, options.Find().SetSort(bson.D{{Key: "alias", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	aliasIs := []intermediaries.DistinguisherAlias{}
+	for cursor.Next(ctx) {
+		aliasR := DistinguisherAlias{}
+		if err := cursor.Decode(&aliasR); err != nil {
+			return nil, err
+		}
+		aliasIs = append(aliasIs, aliasR.toIntermediary())
+	}
+	return aliasIs, cursor.Err()
+}
+
+func (persistence mongoFindingsPersistence) SetDistinguisherAlias(ctx context.Context, aliasI intermediaries.DistinguisherAlias, organizationID int) (intermediaries.DistinguisherAlias, error) {
+	aliasI.OrganizationId = organizationID
+	aliasR := DistinguisherAlias{}
+	err := persistence.distinguisherAliasCollection().FindOneAndUpdate(ctx,
+		bson.D{{Key: "organizationId", Value: organizationID}, {Key: "alias", Value: aliasI.Alias}},
+		bson.M{"$set": distinguisherAliasFromIntermediary(aliasI)},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&aliasR)
+	return aliasR.toIntermediary(), err
+}
+
+func (persistence mongoFindingsPersistence) DeleteDistinguisherAlias(ctx context.Context, alias string, organizationID int) error {
+	result, err := persistence.distinguisherAliasCollection().DeleteOne(ctx, bson.D{{Key: "organizationId", Value: organizationID}, {Key: "alias", Value: alias}})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package database_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Kaese72/finding-registry/internal/database"
+	"github.com/Kaese72/finding-registry/internal/database/databasetest"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// TestMongoDBPersistence runs against the MongoDB replica set in TEST_MONGODB_CONNECTION_STRING, and is skipped without one
+func TestMongoDBPersistence(t *testing.T) {
+	connectionString := os.Getenv("TEST_MONGODB_CONNECTION_STRING")
+	if connectionString == "" {
+		t.Skip("TEST_MONGODB_CONNECTION_STRING not set")
+	}
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI(connectionString))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	t.Cleanup(func() { client.Disconnect(context.Background()) })
+	databasetest.Run(t, func(t *testing.T) database.Persistence {
+		// Every test gets a database of its own, which is dropped when it is done
+		dbName := fmt.Sprintf("findingRegistryTest%d", time.Now().UnixNano())
+		t.Cleanup(func() { client.Database(dbName).Drop(context.Background()) })
+		persistence, err := database.NewMongoFindingsPersistence(database.MongoDBConfig{ConnectionString: connectionString, DbName: dbName})
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		return persistence
+	})
+}
+
+// TestMongoDBMigrate runs against the MongoDB replica set in TEST_MONGODB_CONNECTION_STRING, and is skipped without one
+func TestMongoDBMigrate(t *testing.T) {
+	connectionString := os.Getenv("TEST_MONGODB_CONNECTION_STRING")
+	if connectionString == "" {
+		t.Skip("TEST_MONGODB_CONNECTION_STRING not set")
+	}
+	ctx := context.Background()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(connectionString))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	dbName := fmt.Sprintf("findingRegistryTest%d", time.Now().UnixNano())
+	t.Cleanup(func() {
+		client.Database(dbName).Drop(context.Background())
+		client.Disconnect(context.Background())
+	})
+	config := database.Config{Backend: database.BackendMongoDB, MongoDB: database.MongoDBConfig{ConnectionString: connectionString, DbName: dbName}}
+
+	// Migrating again changes nothing
+	for range 2 {
+		if err := database.Migrate(ctx, config); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	finding := bson.M{
+		"organizationId":      1,
+		"reportDistinguisher": bson.D{{Key: "type", Value: "scanner"}, {Key: "value", Value: "nmap"}},
+		"reportLocator":       bson.D{{Key: "type", Value: "TCP"}, {Key: "value", Value: "10.0.0.1:22"}, {Key: "distinguisher", Value: "dc1"}},
+	}
+	findings := client.Database(dbName).Collection("findings")
+	if _, err := findings.InsertOne(ctx, finding); err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := findings.InsertOne(ctx, finding); !mongo.IsDuplicateKeyError(err) {
+		t.Errorf("expected a duplicate finding to be rejected, got %v", err)
+	}
+}
+
+// TestMongoDBMigrateDuplicates runs against the MongoDB replica set in TEST_MONGODB_CONNECTION_STRING, and is skipped without one
+func TestMongoDBMigrateDuplicates(t *testing.T) {
+	connectionString := os.Getenv("TEST_MONGODB_CONNECTION_STRING")
+	if connectionString == "" {
+		t.Skip("TEST_MONGODB_CONNECTION_STRING not set")
+	}
+	ctx := context.Background()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(connectionString))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	dbName := fmt.Sprintf("findingRegistryTest%d", time.Now().UnixNano())
+	t.Cleanup(func() {
+		client.Database(dbName).Drop(context.Background())
+		client.Disconnect(context.Background())
+	})
+	config := database.Config{Backend: database.BackendMongoDB, MongoDB: database.MongoDBConfig{ConnectionString: connectionString, DbName: dbName}}
+
+	// Two findings of organization 1 share a report distinguisher and locator, which organization 2 reports as well
+	findings := client.Database(dbName).Collection("findings")
+	identifiers := map[int][]string{}
+	for _, organizationID := range []int{1, 1, 2} {
+		result, err := findings.InsertOne(ctx, bson.M{
+			"organizationId":      organizationID,
+			"reportDistinguisher": bson.D{{Key: "type", Value: "scanner"}, {Key: "value", Value: "nmap"}},
+			"reportLocator":       bson.D{{Key: "type", Value: "TCP"}, {Key: "value", Value: "10.0.0.1:22"}, {Key: "distinguisher", Value: "dc1"}},
+		})
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		identifiers[organizationID] = append(identifiers[organizationID], result.InsertedID.(primitive.ObjectID).Hex())
+	}
+
+	err = database.Migrate(ctx, config)
+	if err == nil {
+		t.Fatal("expected the migration to fail on the duplicate findings")
+	}
+	for _, identifier := range identifiers[1] {
+		if !strings.Contains(err.Error(), identifier) {
+			t.Errorf("expected the duplicate finding %s to be listed, got %s", identifier, err.Error())
+		}
+	}
+	if strings.Contains(err.Error(), identifiers[2][0]) {
+		t.Errorf("expected the finding of organization 2 to not be listed, got %s", err.Error())
+	}
+
+	// Once the duplicate is removed the migration completes
+	objID, _ := primitive.ObjectIDFromHex(identifiers[1][1])
+	if _, err := findings.DeleteOne(ctx, bson.D{{Key: "_id", Value: objID}}); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := database.Migrate(ctx, config); err != nil {
+		t.Fatal(err.Error())
+	}
+}
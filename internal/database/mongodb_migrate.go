@@ -0,0 +1,271 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Kaese72/riskie-lib/logging"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// mongoMigration changes the schema of the database, which for MongoDB is mostly its indexes
+type mongoMigration struct {
+	version string
+	apply   func(context.Context, *mongo.Database) error
+}
+
+// mongoMigrations are applied in order, and are never changed once released
+var mongoMigrations = []mongoMigration{
+	{
+		version: "0001_finding_indexes",
+		apply: func(ctx context.Context, db *mongo.Database) error {
+			if err := findDuplicateMongoFindings(ctx, db); err != nil {
+				return err
+			}
+			return createMongoIndexes("findings",
+				mongo.IndexModel{Keys: bson.D{{Key: "organizationId", Value: 1}}},
+				// A finding is unique per organization, report distinguisher and report locator, which is what findings are upserted on
+				mongo.IndexModel{
+					Keys:    bson.D{{Key: "organizationId", Value: 1}, {Key: "reportDistinguisher", Value: 1}, {Key: "reportLocator", Value: 1}},
+					Options: options.Index().SetUnique(true),
+				},
+				mongo.IndexModel{Keys: bson.D{{Key: "organizationId", Value: 1}, {Key: "impliedReportLocators", Value: 1}}},
+			)(ctx, db)
+		},
+	},
+	{
+		version: "0002_indexes",
+		apply: func(ctx context.Context, db *mongo.Database) error {
+			for _, apply := range []func(context.Context, *mongo.Database) error{
+				createMongoIndexes("ownershipRules",
+					mongo.IndexModel{Keys: bson.D{{Key: "organizationId", Value: 1}}},
+				),
+				createMongoIndexes("distinguisherAliases",
+					mongo.IndexModel{
+						Keys:    bson.D{{Key: "organizationId", Value: 1}, {Key: "alias", Value: 1}},
+						Options: options.Index().SetUnique(true),
+					},
+				),
+				createMongoIndexes("outbox",
+					mongo.IndexModel{Keys: bson.D{{Key: "deliveredAt", Value: 1}, {Key: "createdAt", Value: 1}}},
+					mongo.IndexModel{Keys: bson.D{{Key: "organizationId", Value: 1}, {Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}}},
+				),
+				createMongoIndexes("webhookSubscriptions",
+					mongo.IndexModel{Keys: bson.D{{Key: "organizationId", Value: 1}}},
+				),
+				createMongoIndexes("webhookDeliveries",
+					mongo.IndexModel{Keys: bson.D{{Key: "status", Value: 1}, {Key: "nextAttemptAt", Value: 1}}},
+					mongo.IndexModel{Keys: bson.D{{Key: "subscriptionId", Value: 1}, {Key: "organizationId", Value: 1}, {Key: "createdAt", Value: -1}}},
+				),
+			} {
+				if err := apply(ctx, db); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		// Findings stored before versions were introduced start at version 1
+		version: "0003_finding_versions",
+		apply: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("findings").UpdateMany(ctx,
+				bson.D{{Key: "version", Value: bson.D{{Key: "$exists", Value: false}}}},
+				bson.M{"$set": bson.M{"version": 1}},
+			)
+			return err
+		},
+	},
+	{
+		version: "0004_audit_indexes",
+		apply: createMongoIndexes("auditEntries",
+			mongo.IndexModel{Keys: bson.D{{Key: "organizationId", Value: 1}, {Key: "sequence", Value: 1}}},
+		),
+	},
+	{
+		version: "0005_archived_finding_indexes",
+		apply: createMongoIndexes("archivedFindings",
+			mongo.IndexModel{Keys: bson.D{{Key: "organizationId", Value: 1}}},
+			mongo.IndexModel{Keys: bson.D{{Key: "organizationId", Value: 1}, {Key: "reportDistinguisher", Value: 1}, {Key: "reportLocator", Value: 1}}},
+		),
+	},
+	{
+		// Undelivered events have no deliveredAt, and are never expired
+		version: "0006_outbox_expiry",
+		apply: createMongoIndexes("outbox",
+			mongo.IndexModel{Keys: bson.D{{Key: "deliveredAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(int32(mongoOutboxExpiry.Seconds()))},
+		),
+	},
+	{
+		// Deliveries are listed a page at a time, and are deleted once they are older than the delivery retention
+		version: "0007_webhook_delivery_log",
+		apply: func(ctx context.Context, db *mongo.Database) error {
+			err := createMongoIndexes("webhookDeliveries",
+				mongo.IndexModel{Keys: bson.D{{Key: "subscriptionId", Value: 1}, {Key: "organizationId", Value: 1}, {Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}},
+				mongo.IndexModel{Keys: bson.D{{Key: "createdAt", Value: 1}}},
+			)(ctx, db)
+			if err != nil {
+				return err
+			}
+			_, err = db.Collection("webhookDeliveries").Indexes().DropOne(ctx, "subscriptionId_1_organizationId_1_createdAt_-1")
+			return err
+		},
+	},
+	{
+		// Findings are looked up by the type of the locator they are reported on, or of any locator they imply,
+		// rather than by whole implied locators
+		version: "0008_finding_locator_type_indexes",
+		apply: func(ctx context.Context, db *mongo.Database) error {
+			err := createMongoIndexes("findings",
+				mongo.IndexModel{Keys: bson.D{{Key: "organizationId", Value: 1}, {Key: "reportLocator.type", Value: 1}}},
+				mongo.IndexModel{Keys: bson.D{{Key: "organizationId", Value: 1}, {Key: "impliedReportLocators.type", Value: 1}}},
+			)(ctx, db)
+			if err != nil {
+				return err
+			}
+			_, err = db.Collection("findings").Indexes().DropOne(ctx, "organizationId_1_impliedReportLocators_1")
+			return err
+		},
+	},
+	{
+		// The audit log is searched by finding, user, action and time within an organization, a page at a time in sequence order
+		version: "0009_audit_search_indexes",
+		apply: createMongoIndexes("auditEntries",
+			mongo.IndexModel{Keys: bson.D{{Key: "organizationId", Value: 1}, {Key: "findingId", Value: 1}, {Key: "sequence", Value: 1}}},
+			mongo.IndexModel{Keys: bson.D{{Key: "organizationId", Value: 1}, {Key: "userId", Value: 1}, {Key: "sequence", Value: 1}}},
+			mongo.IndexModel{Keys: bson.D{{Key: "organizationId", Value: 1}, {Key: "action", Value: 1}, {Key: "sequence", Value: 1}}},
+			mongo.IndexModel{Keys: bson.D{{Key: "organizationId", Value: 1}, {Key: "createdAt", Value: 1}}},
+		),
+	},
+}
+
+// findDuplicateMongoFindings fails if findings of an organization share a report distinguisher and locator, which
+// the unique index of findings can not be created over. Which of them to keep is not for a migration to decide, so
+// the error lists every group of them, to be merged or deleted before migrating again.
+func findDuplicateMongoFindings(ctx context.Context, db *mongo.Database) error {
+	cursor, err := db.Collection("findings").Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: bson.D{
+				{Key: "organizationId", Value: "$organizationId"},
+				{Key: "reportDistinguisher", Value: "$reportDistinguisher"},
+				{Key: "reportLocator", Value: "$reportLocator"},
+			}},
+			{Key: "identifiers", Value: bson.D{{Key: "$push", Value: "$_id"}}},
+		}}},
+		{{Key: "$match", Value: bson.D{{Key: "identifiers.1", Value: bson.D{{Key: "$exists", Value: true}}}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "_id.organizationId", Value: 1}}}},
+	}, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	duplicates := []string{}
+	for cursor.Next(ctx) {
+		group := struct {
+			Key struct {
+				OrganizationId      int                 `bson:"organizationId"`
+				ReportDistinguisher ReportDistinguisher `bson:"reportDistinguisher"`
+				ReportLocator       ReportLocator       `bson:"reportLocator"`
+			} `bson:"_id"`
+			Identifiers []primitive.ObjectID `bson:"identifiers"`
+		}{}
+		if err := cursor.Decode(&group); err != nil {
+			return err
+		}
+		identifiers := []string{}
+		for _, identifier := range group.Identifiers {
+			identifiers = append(identifiers, identifier.Hex())
+		}
+		duplicates = append(duplicates, fmt.Sprintf("organization %d, %s %s on %s %s in %s: %s",
+			group.Key.OrganizationId, group.Key.ReportDistinguisher.Type, group.Key.ReportDistinguisher.Value,
+			group.Key.ReportLocator.Type, group.Key.ReportLocator.Value, group.Key.ReportLocator.Distinguisher,
+			strings.Join(identifiers, ", "),
+		))
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+	if len(duplicates) > 0 {
+		return fmt.Errorf("findings reported on the same report distinguisher and locator must be merged or deleted before migrating: %s", strings.Join(duplicates, "; "))
+	}
+	return nil
+}
+
+// mongoOutboxExpiry is how long delivered events are kept before MongoDB expires them, which is the stream retention
+// of the application. Changing it needs a new migration, as the expiry is part of the index.
+const mongoOutboxExpiry = time.Hour
+
+func createMongoIndexes(collection string, indexes ...mongo.IndexModel) func(context.Context, *mongo.Database) error {
+	return func(ctx context.Context, db *mongo.Database) error {
+		_, err := db.Collection(collection).Indexes().CreateMany(ctx, indexes)
+		return err
+	}
+}
+
+// mongoMigrationLease is how long the migration lock is held before another instance may take it over,
+// in case the instance holding it stopped while migrating
+const mongoMigrationLease = 5 * time.Minute
+
+// mongoMigrationLockID is the document of the migration lock, in the schemaMigrationLocks collection
+const mongoMigrationLockID = "migrate"
+
+// lockMongoMigrations waits for other instances to finish migrating, and returns a function releasing the lock
+func lockMongoMigrations(ctx context.Context, db *mongo.Database) (func(), error) {
+	locks := db.Collection("schemaMigrationLocks")
+	for {
+		lockedUntil := time.Now().UTC().Add(mongoMigrationLease).Truncate(time.Millisecond)
+		// The lock is taken over when it is expired, and created when there is none.
+		// When it is held by another instance the upsert collides with it instead.
+		_, err := locks.UpdateOne(ctx,
+			bson.D{{Key: "_id", Value: mongoMigrationLockID}, {Key: "lockedUntil", Value: bson.D{{Key: "$lt", Value: time.Now().UTC()}}}},
+			bson.M{"$set": bson.M{"lockedUntil": lockedUntil}},
+			options.Update().SetUpsert(true),
+		)
+		if err == nil {
+			return func() {
+				locks.DeleteOne(context.Background(), bson.D{{Key: "_id", Value: mongoMigrationLockID}, {Key: "lockedUntil", Value: lockedUntil}})
+			}, nil
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return nil, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// migrateMongo applies the migrations that have not been applied yet, and records them in the schemaMigrations collection
+func migrateMongo(ctx context.Context, db *mongo.Database) error {
+	unlock, err := lockMongoMigrations(ctx, db)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	applied := db.Collection("schemaMigrations")
+	for _, migration := range mongoMigrations {
+		count, err := applied.CountDocuments(ctx, bson.D{{Key: "_id", Value: migration.version}})
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+		logging.Info(ctx, "Applying database migration", map[string]interface{}{"version": migration.version})
+		if err := migration.apply(ctx, db); err != nil {
+			return fmt.Errorf("failed to apply migration %s: %w", migration.version, err)
+		}
+		if _, err := applied.InsertOne(ctx, bson.M{"_id": migration.version, "appliedAt": now()}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
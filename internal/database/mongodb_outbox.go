@@ -0,0 +1,145 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type OutboxEvent struct {
+	Identifier     string     `bson:"_id"`
+	OrganizationId int        `bson:"organizationId"`
+	Type           string     `bson:"type"`
+	Payload        []byte     `bson:"payload"`
+	CreatedAt      time.Time  `bson:"createdAt"`
+	DeliveredAt    *time.Time `bson:"deliveredAt"`
+	LockedUntil    *time.Time `bson:"lockedUntil"`
+}
+
+func (outboxEvent OutboxEvent) toIntermediary() intermediaries.OutboxEvent {
+	return intermediaries.OutboxEvent{
+		Identifier:     outboxEvent.Identifier,
+		OrganizationId: outboxEvent.OrganizationId,
+		Type:           outboxEvent.Type,
+		Payload:        outboxEvent.Payload,
+		CreatedAt:      outboxEvent.CreatedAt,
+		DeliveredAt:    outboxEvent.DeliveredAt,
+	}
+}
+
+func outboxEventFromIntermediary(intermediary intermediaries.OutboxEvent) OutboxEvent {
+	return OutboxEvent{
+		Identifier:     intermediary.Identifier,
+		OrganizationId: intermediary.OrganizationId,
+		Type:           intermediary.Type,
+		Payload:        intermediary.Payload,
+		CreatedAt:      intermediary.CreatedAt,
+		DeliveredAt:    intermediary.DeliveredAt,
+	}
+}
+
+func (persistence mongoFindingsPersistence) outboxCollection() *mongo.Collection {
+	return persistence.mongoClient.Database(persistence.dbName).Collection("outbox")
+}
+
+func (persistence mongoFindingsPersistence) InsertOutboxEvent(ctx context.Context, outboxEvent intermediaries.OutboxEvent) error {
+	_, err := persistence.outboxCollection().InsertOne(ctx, outboxEventFromIntermediary(outboxEvent))
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+func (persistence mongoFindingsPersistence) ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]intermediaries.OutboxEvent, error) {
+	claimed := []intermediaries.OutboxEvent{}
+	for len(claimed) < limit {
+		now := time.Now().UTC()
+		lockedUntil := now.Add(lease)
+		outboxEventR := OutboxEvent{}
+		// Each event is claimed separately, since claiming must be atomic per event
+		err := persistence.outboxCollection().FindOneAndUpdate(ctx,
+			bson.D{
+				{Key: "deliveredAt", Value: nil},
+				{Key: "$or", Value: bson.A{
+					bson.D{{Key: "lockedUntil", Value: nil}},
+					bson.D{{Key: "lockedUntil", Value: bson.D{{Key: "$lt", Value: now}}}},
+				}},
+			},
+			bson.M{"$set": bson.M{"lockedUntil": lockedUntil}},
+			options.FindOneAndUpdate().SetSort(bson.D{{Key: "createdAt", Value: 1}}).SetReturnDocument(options.After),
+		).Decode(&outboxEventR)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			break
+		}
+		if err != nil {
+			return claimed, err
+		}
+		claimed = append(claimed, outboxEventR.toIntermediary())
+	}
+	return claimed, nil
+}
+
+func (persistence mongoFindingsPersistence) MarkOutboxEventDelivered(ctx context.Context, identifier string) error {
+	result, err := persistence.outboxCollection().UpdateOne(ctx,
+		bson.D{{Key: "_id", Value: identifier}},
+		bson.M{"$set": bson.M{"deliveredAt": time.Now().UTC()}, "$unset": bson.M{"lockedUntil": ""}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DeleteDeliveredOutboxEvents deletes delivered events right away, which the TTL index on deliveredAt otherwise does
+// once they are older than mongoOutboxExpiry
+func (persistence mongoFindingsPersistence) DeleteDeliveredOutboxEvents(ctx context.Context, before time.Time) (int, error) {
+	result, err := persistence.outboxCollection().DeleteMany(ctx, bson.D{{Key: "deliveredAt", Value: bson.D{{Key: "$lt", Value: before}}}})
+	if err != nil {
+		return 0, err
+	}
+	return int(result.DeletedCount), nil
+}
+
+func (persistence mongoFindingsPersistence) GetOutboxEvent(ctx context.Context, identifier string, organizationID int) (intermediaries.OutboxEvent, error) {
+	outboxEventR := OutboxEvent{}
+	err := persistence.outboxCollection().FindOne(ctx, bson.D{{Key: "_id", Value: identifier}, {Key: "organizationId", Value: organizationID}}).Decode(&outboxEventR)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return intermediaries.OutboxEvent{}, ErrNotFound
+	}
+	return outboxEventR.toIntermediary(), err
+}
+
+func (persistence mongoFindingsPersistence) GetOutboxEventsAfter(ctx context.Context, cursor intermediaries.OutboxCursor, until time.Time, limit int, organizationID int) ([]intermediaries.OutboxEvent, error) {
+	results, err := persistence.outboxCollection().Find(ctx,
+		bson.D{
+			{Key: "organizationId", Value: organizationID},
+			{Key: "createdAt", Value: bson.D{{Key: "$lte", Value: until}}},
+			{Key: "$or", Value: bson.A{
+				bson.D{{Key: "createdAt", Value: bson.D{{Key: "$gt", Value: cursor.CreatedAt}}}},
+				bson.D{{Key: "createdAt", Value: cursor.CreatedAt}, {Key: "_id", Value: bson.D{{Key: "$gt", Value: cursor.Identifier}}}},
+			}},
+		},
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}}).SetLimit(int64(limit)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close(ctx)
+	outboxEventIs := []intermediaries.OutboxEvent{}
+	for results.Next(ctx) {
+		outboxEventR := OutboxEvent{}
+		if err := results.Decode(&outboxEventR); err != nil {
+			return nil, err
+		}
+		outboxEventIs = append(outboxEventIs, outboxEventR.toIntermediary())
+	}
+	return outboxEventIs, results.Err()
+}
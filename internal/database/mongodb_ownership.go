@@ -0,0 +1,148 @@
+package database
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type LocatorPattern struct {
+	Type          string `bson:"type"`
+	Value         string `bson:"value"`
+	Distinguisher string `bson:"distinguisher"`
+}
+
+func (pattern LocatorPattern) toIntermediary() intermediaries.LocatorPattern {
+	return intermediaries.LocatorPattern{
+		Type:          intermediaries.ReportLocatorType(pattern.Type),
+		Value:         pattern.Value,
+		Distinguisher: pattern.Distinguisher,
+	}
+}
+
+func LocatorPatternFromIntermediary(intermediary intermediaries.LocatorPattern) LocatorPattern {
+	return LocatorPattern{
+		Type:          string(intermediary.Type),
+		Value:         intermediary.Value,
+		Distinguisher: intermediary.Distinguisher,
+	}
+}
+
+type OwnershipRule struct {
+	Identifier         string           `bson:"_id,omitempty"`
+	OrganizationId     int              `bson:"organizationId"`
+	Name               string           `bson:"name"`
+	Priority           int              `bson:"priority"`
+	LocatorPatterns    []LocatorPattern `bson:"locatorPatterns"`
+	DistinguisherTypes []string         `bson:"distinguisherTypes"`
+	Owner              Owner            `bson:"owner"`
+}
+
+func (rule OwnershipRule) toIntermediary() intermediaries.OwnershipRule {
+	patterns := []intermediaries.LocatorPattern{}
+	for index := range rule.LocatorPatterns {
+		patterns = append(patterns, rule.LocatorPatterns[index].toIntermediary())
+	}
+	return intermediaries.OwnershipRule{
+		Identifier:         rule.Identifier,
+		OrganizationId:     rule.OrganizationId,
+		Name:               rule.Name,
+		Priority:           rule.Priority,
+		LocatorPatterns:    patterns,
+		DistinguisherTypes: append([]string{}, rule.DistinguisherTypes...),
+		Owner:              rule.Owner.toIntermediary(),
+	}
+}
+
+func ownershipRuleFromIntermediary(intermediary intermediaries.OwnershipRule) OwnershipRule {
+	patterns := []LocatorPattern{}
+	for index := range intermediary.LocatorPatterns {
+		patterns = append(patterns, LocatorPatternFromIntermediary(intermediary.LocatorPatterns[index]))
+	}
+	return OwnershipRule{
+		Identifier:         intermediary.Identifier,
+		OrganizationId:     intermediary.OrganizationId,
+		Name:               intermediary.Name,
+		Priority:           intermediary.Priority,
+		LocatorPatterns:    patterns,
+		DistinguisherTypes: append([]string{}, intermediary.DistinguisherTypes...),
+		Owner:              OwnerFromIntermediary(intermediary.Owner),
+	}
+}
+
+func (persistence mongoFindingsPersistence) ownershipRuleCollection() *mongo.Collection {
+	return persistence.mongoClient.Database(persistence.dbName).Collection("ownershipRules")
+}
+
+func (persistence mongoFindingsPersistence) CreateOwnershipRule(ctx context.Context, ruleI intermediaries.OwnershipRule, organizationID int) (intermediaries.OwnershipRule, error) {
+	ruleI.Identifier = ""
+	ruleI.OrganizationId = organizationID
+	result, err := persistence.ownershipRuleCollection().InsertOne(ctx, ownershipRuleFromIntermediary(ruleI))
+	if err != nil {
+		return intermediaries.OwnershipRule{}, err
+	}
+	ruleI.Identifier = result.InsertedID.(primitive.ObjectID).Hex()
+	return ruleI, nil
+}
+
+func (persistence mongoFindingsPersistence) GetOwnershipRule(ctx context.Context, identifier string, organizationID int) (intermediaries.OwnershipRule, error) {
+	objID, _ := primitive.ObjectIDFromHex(identifier)
+	ruleR := OwnershipRule{}
+	err := persistence.ownershipRuleCollection().FindOne(ctx, bson.D{{Key: "_id", Value: objID}, {Key: "organizationId", Value: organizationID}}).Decode(&ruleR)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return intermediaries.OwnershipRule{}, ErrNotFound
+	}
+	return ruleR.toIntermediary(), err
+}
+
+func (persistence mongoFindingsPersistence) GetOwnershipRules(ctx context.Context, organizationID int) ([]intermediaries.OwnershipRule, error) {
+	cursor, err := persistence.ownershipRuleCollection().Find(ctx, bson.D{{Key: "organizationId", Value: organizationID}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	ruleIs := []intermediaries.OwnershipRule{}
+	for cursor.Next(ctx) {
+		ruleR := OwnershipRule{}
+		if err := cursor.Decode(&ruleR); err != nil {
+			return nil, err
+		}
+		ruleIs = append(ruleIs, ruleR.toIntermediary())
+	}
+	return ruleIs, cursor.Err()
+}
+
+func (persistence mongoFindingsPersistence) UpdateOwnershipRule(ctx context.Context, ruleI intermediaries.OwnershipRule, organizationID int) (intermediaries.OwnershipRule, error) {
+	ruleI.OrganizationId = organizationID
+	objID, _ := primitive.ObjectIDFromHex(ruleI.Identifier)
+	mongoRule := ownershipRuleFromIntermediary(ruleI)
+	// The identifier is part of the filter and may not be part of the update
+	mongoRule.Identifier = ""
+	ruleR := OwnershipRule{}
+	err := persistence.ownershipRuleCollection().FindOneAndUpdate(ctx,
+		bson.D{{Key: "_id", Value: objID}, {Key: "organizationId", Value: organizationID}},
+		bson.M{"$set": mongoRule},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&ruleR)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return intermediaries.OwnershipRule{}, ErrNotFound
+	}
+	return ruleR.toIntermediary(), err
+}
+
+func (persistence mongoFindingsPersistence) DeleteOwnershipRule(ctx context.Context, identifier string, organizationID int) error {
+	objID, _ := primitive.ObjectIDFromHex(identifier)
+	result, err := persistence.ownershipRuleCollection().DeleteOne(ctx, bson.D{{Key: "_id", Value: objID}, {Key: "organizationId", Value: organizationID}})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package database
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// RetentionPolicy is stored with the organization as its identifier, since an organization has at most one
+type RetentionPolicy struct {
+	OrganizationId int `bson:"_id"`
+	ResolvedDays   int `bson:"resolvedDays"`
+	DeletedDays    int `bson:"deletedDays"`
+	ArchiveDays    int `bson:"archiveDays"`
+}
+
+func (policy RetentionPolicy) toIntermediary() intermediaries.RetentionPolicy {
+	return intermediaries.RetentionPolicy{
+		OrganizationId: policy.OrganizationId,
+		ResolvedDays:   policy.ResolvedDays,
+		DeletedDays:    policy.DeletedDays,
+		ArchiveDays:    policy.ArchiveDays,
+	}
+}
+
+func retentionPolicyFromIntermediary(intermediary intermediaries.RetentionPolicy) RetentionPolicy {
+	return RetentionPolicy{
+		OrganizationId: intermediary.OrganizationId,
+		ResolvedDays:   intermediary.ResolvedDays,
+		DeletedDays:    intermediary.DeletedDays,
+		ArchiveDays:    intermediary.ArchiveDays,
+	}
+}
+
+func (persistence mongoFindingsPersistence) retentionPolicyCollection() *mongo.Collection {
+	return persistence.mongoClient.Database(persistence.dbName).Collection("retentionPolicies")
+}
+
+func (persistence mongoFindingsPersistence) GetRetentionPolicy(ctx context.Context, organizationID int) (intermediaries.RetentionPolicy, error) {
+	policyR := RetentionPolicy{}
+	err := persistence.retentionPolicyCollection().FindOne(ctx, bson.D{{Key: "_id", Value: organizationID}}).Decode(&policyR)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return intermediaries.RetentionPolicy{}, ErrNotFound
+	}
+	return policyR.toIntermediary(), err
+}
+
+func (persistence mongoFindingsPersistence) GetRetentionPolicies(ctx context.Context) ([]intermediaries.RetentionPolicy, error) {
+	cursor, err := persistence.retentionPolicyCollection().Find(ctx, bson.D{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	policyIs := []intermediaries.RetentionPolicy{}
+	for cursor.Next(ctx) {
+		policyR := RetentionPolicy{}
+		if err := cursor.Decode(&policyR); err != nil {
+			return nil, err
+		}
+		policyIs = append(policyIs, policyR.toIntermediary())
+	}
+	return policyIs, cursor.Err()
+}
+
+func (persistence mongoFindingsPersistence) SetRetentionPolicy(ctx context.Context, policyI intermediaries.RetentionPolicy, organizationID int) (intermediaries.RetentionPolicy, error) {
+	policyI.OrganizationId = organizationID
+	_, err := persistence.retentionPolicyCollection().ReplaceOne(ctx,
+		bson.D{{Key: "_id", Value: organizationID}},
+		retentionPolicyFromIntermediary(policyI),
+		options.Replace().SetUpsert(true),
+	)
+	if err != nil {
+		return intermediaries.RetentionPolicy{}, err
+	}
+	return policyI, nil
+}
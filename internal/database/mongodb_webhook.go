@@ -0,0 +1,305 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type WebhookSubscription struct {
+	Identifier          string    `bson:"_id,omitempty"`
+	OrganizationId      int       `bson:"organizationId"`
+	URL                 string    `bson:"url"`
+	Secret              string    `bson:"secret"`
+	EventTypes          []string  `bson:"eventTypes"`
+	Enabled             bool      `bson:"enabled"`
+	ConsecutiveFailures int       `bson:"consecutiveFailures"`
+	CreatedAt           time.Time `bson:"createdAt"`
+	UpdatedAt           time.Time `bson:"updatedAt"`
+}
+
+func (subscription WebhookSubscription) toIntermediary() intermediaries.WebhookSubscription {
+	return intermediaries.WebhookSubscription{
+		Identifier:          subscription.Identifier,
+		OrganizationId:      subscription.OrganizationId,
+		URL:                 subscription.URL,
+		Secret:              subscription.Secret,
+		EventTypes:          append([]string{}, subscription.EventTypes...),
+		Enabled:             subscription.Enabled,
+		ConsecutiveFailures: subscription.ConsecutiveFailures,
+		CreatedAt:           subscription.CreatedAt,
+		UpdatedAt:           subscription.UpdatedAt,
+	}
+}
+
+func webhookSubscriptionFromIntermediary(intermediary intermediaries.WebhookSubscription) WebhookSubscription {
+	return WebhookSubscription{
+		Identifier:          intermediary.Identifier,
+		OrganizationId:      intermediary.OrganizationId,
+		URL:                 intermediary.URL,
+		Secret:              intermediary.Secret,
+		EventTypes:          append([]string{}, intermediary.EventTypes...),
+		Enabled:             intermediary.Enabled,
+		ConsecutiveFailures: intermediary.ConsecutiveFailures,
+		CreatedAt:           intermediary.CreatedAt,
+		UpdatedAt:           intermediary.UpdatedAt,
+	}
+}
+
+type WebhookDelivery struct {
+	Identifier     string     `bson:"_id"`
+	SubscriptionId string     `bson:"subscriptionId"`
+	OrganizationId int        `bson:"organizationId"`
+	EventId        string     `bson:"eventId"`
+	EventType      string     `bson:"eventType"`
+	Payload        []byte     `bson:"payload"`
+	Status         string     `bson:"status"`
+	Attempts       int        `bson:"attempts"`
+	NextAttemptAt  time.Time  `bson:"nextAttemptAt"`
+	LastAttemptAt  *time.Time `bson:"lastAttemptAt"`
+	LastStatusCode int        `bson:"lastStatusCode"`
+	LastError      string     `bson:"lastError"`
+	CreatedAt      time.Time  `bson:"createdAt"`
+}
+
+func (delivery WebhookDelivery) toIntermediary() intermediaries.WebhookDelivery {
+	return intermediaries.WebhookDelivery{
+		Identifier:     delivery.Identifier,
+		SubscriptionId: delivery.SubscriptionId,
+		OrganizationId: delivery.OrganizationId,
+		EventId:        delivery.EventId,
+		EventType:      delivery.EventType,
+		Payload:        delivery.Payload,
+		Status:         intermediaries.WebhookDeliveryStatus(delivery.Status),
+		Attempts:       delivery.Attempts,
+		NextAttemptAt:  delivery.NextAttemptAt,
+		LastAttemptAt:  delivery.LastAttemptAt,
+		LastStatusCode: delivery.LastStatusCode,
+		LastError:      delivery.LastError,
+		CreatedAt:      delivery.CreatedAt,
+	}
+}
+
+func webhookDeliveryFromIntermediary(intermediary intermediaries.WebhookDelivery) WebhookDelivery {
+	return WebhookDelivery{
+		Identifier:     intermediary.Identifier,
+		SubscriptionId: intermediary.SubscriptionId,
+		OrganizationId: intermediary.OrganizationId,
+		EventId:        intermediary.EventId,
+		EventType:      intermediary.EventType,
+		Payload:        intermediary.Payload,
+		Status:         string(intermediary.Status),
+		Attempts:       intermediary.Attempts,
+		NextAttemptAt:  intermediary.NextAttemptAt,
+		LastAttemptAt:  intermediary.LastAttemptAt,
+		LastStatusCode: intermediary.LastStatusCode,
+		LastError:      intermediary.LastError,
+		CreatedAt:      intermediary.CreatedAt,
+	}
+}
+
+func (persistence mongoFindingsPersistence) webhookSubscriptionCollection() *mongo.Collection {
+	return persistence.mongoClient.Database(persistence.dbName).Collection("webhookSubscriptions")
+}
+
+func (persistence mongoFindingsPersistence) webhookDeliveryCollection() *mongo.Collection {
+	return persistence.mongoClient.Database(persistence.dbName).Collection("webhookDeliveries")
+}
+
+func (persistence mongoFindingsPersistence) CreateWebhookSubscription(ctx context.Context, subscriptionI intermediaries.WebhookSubscription, organizationID int) (intermediaries.WebhookSubscription, error) {
+	subscriptionI.Identifier = ""
+	subscriptionI.OrganizationId = organizationID
+	result, err := persistence.webhookSubscriptionCollection().InsertOne(ctx, webhookSubscriptionFromIntermediary(subscriptionI))
+	if err != nil {
+		return intermediaries.WebhookSubscription{}, err
+	}
+	subscriptionI.Identifier = result.InsertedID.(primitive.ObjectID).Hex()
+	return subscriptionI, nil
+}
+
+func (persistence mongoFindingsPersistence) GetWebhookSubscription(ctx context.Context, identifier string, organizationID int) (intermediaries.WebhookSubscription, error) {
+	objID, _ := primitive.ObjectIDFromHex(identifier)
+	subscriptionR := WebhookSubscription{}
+	err := persistence.webhookSubscriptionCollection().FindOne(ctx, bson.D{{Key: "_id", Value: objID}, {Key: "organizationId", Value: organizationID}}).Decode(&subscriptionR)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return intermediaries.WebhookSubscription{}, ErrNotFound
+	}
+	return subscriptionR.toIntermediary(), err
+}
+
+func (persistence mongoFindingsPersistence) GetWebhookSubscriptions(ctx context.Context, organizationID int) ([]intermediaries.WebhookSubscription, error) {
+	cursor, err := persistence.webhookSubscriptionCollection().Find(ctx, bson.D{{Key: "organizationId", Value: organizationID}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	subscriptionIs := []intermediaries.WebhookSubscription{}
+	for cursor.Next(ctx) {
+		subscriptionR := WebhookSubscription{}
+		if err := cursor.Decode(&subscriptionR); err != nil {
+			return nil, err
+		}
+		subscriptionIs = append(subscriptionIs, subscriptionR.toIntermediary())
+	}
+	return subscriptionIs, cursor.Err()
+}
+
+func (persistence mongoFindingsPersistence) UpdateWebhookSubscription(ctx context.Context, subscriptionI intermediaries.WebhookSubscription, organizationID int) (intermediaries.WebhookSubscription, error) {
+	subscriptionI.OrganizationId = organizationID
+	objID, _ := primitive.ObjectIDFromHex(subscriptionI.Identifier)
+	mongoSubscription := webhookSubscriptionFromIntermediary(subscriptionI)
+	// The identifier is part of the filter and may not be part of the update
+	mongoSubscription.Identifier = ""
+	subscriptionR := WebhookSubscription{}
+	err := persistence.webhookSubscriptionCollection().FindOneAndUpdate(ctx,
+		bson.D{{Key: "_id", Value: objID}, {Key: "organizationId", Value: organizationID}},
+		bson.M{"$set": mongoSubscription},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&subscriptionR)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return intermediaries.WebhookSubscription{}, ErrNotFound
+	}
+	return subscriptionR.toIntermediary(), err
+}
+
+func (persistence mongoFindingsPersistence) RecordWebhookFailure(ctx context.Context, identifier string, disableAfter int, organizationID int) (intermediaries.WebhookSubscription, error) {
+	objID, _ := primitive.ObjectIDFromHex(identifier)
+	subscriptionR := WebhookSubscription{}
+	// The update is a pipeline, so that the second stage checks the count as incremented by the first
+	err := persistence.webhookSubscriptionCollection().FindOneAndUpdate(ctx,
+		bson.D{{Key: "_id", Value: objID}, {Key: "organizationId", Value: organizationID}},
+		bson.A{
+			bson.D{{Key: "$set", Value: bson.D{
+				{Key: "consecutiveFailures", Value: bson.D{{Key: "$add", Value: bson.A{"$consecutiveFailures", 1}}}},
+			}}},
+			bson.D{{Key: "$set", Value: bson.D{
+				{Key: "enabled", Value: bson.D{{Key: "$and", Value: bson.A{
+					"$enabled",
+					bson.D{{Key: "$lt", Value: bson.A{"$consecutiveFailures", disableAfter}}},
+				}}}},
+			}}},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&subscriptionR)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return intermediaries.WebhookSubscription{}, ErrNotFound
+	}
+	return subscriptionR.toIntermediary(), err
+}
+
+func (persistence mongoFindingsPersistence) RecordWebhookSuccess(ctx context.Context, identifier string, organizationID int) error {
+	objID, _ := primitive.ObjectIDFromHex(identifier)
+	result, err := persistence.webhookSubscriptionCollection().UpdateOne(ctx,
+		bson.D{{Key: "_id", Value: objID}, {Key: "organizationId", Value: organizationID}},
+		bson.M{"$set": bson.M{"consecutiveFailures": 0}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (persistence mongoFindingsPersistence) DeleteWebhookSubscription(ctx context.Context, identifier string, organizationID int) error {
+	objID, _ := primitive.ObjectIDFromHex(identifier)
+	result, err := persistence.webhookSubscriptionCollection().DeleteOne(ctx, bson.D{{Key: "_id", Value: objID}, {Key: "organizationId", Value: organizationID}})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	_, err = persistence.webhookDeliveryCollection().DeleteMany(ctx, bson.D{{Key: "subscriptionId", Value: identifier}, {Key: "organizationId", Value: organizationID}})
+	return err
+}
+
+func (persistence mongoFindingsPersistence) InsertWebhookDelivery(ctx context.Context, delivery intermediaries.WebhookDelivery) error {
+	_, err := persistence.webhookDeliveryCollection().InsertOne(ctx, webhookDeliveryFromIntermediary(delivery))
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+func (persistence mongoFindingsPersistence) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]intermediaries.WebhookDelivery, error) {
+	claimed := []intermediaries.WebhookDelivery{}
+	for len(claimed) < limit {
+		now := time.Now().UTC()
+		deliveryR := WebhookDelivery{}
+		// Each delivery is claimed separately, since claiming must be atomic per delivery.
+		// The claim pushes the next attempt past the lease, so the delivery is retried if the claimer stops.
+		err := persistence.webhookDeliveryCollection().FindOneAndUpdate(ctx,
+			bson.D{
+				{Key: "status", Value: string(intermediaries.DeliveryPending)},
+				{Key: "nextAttemptAt", Value: bson.D{{Key: "$lte", Value: now}}},
+			},
+			bson.M{"$set": bson.M{"nextAttemptAt": now.Add(lease)}},
+			options.FindOneAndUpdate().SetSort(bson.D{{Key: "nextAttemptAt", Value: 1}}).SetReturnDocument(options.Before),
+		).Decode(&deliveryR)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			break
+		}
+		if err != nil {
+			return claimed, err
+		}
+		claimed = append(claimed, deliveryR.toIntermediary())
+	}
+	return claimed, nil
+}
+
+func (persistence mongoFindingsPersistence) UpdateWebhookDelivery(ctx context.Context, delivery intermediaries.WebhookDelivery) error {
+	mongoDelivery := webhookDeliveryFromIntermediary(delivery)
+	result, err := persistence.webhookDeliveryCollection().ReplaceOne(ctx, bson.D{{Key: "_id", Value: delivery.Identifier}}, mongoDelivery)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (persistence mongoFindingsPersistence) GetWebhookDeliveries(ctx context.Context, subscriptionID string, before intermediaries.WebhookDeliveryCursor, limit int, organizationID int) ([]intermediaries.WebhookDelivery, error) {
+	filter := bson.D{{Key: "subscriptionId", Value: subscriptionID}, {Key: "organizationId", Value: organizationID}}
+	if !before.CreatedAt.IsZero() {
+		filter = append(filter, bson.E{Key: "$or", Value: bson.A{
+			bson.D{{Key: "createdAt", Value: bson.D{{Key: "$lt", Value: before.CreatedAt}}}},
+			bson.D{{Key: "createdAt", Value: before.CreatedAt}, {Key: "_id", Value: bson.D{{Key: "$lt", Value: before.Identifier}}}},
+		}})
+	}
+	cursor, err := persistence.webhookDeliveryCollection().Find(ctx, filter,
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}).SetLimit(int64(limit)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	deliveryIs := []intermediaries.WebhookDelivery{}
+	for cursor.Next(ctx) {
+		deliveryR := WebhookDelivery{}
+		if err := cursor.Decode(&deliveryR); err != nil {
+			return nil, err
+		}
+		deliveryIs = append(deliveryIs, deliveryR.toIntermediary())
+	}
+	return deliveryIs, cursor.Err()
+}
+
+func (persistence mongoFindingsPersistence) DeleteWebhookDeliveries(ctx context.Context, before time.Time) (int, error) {
+	result, err := persistence.webhookDeliveryCollection().DeleteMany(ctx, bson.D{
+		{Key: "status", Value: bson.D{{Key: "$ne", Value: string(intermediaries.DeliveryPending)}}},
+		{Key: "createdAt", Value: bson.D{{Key: "$lt", Value: before}}},
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int(result.DeletedCount), nil
+}
@@ -0,0 +1,381 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type PostgresConfig struct {
+	ConnectionString string
+}
+
+type postgresFindingsPersistence struct {
+	pool *pgxpool.Pool
+}
+
+// postgresQuerier is implemented by both the connection pool and transactions
+type postgresQuerier interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// postgresTransactionKey holds the transaction of the context
+type postgresTransactionKey struct{}
+
+// postgresUniqueViolation is the SQLSTATE of unique constraint violations
+const postgresUniqueViolation = "23505"
+
+func NewPostgresFindingsPersistence(config PostgresConfig) (postgresFindingsPersistence, error) {
+	pool, err := pgxpool.New(context.Background(), config.ConnectionString)
+	if err != nil {
+		return postgresFindingsPersistence{}, err
+	}
+	if err := pool.Ping(context.Background()); err != nil {
+		pool.Close()
+		return postgresFindingsPersistence{}, err
+	}
+	if err := migratePostgres(context.Background(), pool); err != nil {
+		pool.Close()
+		return postgresFindingsPersistence{}, err
+	}
+	return postgresFindingsPersistence{pool: pool}, nil
+}
+
+// querier is the transaction of the context, or the connection pool outside of transactions
+func (persistence postgresFindingsPersistence) querier(ctx context.Context) postgresQuerier {
+	if tx, ok := ctx.Value(postgresTransactionKey{}).(pgx.Tx); ok {
+		return tx
+	}
+	return persistence.pool
+}
+
+func (persistence postgresFindingsPersistence) WithTransaction(ctx context.Context, fn func(context.Context) error) error {
+	if _, ok := ctx.Value(postgresTransactionKey{}).(pgx.Tx); ok {
+		return fn(ctx)
+	}
+	return pgx.BeginTxFunc(ctx, persistence.pool, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		return fn(context.WithValue(ctx, postgresTransactionKey{}, tx))
+	})
+}
+
+// postgresError translates errors of unique constraint violations into ErrDuplicate
+func postgresError(err error) error {
+	pgErr := &pgconn.PgError{}
+	if errors.As(err, &pgErr) && pgErr.Code == postgresUniqueViolation {
+		return ErrDuplicate
+	}
+	return err
+}
+
+// postgresTime converts stored times to UTC, like the other backends return them
+func postgresTime(stored *time.Time) *time.Time {
+	if stored == nil {
+		return nil
+	}
+	utc := stored.UTC()
+	return &utc
+}
+
+const postgresFindingColumns = `id, organization_id, name, report_distinguisher_type, report_distinguisher_value,
+	report_locator_type, report_locator_value, report_locator_distinguisher,
+	owner_team, owner_contact, severity, status, created_at, updated_at, version, deleted_at, deleted_by`
+
+// scanPostgresFinding scans the finding columns, followed by any other columns into extra
+func scanPostgresFinding(row pgx.Row, extra ...interface{}) (intermediaries.Finding, error) {
+	finding := intermediaries.Finding{ImpliedReportLocators: []intermediaries.ReportLocator{}}
+	var locatorType, severity, status string
+	var deletedAt *time.Time
+	err := row.Scan(append([]interface{}{
+		&finding.Identifier, &finding.OrganizationId, &finding.Name,
+		&finding.ReportDistinguisher.Type, &finding.ReportDistinguisher.Value,
+		&locatorType, &finding.ReportLocator.Value, &finding.ReportLocator.Distinguisher,
+		&finding.Owner.Team, &finding.Owner.Contact, &severity, &status, &finding.CreatedAt, &finding.UpdatedAt, &finding.Version,
+		&deletedAt, &finding.DeletedBy,
+	}, extra...)...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return intermediaries.Finding{}, ErrNotFound
+	}
+	finding.ReportLocator.Type = intermediaries.ReportLocatorType(locatorType)
+	finding.Severity = intermediaries.Severity(severity)
+	finding.Status = intermediaries.FindingStatus(status)
+	finding.CreatedAt = finding.CreatedAt.UTC()
+	finding.UpdatedAt = finding.UpdatedAt.UTC()
+	finding.DeletedAt = postgresTime(deletedAt)
+	return finding, err
+}
+
+// loadImpliedLocators reads the implied report locators of the findings
+func (persistence postgresFindingsPersistence) loadImpliedLocators(ctx context.Context, findings []intermediaries.Finding) error {
+	return persistence.loadImpliedLocatorsFrom(ctx, "finding_implied_locators", findings)
+}
+
+// loadImpliedLocatorsFrom reads the implied report locators of the findings from the table
+func (persistence postgresFindingsPersistence) loadImpliedLocatorsFrom(ctx context.Context, table string, findings []intermediaries.Finding) error {
+	if len(findings) == 0 {
+		return nil
+	}
+	identifiers := []string{}
+	indexes := map[string]int{}
+	for index := range findings {
+		identifiers = append(identifiers, findings[index].Identifier)
+		indexes[findings[index].Identifier] = index
+	}
+	rows, err := persistence.querier(ctx).Query(ctx,
+		`SELECT finding_id, type, value, distinguisher FROM `+table+` WHERE finding_id = ANY($1) ORDER BY finding_id, position`,
+		identifiers,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var findingID, locatorType string
+		locator := intermediaries.ReportLocator{}
+		if err := rows.Scan(&findingID, &locatorType, &locator.Value, &locator.Distinguisher); err != nil {
+			return err
+		}
+		locator.Type = intermediaries.ReportLocatorType(locatorType)
+		index := indexes[findingID]
+		findings[index].ImpliedReportLocators = append(findings[index].ImpliedReportLocators, locator)
+	}
+	return rows.Err()
+}
+
+// replaceImpliedLocators replaces the implied report locators of a finding of the organization
+func (persistence postgresFindingsPersistence) replaceImpliedLocators(ctx context.Context, identifier string, implied []intermediaries.ReportLocator, organizationID int) error {
+	types, values, distinguishers := []string{}, []string{}, []string{}
+	for _, locator := range implied {
+		types = append(types, string(locator.Type))
+		values = append(values, locator.Value)
+		distinguishers = append(distinguishers, locator.Distinguisher)
+	}
+	if _, err := persistence.querier(ctx).Exec(ctx, `DELETE FROM finding_implied_locators WHERE finding_id = $1`, identifier); err != nil {
+		return err
+	}
+	_, err := persistence.querier(ctx).Exec(ctx,
+		`INSERT INTO finding_implied_locators (finding_id, organization_id, position, type, value, distinguisher)
+		SELECT $1::text, $2::integer, locator.position, locator.type, locator.value, locator.distinguisher
+		FROM unnest($3::text[], $4::text[], $5::text[]) WITH ORDINALITY AS locator (type, value, distinguisher, position)`,
+		identifier, organizationID, types, values, distinguishers,
+	)
+	return err
+}
+
+func (persistence postgresFindingsPersistence) UpdateFinding(ctx context.Context, findingI intermediaries.Finding, expectedVersion int, organizationID int) (intermediaries.Finding, error) {
+	var findingR intermediaries.Finding
+	err := persistence.WithTransaction(ctx, func(ctx context.Context) error {
+		var identifier string
+		var err error
+		if expectedVersion == 0 {
+			err = persistence.upsertFinding(ctx, findingI, organizationID).Scan(&identifier)
+		} else {
+			// Checking the version in the update makes the check and the update a single atomic operation,
+			// and a finding at another version is not inserted in its place
+			err = persistence.querier(ctx).QueryRow(ctx,
+				`UPDATE findings SET name = $7, owner_team = $8, owner_contact = $9, severity = $10, status = $11,
+					created_at = $12, updated_at = $13, version = version + 1, deleted_at = $14, deleted_by = $15
+				WHERE organization_id = $1 AND report_distinguisher_type = $2 AND report_distinguisher_value = $3
+					AND report_locator_type = $4 AND report_locator_value = $5 AND report_locator_distinguisher = $6 AND version = $16
+				RETURNING id`,
+				organizationID, findingI.ReportDistinguisher.Type, findingI.ReportDistinguisher.Value,
+				string(findingI.ReportLocator.Type), findingI.ReportLocator.Value, findingI.ReportLocator.Distinguisher,
+				findingI.Name, findingI.Owner.Team, findingI.Owner.Contact, string(findingI.Severity), string(findingI.Status),
+				findingI.CreatedAt, findingI.UpdatedAt, findingI.DeletedAt, findingI.DeletedBy, expectedVersion,
+			).Scan(&identifier)
+			if errors.Is(err, pgx.ErrNoRows) {
+				err = ErrVersionMismatch
+			}
+		}
+		if err != nil {
+			return err
+		}
+		if err := persistence.replaceImpliedLocators(ctx, identifier, findingI.ImpliedReportLocators, organizationID); err != nil {
+			return err
+		}
+		findingR, err = persistence.GetFinding(ctx, identifier, organizationID)
+		return err
+	})
+	return findingR, err
+}
+
+// upsertFinding creates or replaces the finding reported on the same report distinguisher and locator
+func (persistence postgresFindingsPersistence) upsertFinding(ctx context.Context, findingI intermediaries.Finding, organizationID int) pgx.Row {
+	return persistence.querier(ctx).QueryRow(ctx,
+		`INSERT INTO findings (`+postgresFindingColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, 1, $15, $16)
+		ON CONFLICT (organization_id, report_distinguisher_type, report_distinguisher_value, report_locator_type, report_locator_value, report_locator_distinguisher)
+		DO UPDATE SET name = EXCLUDED.name, owner_team = EXCLUDED.owner_team, owner_contact = EXCLUDED.owner_contact,
+			severity = EXCLUDED.severity, status = EXCLUDED.status, created_at = EXCLUDED.created_at, updated_at = EXCLUDED.updated_at,
+			version = findings.version + 1, deleted_at = EXCLUDED.deleted_at, deleted_by = EXCLUDED.deleted_by
+		RETURNING id`,
+		newIdentifier(), organizationID, findingI.Name, findingI.ReportDistinguisher.Type, findingI.ReportDistinguisher.Value,
+		string(findingI.ReportLocator.Type), findingI.ReportLocator.Value, findingI.ReportLocator.Distinguisher,
+		findingI.Owner.Team, findingI.Owner.Contact, string(findingI.Severity), string(findingI.Status), findingI.CreatedAt, findingI.UpdatedAt,
+		findingI.DeletedAt, findingI.DeletedBy,
+	)
+}
+
+func (persistence postgresFindingsPersistence) GetFinding(ctx context.Context, identifier string, organizationID int) (intermediaries.Finding, error) {
+	finding, err := scanPostgresFinding(persistence.querier(ctx).QueryRow(ctx,
+		`SELECT `+postgresFindingColumns+` FROM findings WHERE id = $1 AND organization_id = $2`,
+		identifier, organizationID,
+	))
+	if err != nil {
+		return intermediaries.Finding{}, err
+	}
+	findings := []intermediaries.Finding{finding}
+	err = persistence.loadImpliedLocators(ctx, findings)
+	return findings[0], err
+}
+
+func (persistence postgresFindingsPersistence) GetFindings(ctx context.Context, organizationID int) ([]intermediaries.Finding, error) {
+	return persistence.queryFindings(ctx,
+		`SELECT `+postgresFindingColumns+` FROM findings WHERE organization_id = $1 ORDER BY id`,
+		organizationID,
+	)
+}
+
+func (persistence postgresFindingsPersistence) GetFindingsAfter(ctx context.Context, after string, limit int, organizationID int) ([]intermediaries.Finding, error) {
+	return persistence.queryFindings(ctx,
+		`SELECT `+postgresFindingColumns+` FROM findings WHERE organization_id = $1 AND id > $2 ORDER BY id LIMIT $3`,
+		organizationID, after, limit,
+	)
+}
+
+func (persistence postgresFindingsPersistence) GetFindingsByLocatorType(ctx context.Context, locatorType intermediaries.ReportLocatorType, organizationID int) ([]intermediaries.Finding, error) {
+	return persistence.queryFindings(ctx,
+		`SELECT `+postgresFindingColumns+` FROM findings
+		WHERE organization_id = $1 AND (report_locator_type = $2
+			OR id IN (SELECT finding_id FROM finding_implied_locators WHERE organization_id = $1 AND type = $2))
+		ORDER BY id`,
+		organizationID, string(locatorType),
+	)
+}
+
+// queryFindings reads the findings selected by the query, together with their implied locators
+func (persistence postgresFindingsPersistence) queryFindings(ctx context.Context, query string, args ...interface{}) ([]intermediaries.Finding, error) {
+	rows, err := persistence.querier(ctx).Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	findings := []intermediaries.Finding{}
+	for rows.Next() {
+		finding, err := scanPostgresFinding(rows)
+		if err != nil {
+			return nil, err
+		}
+		findings = append(findings, finding)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return findings, persistence.loadImpliedLocators(ctx, findings)
+}
+
+func (persistence postgresFindingsPersistence) GetFindingByReport(ctx context.Context, distinguisher intermediaries.ReportDistinguisher, locator intermediaries.ReportLocator, organizationID int) (intermediaries.Finding, error) {
+	finding, err := scanPostgresFinding(persistence.querier(ctx).QueryRow(ctx,
+		`SELECT `+postgresFindingColumns+` FROM findings
+		WHERE organization_id = $1 AND report_distinguisher_type = $2 AND report_distinguisher_value = $3
+			AND report_locator_type = $4 AND report_locator_value = $5 AND report_locator_distinguisher = $6`,
+		organizationID, distinguisher.Type, distinguisher.Value, string(locator.Type), locator.Value, locator.Distinguisher,
+	))
+	if err != nil {
+		return intermediaries.Finding{}, err
+	}
+	findings := []intermediaries.Finding{finding}
+	err = persistence.loadImpliedLocators(ctx, findings)
+	return findings[0], err
+}
+
+// updateFinding runs an update of a single finding of the organization, and returns the updated finding
+func (persistence postgresFindingsPersistence) updateFinding(ctx context.Context, identifier string, organizationID int, update func(context.Context) (pgconn.CommandTag, error)) (intermediaries.Finding, error) {
+	var findingR intermediaries.Finding
+	err := persistence.WithTransaction(ctx, func(ctx context.Context) error {
+		tag, err := update(ctx)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrNotFound
+		}
+		findingR, err = persistence.GetFinding(ctx, identifier, organizationID)
+		return err
+	})
+	return findingR, err
+}
+
+func (persistence postgresFindingsPersistence) UpdateFindingStatus(ctx context.Context, identifier string, status intermediaries.FindingStatus, expectedVersion int, organizationID int) (intermediaries.Finding, error) {
+	findingR, err := persistence.updateFinding(ctx, identifier, organizationID, func(ctx context.Context) (pgconn.CommandTag, error) {
+		return persistence.querier(ctx).Exec(ctx,
+			`UPDATE findings SET status = $3, updated_at = $4, version = version + 1
+			WHERE id = $1 AND organization_id = $2 AND ($5 = 0 OR version = $5)`,
+			identifier, organizationID, string(status), now(), expectedVersion,
+		)
+	})
+	return findingR, persistence.versionMismatchError(ctx, err, identifier, expectedVersion, organizationID)
+}
+
+func (persistence postgresFindingsPersistence) SoftDeleteFinding(ctx context.Context, identifier string, deletedBy int, expectedVersion int, organizationID int) (intermediaries.Finding, error) {
+	findingR, err := persistence.updateFinding(ctx, identifier, organizationID, func(ctx context.Context) (pgconn.CommandTag, error) {
+		return persistence.querier(ctx).Exec(ctx,
+			`UPDATE findings SET deleted_at = $3, deleted_by = $4, updated_at = $3, version = version + 1
+			WHERE id = $1 AND organization_id = $2 AND ($5 = 0 OR version = $5)`,
+			identifier, organizationID, now(), deletedBy, expectedVersion,
+		)
+	})
+	return findingR, persistence.versionMismatchError(ctx, err, identifier, expectedVersion, organizationID)
+}
+
+// versionMismatchError tells apart the reasons an update at the expected version changed nothing,
+// which is either that there is no such finding, or that it is at another version
+func (persistence postgresFindingsPersistence) versionMismatchError(ctx context.Context, err error, identifier string, expectedVersion int, organizationID int) error {
+	if errors.Is(err, ErrNotFound) && expectedVersion != 0 {
+		if _, err := persistence.GetFinding(ctx, identifier, organizationID); err == nil {
+			return ErrVersionMismatch
+		}
+	}
+	return err
+}
+
+func (persistence postgresFindingsPersistence) UpdateFindingOwner(ctx context.Context, identifier string, owner intermediaries.Owner, organizationID int) (intermediaries.Finding, error) {
+	return persistence.updateFinding(ctx, identifier, organizationID, func(ctx context.Context) (pgconn.CommandTag, error) {
+		return persistence.querier(ctx).Exec(ctx,
+			`UPDATE findings SET owner_team = $3, owner_contact = $4, updated_at = $5, version = version + 1 WHERE id = $1 AND organization_id = $2`,
+			identifier, organizationID, owner.Team, owner.Contact, now(),
+		)
+	})
+}
+
+func (persistence postgresFindingsPersistence) UpdateFindingLocators(ctx context.Context, identifier string, locator intermediaries.ReportLocator, implied []intermediaries.ReportLocator, organizationID int) (intermediaries.Finding, error) {
+	return persistence.updateFinding(ctx, identifier, organizationID, func(ctx context.Context) (pgconn.CommandTag, error) {
+		tag, err := persistence.querier(ctx).Exec(ctx,
+			`UPDATE findings SET report_locator_type = $3, report_locator_value = $4, report_locator_distinguisher = $5, updated_at = $6,
+				version = version + 1
+			WHERE id = $1 AND organization_id = $2`,
+			identifier, organizationID, string(locator.Type), locator.Value, locator.Distinguisher, now(),
+		)
+		if err != nil || tag.RowsAffected() == 0 {
+			return tag, postgresError(err)
+		}
+		return tag, persistence.replaceImpliedLocators(ctx, identifier, implied, organizationID)
+	})
+}
+
+func (persistence postgresFindingsPersistence) DeleteFinding(ctx context.Context, identifier string, organizationID int) error {
+	tag, err := persistence.querier(ctx).Exec(ctx, `DELETE FROM findings WHERE id = $1 AND organization_id = $2`, identifier, organizationID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
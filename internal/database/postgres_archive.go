@@ -0,0 +1,164 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
+	"github.com/jackc/pgx/v5"
+)
+
+func scanPostgresArchivedFinding(row pgx.Row) (intermediaries.Finding, error) {
+	var archivedAt time.Time
+	finding, err := scanPostgresFinding(row, &archivedAt)
+	if err != nil {
+		return intermediaries.Finding{}, err
+	}
+	finding.ArchivedAt = postgresTime(&archivedAt)
+	return finding, nil
+}
+
+// moveFinding moves a finding of the organization with its implied locators from one table of findings to another.
+// The finding is copied by the insert, which selects it by identifier and organization as $1 and $2.
+func (persistence postgresFindingsPersistence) moveFinding(ctx context.Context, from string, to string, insert string, identifier string, organizationID int, args ...interface{}) error {
+	return persistence.WithTransaction(ctx, func(ctx context.Context) error {
+		tag, err := persistence.querier(ctx).Exec(ctx, insert, append([]interface{}{identifier, organizationID}, args...)...)
+		if err != nil {
+			return postgresError(err)
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrNotFound
+		}
+		_, err = persistence.querier(ctx).Exec(ctx,
+			`INSERT INTO `+postgresImpliedLocatorTable(to)+` (finding_id, organization_id, position, type, value, distinguisher)
+			SELECT finding_id, organization_id, position, type, value, distinguisher FROM `+postgresImpliedLocatorTable(from)+` WHERE finding_id = $1`,
+			identifier,
+		)
+		if err != nil {
+			return err
+		}
+		// The implied locators are deleted along with the finding
+		_, err = persistence.querier(ctx).Exec(ctx, `DELETE FROM `+from+` WHERE id = $1`, identifier)
+		return err
+	})
+}
+
+// postgresImpliedLocatorTable is the table of the implied locators of the findings of the table
+func postgresImpliedLocatorTable(findingTable string) string {
+	if findingTable == "archived_findings" {
+		return "archived_finding_implied_locators"
+	}
+	return "finding_implied_locators"
+}
+
+func (persistence postgresFindingsPersistence) ArchiveFinding(ctx context.Context, identifier string, archivedAt time.Time, organizationID int) (intermediaries.Finding, error) {
+	var findingR intermediaries.Finding
+	err := persistence.WithTransaction(ctx, func(ctx context.Context) error {
+		err := persistence.moveFinding(ctx, "findings", "archived_findings",
+			`INSERT INTO archived_findings (`+postgresArchivedFindingColumns+`)
+			SELECT `+postgresFindingColumns+`, $3 FROM findings WHERE id = $1 AND organization_id = $2`,
+			identifier, organizationID, archivedAt.UTC().Truncate(time.Millisecond),
+		)
+		if err != nil {
+			return err
+		}
+		findingR, err = persistence.GetArchivedFinding(ctx, identifier, organizationID)
+		return err
+	})
+	return findingR, err
+}
+
+func (persistence postgresFindingsPersistence) RestoreArchivedFinding(ctx context.Context, identifier string, organizationID int) (intermediaries.Finding, error) {
+	var findingR intermediaries.Finding
+	err := persistence.WithTransaction(ctx, func(ctx context.Context) error {
+		err := persistence.moveFinding(ctx, "archived_findings", "findings",
+			`INSERT INTO findings (`+postgresFindingColumns+`)
+			SELECT `+postgresFindingColumns+` FROM archived_findings WHERE id = $1 AND organization_id = $2`,
+			identifier, organizationID,
+		)
+		if err != nil {
+			return err
+		}
+		findingR, err = persistence.GetFinding(ctx, identifier, organizationID)
+		return err
+	})
+	return findingR, err
+}
+
+const postgresArchivedFindingColumns = postgresFindingColumns + `, archived_at`
+
+func (persistence postgresFindingsPersistence) GetArchivedFinding(ctx context.Context, identifier string, organizationID int) (intermediaries.Finding, error) {
+	finding, err := scanPostgresArchivedFinding(persistence.querier(ctx).QueryRow(ctx,
+		`SELECT `+postgresArchivedFindingColumns+` FROM archived_findings WHERE id = $1 AND organization_id = $2`,
+		identifier, organizationID,
+	))
+	if err != nil {
+		return intermediaries.Finding{}, err
+	}
+	findings := []intermediaries.Finding{finding}
+	err = persistence.loadImpliedLocatorsFrom(ctx, "archived_finding_implied_locators", findings)
+	return findings[0], err
+}
+
+func (persistence postgresFindingsPersistence) GetArchivedFindings(ctx context.Context, organizationID int) ([]intermediaries.Finding, error) {
+	return persistence.queryArchivedFindings(ctx,
+		`SELECT `+postgresArchivedFindingColumns+` FROM archived_findings WHERE organization_id = $1 ORDER BY id`,
+		organizationID,
+	)
+}
+
+func (persistence postgresFindingsPersistence) GetArchivedFindingsAfter(ctx context.Context, after string, limit int, organizationID int) ([]intermediaries.Finding, error) {
+	return persistence.queryArchivedFindings(ctx,
+		`SELECT `+postgresArchivedFindingColumns+` FROM archived_findings WHERE organization_id = $1 AND id > $2 ORDER BY id LIMIT $3`,
+		organizationID, after, limit,
+	)
+}
+
+// queryArchivedFindings reads the archived findings selected by the query, together with their implied locators
+func (persistence postgresFindingsPersistence) queryArchivedFindings(ctx context.Context, query string, args ...interface{}) ([]intermediaries.Finding, error) {
+	rows, err := persistence.querier(ctx).Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	findings := []intermediaries.Finding{}
+	for rows.Next() {
+		finding, err := scanPostgresArchivedFinding(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		findings = append(findings, finding)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return findings, persistence.loadImpliedLocatorsFrom(ctx, "archived_finding_implied_locators", findings)
+}
+
+func (persistence postgresFindingsPersistence) GetArchivedFindingByReport(ctx context.Context, distinguisher intermediaries.ReportDistinguisher, locator intermediaries.ReportLocator, organizationID int) (intermediaries.Finding, error) {
+	finding, err := scanPostgresArchivedFinding(persistence.querier(ctx).QueryRow(ctx,
+		`SELECT `+postgresArchivedFindingColumns+` FROM archived_findings
+		WHERE organization_id = $1 AND report_distinguisher_type = $2 AND report_distinguisher_value = $3
+			AND report_locator_type = $4 AND report_locator_value = $5 AND report_locator_distinguisher = $6
+		ORDER BY id LIMIT 1`,
+		organizationID, distinguisher.Type, distinguisher.Value, string(locator.Type), locator.Value, locator.Distinguisher,
+	))
+	if err != nil {
+		return intermediaries.Finding{}, err
+	}
+	findings := []intermediaries.Finding{finding}
+	err = persistence.loadImpliedLocatorsFrom(ctx, "archived_finding_implied_locators", findings)
+	return findings[0], err
+}
+
+func (persistence postgresFindingsPersistence) DeleteArchivedFinding(ctx context.Context, identifier string, organizationID int) error {
+	tag, err := persistence.querier(ctx).Exec(ctx, `DELETE FROM archived_findings WHERE id = $1 AND organization_id = $2`, identifier, organizationID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
+	"github.com/jackc/pgx/v5"
+)
+
+// postgresAuditLock is the advisory lock class held while appending to the audit chain of an organization,
+// which is locked by the organization within the class so that organizations do not wait for each other
+const postgresAuditLock = 7245823
+
+const postgresAuditEntryColumns = `organization_id, sequence, finding_id, action, user_id, request_id, source_ip, created_at, previous_hash, hash`
+
+func scanPostgresAuditEntry(row pgx.Row) (intermediaries.AuditEntry, error) {
+	entry := intermediaries.AuditEntry{Changes: []intermediaries.AuditChange{}}
+	var action string
+	err := row.Scan(
+		&entry.OrganizationId, &entry.Sequence, &entry.FindingIdentifier, &action,
+		&entry.Actor.UserId, &entry.Actor.RequestId, &entry.Actor.SourceIP,
+		&entry.CreatedAt, &entry.PreviousHash, &entry.Hash,
+	)
+	entry.Action = intermediaries.AuditAction(action)
+	entry.CreatedAt = entry.CreatedAt.UTC()
+	return entry, err
+}
+
+func (persistence postgresFindingsPersistence) AppendAuditEntry(ctx context.Context, entry intermediaries.AuditEntry, organizationID int) (intermediaries.AuditEntry, error) {
+	entry.OrganizationId = organizationID
+	err := persistence.WithTransaction(ctx, func(ctx context.Context) error {
+		// The lock is held until the transaction ends, so the next append reads this entry as the last one
+		if _, err := persistence.querier(ctx).Exec(ctx, `SELECT pg_advisory_xact_lock($1, $2)`, postgresAuditLock, organizationID); err != nil {
+			return err
+		}
+		var previous *intermediaries.AuditEntry
+		last, err := scanPostgresAuditEntry(persistence.querier(ctx).QueryRow(ctx,
+			`SELECT `+postgresAuditEntryColumns+` FROM audit_entries WHERE organization_id = $1 ORDER BY sequence DESC LIMIT 1`,
+			organizationID,
+		))
+		if err == nil {
+			previous = &last
+		} else if !errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+		entry = entry.Chain(previous)
+		_, err = persistence.querier(ctx).Exec(ctx,
+			`INSERT INTO audit_entries (`+postgresAuditEntryColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+			entry.OrganizationId, entry.Sequence, entry.FindingIdentifier, string(entry.Action),
+			entry.Actor.UserId, entry.Actor.RequestId, entry.Actor.SourceIP,
+			entry.CreatedAt, entry.PreviousHash, entry.Hash,
+		)
+		if err != nil {
+			return postgresError(err)
+		}
+		fields, befores, afters := []string{}, []string{}, []string{}
+		for _, change := range entry.Changes {
+			fields = append(fields, change.Field)
+			befores = append(befores, change.Before)
+			afters = append(afters, change.After)
+		}
+		_, err = persistence.querier(ctx).Exec(ctx,
+			`INSERT INTO audit_entry_changes (organization_id, sequence, position, field, before, after)
+			SELECT $1::integer, $2::integer, change.position, change.field, change.before, change.after
+			FROM unnest($3::text[], $4::text[], $5::text[]) WITH ORDINALITY AS change (field, before, after, position)`,
+			entry.OrganizationId, entry.Sequence, fields, befores, afters,
+		)
+		return err
+	})
+	if err != nil {
+		return intermediaries.AuditEntry{}, err
+	}
+	return entry, nil
+}
+
+func (persistence postgresFindingsPersistence) GetAuditEntries(ctx context.Context, organizationID int) ([]intermediaries.AuditEntry, error) {
+	return persistence.queryAuditEntries(ctx,
+		`SELECT `+postgresAuditEntryColumns+` FROM audit_entries WHERE organization_id = $1 ORDER BY sequence`,
+		organizationID,
+	)
+}
+
+func (persistence postgresFindingsPersistence) GetAuditEntriesAfter(ctx context.Context, filter intermediaries.AuditFilter, after int, limit int, organizationID int) ([]intermediaries.AuditEntry, error) {
+	// Only the criteria that are set are queried, so that the index of the criteria is used
+	conditions := []string{"organization_id = $1", "sequence > $2"}
+	args := []interface{}{organizationID, after}
+	condition := func(format string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(format, len(args)))
+	}
+	if filter.FindingIdentifier != "" {
+		condition("finding_id = $%d", filter.FindingIdentifier)
+	}
+	if filter.UserId != 0 {
+		condition("user_id = $%d", filter.UserId)
+	}
+	if len(filter.Actions) > 0 {
+		actions := []string{}
+		for _, action := range filter.Actions {
+			actions = append(actions, string(action))
+		}
+		condition("action = ANY($%d::text[])", actions)
+	}
+	if !filter.Since.IsZero() {
+		condition("created_at >= $%d", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		condition("created_at < $%d", filter.Until)
+	}
+	args = append(args, limit)
+	return persistence.queryAuditEntries(ctx,
+		`SELECT `+postgresAuditEntryColumns+` FROM audit_entries WHERE `+strings.Join(conditions, " AND ")+
+			fmt.Sprintf(` ORDER BY sequence LIMIT $%d`, len(args)),
+		args...,
+	)
+}
+
+// queryAuditEntries reads the entries of an organization selected by the query in sequence order, together with their changes
+func (persistence postgresFindingsPersistence) queryAuditEntries(ctx context.Context, query string, args ...interface{}) ([]intermediaries.AuditEntry, error) {
+	rows, err := persistence.querier(ctx).Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	entries := []intermediaries.AuditEntry{}
+	for rows.Next() {
+		entry, err := scanPostgresAuditEntry(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return entries, persistence.loadAuditChanges(ctx, entries)
+}
+
+// loadAuditChanges reads the changes of the entries, which are entries of a single organization in sequence order
+func (persistence postgresFindingsPersistence) loadAuditChanges(ctx context.Context, entries []intermediaries.AuditEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	// The changes are read by the range of sequences of the entries, which also holds the changes of entries that were filtered out
+	rows, err := persistence.querier(ctx).Query(ctx,
+		`SELECT sequence, field, before, after FROM audit_entry_changes
+		WHERE organization_id = $1 AND sequence BETWEEN $2 AND $3 ORDER BY sequence, position`,
+		entries[0].OrganizationId, entries[0].Sequence, entries[len(entries)-1].Sequence,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	indexes := map[int]int{}
+	for index := range entries {
+		indexes[entries[index].Sequence] = index
+	}
+	for rows.Next() {
+		var sequence int
+		change := intermediaries.AuditChange{}
+		if err := rows.Scan(&sequence, &change.Field, &change.Before, &change.After); err != nil {
+			return err
+		}
+		if index, ok := indexes[sequence]; ok {
+			entries[index].Changes = append(entries[index].Changes, change)
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,65 @@
+package database
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
+	"github.com/jackc/pgx/v5"
+)
+
+func (persistence postgresFindingsPersistence) GetDistinguisherAlias(ctx context.Context, alias string, organizationID int) (intermediaries.DistinguisherAlias, error) {
+	aliasR := intermediaries.DistinguisherAlias{}
+	err := persistence.querier(ctx).QueryRow(ctx,
+		`SELECT organization_id, alias, distinguisher FROM distinguisher_aliases WHERE organization_id = $1 AND alias = $2`,
+		organizationID, alias,
+	).Scan(&aliasR.OrganizationId, &aliasR.Alias, &aliasR.Distinguisher)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return intermediaries.DistinguisherAlias{}, ErrNotFound
+	}
+	return aliasR, err
+}
+
+func (persistence postgresFindingsPersistence) GetDistinguisherAliases(ctx context.Context, organizationID int) ([]intermediaries.DistinguisherAlias, error) {
+	rows, err := persistence.querier(ctx).Query(ctx,
+		`SELECT organization_id, alias, distinguisher FROM distinguisher_aliases WHERE organization_id = $1 ORDER BY alias`,
+		organizationID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	aliasIs := []intermediaries.DistinguisherAlias{}
+	for rows.Next() {
+		aliasR := intermediaries.DistinguisherAlias{}
+		if err := rows.Scan(&aliasR.OrganizationId, &aliasR.Alias, &aliasR.Distinguisher); err != nil {
+			return nil, err
+		}
+		aliasIs = append(aliasIs, aliasR)
+	}
+	return aliasIs, rows.Err()
+}
+
+func (persistence postgresFindingsPersistence) SetDistinguisherAlias(ctx context.Context, aliasI intermediaries.DistinguisherAlias, organizationID int) (intermediaries.DistinguisherAlias, error) {
+	aliasI.OrganizationId = organizationID
+	_, err := persistence.querier(ctx).Exec(ctx,
+		`INSERT INTO distinguisher_aliases (organization_id, alias, distinguisher) VALUES ($1, $2, $3)
+		ON CONFLICT (organization_id, alias) DO UPDATE SET distinguisher = EXCLUDED.distinguisher`,
+		organizationID, aliasI.Alias, aliasI.Distinguisher,
+	)
+	if err != nil {
+		return intermediaries.DistinguisherAlias{}, err
+	}
+	return aliasI, nil
+}
+
+func (persistence postgresFindingsPersistence) DeleteDistinguisherAlias(ctx context.Context, alias string, organizationID int) error {
+	tag, err := persistence.querier(ctx).Exec(ctx, `DELETE FROM distinguisher_aliases WHERE organization_id = $1 AND alias = $2`, organizationID, alias)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package database_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/Kaese72/finding-registry/internal/database"
+	"github.com/Kaese72/finding-registry/internal/database/databasetest"
+	"github.com/jackc/pgx/v5"
+)
+
+// TestPostgresPersistence runs against the PostgreSQL database in TEST_POSTGRES_CONNECTION_STRING, and is skipped without one.
+// Everything stored in the database is removed.
+func TestPostgresPersistence(t *testing.T) {
+	connectionString := os.Getenv("TEST_POSTGRES_CONNECTION_STRING")
+	if connectionString == "" {
+		t.Skip("TEST_POSTGRES_CONNECTION_STRING not set")
+	}
+	conn, err := pgx.Connect(context.Background(), connectionString)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	t.Cleanup(func() { conn.Close(context.Background()) })
+	databasetest.Run(t, func(t *testing.T) database.Persistence {
+		persistence, err := database.NewPostgresFindingsPersistence(database.PostgresConfig{ConnectionString: connectionString})
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		// Every test starts from an empty database
+		_, err = conn.Exec(context.Background(), `TRUNCATE findings, archived_findings, ownership_rules, distinguisher_aliases, outbox, webhook_subscriptions, retention_policies, audit_entries CASCADE`)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		return persistence
+	})
+}
@@ -0,0 +1,67 @@
+package database
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+
+	"github.com/Kaese72/riskie-lib/logging"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// postgresMigrations are applied in the order of their file names, and are never changed once released
+//
+//go:embed postgres_migrations/*.sql
+var postgresMigrations embed.FS
+
+// postgresMigrationLock is the advisory lock held while migrating, so that instances starting together do not race
+const postgresMigrationLock = 7245823461
+
+// migratePostgres applies the migrations that have not been applied yet, each in a transaction of its own
+func migratePostgres(ctx context.Context, pool *pgxpool.Pool) error {
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+	if _, err := conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, postgresMigrationLock); err != nil {
+		return err
+	}
+	defer conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, postgresMigrationLock)
+
+	if _, err := conn.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (version text PRIMARY KEY, applied_at timestamptz NOT NULL)`); err != nil {
+		return err
+	}
+	names, err := fs.Glob(postgresMigrations, "postgres_migrations/*.sql")
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		version := strings.TrimSuffix(strings.TrimPrefix(name, "postgres_migrations/"), ".sql")
+		migration, err := postgresMigrations.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		err = pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+			applied := false
+			if err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)`, version).Scan(&applied); err != nil || applied {
+				return err
+			}
+			logging.Info(ctx, "Applying database migration", map[string]interface{}{"version": version})
+			if _, err := tx.Exec(ctx, string(migration)); err != nil {
+				return err
+			}
+			_, err := tx.Exec(ctx, `INSERT INTO schema_migrations (version, applied_at) VALUES ($1, $2)`, version, now())
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to apply migration %s: %w", version, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+CREATE TABLE findings (
+    id text PRIMARY KEY,
+    organization_id integer NOT NULL,
+    name text NOT NULL,
+    report_distinguisher_type text NOT NULL,
+    report_distinguisher_value text NOT NULL,
+    report_locator_type text NOT NULL,
+    report_locator_value text NOT NULL,
+    report_locator_distinguisher text NOT NULL,
+    owner_team text NOT NULL,
+    owner_contact text NOT NULL,
+    severity text NOT NULL,
+    status text NOT NULL,
+    created_at timestamptz NOT NULL,
+    updated_at timestamptz NOT NULL,
+    -- A finding is unique per report distinguisher and locator within its organization
+    UNIQUE (organization_id, report_distinguisher_type, report_distinguisher_value, report_locator_type, report_locator_value, report_locator_distinguisher)
+);
+
+CREATE TABLE finding_implied_locators (
+    finding_id text NOT NULL REFERENCES findings (id) ON DELETE CASCADE,
+    position integer NOT NULL,
+    type text NOT NULL,
+    value text NOT NULL,
+    distinguisher text NOT NULL,
+    PRIMARY KEY (finding_id, position)
+);
+
+CREATE INDEX finding_implied_locators_locator ON finding_implied_locators (type, value, distinguisher);
+
+CREATE TABLE ownership_rules (
+    id text PRIMARY KEY,
+    organization_id integer NOT NULL,
+    name text NOT NULL,
+    priority integer NOT NULL,
+    distinguisher_types text[] NOT NULL,
+    owner_team text NOT NULL,
+    owner_contact text NOT NULL
+);
+
+CREATE INDEX ownership_rules_organization ON ownership_rules (organization_id);
+
+CREATE TABLE ownership_rule_locator_patterns (
+    rule_id text NOT NULL REFERENCES ownership_rules (id) ON DELETE CASCADE,
+    position integer NOT NULL,
+    type text NOT NULL,
+    value text NOT NULL,
+    distinguisher text NOT NULL,
+    PRIMARY KEY (rule_id, position)
+);
+
+CREATE TABLE distinguisher_aliases (
+    organization_id integer NOT NULL,
+    alias text NOT NULL,
+    distinguisher text NOT NULL,
+    PRIMARY KEY (organization_id, alias)
+);
+
+CREATE TABLE outbox (
+    id text PRIMARY KEY,
+    organization_id integer NOT NULL,
+    type text NOT NULL,
+    payload bytea NOT NULL,
+    created_at timestamptz NOT NULL,
+    delivered_at timestamptz,
+    locked_until timestamptz
+);
+
+-- Undelivered events are claimed by the relay, oldest first
+CREATE INDEX outbox_undelivered ON outbox (created_at, id) WHERE delivered_at IS NULL;
+-- Streams read the events of an organization in cursor order
+CREATE INDEX outbox_organization_cursor ON outbox (organization_id, created_at, id);
+
+CREATE TABLE webhook_subscriptions (
+    id text PRIMARY KEY,
+    organization_id integer NOT NULL,
+    url text NOT NULL,
+    secret text NOT NULL,
+    event_types text[] NOT NULL,
+    enabled boolean NOT NULL,
+    consecutive_failures integer NOT NULL,
+    created_at timestamptz NOT NULL,
+    updated_at timestamptz NOT NULL
+);
+
+CREATE INDEX webhook_subscriptions_organization ON webhook_subscriptions (organization_id);
+
+CREATE TABLE webhook_deliveries (
+    id text PRIMARY KEY,
+    subscription_id text NOT NULL REFERENCES webhook_subscriptions (id) ON DELETE CASCADE,
+    organization_id integer NOT NULL,
+    event_id text NOT NULL,
+    event_type text NOT NULL,
+    payload bytea NOT NULL,
+    status text NOT NULL,
+    attempts integer NOT NULL,
+    next_attempt_at timestamptz NOT NULL,
+    last_attempt_at timestamptz,
+    last_status_code integer NOT NULL,
+    last_error text NOT NULL,
+    created_at timestamptz NOT NULL
+);
+
+-- Pending deliveries are claimed by the dispatcher once they are due
+CREATE INDEX webhook_deliveries_pending ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX webhook_deliveries_subscription ON webhook_deliveries (subscription_id, created_at);
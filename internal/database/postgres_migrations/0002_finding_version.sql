@@ -0,0 +1,2 @@
+-- Findings stored before versions were introduced start at version 1
+ALTER TABLE findings ADD COLUMN version integer NOT NULL DEFAULT 1;
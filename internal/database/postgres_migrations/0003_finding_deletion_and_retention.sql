@@ -0,0 +1,9 @@
+-- Deleted findings are kept as tombstones until they are purged
+ALTER TABLE findings ADD COLUMN deleted_at timestamptz;
+ALTER TABLE findings ADD COLUMN deleted_by integer NOT NULL DEFAULT 0;
+
+CREATE TABLE retention_policies (
+    organization_id integer PRIMARY KEY,
+    resolved_days integer NOT NULL,
+    deleted_days integer NOT NULL
+);
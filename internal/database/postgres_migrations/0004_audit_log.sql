@@ -0,0 +1,25 @@
+-- Audit entries are only ever inserted, and chain per organization by their sequence
+CREATE TABLE audit_entries (
+    organization_id integer NOT NULL,
+    sequence integer NOT NULL,
+    finding_id text NOT NULL,
+    action text NOT NULL,
+    user_id integer NOT NULL,
+    request_id text NOT NULL,
+    source_ip text NOT NULL,
+    created_at timestamptz NOT NULL,
+    previous_hash text NOT NULL,
+    hash text NOT NULL,
+    PRIMARY KEY (organization_id, sequence)
+);
+
+CREATE TABLE audit_entry_changes (
+    organization_id integer NOT NULL,
+    sequence integer NOT NULL,
+    position integer NOT NULL,
+    field text NOT NULL,
+    before text NOT NULL,
+    after text NOT NULL,
+    PRIMARY KEY (organization_id, sequence, position),
+    FOREIGN KEY (organization_id, sequence) REFERENCES audit_entries (organization_id, sequence)
+);
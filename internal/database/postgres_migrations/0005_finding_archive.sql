@@ -0,0 +1,18 @@
+-- Archived findings are moved out of findings, keeping their columns, so that findings only holds the active findings
+CREATE TABLE archived_findings (LIKE findings INCLUDING DEFAULTS INCLUDING CONSTRAINTS);
+ALTER TABLE archived_findings ADD COLUMN archived_at timestamptz NOT NULL;
+ALTER TABLE archived_findings ADD PRIMARY KEY (id);
+
+CREATE INDEX archived_findings_organization ON archived_findings (organization_id);
+CREATE INDEX archived_findings_report ON archived_findings (organization_id, report_distinguisher_type, report_distinguisher_value, report_locator_type, report_locator_value, report_locator_distinguisher);
+
+CREATE TABLE archived_finding_implied_locators (
+    finding_id text NOT NULL REFERENCES archived_findings (id) ON DELETE CASCADE,
+    position integer NOT NULL,
+    type text NOT NULL,
+    value text NOT NULL,
+    distinguisher text NOT NULL,
+    PRIMARY KEY (finding_id, position)
+);
+
+ALTER TABLE retention_policies ADD COLUMN archive_days integer NOT NULL DEFAULT 0;
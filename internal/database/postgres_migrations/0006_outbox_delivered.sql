@@ -0,0 +1,2 @@
+-- Delivered events are deleted once they are older than the stream retention
+CREATE INDEX outbox_delivered ON outbox (delivered_at) WHERE delivered_at IS NOT NULL;
@@ -0,0 +1,5 @@
+-- Deliveries are listed a page at a time, most recent first
+DROP INDEX webhook_deliveries_subscription;
+CREATE INDEX webhook_deliveries_subscription ON webhook_deliveries (subscription_id, organization_id, created_at, id);
+-- Deliveries that are no longer pending are deleted once they are older than the delivery retention
+CREATE INDEX webhook_deliveries_created ON webhook_deliveries (created_at) WHERE status <> 'pending';
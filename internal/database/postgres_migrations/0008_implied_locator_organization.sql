@@ -0,0 +1,15 @@
+-- Implied locators are looked up within an organization, so they are stored with the organization of their finding
+ALTER TABLE finding_implied_locators ADD COLUMN organization_id integer;
+UPDATE finding_implied_locators SET organization_id = findings.organization_id
+FROM findings WHERE findings.id = finding_implied_locators.finding_id;
+ALTER TABLE finding_implied_locators ALTER COLUMN organization_id SET NOT NULL;
+
+ALTER TABLE archived_finding_implied_locators ADD COLUMN organization_id integer;
+UPDATE archived_finding_implied_locators SET organization_id = archived_findings.organization_id
+FROM archived_findings WHERE archived_findings.id = archived_finding_implied_locators.finding_id;
+ALTER TABLE archived_finding_implied_locators ALTER COLUMN organization_id SET NOT NULL;
+
+-- Findings are looked up by the type of the locator they are reported on, or of any locator they imply
+DROP INDEX finding_implied_locators_locator;
+CREATE INDEX finding_implied_locators_locator ON finding_implied_locators (organization_id, type, value, distinguisher);
+CREATE INDEX findings_report_locator_type ON findings (organization_id, report_locator_type);
@@ -0,0 +1,5 @@
+-- The audit log is searched by finding, user, action and time within an organization, a page at a time in sequence order
+CREATE INDEX audit_entries_finding ON audit_entries (organization_id, finding_id, sequence);
+CREATE INDEX audit_entries_user ON audit_entries (organization_id, user_id, sequence);
+CREATE INDEX audit_entries_action ON audit_entries (organization_id, action, sequence);
+CREATE INDEX audit_entries_created_at ON audit_entries (organization_id, created_at);
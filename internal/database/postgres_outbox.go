@@ -0,0 +1,110 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
+	"github.com/jackc/pgx/v5"
+)
+
+const postgresOutboxColumns = `id, organization_id, type, payload, created_at, delivered_at`
+
+func scanPostgresOutboxEvent(row pgx.Row) (intermediaries.OutboxEvent, error) {
+	outboxEvent := intermediaries.OutboxEvent{}
+	err := row.Scan(&outboxEvent.Identifier, &outboxEvent.OrganizationId, &outboxEvent.Type, &outboxEvent.Payload, &outboxEvent.CreatedAt, &outboxEvent.DeliveredAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return intermediaries.OutboxEvent{}, ErrNotFound
+	}
+	outboxEvent.CreatedAt = outboxEvent.CreatedAt.UTC()
+	outboxEvent.DeliveredAt = postgresTime(outboxEvent.DeliveredAt)
+	return outboxEvent, err
+}
+
+func scanPostgresOutboxEvents(rows pgx.Rows) ([]intermediaries.OutboxEvent, error) {
+	defer rows.Close()
+	outboxEventIs := []intermediaries.OutboxEvent{}
+	for rows.Next() {
+		outboxEvent, err := scanPostgresOutboxEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		outboxEventIs = append(outboxEventIs, outboxEvent)
+	}
+	return outboxEventIs, rows.Err()
+}
+
+func (persistence postgresFindingsPersistence) InsertOutboxEvent(ctx context.Context, outboxEvent intermediaries.OutboxEvent) error {
+	_, err := persistence.querier(ctx).Exec(ctx,
+		`INSERT INTO outbox (`+postgresOutboxColumns+`) VALUES ($1, $2, $3, $4, $5, $6)`,
+		outboxEvent.Identifier, outboxEvent.OrganizationId, outboxEvent.Type, outboxEvent.Payload, outboxEvent.CreatedAt, outboxEvent.DeliveredAt,
+	)
+	return postgresError(err)
+}
+
+func (persistence postgresFindingsPersistence) ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]intermediaries.OutboxEvent, error) {
+	now := time.Now().UTC()
+	// Events locked by concurrent claims are skipped rather than waited for
+	rows, err := persistence.querier(ctx).Query(ctx,
+		`UPDATE outbox SET locked_until = $1
+		WHERE id IN (
+			SELECT id FROM outbox
+			WHERE delivered_at IS NULL AND (locked_until IS NULL OR locked_until < $2)
+			ORDER BY created_at, id LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+postgresOutboxColumns,
+		now.Add(lease), now, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	claimed, err := scanPostgresOutboxEvents(rows)
+	if err != nil {
+		return nil, err
+	}
+	// The order of returned rows is not defined
+	sort.Slice(claimed, func(i, j int) bool { return outboxCursorLess(claimed[i].Cursor(), claimed[j].Cursor()) })
+	return claimed, nil
+}
+
+func (persistence postgresFindingsPersistence) MarkOutboxEventDelivered(ctx context.Context, identifier string) error {
+	tag, err := persistence.querier(ctx).Exec(ctx, `UPDATE outbox SET delivered_at = $2, locked_until = NULL WHERE id = $1`, identifier, now())
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (persistence postgresFindingsPersistence) DeleteDeliveredOutboxEvents(ctx context.Context, before time.Time) (int, error) {
+	tag, err := persistence.querier(ctx).Exec(ctx, `DELETE FROM outbox WHERE delivered_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+func (persistence postgresFindingsPersistence) GetOutboxEvent(ctx context.Context, identifier string, organizationID int) (intermediaries.OutboxEvent, error) {
+	return scanPostgresOutboxEvent(persistence.querier(ctx).QueryRow(ctx,
+		`SELECT `+postgresOutboxColumns+` FROM outbox WHERE id = $1 AND organization_id = $2`,
+		identifier, organizationID,
+	))
+}
+
+func (persistence postgresFindingsPersistence) GetOutboxEventsAfter(ctx context.Context, cursor intermediaries.OutboxCursor, until time.Time, limit int, organizationID int) ([]intermediaries.OutboxEvent, error) {
+	rows, err := persistence.querier(ctx).Query(ctx,
+		`SELECT `+postgresOutboxColumns+` FROM outbox
+		WHERE organization_id = $1 AND created_at <= $2 AND (created_at, id) > ($3, $4)
+		ORDER BY created_at, id LIMIT $5`,
+		organizationID, until, cursor.CreatedAt, cursor.Identifier, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return scanPostgresOutboxEvents(rows)
+}
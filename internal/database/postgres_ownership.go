@@ -0,0 +1,162 @@
+package database
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
+	"github.com/jackc/pgx/v5"
+)
+
+const postgresOwnershipRuleColumns = `id, organization_id, name, priority, distinguisher_types, owner_team, owner_contact`
+
+func scanPostgresOwnershipRule(row pgx.Row) (intermediaries.OwnershipRule, error) {
+	rule := intermediaries.OwnershipRule{LocatorPatterns: []intermediaries.LocatorPattern{}}
+	err := row.Scan(&rule.Identifier, &rule.OrganizationId, &rule.Name, &rule.Priority, &rule.DistinguisherTypes, &rule.Owner.Team, &rule.Owner.Contact)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return intermediaries.OwnershipRule{}, ErrNotFound
+	}
+	return rule, err
+}
+
+// loadLocatorPatterns reads the locator patterns of the rules
+func (persistence postgresFindingsPersistence) loadLocatorPatterns(ctx context.Context, rules []intermediaries.OwnershipRule) error {
+	if len(rules) == 0 {
+		return nil
+	}
+	identifiers := []string{}
+	indexes := map[string]int{}
+	for index := range rules {
+		identifiers = append(identifiers, rules[index].Identifier)
+		indexes[rules[index].Identifier] = index
+	}
+	rows, err := persistence.querier(ctx).Query(ctx,
+		`SELECT rule_id, type, value, distinguisher FROM ownership_rule_locator_patterns WHERE rule_id = ANY($1) ORDER BY rule_id, position`,
+		identifiers,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var ruleID, patternType string
+		pattern := intermediaries.LocatorPattern{}
+		if err := rows.Scan(&ruleID, &patternType, &pattern.Value, &pattern.Distinguisher); err != nil {
+			return err
+		}
+		pattern.Type = intermediaries.ReportLocatorType(patternType)
+		index := indexes[ruleID]
+		rules[index].LocatorPatterns = append(rules[index].LocatorPatterns, pattern)
+	}
+	return rows.Err()
+}
+
+// replaceLocatorPatterns replaces the locator patterns of a rule
+func (persistence postgresFindingsPersistence) replaceLocatorPatterns(ctx context.Context, identifier string, patterns []intermediaries.LocatorPattern) error {
+	types, values, distinguishers := []string{}, []string{}, []string{}
+	for _, pattern := range patterns {
+		types = append(types, string(pattern.Type))
+		values = append(values, pattern.Value)
+		distinguishers = append(distinguishers, pattern.Distinguisher)
+	}
+	if _, err := persistence.querier(ctx).Exec(ctx, `DELETE FROM ownership_rule_locator_patterns WHERE rule_id = $1`, identifier); err != nil {
+		return err
+	}
+	_, err := persistence.querier(ctx).Exec(ctx,
+		`INSERT INTO ownership_rule_locator_patterns (rule_id, position, type, value, distinguisher)
+		SELECT $1::text, pattern.position, pattern.type, pattern.value, pattern.distinguisher
+		FROM unnest($2::text[], $3::text[], $4::text[]) WITH ORDINALITY AS pattern (type, value, distinguisher, position)`,
+		identifier, types, values, distinguishers,
+	)
+	return err
+}
+
+func (persistence postgresFindingsPersistence) CreateOwnershipRule(ctx context.Context, ruleI intermediaries.OwnershipRule, organizationID int) (intermediaries.OwnershipRule, error) {
+	var ruleR intermediaries.OwnershipRule
+	err := persistence.WithTransaction(ctx, func(ctx context.Context) error {
+		identifier := newIdentifier()
+		_, err := persistence.querier(ctx).Exec(ctx,
+			`INSERT INTO ownership_rules (`+postgresOwnershipRuleColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+			identifier, organizationID, ruleI.Name, ruleI.Priority, append([]string{}, ruleI.DistinguisherTypes...), ruleI.Owner.Team, ruleI.Owner.Contact,
+		)
+		if err != nil {
+			return err
+		}
+		if err := persistence.replaceLocatorPatterns(ctx, identifier, ruleI.LocatorPatterns); err != nil {
+			return err
+		}
+		ruleR, err = persistence.GetOwnershipRule(ctx, identifier, organizationID)
+		return err
+	})
+	return ruleR, err
+}
+
+func (persistence postgresFindingsPersistence) GetOwnershipRule(ctx context.Context, identifier string, organizationID int) (intermediaries.OwnershipRule, error) {
+	rule, err := scanPostgresOwnershipRule(persistence.querier(ctx).QueryRow(ctx,
+		`SELECT `+postgresOwnershipRuleColumns+` FROM ownership_rules WHERE id = $1 AND organization_id = $2`,
+		identifier, organizationID,
+	))
+	if err != nil {
+		return intermediaries.OwnershipRule{}, err
+	}
+	rules := []intermediaries.OwnershipRule{rule}
+	err = persistence.loadLocatorPatterns(ctx, rules)
+	return rules[0], err
+}
+
+func (persistence postgresFindingsPersistence) GetOwnershipRules(ctx context.Context, organizationID int) ([]intermediaries.OwnershipRule, error) {
+	rows, err := persistence.querier(ctx).Query(ctx,
+		`SELECT `+postgresOwnershipRuleColumns+` FROM ownership_rules WHERE organization_id = $1 ORDER BY id`,
+		organizationID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	rules := []intermediaries.OwnershipRule{}
+	for rows.Next() {
+		rule, err := scanPostgresOwnershipRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return rules, persistence.loadLocatorPatterns(ctx, rules)
+}
+
+func (persistence postgresFindingsPersistence) UpdateOwnershipRule(ctx context.Context, ruleI intermediaries.OwnershipRule, organizationID int) (intermediaries.OwnershipRule, error) {
+	var ruleR intermediaries.OwnershipRule
+	err := persistence.WithTransaction(ctx, func(ctx context.Context) error {
+		tag, err := persistence.querier(ctx).Exec(ctx,
+			`UPDATE ownership_rules SET name = $3, priority = $4, distinguisher_types = $5, owner_team = $6, owner_contact = $7
+			WHERE id = $1 AND organization_id = $2`,
+			ruleI.Identifier, organizationID, ruleI.Name, ruleI.Priority, append([]string{}, ruleI.DistinguisherTypes...), ruleI.Owner.Team, ruleI.Owner.Contact,
+		)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrNotFound
+		}
+		if err := persistence.replaceLocatorPatterns(ctx, ruleI.Identifier, ruleI.LocatorPatterns); err != nil {
+			return err
+		}
+		ruleR, err = persistence.GetOwnershipRule(ctx, ruleI.Identifier, organizationID)
+		return err
+	})
+	return ruleR, err
+}
+
+func (persistence postgresFindingsPersistence) DeleteOwnershipRule(ctx context.Context, identifier string, organizationID int) error {
+	tag, err := persistence.querier(ctx).Exec(ctx, `DELETE FROM ownership_rules WHERE id = $1 AND organization_id = $2`, identifier, organizationID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package database
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
+	"github.com/jackc/pgx/v5"
+)
+
+func (persistence postgresFindingsPersistence) GetRetentionPolicy(ctx context.Context, organizationID int) (intermediaries.RetentionPolicy, error) {
+	policyR := intermediaries.RetentionPolicy{}
+	err := persistence.querier(ctx).QueryRow(ctx,
+		`SELECT organization_id, resolved_days, deleted_days, archive_days FROM retention_policies WHERE organization_id = $1`,
+		organizationID,
+	).Scan(&policyR.OrganizationId, &policyR.ResolvedDays, &policyR.DeletedDays, &policyR.ArchiveDays)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return intermediaries.RetentionPolicy{}, ErrNotFound
+	}
+	return policyR, err
+}
+
+func (persistence postgresFindingsPersistence) GetRetentionPolicies(ctx context.Context) ([]intermediaries.RetentionPolicy, error) {
+	rows, err := persistence.querier(ctx).Query(ctx,
+		`SELECT organization_id, resolved_days, deleted_days, archive_days FROM retention_policies ORDER BY organization_id`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	policyIs := []intermediaries.RetentionPolicy{}
+	for rows.Next() {
+		policyR := intermediaries.RetentionPolicy{}
+		if err := rows.Scan(&policyR.OrganizationId, &policyR.ResolvedDays, &policyR.DeletedDays, &policyR.ArchiveDays); err != nil {
+			return nil, err
+		}
+		policyIs = append(policyIs, policyR)
+	}
+	return policyIs, rows.Err()
+}
+
+func (persistence postgresFindingsPersistence) SetRetentionPolicy(ctx context.Context, policyI intermediaries.RetentionPolicy, organizationID int) (intermediaries.RetentionPolicy, error) {
+	policyI.OrganizationId = organizationID
+	_, err := persistence.querier(ctx).Exec(ctx,
+		`INSERT INTO retention_policies (organization_id, resolved_days, deleted_days, archive_days) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (organization_id) DO UPDATE SET resolved_days = EXCLUDED.resolved_days, deleted_days = EXCLUDED.deleted_days,
+			archive_days = EXCLUDED.archive_days`,
+		organizationID, policyI.ResolvedDays, policyI.DeletedDays, policyI.ArchiveDays,
+	)
+	if err != nil {
+		return intermediaries.RetentionPolicy{}, err
+	}
+	return policyI, nil
+}
@@ -0,0 +1,225 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
+	"github.com/jackc/pgx/v5"
+)
+
+const postgresWebhookSubscriptionColumns = `id, organization_id, url, secret, event_types, enabled, consecutive_failures, created_at, updated_at`
+
+func scanPostgresWebhookSubscription(row pgx.Row) (intermediaries.WebhookSubscription, error) {
+	subscription := intermediaries.WebhookSubscription{}
+	err := row.Scan(
+		&subscription.Identifier, &subscription.OrganizationId, &subscription.URL, &subscription.Secret, &subscription.EventTypes,
+		&subscription.Enabled, &subscription.ConsecutiveFailures, &subscription.CreatedAt, &subscription.UpdatedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return intermediaries.WebhookSubscription{}, ErrNotFound
+	}
+	subscription.CreatedAt = subscription.CreatedAt.UTC()
+	subscription.UpdatedAt = subscription.UpdatedAt.UTC()
+	return subscription, err
+}
+
+const postgresWebhookDeliveryColumns = `id, subscription_id, organization_id, event_id, event_type, payload, status,
+	attempts, next_attempt_at, last_attempt_at, last_status_code, last_error, created_at`
+
+func scanPostgresWebhookDelivery(row pgx.Row) (intermediaries.WebhookDelivery, error) {
+	delivery := intermediaries.WebhookDelivery{}
+	var status string
+	err := row.Scan(
+		&delivery.Identifier, &delivery.SubscriptionId, &delivery.OrganizationId, &delivery.EventId, &delivery.EventType, &delivery.Payload, &status,
+		&delivery.Attempts, &delivery.NextAttemptAt, &delivery.LastAttemptAt, &delivery.LastStatusCode, &delivery.LastError, &delivery.CreatedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return intermediaries.WebhookDelivery{}, ErrNotFound
+	}
+	delivery.Status = intermediaries.WebhookDeliveryStatus(status)
+	delivery.NextAttemptAt = delivery.NextAttemptAt.UTC()
+	delivery.LastAttemptAt = postgresTime(delivery.LastAttemptAt)
+	delivery.CreatedAt = delivery.CreatedAt.UTC()
+	return delivery, err
+}
+
+func scanPostgresWebhookDeliveries(rows pgx.Rows) ([]intermediaries.WebhookDelivery, error) {
+	defer rows.Close()
+	deliveryIs := []intermediaries.WebhookDelivery{}
+	for rows.Next() {
+		delivery, err := scanPostgresWebhookDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveryIs = append(deliveryIs, delivery)
+	}
+	return deliveryIs, rows.Err()
+}
+
+func (persistence postgresFindingsPersistence) CreateWebhookSubscription(ctx context.Context, subscriptionI intermediaries.WebhookSubscription, organizationID int) (intermediaries.WebhookSubscription, error) {
+	subscriptionI.Identifier = newIdentifier()
+	subscriptionI.OrganizationId = organizationID
+	subscriptionI.EventTypes = append([]string{}, subscriptionI.EventTypes...)
+	_, err := persistence.querier(ctx).Exec(ctx,
+		`INSERT INTO webhook_subscriptions (`+postgresWebhookSubscriptionColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		subscriptionI.Identifier, organizationID, subscriptionI.URL, subscriptionI.Secret, subscriptionI.EventTypes,
+		subscriptionI.Enabled, subscriptionI.ConsecutiveFailures, subscriptionI.CreatedAt, subscriptionI.UpdatedAt,
+	)
+	if err != nil {
+		return intermediaries.WebhookSubscription{}, err
+	}
+	return subscriptionI, nil
+}
+
+func (persistence postgresFindingsPersistence) GetWebhookSubscription(ctx context.Context, identifier string, organizationID int) (intermediaries.WebhookSubscription, error) {
+	return scanPostgresWebhookSubscription(persistence.querier(ctx).QueryRow(ctx,
+		`SELECT `+postgresWebhookSubscriptionColumns+` FROM webhook_subscriptions WHERE id = $1 AND organization_id = $2`,
+		identifier, organizationID,
+	))
+}
+
+func (persistence postgresFindingsPersistence) GetWebhookSubscriptions(ctx context.Context, organizationID int) ([]intermediaries.WebhookSubscription, error) {
+	rows, err := persistence.querier(ctx).Query(ctx,
+		`SELECT `+postgresWebhookSubscriptionColumns+` FROM webhook_subscriptions WHERE organization_id = $1 ORDER BY id`,
+		organizationID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	subscriptionIs := []intermediaries.WebhookSubscription{}
+	for rows.Next() {
+		subscription, err := scanPostgresWebhookSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subscriptionIs = append(subscriptionIs, subscription)
+	}
+	return subscriptionIs, rows.Err()
+}
+
+func (persistence postgresFindingsPersistence) UpdateWebhookSubscription(ctx context.Context, subscriptionI intermediaries.WebhookSubscription, organizationID int) (intermediaries.WebhookSubscription, error) {
+	return scanPostgresWebhookSubscription(persistence.querier(ctx).QueryRow(ctx,
+		`UPDATE webhook_subscriptions SET url = $3, secret = $4, event_types = $5, enabled = $6, consecutive_failures = $7, created_at = $8, updated_at = $9
+		WHERE id = $1 AND organization_id = $2
+		RETURNING `+postgresWebhookSubscriptionColumns,
+		subscriptionI.Identifier, organizationID, subscriptionI.URL, subscriptionI.Secret, append([]string{}, subscriptionI.EventTypes...),
+		subscriptionI.Enabled, subscriptionI.ConsecutiveFailures, subscriptionI.CreatedAt, subscriptionI.UpdatedAt,
+	))
+}
+
+func (persistence postgresFindingsPersistence) RecordWebhookFailure(ctx context.Context, identifier string, disableAfter int, organizationID int) (intermediaries.WebhookSubscription, error) {
+	// The right hand sides read the row as it was before the update
+	return scanPostgresWebhookSubscription(persistence.querier(ctx).QueryRow(ctx,
+		`UPDATE webhook_subscriptions SET consecutive_failures = consecutive_failures + 1,
+			enabled = enabled AND consecutive_failures + 1 < $3
+		WHERE id = $1 AND organization_id = $2
+		RETURNING `+postgresWebhookSubscriptionColumns,
+		identifier, organizationID, disableAfter,
+	))
+}
+
+func (persistence postgresFindingsPersistence) RecordWebhookSuccess(ctx context.Context, identifier string, organizationID int) error {
+	tag, err := persistence.querier(ctx).Exec(ctx,
+		`UPDATE webhook_subscriptions SET consecutive_failures = 0 WHERE id = $1 AND organization_id = $2`,
+		identifier, organizationID,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DeleteWebhookSubscription deletes the subscription, and its deliveries through the foreign key
+func (persistence postgresFindingsPersistence) DeleteWebhookSubscription(ctx context.Context, identifier string, organizationID int) error {
+	tag, err := persistence.querier(ctx).Exec(ctx, `DELETE FROM webhook_subscriptions WHERE id = $1 AND organization_id = $2`, identifier, organizationID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (persistence postgresFindingsPersistence) InsertWebhookDelivery(ctx context.Context, delivery intermediaries.WebhookDelivery) error {
+	_, err := persistence.querier(ctx).Exec(ctx,
+		`INSERT INTO webhook_deliveries (`+postgresWebhookDeliveryColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`,
+		delivery.Identifier, delivery.SubscriptionId, delivery.OrganizationId, delivery.EventId, delivery.EventType, delivery.Payload, string(delivery.Status),
+		delivery.Attempts, delivery.NextAttemptAt, delivery.LastAttemptAt, delivery.LastStatusCode, delivery.LastError, delivery.CreatedAt,
+	)
+	return postgresError(err)
+}
+
+func (persistence postgresFindingsPersistence) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]intermediaries.WebhookDelivery, error) {
+	now := time.Now().UTC()
+	// The deliveries are returned as they were before the claim, like the MongoDB persistence does
+	rows, err := persistence.querier(ctx).Query(ctx,
+		`WITH due AS (
+			SELECT `+postgresWebhookDeliveryColumns+` FROM webhook_deliveries
+			WHERE status = $1 AND next_attempt_at <= $2
+			ORDER BY next_attempt_at LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE webhook_deliveries SET next_attempt_at = $4 FROM due WHERE webhook_deliveries.id = due.id
+		RETURNING due.id, due.subscription_id, due.organization_id, due.event_id, due.event_type, due.payload, due.status,
+			due.attempts, due.next_attempt_at, due.last_attempt_at, due.last_status_code, due.last_error, due.created_at`,
+		string(intermediaries.DeliveryPending), now, limit, now.Add(lease),
+	)
+	if err != nil {
+		return nil, err
+	}
+	claimed, err := scanPostgresWebhookDeliveries(rows)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(claimed, func(i, j int) bool { return claimed[i].NextAttemptAt.Before(claimed[j].NextAttemptAt) })
+	return claimed, nil
+}
+
+func (persistence postgresFindingsPersistence) UpdateWebhookDelivery(ctx context.Context, delivery intermediaries.WebhookDelivery) error {
+	tag, err := persistence.querier(ctx).Exec(ctx,
+		`UPDATE webhook_deliveries SET subscription_id = $2, organization_id = $3, event_id = $4, event_type = $5, payload = $6, status = $7,
+			attempts = $8, next_attempt_at = $9, last_attempt_at = $10, last_status_code = $11, last_error = $12, created_at = $13
+		WHERE id = $1`,
+		delivery.Identifier, delivery.SubscriptionId, delivery.OrganizationId, delivery.EventId, delivery.EventType, delivery.Payload, string(delivery.Status),
+		delivery.Attempts, delivery.NextAttemptAt, delivery.LastAttemptAt, delivery.LastStatusCode, delivery.LastError, delivery.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (persistence postgresFindingsPersistence) GetWebhookDeliveries(ctx context.Context, subscriptionID string, before intermediaries.WebhookDeliveryCursor, limit int, organizationID int) ([]intermediaries.WebhookDelivery, error) {
+	rows, err := persistence.querier(ctx).Query(ctx,
+		`SELECT `+postgresWebhookDeliveryColumns+` FROM webhook_deliveries
+		WHERE subscription_id = $1 AND organization_id = $2 AND ($3 OR (created_at, id) < ($4, $5))
+		ORDER BY created_at DESC, id DESC LIMIT $6`,
+		subscriptionID, organizationID, before.CreatedAt.IsZero(), before.CreatedAt, before.Identifier, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return scanPostgresWebhookDeliveries(rows)
+}
+
+func (persistence postgresFindingsPersistence) DeleteWebhookDeliveries(ctx context.Context, before time.Time) (int, error) {
+	tag, err := persistence.querier(ctx).Exec(ctx,
+		`DELETE FROM webhook_deliveries WHERE status <> 'pending' AND created_at < $1`,
+		before,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return int(tag.RowsAffected()), nil
+}
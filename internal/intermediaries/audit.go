@@ -0,0 +1,195 @@
+package intermediaries
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Kaese72/riskie-lib/apierror"
+)
+
+type AuditAction string
+
+const (
+	AuditCreated       AuditAction = "created"
+	AuditUpdated       AuditAction = "updated"
+	AuditStatusChanged AuditAction = "statusChanged"
+	// AuditDeleted is a finding being marked as deleted, AuditPurged a finding being deleted for good
+	AuditDeleted AuditAction = "deleted"
+	AuditPurged  AuditAction = "purged"
+	// AuditArchived is a finding being moved to the archive, AuditRestored a finding being moved back when reported again
+	AuditArchived AuditAction = "archived"
+	AuditRestored AuditAction = "restored"
+	// AuditImported is a finding being created or replaced by importing an export, whatever changed
+	AuditImported AuditAction = "imported"
+)
+
+// AuditActor is who made a change, and from where. Changes made by the service itself, like enforcing
+// retention policies, have no user.
+type AuditActor struct {
+	UserId    int
+	RequestId string
+	SourceIP  string
+}
+
+// AuditChange is a field of a finding that changed. The values are JSON encoded, and empty when the
+// finding did not exist before or after the change.
+type AuditChange struct {
+	Field  string
+	Before string
+	After  string
+}
+
+// AuditEntry records a single change to a finding. The entries of an organization form a chain, where every
+// entry includes the hash of the one before it, so that changing or removing an entry is detected.
+type AuditEntry struct {
+	OrganizationId int
+	// Sequence numbers the entries of the organization from 1 without gaps
+	Sequence          int
+	FindingIdentifier string
+	Action            AuditAction
+	Actor             AuditActor
+	Changes           []AuditChange
+	CreatedAt         time.Time
+	PreviousHash      string
+	Hash              string
+}
+
+// auditHashed is what the hash of an entry covers, which is every field but the hash itself
+type auditHashed struct {
+	OrganizationId    int           `json:"organizationId"`
+	Sequence          int           `json:"sequence"`
+	FindingIdentifier string        `json:"findingId"`
+	Action            AuditAction   `json:"action"`
+	UserId            int           `json:"userId"`
+	RequestId         string        `json:"requestId"`
+	SourceIP          string        `json:"sourceIP"`
+	Changes           []AuditChange `json:"changes"`
+	CreatedAt         string        `json:"createdAt"`
+	PreviousHash      string        `json:"previousHash"`
+}
+
+// ComputeHash hashes the entry, including the hash of the entry before it
+func (entry AuditEntry) ComputeHash() string {
+	changes := entry.Changes
+	if changes == nil {
+		changes = []AuditChange{}
+	}
+	// Encoding a struct is deterministic, and the time is formatted so that its location does not matter
+	encoded, _ := json.Marshal(auditHashed{
+		OrganizationId:    entry.OrganizationId,
+		Sequence:          entry.Sequence,
+		FindingIdentifier: entry.FindingIdentifier,
+		Action:            entry.Action,
+		UserId:            entry.Actor.UserId,
+		RequestId:         entry.Actor.RequestId,
+		SourceIP:          entry.Actor.SourceIP,
+		Changes:           changes,
+		CreatedAt:         entry.CreatedAt.UTC().Format(time.RFC3339Nano),
+		PreviousHash:      entry.PreviousHash,
+	})
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:])
+}
+
+// Chain places the entry after the previous entry of the organization, or first if there is none, and hashes it
+func (entry AuditEntry) Chain(previous *AuditEntry) AuditEntry {
+	// The time is hashed as precisely as every backend stores it, so that stored entries still match their hash
+	entry.CreatedAt = entry.CreatedAt.UTC().Truncate(time.Millisecond)
+	entry.Sequence = 1
+	entry.PreviousHash = ""
+	if previous != nil {
+		entry.Sequence = previous.Sequence + 1
+		entry.PreviousHash = previous.Hash
+	}
+	entry.Hash = entry.ComputeHash()
+	return entry
+}
+
+// AuditVerification is the result of verifying the audit chain of an organization
+type AuditVerification struct {
+	Entries int
+	// BrokenAt is the sequence of the first entry that does not belong in the chain, or 0 if every entry does
+	BrokenAt int
+	Reason   string
+}
+
+func (verification AuditVerification) Valid() bool {
+	return verification.BrokenAt == 0
+}
+
+// VerifyAuditChain checks that the entries, in sequence order, form an unbroken chain from the first entry
+func VerifyAuditChain(entries []AuditEntry) AuditVerification {
+	verification := AuditVerification{Entries: len(entries)}
+	var previous *AuditEntry
+	for index := range entries {
+		entry := entries[index]
+		expectedSequence, expectedPrevious := 1, ""
+		if previous != nil {
+			expectedSequence, expectedPrevious = previous.Sequence+1, previous.Hash
+		}
+		switch {
+		case entry.Sequence != expectedSequence:
+			verification.BrokenAt = expectedSequence
+			verification.Reason = fmt.Sprintf("expected entry %d, found entry %d", expectedSequence, entry.Sequence)
+		case entry.PreviousHash != expectedPrevious:
+			verification.BrokenAt = entry.Sequence
+			verification.Reason = "entry does not follow the entry before it"
+		case entry.Hash != entry.ComputeHash():
+			verification.BrokenAt = entry.Sequence
+			verification.Reason = "entry does not match its hash"
+		}
+		if !verification.Valid() {
+			return verification
+		}
+		previous = &entries[index]
+	}
+	return verification
+}
+
+// AuditFilter narrows down which audit entries are returned when searching the audit log.
+// An entry must match every criteria that is set, and the zero value matches every entry.
+type AuditFilter struct {
+	// FindingIdentifier matches entries of the finding, if set
+	FindingIdentifier string
+	// UserId matches entries of changes made by the user, if set
+	UserId int
+	// Actions matches entries of any of the actions, if set
+	Actions []AuditAction
+	// Since matches entries created at or after the time, if set
+	Since time.Time
+	// Until matches entries created before the time, if set
+	Until time.Time
+}
+
+func (filter AuditFilter) Matches(entry AuditEntry) bool {
+	return (filter.FindingIdentifier == "" || entry.FindingIdentifier == filter.FindingIdentifier) &&
+		(filter.UserId == 0 || entry.Actor.UserId == filter.UserId) &&
+		filter.matchesActions(entry) &&
+		(filter.Since.IsZero() || !entry.CreatedAt.Before(filter.Since)) &&
+		(filter.Until.IsZero() || entry.CreatedAt.Before(filter.Until))
+}
+
+func (filter AuditFilter) matchesActions(entry AuditEntry) bool {
+	if len(filter.Actions) == 0 {
+		return true
+	}
+	for _, action := range filter.Actions {
+		if entry.Action == action {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks that the action is one of the known actions
+func (action AuditAction) Validate() error {
+	switch action {
+	case AuditCreated, AuditUpdated, AuditStatusChanged, AuditDeleted, AuditPurged, AuditArchived, AuditRestored, AuditImported:
+		return nil
+	}
+	return apierror.APIError{Code: http.StatusBadRequest, WrappedError: fmt.Errorf("invalid Action: %s", action)}
+}
@@ -0,0 +1,114 @@
+package intermediaries_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
+)
+
+// auditChain chains an entry for each of the findings
+func auditChain(findings ...string) []intermediaries.AuditEntry {
+	entries := []intermediaries.AuditEntry{}
+	var previous *intermediaries.AuditEntry
+	for index, finding := range findings {
+		entry := intermediaries.AuditEntry{
+			OrganizationId:    1,
+			FindingIdentifier: finding,
+			Action:            intermediaries.AuditStatusChanged,
+			Actor:             intermediaries.AuditActor{UserId: 7},
+			Changes:           []intermediaries.AuditChange{{Field: "status", Before: `"open"`, After: `"resolved"`}},
+			CreatedAt:         time.Date(2024, 3, 1, 12, index, 0, 0, time.UTC),
+		}.Chain(previous)
+		entries = append(entries, entry)
+		previous = &entries[len(entries)-1]
+	}
+	return entries
+}
+
+func TestVerifyAuditChain(t *testing.T) {
+	var tests = []struct {
+		name     string
+		tamper   func([]intermediaries.AuditEntry) []intermediaries.AuditEntry
+		brokenAt int
+	}{
+		{"untouched", func(entries []intermediaries.AuditEntry) []intermediaries.AuditEntry { return entries }, 0},
+		{"changed entry", func(entries []intermediaries.AuditEntry) []intermediaries.AuditEntry {
+			entries[1].Actor.UserId = 8
+			return entries
+		}, 2},
+		{"changed entry with its hash", func(entries []intermediaries.AuditEntry) []intermediaries.AuditEntry {
+			entries[1].Changes[0].After = `"accepted"`
+			entries[1].Hash = entries[1].ComputeHash()
+			return entries
+		}, 3},
+		{"removed entry", func(entries []intermediaries.AuditEntry) []intermediaries.AuditEntry {
+			return append(entries[:1], entries[2:]...)
+		}, 2},
+		{"removed first entry", func(entries []intermediaries.AuditEntry) []intermediaries.AuditEntry {
+			return entries[1:]
+		}, 1},
+		{"swapped entries", func(entries []intermediaries.AuditEntry) []intermediaries.AuditEntry {
+			entries[1], entries[2] = entries[2], entries[1]
+			return entries
+		}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verification := intermediaries.VerifyAuditChain(tt.tamper(auditChain("a", "b", "c")))
+			if verification.BrokenAt != tt.brokenAt {
+				t.Errorf("expected the chain to break at %d, got %+v", tt.brokenAt, verification)
+			}
+			if verification.Valid() != (tt.brokenAt == 0) {
+				t.Errorf("expected valid to be %t", tt.brokenAt == 0)
+			}
+		})
+	}
+}
+
+func TestAuditEntryChain(t *testing.T) {
+	entries := auditChain("a", "b")
+	if entries[0].Sequence != 1 || entries[0].PreviousHash != "" || entries[1].Sequence != 2 || entries[1].PreviousHash != entries[0].Hash {
+		t.Errorf("expected the second entry to follow the first, got %+v", entries)
+	}
+	// The hash does not depend on the location of the time
+	moved := entries[0]
+	moved.CreatedAt = moved.CreatedAt.In(time.FixedZone("CET", 3600))
+	if moved.ComputeHash() != entries[0].Hash {
+		t.Error("expected the hash to not depend on the location of the time")
+	}
+}
+
+func TestAuditFilterMatches(t *testing.T) {
+	createdAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	entry := intermediaries.AuditEntry{
+		FindingIdentifier: "a",
+		Action:            intermediaries.AuditDeleted,
+		Actor:             intermediaries.AuditActor{UserId: 7},
+		CreatedAt:         createdAt,
+	}
+	var tests = []struct {
+		name     string
+		filter   intermediaries.AuditFilter
+		expected bool
+	}{
+		{"zero value", intermediaries.AuditFilter{}, true},
+		{"finding", intermediaries.AuditFilter{FindingIdentifier: "a"}, true},
+		{"other finding", intermediaries.AuditFilter{FindingIdentifier: "b"}, false},
+		{"user", intermediaries.AuditFilter{UserId: 7}, true},
+		{"other user", intermediaries.AuditFilter{UserId: 8}, false},
+		{"action", intermediaries.AuditFilter{Actions: []intermediaries.AuditAction{intermediaries.AuditDeleted, intermediaries.AuditPurged}}, true},
+		{"other action", intermediaries.AuditFilter{Actions: []intermediaries.AuditAction{intermediaries.AuditCreated}}, false},
+		{"created at since", intermediaries.AuditFilter{Since: createdAt}, true},
+		{"created before since", intermediaries.AuditFilter{Since: createdAt.Add(time.Second)}, false},
+		{"created before until", intermediaries.AuditFilter{Until: createdAt.Add(time.Second)}, true},
+		{"created at until", intermediaries.AuditFilter{Until: createdAt}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if actual := tt.filter.Matches(entry); actual != tt.expected {
+				t.Errorf("expected %t, got %t", tt.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package intermediaries
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/Kaese72/riskie-lib/apierror"
+)
+
+// DistinguisherAlias rewrites the distinguisher of incoming report locators,
+// so that scanners using different names for the same network report on the same locators
+type DistinguisherAlias struct {
+	OrganizationId int
+	Alias          string
+	Distinguisher  string
+}
+
+func (alias DistinguisherAlias) Validate() error {
+	if alias.Alias == "" {
+		return apierror.APIError{Code: http.StatusBadRequest, WrappedError: fmt.Errorf("missing Alias")}
+	}
+	if alias.Distinguisher == "" {
+		return apierror.APIError{Code: http.StatusBadRequest, WrappedError: fmt.Errorf("missing Distinguisher")}
+	}
+	if alias.Alias == GlobalDistinguisher {
+		return apierror.APIError{Code: http.StatusUnprocessableEntity, WrappedError: fmt.Errorf("the %s distinguisher can not be aliased", GlobalDistinguisher)}
+	}
+	if alias.Alias == alias.Distinguisher {
+		return apierror.APIError{Code: http.StatusUnprocessableEntity, WrappedError: fmt.Errorf("distinguisher can not be an alias of itself")}
+	}
+	return nil
+}
+
+// DistinguisherMerge is the outcome of merging one distinguisher into another
+type DistinguisherMerge struct {
+	From string
+	Into string
+	// Rekeyed is the number of findings moved to the Into distinguisher
+	Rekeyed int
+	// Deduplicated is the number of findings removed since the same finding already existed on the Into distinguisher
+	Deduplicated int
+}
@@ -0,0 +1,123 @@
+package intermediaries
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Kaese72/riskie-lib/apierror"
+)
+
+// ExportFormatVersion is the version of the export format written by this version of the service.
+// It is incremented whenever the format changes in a way older versions can not import.
+const ExportFormatVersion = 1
+
+// ExportHeader describes an export of the findings of an organization
+type ExportHeader struct {
+	Version int
+	// OrganizationId is the organization the findings were exported from
+	OrganizationId int
+	ExportedAt     time.Time
+}
+
+func (header ExportHeader) Validate() error {
+	if header.Version == 0 {
+		return apierror.APIError{Code: http.StatusBadRequest, WrappedError: errors.New("missing Version")}
+	}
+	if header.Version > ExportFormatVersion {
+		return apierror.APIError{Code: http.StatusUnprocessableEntity, WrappedError: fmt.Errorf("unsupported export Version: %d", header.Version)}
+	}
+	return nil
+}
+
+// Validate checks that the finding is complete, as when restoring it rather than when it is reported
+func (finding Finding) Validate() error {
+	if finding.ReportDistinguisher.Type == "" {
+		return apierror.APIError{Code: http.StatusBadRequest, WrappedError: errors.New("missing ReportDistinguisher Type")}
+	}
+	if finding.ReportDistinguisher.Value == "" {
+		return apierror.APIError{Code: http.StatusBadRequest, WrappedError: errors.New("missing ReportDistinguisher Value")}
+	}
+	if err := finding.ReportLocator.Validate(); err != nil {
+		return err
+	}
+	if err := finding.Severity.Validate(); err != nil {
+		return err
+	}
+	if err := finding.Status.Validate(); err != nil {
+		return err
+	}
+	if finding.CreatedAt.IsZero() || finding.UpdatedAt.IsZero() {
+		return apierror.APIError{Code: http.StatusBadRequest, WrappedError: errors.New("missing CreatedAt or UpdatedAt")}
+	}
+	if finding.UpdatedAt.Before(finding.CreatedAt) {
+		return apierror.APIError{Code: http.StatusUnprocessableEntity, WrappedError: errors.New("UpdatedAt is before CreatedAt")}
+	}
+	return nil
+}
+
+// Validate checks that the entry is complete and still matches its hash. The chain it was part of can not be
+// verified from a single entry, since the entries before it may be of other findings.
+func (entry AuditEntry) Validate() error {
+	if err := entry.Action.Validate(); err != nil {
+		return err
+	}
+	if entry.CreatedAt.IsZero() {
+		return apierror.APIError{Code: http.StatusBadRequest, WrappedError: errors.New("missing CreatedAt")}
+	}
+	for _, change := range entry.Changes {
+		if change.Field == "" {
+			return apierror.APIError{Code: http.StatusBadRequest, WrappedError: errors.New("missing change Field")}
+		}
+		if (change.Before != "" && !json.Valid([]byte(change.Before))) || (change.After != "" && !json.Valid([]byte(change.After))) {
+			return apierror.APIError{Code: http.StatusBadRequest, WrappedError: fmt.Errorf("invalid change of %s", change.Field)}
+		}
+	}
+	if entry.Hash != entry.ComputeHash() {
+		return apierror.APIError{Code: http.StatusUnprocessableEntity, WrappedError: fmt.Errorf("entry %d does not match its hash", entry.Sequence)}
+	}
+	return nil
+}
+
+// ExportedFinding is a finding together with its audit history, oldest first
+type ExportedFinding struct {
+	Finding Finding
+	History []AuditEntry
+}
+
+func (exported ExportedFinding) Validate() error {
+	if err := exported.Finding.Validate(); err != nil {
+		return err
+	}
+	for _, entry := range exported.History {
+		if entry.FindingIdentifier != exported.Finding.Identifier {
+			return apierror.APIError{Code: http.StatusUnprocessableEntity, WrappedError: fmt.Errorf("entry %d is of another finding", entry.Sequence)}
+		}
+		if err := entry.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidateAt validates the finding of an export, and tells in the error that it is the finding at the number, counting from 1
+func (exported ExportedFinding) ValidateAt(number int) error {
+	if err := exported.Validate(); err != nil {
+		apiErr := apierror.APIError{Code: http.StatusBadRequest, WrappedError: err}
+		errors.As(err, &apiErr)
+		return apierror.APIError{Code: apiErr.Code, WrappedError: fmt.Errorf("finding %d: %w", number, apiErr.WrappedError)}
+	}
+	return nil
+}
+
+// FindingImport is the outcome of importing findings. Importing the same export again leaves every finding unchanged.
+type FindingImport struct {
+	// Created is the number of findings that did not exist
+	Created int
+	// Updated is the number of findings that existed, but differed from the export
+	Updated int
+	// Unchanged is the number of findings that already matched the export
+	Unchanged int
+}
@@ -0,0 +1,82 @@
+package intermediaries_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
+	"github.com/Kaese72/riskie-lib/apierror"
+)
+
+func exportedFinding() intermediaries.ExportedFinding {
+	createdAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	return intermediaries.ExportedFinding{
+		Finding: intermediaries.Finding{
+			Identifier:          "a",
+			ReportDistinguisher: intermediaries.ReportDistinguisher{Type: "scanner", Value: "nmap"},
+			ReportLocator:       intermediaries.ReportLocator{Type: intermediaries.TCP, Value: "10.0.0.1:22", Distinguisher: "dc1"},
+			Status:              intermediaries.StatusResolved,
+			CreatedAt:           createdAt,
+			UpdatedAt:           createdAt.Add(time.Minute),
+		},
+		History: auditChain("a"),
+	}
+}
+
+func TestExportValidate(t *testing.T) {
+	var tests = []struct {
+		name   string
+		change func(*intermediaries.ExportHeader, []intermediaries.ExportedFinding)
+		code   int
+		err    string
+	}{
+		{"valid", func(header *intermediaries.ExportHeader, findings []intermediaries.ExportedFinding) {}, 0, ""},
+		{"missing version", func(header *intermediaries.ExportHeader, findings []intermediaries.ExportedFinding) {
+			header.Version = 0
+		}, 400, "missing Version"},
+		{"newer version", func(header *intermediaries.ExportHeader, findings []intermediaries.ExportedFinding) { header.Version++ }, 422, "unsupported export Version: 2"},
+		{"invalid status", func(header *intermediaries.ExportHeader, findings []intermediaries.ExportedFinding) {
+			findings[1].Finding.Status = "fixed"
+		}, 400, "finding 2: invalid Status: fixed"},
+		{"missing timestamps", func(header *intermediaries.ExportHeader, findings []intermediaries.ExportedFinding) {
+			findings[1].Finding.CreatedAt = time.Time{}
+		}, 400, "finding 2: missing CreatedAt or UpdatedAt"},
+		{"updated before created", func(header *intermediaries.ExportHeader, findings []intermediaries.ExportedFinding) {
+			findings[0].Finding.UpdatedAt = findings[0].Finding.CreatedAt.Add(-time.Minute)
+		}, 422, "finding 1: UpdatedAt is before CreatedAt"},
+		{"history of another finding", func(header *intermediaries.ExportHeader, findings []intermediaries.ExportedFinding) {
+			findings[0].History[0].FindingIdentifier = "b"
+		}, 422, "finding 1: entry 1 is of another finding"},
+		{"changed history", func(header *intermediaries.ExportHeader, findings []intermediaries.ExportedFinding) {
+			findings[0].History[0].Actor.UserId = 8
+		}, 422, "finding 1: entry 1 does not match its hash"},
+		{"invalid history change", func(header *intermediaries.ExportHeader, findings []intermediaries.ExportedFinding) {
+			findings[0].History[0].Changes[0].After = "resolved"
+		}, 400, "finding 1: invalid change of status"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := intermediaries.ExportHeader{Version: intermediaries.ExportFormatVersion, OrganizationId: 1}
+			findings := []intermediaries.ExportedFinding{exportedFinding(), exportedFinding()}
+			tt.change(&header, findings)
+			err := header.Validate()
+			for index := 0; err == nil && index < len(findings); index++ {
+				err = findings[index].ValidateAt(index + 1)
+			}
+			if tt.code == 0 {
+				if err != nil {
+					t.Fatalf("expected the export to be valid, got %v", err)
+				}
+				return
+			}
+			var apiErr apierror.APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("expected APIError, got %v", err)
+			}
+			if apiErr.Code != tt.code || apiErr.WrappedError.Error() != tt.err {
+				t.Errorf("expected %d %q, got %d %q", tt.code, tt.err, apiErr.Code, apiErr.WrappedError.Error())
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package intermediaries
+
+import "time"
+
+// FindingFilter narrows down which findings are returned when listing findings.
+// A finding must match every criteria that is set, and the zero value matches every finding.
+type FindingFilter struct {
+	// LocatorPatterns matches findings where any of the patterns match the finding, if set
+	LocatorPatterns []LocatorPattern
+	// LocatorTypes matches findings reported with any of the locator types, if set
+	LocatorTypes []ReportLocatorType
+	// Severities matches findings with any of the severities, if set
+	Severities []Severity
+	// UpdatedSince matches findings updated at or after the time, if set
+	UpdatedSince time.Time
+	// Deleted matches deleted findings instead of the other findings, if set
+	Deleted bool
+	// IncludeArchived matches archived findings as well as the active findings, if set
+	IncludeArchived bool
+}
+
+func (filter FindingFilter) Matches(finding Finding) bool {
+	return filter.matchesLocatorPatterns(finding) &&
+		filter.matchesLocatorTypes(finding) &&
+		filter.matchesSeverities(finding) &&
+		(filter.UpdatedSince.IsZero() || !finding.UpdatedAt.Before(filter.UpdatedSince)) &&
+		filter.Deleted == finding.Deleted() &&
+		(filter.IncludeArchived || !finding.Archived())
+}
+
+func (filter FindingFilter) matchesLocatorPatterns(finding Finding) bool {
+	if len(filter.LocatorPatterns) == 0 {
+		return true
+	}
+	for _, pattern := range filter.LocatorPatterns {
+		if pattern.MatchesFinding(finding) {
+			return true
+		}
+	}
+	return false
+}
+
+func (filter FindingFilter) matchesLocatorTypes(finding Finding) bool {
+	if len(filter.LocatorTypes) == 0 {
+		return true
+	}
+	for _, locatorType := range filter.LocatorTypes {
+		if finding.ReportLocator.Type == locatorType {
+			return true
+		}
+	}
+	return false
+}
+
+func (filter FindingFilter) matchesSeverities(finding Finding) bool {
+	if len(filter.Severities) == 0 {
+		return true
+	}
+	for _, severity := range filter.Severities {
+		if finding.Severity == severity {
+			return true
+		}
+	}
+	return false
+}
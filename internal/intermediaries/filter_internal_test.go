@@ -0,0 +1,68 @@
+package intermediaries_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
+)
+
+func TestFindingFilterMatches(t *testing.T) {
+	updatedAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	finding := intermediaries.Finding{
+		ReportLocator: intermediaries.ReportLocator{Type: intermediaries.HTTP, Value: "http://example.com:80/", Distinguisher: "global"},
+		Severity:      intermediaries.SeverityHigh,
+		UpdatedAt:     updatedAt,
+	}
+	pattern, err := intermediaries.ParseLocatorPattern("HTTP:http://*.org/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tests = []struct {
+		name     string
+		filter   intermediaries.FindingFilter
+		expected bool
+	}{
+		{"zero value", intermediaries.FindingFilter{}, true},
+		{"locator type", intermediaries.FindingFilter{LocatorTypes: []intermediaries.ReportLocatorType{intermediaries.TCP, intermediaries.HTTP}}, true},
+		{"other locator type", intermediaries.FindingFilter{LocatorTypes: []intermediaries.ReportLocatorType{intermediaries.TCP}}, false},
+		{"severity", intermediaries.FindingFilter{Severities: []intermediaries.Severity{intermediaries.SeverityHigh, intermediaries.SeverityCritical}}, true},
+		{"other severity", intermediaries.FindingFilter{Severities: []intermediaries.Severity{intermediaries.SeverityLow}}, false},
+		{"updated at since", intermediaries.FindingFilter{UpdatedSince: updatedAt}, true},
+		{"updated before since", intermediaries.FindingFilter{UpdatedSince: updatedAt.Add(time.Second)}, false},
+		{"deleted", intermediaries.FindingFilter{Deleted: true}, false},
+		{"every criteria must match", intermediaries.FindingFilter{LocatorTypes: []intermediaries.ReportLocatorType{intermediaries.HTTP}, LocatorPatterns: []intermediaries.LocatorPattern{pattern}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if actual := tt.filter.Matches(finding); actual != tt.expected {
+				t.Errorf("expected %t, got %t", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestFindingFilterMatchesDeleted(t *testing.T) {
+	deletedAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	finding := intermediaries.Finding{DeletedAt: &deletedAt}
+	if (intermediaries.FindingFilter{}).Matches(finding) {
+		t.Error("expected the zero value not to match a deleted finding")
+	}
+	if !(intermediaries.FindingFilter{Deleted: true}).Matches(finding) {
+		t.Error("expected a deleted finding to match")
+	}
+}
+
+func TestFindingFilterMatchesArchived(t *testing.T) {
+	archivedAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	finding := intermediaries.Finding{Status: intermediaries.StatusResolved, ArchivedAt: &archivedAt}
+	if (intermediaries.FindingFilter{}).Matches(finding) {
+		t.Error("expected the zero value not to match an archived finding")
+	}
+	if !(intermediaries.FindingFilter{IncludeArchived: true}).Matches(finding) {
+		t.Error("expected an archived finding to match")
+	}
+	if !(intermediaries.FindingFilter{IncludeArchived: true}).Matches(intermediaries.Finding{}) {
+		t.Error("expected an active finding to match as well")
+	}
+}
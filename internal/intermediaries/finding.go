@@ -2,9 +2,9 @@ package intermediaries
 
 import (
 	"fmt"
-	"net"
 	"net/http"
-	"net/url"
+	"slices"
+	"time"
 
 	"github.com/Kaese72/riskie-lib/apierror"
 )
@@ -17,6 +17,7 @@ const (
 	HTTP     ReportLocatorType = "HTTP"
 	TCP      ReportLocatorType = "TCP"
 	UDP      ReportLocatorType = "UDP"
+	MAC      ReportLocatorType = "MAC"
 )
 
 const (
@@ -25,12 +26,8 @@ const (
 	GlobalDistinguisher = "global"
 )
 
-func isValidIPv4(ip string) (net.IP, bool) {
-	parsedIP := net.ParseIP(ip)
-	return parsedIP, parsedIP != nil && parsedIP.To4() != nil
-}
-
 // Validate checks if the ReportLocator is valid together with its value.
+// Type specific validation is delegated to the registered LocatorType.
 // Returns an API Error if the validation fails.
 // 400: The provided data is syntactically incorrect
 // 422: The provided data is syntactically correct, but semantically incorrect, like disallowed values
@@ -44,59 +41,11 @@ func (locator ReportLocator) Validate() error {
 	if locator.Distinguisher == "" {
 		return apierror.APIError{Code: http.StatusBadRequest, WrappedError: fmt.Errorf("missing Distinguisher")}
 	}
-	switch locator.Type {
-	case IPv4:
-		// Validate IPv4 address
-		ip, is4 := isValidIPv4(locator.Value)
-		if !is4 {
-			return apierror.APIError{Code: http.StatusBadRequest, WrappedError: fmt.Errorf("invalid IPv4 address: %s", locator.Value)}
-		}
-		if ip.IsPrivate() {
-			// If the IP address is private, it must have a distinguisher.
-			// This is to allow multiple private IPv4 addresses to be distinguished,
-			// and you need to explicitly set separate or merge private addresses.
-			if locator.Distinguisher == "" {
-				return apierror.APIError{Code: http.StatusUnprocessableEntity, WrappedError: fmt.Errorf("private IPv4 address must have a distinguisher")}
-			}
-			if locator.Distinguisher == GlobalDistinguisher {
-				return apierror.APIError{Code: http.StatusUnprocessableEntity, WrappedError: fmt.Errorf("private IPv4 address cannot have a global distinguisher")}
-			}
-		}
-		if ip.IsLoopback() {
-			// We do not allow findings to be reported on loopback addresses
-			return apierror.APIError{Code: http.StatusUnprocessableEntity, WrappedError: fmt.Errorf("loopback IPv4 address not allowed")}
-		}
-	// case IPv6:
-	// 	// Validate IPv6 address
-	// 	// FIXME global check
-	case HTTP:
-		// Validate URL
-		_, err := url.Parse(locator.Value)
-		if err != nil {
-			return apierror.APIError{Code: http.StatusBadRequest, WrappedError: fmt.Errorf("invalid URL: %s", locator.Value)}
-		}
-	case TCP:
-		// Validate TCP address
-		_, err := net.ResolveTCPAddr("tcp", locator.Value)
-		if err != nil {
-			return apierror.APIError{Code: http.StatusBadRequest, WrappedError: fmt.Errorf("invalid TCP address: %s", locator.Value)}
-		}
-	case UDP:
-		// Validate UDP address
-		_, err := net.ResolveUDPAddr("udp", locator.Value)
-		if err != nil {
-			return apierror.APIError{Code: http.StatusBadRequest, WrappedError: fmt.Errorf("invalid IPv4 address: %s", locator.Value)}
-		}
-	case Hostname:
-		// Everything is a valid hostname it seems
-		// FIXME there are some restrictions on hostnames after all...
-		if locator.Value == "localhost" {
-			return apierror.APIError{Code: http.StatusUnprocessableEntity, WrappedError: fmt.Errorf("hostname may not be '%s'", locator.Value)}
-		}
-	default:
+	locatorType, found := LookupLocatorType(locator.Type)
+	if !found {
 		return apierror.APIError{Code: http.StatusBadRequest, WrappedError: fmt.Errorf("invalid ReportLocatorType: %s", locator.Type)}
 	}
-	return nil
+	return locatorType.Validate(locator)
 }
 
 type ReportLocator struct {
@@ -105,44 +54,81 @@ type ReportLocator struct {
 	Distinguisher string
 }
 
+// Canonical returns the locator with its value in the canonical format for its type,
+// so that the same asset reported in different notations ends up on the same finding.
+// Values that can not be parsed are returned untouched and left for Validate to reject.
+func (r ReportLocator) Canonical() ReportLocator {
+	locatorType, found := LookupLocatorType(r.Type)
+	if !found || locatorType.Canonicalize == nil {
+		return r
+	}
+	return locatorType.Canonicalize(r)
+}
+
+// Implied returns the locator itself followed by every locator it implies, recursively
 func (r ReportLocator) Implied() ([]ReportLocator, error) {
 	if err := r.Validate(); err != nil {
 		return nil, err
 	}
 	ret := []ReportLocator{r}
-	switch r.Type {
-	case HTTP:
-		u, err := url.Parse(r.Value)
-		if err != nil {
-			// This should never happen, since we already validated the URL
-			panic(err)
-		}
-		locator := ReportLocator{Type: TCP, Value: u.Host, Distinguisher: r.Distinguisher}
-		if u.Port() == "" {
-			if u.Scheme == "http" {
-				locator.Value += ":80"
-			} else if u.Scheme == "https" {
-				locator.Value += ":443"
-			}
-		}
+	locatorType, _ := LookupLocatorType(r.Type)
+	if locatorType.Implied == nil {
+		return ret, nil
+	}
+	directlyImplied, err := locatorType.Implied(r)
+	if err != nil {
+		return nil, err
+	}
+	for _, locator := range directlyImplied {
 		downstreamLocators, err := locator.Implied()
-		return append(ret, downstreamLocators...), err
-	case TCP, UDP:
-		// Check if the TCP/UDP address implies an IP Address
-		host, _, err := net.SplitHostPort(r.Value)
 		if err != nil {
 			return nil, err
 		}
-		locator := ReportLocator{Type: Hostname, Value: host, Distinguisher: r.Distinguisher}
-		if _, is4 := isValidIPv4(host); is4 {
-			locator.Type = IPv4
-		}
-		downstreamLocators, err := locator.Implied()
-		return append(ret, downstreamLocators...), err
+		ret = append(ret, downstreamLocators...)
 	}
 	return ret, nil
 }
 
+type FindingStatus string
+
+const (
+	StatusOpen          FindingStatus = "open"
+	StatusResolved      FindingStatus = "resolved"
+	StatusAccepted      FindingStatus = "accepted"
+	StatusFalsePositive FindingStatus = "falsePositive"
+)
+
+func (status FindingStatus) Validate() error {
+	switch status {
+	case StatusOpen, StatusResolved, StatusAccepted, StatusFalsePositive:
+		return nil
+	case "":
+		return apierror.APIError{Code: http.StatusBadRequest, WrappedError: fmt.Errorf("missing Status")}
+	default:
+		return apierror.APIError{Code: http.StatusBadRequest, WrappedError: fmt.Errorf("invalid Status: %s", status)}
+	}
+}
+
+// Severity is how severe the reporter considers a finding. It is optional, and empty when not reported.
+type Severity string
+
+const (
+	SeverityInfo     Severity = "info"
+	SeverityLow      Severity = "low"
+	SeverityMedium   Severity = "medium"
+	SeverityHigh     Severity = "high"
+	SeverityCritical Severity = "critical"
+)
+
+func (severity Severity) Validate() error {
+	switch severity {
+	case "", SeverityInfo, SeverityLow, SeverityMedium, SeverityHigh, SeverityCritical:
+		return nil
+	default:
+		return apierror.APIError{Code: http.StatusBadRequest, WrappedError: fmt.Errorf("invalid Severity: %s", severity)}
+	}
+}
+
 type ReportDistinguisher struct {
 	Type  string
 	Value string
@@ -155,4 +141,60 @@ type Finding struct {
 	ReportDistinguisher   ReportDistinguisher
 	ReportLocator         ReportLocator
 	ImpliedReportLocators []ReportLocator
+	Owner                 Owner
+	Severity              Severity
+	Status                FindingStatus
+	CreatedAt             time.Time
+	UpdatedAt             time.Time
+	// Version starts at 1 and is incremented every time the finding is stored, so that concurrent changes can be detected
+	Version int
+	// DeletedAt is set when the finding has been deleted, and the finding is only kept as a tombstone until it is purged
+	DeletedAt *time.Time
+	// DeletedBy is the user that deleted the finding
+	DeletedBy int
+	// ArchivedAt is set when the finding has been moved to the archive, where it is kept apart from the active findings
+	ArchivedAt *time.Time
+}
+
+// Deleted checks if the finding is a tombstone of a deleted finding
+func (finding Finding) Deleted() bool {
+	return finding.DeletedAt != nil
+}
+
+// Archived checks if the finding has been moved to the archive
+func (finding Finding) Archived() bool {
+	return finding.ArchivedAt != nil
+}
+
+// VersionPrecondition is what a change expects of the finding it changes, like an If-Match header does.
+// The zero value expects nothing, and changes the finding at whatever version it is.
+type VersionPrecondition struct {
+	// Exists expects the finding to exist, at any version
+	Exists bool
+	// Versions expects the finding to be at any of the versions, if set
+	Versions []int
+}
+
+// ExpectVersion expects the finding to be at the version
+func ExpectVersion(version int) VersionPrecondition {
+	return VersionPrecondition{Versions: []int{version}}
+}
+
+// Expects checks if the precondition expects the finding to exist
+func (precondition VersionPrecondition) Expects() bool {
+	return precondition.Exists || len(precondition.Versions) > 0
+}
+
+// Matches checks if an existing finding at the version passes the precondition
+func (precondition VersionPrecondition) Matches(version int) bool {
+	return len(precondition.Versions) == 0 || slices.Contains(precondition.Versions, version)
+}
+
+// ExpectedVersion is the version a finding read at the version must still be at when it is changed,
+// or 0 when the precondition does not expect any version in particular
+func (precondition VersionPrecondition) ExpectedVersion(version int) int {
+	if len(precondition.Versions) == 0 {
+		return 0
+	}
+	return version
 }
@@ -49,6 +49,23 @@ func TestReportLocatorValidateError(t *testing.T) {
 			intermediaries.ReportLocator{Type: intermediaries.Hostname, Value: "localhost", Distinguisher: "global"},
 			apierror.APIError{Code: 400, WrappedError: fmt.Errorf("hostname may not be 'localhost'")},
 		},
+		// MAC validation
+		{
+			intermediaries.ReportLocator{Type: intermediaries.MAC, Value: "00:50:56:ab:cd", Distinguisher: "apartment"},
+			apierror.APIError{Code: 400, WrappedError: fmt.Errorf("invalid MAC address: 00:50:56:ab:cd")},
+		},
+		{
+			intermediaries.ReportLocator{Type: intermediaries.MAC, Value: "00:50:56:ab:cd:ef", Distinguisher: "global"},
+			apierror.APIError{Code: 422, WrappedError: fmt.Errorf("MAC address cannot have a global distinguisher")},
+		},
+		{
+			intermediaries.ReportLocator{Type: intermediaries.MAC, Value: "ff:ff:ff:ff:ff:ff", Distinguisher: "apartment"},
+			apierror.APIError{Code: 422, WrappedError: fmt.Errorf("multicast MAC address not allowed")},
+		},
+		{
+			intermediaries.ReportLocator{Type: intermediaries.MAC, Value: "00:00:00:00:00:00", Distinguisher: "apartment"},
+			apierror.APIError{Code: 422, WrappedError: fmt.Errorf("all-zero MAC address not allowed")},
+		},
 	}
 	for _, testInput := range tests {
 		t.Run(testInput.locator.Value, func(t *testing.T) {
@@ -78,6 +95,8 @@ func TestReportLocatorValidatePositive(t *testing.T) {
 	var tests = []intermediaries.ReportLocator{
 		{Type: intermediaries.IPv4, Value: "84.84.84.84", Distinguisher: "global"},
 		{Type: intermediaries.HTTP, Value: "https://example.com", Distinguisher: "global"},
+		{Type: intermediaries.MAC, Value: "00:50:56:ab:cd:ef", Distinguisher: "apartment"},
+		{Type: intermediaries.MAC, Value: "02:00:5e:10:00:00:00:01", Distinguisher: "apartment"},
 	}
 	for _, testInput := range tests {
 		t.Run(testInput.Value, func(t *testing.T) {
@@ -88,3 +107,102 @@ func TestReportLocatorValidatePositive(t *testing.T) {
 		})
 	}
 }
+
+func TestReportLocatorCanonical(t *testing.T) {
+	var tests = []struct {
+		locator  intermediaries.ReportLocator
+		expected string
+	}{
+		{intermediaries.ReportLocator{Type: intermediaries.MAC, Value: "00-50-56-AB-CD-EF", Distinguisher: "apartment"}, "00:50:56:ab:cd:ef"},
+		{intermediaries.ReportLocator{Type: intermediaries.MAC, Value: "0050.56ab.cdef", Distinguisher: "apartment"}, "00:50:56:ab:cd:ef"},
+		{intermediaries.ReportLocator{Type: intermediaries.MAC, Value: "02-00-5E-10-00-00-00-01", Distinguisher: "apartment"}, "02:00:5e:10:00:00:00:01"},
+		{intermediaries.ReportLocator{Type: intermediaries.MAC, Value: "not a mac", Distinguisher: "apartment"}, "not a mac"},
+	}
+	for _, testInput := range tests {
+		t.Run(testInput.locator.Value, func(t *testing.T) {
+			canonical := testInput.locator.Canonical()
+			if canonical.Value != testInput.expected {
+				t.Fatalf("expected %s, got %s", testInput.expected, canonical.Value)
+			}
+		})
+	}
+}
+
+func TestMACVendor(t *testing.T) {
+	var tests = []struct {
+		mac    string
+		vendor string
+		found  bool
+	}{
+		{"00:50:56:ab:cd:ef", "VMware, Inc.", true},
+		{"B8-27-EB-00-11-22", "Raspberry Pi Foundation", true},
+		// Locally administered
+		{"02:50:56:ab:cd:ef", "", false},
+		{"not a mac", "", false},
+	}
+	for _, testInput := range tests {
+		t.Run(testInput.mac, func(t *testing.T) {
+			vendor, found := intermediaries.MACVendor(testInput.mac)
+			if found != testInput.found || vendor != testInput.vendor {
+				t.Fatalf("expected (%s, %t), got (%s, %t)", testInput.vendor, testInput.found, vendor, found)
+			}
+		})
+	}
+}
+
+func TestReportLocatorImplied(t *testing.T) {
+	var tests = []struct {
+		locator  intermediaries.ReportLocator
+		expected []intermediaries.ReportLocator
+	}{
+		{
+			intermediaries.ReportLocator{Type: intermediaries.HTTP, Value: "https://192.168.101.3/api", Distinguisher: "apartment"},
+			[]intermediaries.ReportLocator{
+				{Type: intermediaries.HTTP, Value: "https://192.168.101.3/api", Distinguisher: "apartment"},
+				{Type: intermediaries.TCP, Value: "192.168.101.3:443", Distinguisher: "apartment"},
+				{Type: intermediaries.IPv4, Value: "192.168.101.3", Distinguisher: "apartment"},
+			},
+		},
+		{
+			intermediaries.ReportLocator{Type: intermediaries.UDP, Value: "84.84.84.84:53", Distinguisher: "global"},
+			[]intermediaries.ReportLocator{
+				{Type: intermediaries.UDP, Value: "84.84.84.84:53", Distinguisher: "global"},
+				{Type: intermediaries.IPv4, Value: "84.84.84.84", Distinguisher: "global"},
+			},
+		},
+		{
+			intermediaries.ReportLocator{Type: intermediaries.MAC, Value: "00:50:56:ab:cd:ef", Distinguisher: "apartment"},
+			[]intermediaries.ReportLocator{
+				{Type: intermediaries.MAC, Value: "00:50:56:ab:cd:ef", Distinguisher: "apartment"},
+			},
+		},
+	}
+	for _, testInput := range tests {
+		t.Run(testInput.locator.Value, func(t *testing.T) {
+			implied, err := testInput.locator.Implied()
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if len(implied) != len(testInput.expected) {
+				t.Fatalf("expected %v, got %v", testInput.expected, implied)
+			}
+			for index := range implied {
+				if implied[index] != testInput.expected[index] {
+					t.Fatalf("expected %v, got %v", testInput.expected, implied)
+				}
+			}
+		})
+	}
+}
+
+func TestReportLocatorImpliedInvalid(t *testing.T) {
+	// The TCP address is valid on the global distinguisher, but the private IPv4 address it implies is not
+	locator := intermediaries.ReportLocator{Type: intermediaries.HTTP, Value: "http://10.0.0.1/", Distinguisher: intermediaries.GlobalDistinguisher}
+	implied, err := locator.Implied()
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if implied != nil {
+		t.Errorf("expected no locators along with the error, got %v", implied)
+	}
+}
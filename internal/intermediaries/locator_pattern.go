@@ -0,0 +1,345 @@
+package intermediaries
+
+import (
+	"container/list"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Kaese72/riskie-lib/apierror"
+)
+
+// AnyDistinguisher matches locators regardless of distinguisher when used in a LocatorPattern
+const AnyDistinguisher = "*"
+
+// LocatorPattern matches report locators of a single type.
+// How Value is interpreted depends on the type, see the PatternFormat of the registered LocatorType.
+// An empty Distinguisher, or AnyDistinguisher, matches every distinguisher.
+type LocatorPattern struct {
+	Type          ReportLocatorType
+	Value         string
+	Distinguisher string
+}
+
+// ParseLocatorPattern parses the compact "<type>:<value>[@<distinguisher>]" notation,
+// eg. "HTTP:https://*.shop.example.com/", "IPv4:10.20.0.0/16@dc1" or "TCP:*:22".
+// The distinguisher is only separated by an "@" after the last "/", so that "@" can be part of URLs like
+// "HTTP:https://user@example.com/". A value ending in "@" and something else is written with "@*" last.
+func ParseLocatorPattern(pattern string) (LocatorPattern, error) {
+	locatorType, value, found := strings.Cut(pattern, ":")
+	if !found {
+		return LocatorPattern{}, apierror.APIError{Code: http.StatusBadRequest, WrappedError: fmt.Errorf("locator pattern must be on the form <type>:<value>[@<distinguisher>]: %s", pattern)}
+	}
+	parsed := LocatorPattern{Type: ReportLocatorType(locatorType), Value: value}
+	if index := strings.LastIndex(value, "@"); index >= 0 && index > strings.LastIndex(value, "/") {
+		parsed.Value = value[:index]
+		parsed.Distinguisher = value[index+1:]
+	}
+	return parsed, parsed.Validate()
+}
+
+func (pattern LocatorPattern) String() string {
+	if pattern.Distinguisher == "" || pattern.Distinguisher == AnyDistinguisher {
+		return fmt.Sprintf("%s:%s", pattern.Type, pattern.Value)
+	}
+	return fmt.Sprintf("%s:%s@%s", pattern.Type, pattern.Value, pattern.Distinguisher)
+}
+
+// Validate checks that the pattern is well formed for its locator type.
+// Returns a 400 API Error if it is not.
+func (pattern LocatorPattern) Validate() error {
+	if pattern.Type == "" {
+		return apierror.APIError{Code: http.StatusBadRequest, WrappedError: fmt.Errorf("missing pattern Type")}
+	}
+	if pattern.Value == "" {
+		return apierror.APIError{Code: http.StatusBadRequest, WrappedError: fmt.Errorf("missing pattern Value")}
+	}
+	locatorType, found := LookupLocatorType(pattern.Type)
+	if !found {
+		return apierror.APIError{Code: http.StatusBadRequest, WrappedError: fmt.Errorf("invalid ReportLocatorType: %s", pattern.Type)}
+	}
+	if locatorType.ValidatePattern == nil {
+		return nil
+	}
+	if err := locatorType.ValidatePattern(pattern.Value); err != nil {
+		return apierror.APIError{Code: http.StatusBadRequest, WrappedError: fmt.Errorf("invalid %s pattern %s: %s", pattern.Type, pattern.Value, err.Error())}
+	}
+	return nil
+}
+
+// Matches checks if the locator matches the pattern. Only the locator itself is considered,
+// use MatchesFinding to also consider the locators it implies.
+func (pattern LocatorPattern) Matches(locator ReportLocator) bool {
+	if pattern.Type != locator.Type {
+		return false
+	}
+	if pattern.Distinguisher != "" && pattern.Distinguisher != AnyDistinguisher && pattern.Distinguisher != locator.Distinguisher {
+		return false
+	}
+	locatorType, found := LookupLocatorType(pattern.Type)
+	if !found {
+		return false
+	}
+	if locatorType.MatchPattern == nil {
+		return globMatch(pattern.Value, locator.Value, globOptions{})
+	}
+	return locatorType.MatchPattern(pattern.Value, locator)
+}
+
+// MatchesFinding checks if the report locator of the finding, or any of its implied locators, match the pattern
+func (pattern LocatorPattern) MatchesFinding(finding Finding) bool {
+	if pattern.Matches(finding.ReportLocator) {
+		return true
+	}
+	for _, implied := range finding.ImpliedReportLocators {
+		if pattern.Matches(implied) {
+			return true
+		}
+	}
+	return false
+}
+
+// globOptions controls how glob patterns are translated into regular expressions
+type globOptions struct {
+	// separator may not be matched by wildcards when set
+	separator byte
+	// caseInsensitive ignores case when matching
+	caseInsensitive bool
+	// subtree lets a pattern ending in the separator match everything below it
+	subtree bool
+}
+
+// globCacheSize bounds how many compiled globs are kept, since the patterns are given by clients
+const globCacheSize = 256
+
+// regexpCache keeps the most recently used compiled expressions, up to a size
+type regexpCache struct {
+	mutex   sync.Mutex
+	size    int
+	entries map[string]*list.Element
+	recent  *list.List
+}
+
+// regexpCacheEntry is an expression in a regexpCache, and the key it is kept by
+type regexpCacheEntry struct {
+	key        string
+	expression *regexp.Regexp
+}
+
+func newRegexpCache(size int) *regexpCache {
+	return &regexpCache{size: size, entries: map[string]*list.Element{}, recent: list.New()}
+}
+
+func (cache *regexpCache) load(key string) (*regexp.Regexp, bool) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	element, found := cache.entries[key]
+	if !found {
+		return nil, false
+	}
+	cache.recent.MoveToFront(element)
+	return element.Value.(regexpCacheEntry).expression, true
+}
+
+// store keeps the expression, and forgets the least recently used expression when the cache is full
+func (cache *regexpCache) store(key string, expression *regexp.Regexp) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if element, found := cache.entries[key]; found {
+		cache.recent.MoveToFront(element)
+		return
+	}
+	cache.entries[key] = cache.recent.PushFront(regexpCacheEntry{key: key, expression: expression})
+	if cache.recent.Len() > cache.size {
+		oldest := cache.recent.Back()
+		cache.recent.Remove(oldest)
+		delete(cache.entries, oldest.Value.(regexpCacheEntry).key)
+	}
+}
+
+var globCache = newRegexpCache(globCacheSize)
+
+// globRegexp translates a glob, where "*" matches any number of characters and "?" a single character,
+// into an anchored regular expression. Compiled expressions are cached since the same patterns
+// are typically matched against many locators.
+func globRegexp(pattern string, options globOptions) *regexp.Regexp {
+	cacheKey := fmt.Sprintf("%v|%s", options, pattern)
+	if cached, found := globCache.load(cacheKey); found {
+		return cached
+	}
+	anyCharacter := "."
+	if options.separator != 0 {
+		anyCharacter = "[^" + regexp.QuoteMeta(string(options.separator)) + "]"
+	}
+	expression := strings.Builder{}
+	if options.caseInsensitive {
+		expression.WriteString("(?i)")
+	}
+	expression.WriteString("^")
+	body := pattern
+	subtree := options.subtree && options.separator != 0 && strings.HasSuffix(pattern, string(options.separator))
+	if subtree {
+		body = strings.TrimSuffix(pattern, string(options.separator))
+	}
+	for _, character := range body {
+		switch character {
+		case '*':
+			expression.WriteString(anyCharacter + "*")
+		case '?':
+			expression.WriteString(anyCharacter)
+		default:
+			expression.WriteString(regexp.QuoteMeta(string(character)))
+		}
+	}
+	if subtree {
+		expression.WriteString("(" + regexp.QuoteMeta(string(options.separator)) + ".*)?")
+	}
+	expression.WriteString("$")
+	compiled := regexp.MustCompile(expression.String())
+	globCache.store(cacheKey, compiled)
+	return compiled
+}
+
+func globMatch(pattern string, value string, options globOptions) bool {
+	return globRegexp(pattern, options).MatchString(value)
+}
+
+// ipPattern is either "*", a single IPv4 address or a CIDR range
+type ipPattern struct {
+	any     bool
+	network *net.IPNet
+}
+
+func parseIPPattern(pattern string) (ipPattern, error) {
+	if pattern == "*" {
+		return ipPattern{any: true}, nil
+	}
+	if !strings.Contains(pattern, "/") {
+		ip, is4 := isValidIPv4(pattern)
+		if !is4 {
+			return ipPattern{}, fmt.Errorf("not an IPv4 address or CIDR range")
+		}
+		return ipPattern{network: &net.IPNet{IP: ip.To4(), Mask: net.CIDRMask(32, 32)}}, nil
+	}
+	ip, network, err := net.ParseCIDR(pattern)
+	if err != nil || ip.To4() == nil {
+		return ipPattern{}, fmt.Errorf("not an IPv4 address or CIDR range")
+	}
+	return ipPattern{network: network}, nil
+}
+
+func (pattern ipPattern) contains(value string) bool {
+	if pattern.any {
+		return true
+	}
+	ip, is4 := isValidIPv4(value)
+	return is4 && pattern.network.Contains(ip)
+}
+
+// portPattern is either "*", a single port or an inclusive "<low>-<high>" range
+type portPattern struct {
+	low  int
+	high int
+}
+
+func parsePortPattern(pattern string) (portPattern, error) {
+	if pattern == "*" {
+		return portPattern{low: 0, high: 65535}, nil
+	}
+	lowString, highString, isRange := strings.Cut(pattern, "-")
+	if !isRange {
+		highString = lowString
+	}
+	low, err := strconv.Atoi(lowString)
+	if err != nil {
+		return portPattern{}, fmt.Errorf("invalid port: %s", lowString)
+	}
+	high, err := strconv.Atoi(highString)
+	if err != nil {
+		return portPattern{}, fmt.Errorf("invalid port: %s", highString)
+	}
+	if low < 0 || high > 65535 || low > high {
+		return portPattern{}, fmt.Errorf("invalid port range: %s", pattern)
+	}
+	return portPattern{low: low, high: high}, nil
+}
+
+func (pattern portPattern) contains(value string) bool {
+	port, err := strconv.Atoi(value)
+	return err == nil && port >= pattern.low && port <= pattern.high
+}
+
+// splitHostPortPattern splits "<host>:<port>" patterns on the last colon,
+// allowing the host part to be a bracketed IPv6 address or contain wildcards
+func splitHostPortPattern(pattern string) (string, string, error) {
+	index := strings.LastIndex(pattern, ":")
+	if index < 0 {
+		return "", "", fmt.Errorf("must be on the form <host>:<port>")
+	}
+	return strings.Trim(pattern[:index], "[]"), pattern[index+1:], nil
+}
+
+func validateHostPortPattern(pattern string) error {
+	host, port, err := splitHostPortPattern(pattern)
+	if err != nil {
+		return err
+	}
+	if host == "" {
+		return fmt.Errorf("missing host")
+	}
+	if _, err := parsePortPattern(port); err != nil {
+		return err
+	}
+	if strings.Contains(host, "/") {
+		_, err := parseIPPattern(host)
+		return err
+	}
+	return nil
+}
+
+// matchHostPortPattern matches TCP/UDP locators. The host part of the pattern is
+// matched as an IPv4 pattern when it is an address or range, and as a hostname glob otherwise.
+func matchHostPortPattern(pattern string, locator ReportLocator) bool {
+	patternHost, patternPort, err := splitHostPortPattern(pattern)
+	if err != nil {
+		return false
+	}
+	ports, err := parsePortPattern(patternPort)
+	if err != nil {
+		return false
+	}
+	host, port, err := net.SplitHostPort(locator.Value)
+	if err != nil || !ports.contains(port) {
+		return false
+	}
+	if hosts, err := parseIPPattern(patternHost); err == nil {
+		return hosts.contains(host)
+	}
+	return globMatch(patternHost, host, globOptions{caseInsensitive: true})
+}
+
+func validateIPv4Pattern(pattern string) error {
+	_, err := parseIPPattern(pattern)
+	return err
+}
+
+func matchIPv4Pattern(pattern string, locator ReportLocator) bool {
+	addresses, err := parseIPPattern(pattern)
+	return err == nil && addresses.contains(locator.Value)
+}
+
+func matchHostnamePattern(pattern string, locator ReportLocator) bool {
+	return globMatch(pattern, locator.Value, globOptions{caseInsensitive: true})
+}
+
+func matchHTTPPattern(pattern string, locator ReportLocator) bool {
+	return globMatch(pattern, locator.Value, globOptions{separator: '/', subtree: true})
+}
+
+func matchMACPattern(pattern string, locator ReportLocator) bool {
+	return globMatch(pattern, locator.Value, globOptions{caseInsensitive: true})
+}
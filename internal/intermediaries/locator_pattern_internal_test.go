@@ -0,0 +1,117 @@
+package intermediaries_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
+)
+
+func TestLocatorPatternMatches(t *testing.T) {
+	var tests = []struct {
+		pattern string
+		locator intermediaries.ReportLocator
+		matches bool
+	}{
+		// HTTP
+		{"HTTP:https://*.shop.example.com/", intermediaries.ReportLocator{Type: intermediaries.HTTP, Value: "https://eu.shop.example.com/cart", Distinguisher: "global"}, true},
+		{"HTTP:https://*.shop.example.com/", intermediaries.ReportLocator{Type: intermediaries.HTTP, Value: "https://eu.shop.example.com", Distinguisher: "global"}, true},
+		{"HTTP:https://*.shop.example.com/", intermediaries.ReportLocator{Type: intermediaries.HTTP, Value: "https://shop.example.com/cart", Distinguisher: "global"}, false},
+		{"HTTP:https://*.shop.example.com/", intermediaries.ReportLocator{Type: intermediaries.HTTP, Value: "https://evil.com/.shop.example.com/", Distinguisher: "global"}, false},
+		{"HTTP:https://example.com/api", intermediaries.ReportLocator{Type: intermediaries.HTTP, Value: "https://example.com/api/v1", Distinguisher: "global"}, false},
+		// IPv4
+		{"IPv4:10.20.0.0/16@dc1", intermediaries.ReportLocator{Type: intermediaries.IPv4, Value: "10.20.3.4", Distinguisher: "dc1"}, true},
+		{"IPv4:10.20.0.0/16@dc1", intermediaries.ReportLocator{Type: intermediaries.IPv4, Value: "10.20.3.4", Distinguisher: "dc2"}, false},
+		{"IPv4:10.20.0.0/16@dc1", intermediaries.ReportLocator{Type: intermediaries.IPv4, Value: "10.21.3.4", Distinguisher: "dc1"}, false},
+		{"IPv4:84.84.84.84", intermediaries.ReportLocator{Type: intermediaries.IPv4, Value: "84.84.84.84", Distinguisher: "global"}, true},
+		// TCP
+		{"TCP:*:22", intermediaries.ReportLocator{Type: intermediaries.TCP, Value: "10.0.0.1:22", Distinguisher: "dc1"}, true},
+		{"TCP:*:22", intermediaries.ReportLocator{Type: intermediaries.TCP, Value: "example.com:22", Distinguisher: "global"}, true},
+		{"TCP:*:22", intermediaries.ReportLocator{Type: intermediaries.TCP, Value: "example.com:2222", Distinguisher: "global"}, false},
+		{"TCP:*:22", intermediaries.ReportLocator{Type: intermediaries.UDP, Value: "example.com:22", Distinguisher: "global"}, false},
+		{"TCP:10.0.0.0/8:8000-8999", intermediaries.ReportLocator{Type: intermediaries.TCP, Value: "10.1.1.1:8443", Distinguisher: "dc1"}, true},
+		{"TCP:*.example.com:443", intermediaries.ReportLocator{Type: intermediaries.TCP, Value: "WWW.example.com:443", Distinguisher: "global"}, true},
+		// Hostname
+		{"Hostname:*.example.com", intermediaries.ReportLocator{Type: intermediaries.Hostname, Value: "a.b.example.com", Distinguisher: "global"}, true},
+		{"Hostname:*.example.com", intermediaries.ReportLocator{Type: intermediaries.Hostname, Value: "example.com", Distinguisher: "global"}, false},
+		// MAC
+		{"MAC:00:50:56:*@apartment", intermediaries.ReportLocator{Type: intermediaries.MAC, Value: "00:50:56:ab:cd:ef", Distinguisher: "apartment"}, true},
+	}
+	for _, testInput := range tests {
+		t.Run(testInput.pattern+" "+testInput.locator.Value, func(t *testing.T) {
+			pattern, err := intermediaries.ParseLocatorPattern(testInput.pattern)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if pattern.Matches(testInput.locator) != testInput.matches {
+				t.Fatalf("expected match to be %t", testInput.matches)
+			}
+		})
+	}
+}
+
+func TestLocatorPatternMatchesFinding(t *testing.T) {
+	locator := intermediaries.ReportLocator{Type: intermediaries.HTTP, Value: "https://10.20.1.1/admin", Distinguisher: "dc1"}
+	implied, err := locator.Implied()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	finding := intermediaries.Finding{ReportLocator: locator, ImpliedReportLocators: implied}
+	for _, rawPattern := range []string{"IPv4:10.20.0.0/16@dc1", "TCP:*:443", "HTTP:https://10.20.1.1/"} {
+		pattern, err := intermediaries.ParseLocatorPattern(rawPattern)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !pattern.MatchesFinding(finding) {
+			t.Fatalf("expected %s to match finding", rawPattern)
+		}
+	}
+}
+
+func TestParseLocatorPattern(t *testing.T) {
+	var tests = []struct {
+		pattern  string
+		expected intermediaries.LocatorPattern
+	}{
+		{"IPv4:10.20.0.0/16@dc1", intermediaries.LocatorPattern{Type: intermediaries.IPv4, Value: "10.20.0.0/16", Distinguisher: "dc1"}},
+		{"TCP:*:22", intermediaries.LocatorPattern{Type: intermediaries.TCP, Value: "*:22"}},
+		{"HTTP:https://user@example.com/", intermediaries.LocatorPattern{Type: intermediaries.HTTP, Value: "https://user@example.com/"}},
+		{"HTTP:https://example.com/@team/*", intermediaries.LocatorPattern{Type: intermediaries.HTTP, Value: "https://example.com/@team/*"}},
+		{"HTTP:https://example.com/*@dc1", intermediaries.LocatorPattern{Type: intermediaries.HTTP, Value: "https://example.com/*", Distinguisher: "dc1"}},
+		{"HTTP:https://example.com/a@b@*", intermediaries.LocatorPattern{Type: intermediaries.HTTP, Value: "https://example.com/a@b", Distinguisher: "*"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			pattern, err := intermediaries.ParseLocatorPattern(tt.pattern)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if pattern != tt.expected {
+				t.Errorf("expected %+v, got %+v", tt.expected, pattern)
+			}
+		})
+	}
+}
+
+func TestLocatorPatternMatchesManyPatterns(t *testing.T) {
+	// More patterns than are cached are still matched, as the least recently used are compiled again
+	locator := intermediaries.ReportLocator{Type: intermediaries.Hostname, Value: "host-7.example.com", Distinguisher: "global"}
+	for round := 0; round < 2; round++ {
+		for index := 0; index < 1000; index++ {
+			pattern := intermediaries.LocatorPattern{Type: intermediaries.Hostname, Value: fmt.Sprintf("host-%d.*", index)}
+			if expected := index == 7; pattern.Matches(locator) != expected {
+				t.Fatalf("expected %s to match %t", pattern, expected)
+			}
+		}
+	}
+}
+
+func TestParseLocatorPatternError(t *testing.T) {
+	for _, rawPattern := range []string{"IPv4", "IPv4:10.20.0.0/33", "TCP:*:70000", "TCP:*:22-21", "TCP:example.com", "Unknown:*", "IPv4:"} {
+		t.Run(rawPattern, func(t *testing.T) {
+			if _, err := intermediaries.ParseLocatorPattern(rawPattern); err == nil {
+				t.Fatalf("expected error, got nil")
+			}
+		})
+	}
+}
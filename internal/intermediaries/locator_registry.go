@@ -0,0 +1,76 @@
+package intermediaries
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// LocatorType describes how report locators of a single ReportLocatorType
+// are validated, canonicalized and what other locators they imply.
+type LocatorType struct {
+	Type ReportLocatorType
+	// Format is a human readable description of the accepted value format
+	Format string
+	// Example is a valid value of the locator type
+	Example string
+	// Validate checks the type specific constraints of the locator.
+	// Type, Value and Distinguisher are guaranteed to be set when it is called.
+	Validate func(ReportLocator) error
+	// Canonicalize returns the locator with its value in the canonical format.
+	// Optional, values are used as reported when not set.
+	Canonicalize func(ReportLocator) ReportLocator
+	// Implied returns the locators that are directly implied by a valid locator,
+	// not including the locator itself. Optional, nothing is implied when not set.
+	Implied func(ReportLocator) ([]ReportLocator, error)
+	// PatternFormat is a human readable description of the LocatorPattern values accepted for the type
+	PatternFormat string
+	// ValidatePattern checks that a LocatorPattern value is well formed.
+	// Optional, every pattern is accepted when not set.
+	ValidatePattern func(string) error
+	// MatchPattern checks if a locator of the type matches a LocatorPattern value.
+	// Optional, the pattern is matched as a glob against the locator value when not set.
+	MatchPattern func(string, ReportLocator) bool
+}
+
+var (
+	locatorTypesMutex sync.RWMutex
+	locatorTypes      = map[ReportLocatorType]LocatorType{}
+)
+
+// RegisterLocatorType makes a locator type available for reporting findings on.
+// Registering the same type twice, or a type without a Validate function, panics.
+func RegisterLocatorType(locatorType LocatorType) {
+	locatorTypesMutex.Lock()
+	defer locatorTypesMutex.Unlock()
+	if locatorType.Type == "" {
+		panic("locator type must have a name")
+	}
+	if locatorType.Validate == nil {
+		panic(fmt.Sprintf("locator type %s must have a Validate function", locatorType.Type))
+	}
+	if _, exists := locatorTypes[locatorType.Type]; exists {
+		panic(fmt.Sprintf("locator type %s registered twice", locatorType.Type))
+	}
+	locatorTypes[locatorType.Type] = locatorType
+}
+
+// LookupLocatorType returns the registered locator type, if any
+func LookupLocatorType(locatorType ReportLocatorType) (LocatorType, bool) {
+	locatorTypesMutex.RLock()
+	defer locatorTypesMutex.RUnlock()
+	registered, found := locatorTypes[locatorType]
+	return registered, found
+}
+
+// LocatorTypes returns all registered locator types ordered by name
+func LocatorTypes() []LocatorType {
+	locatorTypesMutex.RLock()
+	defer locatorTypesMutex.RUnlock()
+	result := make([]LocatorType, 0, len(locatorTypes))
+	for _, locatorType := range locatorTypes {
+		result = append(result, locatorType)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Type < result[j].Type })
+	return result
+}
@@ -0,0 +1,203 @@
+package intermediaries
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+
+	"github.com/Kaese72/riskie-lib/apierror"
+)
+
+func init() {
+	RegisterLocatorType(LocatorType{
+		Type:            IPv4,
+		Format:          "Dotted decimal IPv4 address. Private addresses require a distinguisher other than global",
+		Example:         "84.84.84.84",
+		Validate:        validateIPv4,
+		PatternFormat:   "IPv4 address, CIDR range or *",
+		ValidatePattern: validateIPv4Pattern,
+		MatchPattern:    matchIPv4Pattern,
+	})
+	RegisterLocatorType(LocatorType{
+		Type:          Hostname,
+		Format:        "DNS hostname",
+		Example:       "example.com",
+		Validate:      validateHostname,
+		PatternFormat: "Case insensitive glob where * matches any number of characters and ? a single character",
+		MatchPattern:  matchHostnamePattern,
+	})
+	RegisterLocatorType(LocatorType{
+		Type:          HTTP,
+		Format:        "URL, implies the TCP address it is served on",
+		Example:       "https://example.com/api",
+		Validate:      validateHTTP,
+		Implied:       impliedHTTP,
+		PatternFormat: "URL glob where * and ? do not match /. A pattern ending in / also matches everything below it",
+		MatchPattern:  matchHTTPPattern,
+	})
+	RegisterLocatorType(LocatorType{
+		Type:            TCP,
+		Format:          "host:port, implies the IPv4 address or hostname of the host",
+		Example:         "example.com:443",
+		Validate:        validateTCP,
+		Implied:         impliedHostPort,
+		PatternFormat:   "host:ports where host is an IPv4 pattern or hostname glob, and ports a port, an inclusive low-high range or *",
+		ValidatePattern: validateHostPortPattern,
+		MatchPattern:    matchHostPortPattern,
+	})
+	RegisterLocatorType(LocatorType{
+		Type:            UDP,
+		Format:          "host:port, implies the IPv4 address or hostname of the host",
+		Example:         "84.84.84.84:53",
+		Validate:        validateUDP,
+		Implied:         impliedHostPort,
+		PatternFormat:   "host:ports where host is an IPv4 pattern or hostname glob, and ports a port, an inclusive low-high range or *",
+		ValidatePattern: validateHostPortPattern,
+		MatchPattern:    matchHostPortPattern,
+	})
+	RegisterLocatorType(LocatorType{
+		Type:          MAC,
+		Format:        "EUI-48 or EUI-64 address in colon, hyphen or dot notation. Requires a distinguisher other than global",
+		Example:       "00:50:56:ab:cd:ef",
+		Validate:      validateMAC,
+		Canonicalize:  canonicalMAC,
+		PatternFormat: "Case insensitive glob against the lower case colon separated address, eg. 00:50:56:*",
+		MatchPattern:  matchMACPattern,
+	})
+}
+
+func isValidIPv4(ip string) (net.IP, bool) {
+	parsedIP := net.ParseIP(ip)
+	return parsedIP, parsedIP != nil && parsedIP.To4() != nil
+}
+
+func validateIPv4(locator ReportLocator) error {
+	ip, is4 := isValidIPv4(locator.Value)
+	if !is4 {
+		return apierror.APIError{Code: http.StatusBadRequest, WrappedError: fmt.Errorf("invalid IPv4 address: %s", locator.Value)}
+	}
+	if ip.IsPrivate() {
+		// If the IP address is private, it must have a distinguisher.
+		// This is to allow multiple private IPv4 addresses to be distinguished,
+		// and you need to explicitly set separate or merge private addresses.
+		if locator.Distinguisher == GlobalDistinguisher {
+			return apierror.APIError{Code: http.StatusUnprocessableEntity, WrappedError: fmt.Errorf("private IPv4 address cannot have a global distinguisher")}
+		}
+	}
+	if ip.IsLoopback() {
+		// We do not allow findings to be reported on loopback addresses
+		return apierror.APIError{Code: http.StatusUnprocessableEntity, WrappedError: fmt.Errorf("loopback IPv4 address not allowed")}
+	}
+	return nil
+}
+
+func validateHostname(locator ReportLocator) error {
+	// Everything is a valid hostname it seems
+	// FIXME there are some restrictions on hostnames after all...
+	if locator.Value == "localhost" {
+		return apierror.APIError{Code: http.StatusUnprocessableEntity, WrappedError: fmt.Errorf("hostname may not be '%s'", locator.Value)}
+	}
+	return nil
+}
+
+func validateHTTP(locator ReportLocator) error {
+	_, err := url.Parse(locator.Value)
+	if err != nil {
+		return apierror.APIError{Code: http.StatusBadRequest, WrappedError: fmt.Errorf("invalid URL: %s", locator.Value)}
+	}
+	return nil
+}
+
+func impliedHTTP(r ReportLocator) ([]ReportLocator, error) {
+	u, err := url.Parse(r.Value)
+	if err != nil {
+		// This should never happen, since we already validated the URL
+		panic(err)
+	}
+	locator := ReportLocator{Type: TCP, Value: u.Host, Distinguisher: r.Distinguisher}
+	if u.Port() == "" {
+		if u.Scheme == "http" {
+			locator.Value += ":80"
+		} else if u.Scheme == "https" {
+			locator.Value += ":443"
+		}
+	}
+	return []ReportLocator{locator}, nil
+}
+
+func validateTCP(locator ReportLocator) error {
+	_, err := net.ResolveTCPAddr("tcp", locator.Value)
+	if err != nil {
+		return apierror.APIError{Code: http.StatusBadRequest, WrappedError: fmt.Errorf("invalid TCP address: %s", locator.Value)}
+	}
+	return nil
+}
+
+func validateUDP(locator ReportLocator) error {
+	_, err := net.ResolveUDPAddr("udp", locator.Value)
+	if err != nil {
+		return apierror.APIError{Code: http.StatusBadRequest, WrappedError: fmt.Errorf("invalid UDP address: %s", locator.Value)}
+	}
+	return nil
+}
+
+// impliedHostPort checks if the TCP/UDP address implies an IP Address
+func impliedHostPort(r ReportLocator) ([]ReportLocator, error) {
+	host, _, err := net.SplitHostPort(r.Value)
+	if err != nil {
+		return nil, err
+	}
+	locator := ReportLocator{Type: Hostname, Value: host, Distinguisher: r.Distinguisher}
+	if _, is4 := isValidIPv4(host); is4 {
+		locator.Type = IPv4
+	}
+	return []ReportLocator{locator}, nil
+}
+
+// isValidMAC parses EUI-48 and EUI-64 addresses in any of the notations
+// accepted by net.ParseMAC. 20-octet InfiniBand addresses are rejected.
+func isValidMAC(mac string) (net.HardwareAddr, bool) {
+	parsedMAC, err := net.ParseMAC(mac)
+	if err != nil {
+		return nil, false
+	}
+	return parsedMAC, len(parsedMAC) == 6 || len(parsedMAC) == 8
+}
+
+func isZeroMAC(mac net.HardwareAddr) bool {
+	for _, octet := range mac {
+		if octet != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func validateMAC(locator ReportLocator) error {
+	mac, ok := isValidMAC(locator.Value)
+	if !ok {
+		return apierror.APIError{Code: http.StatusBadRequest, WrappedError: fmt.Errorf("invalid MAC address: %s", locator.Value)}
+	}
+	// MAC addresses are only meaningful within a layer 2 segment,
+	// so they must always be scoped to a non-global distinguisher.
+	if locator.Distinguisher == GlobalDistinguisher {
+		return apierror.APIError{Code: http.StatusUnprocessableEntity, WrappedError: fmt.Errorf("MAC address cannot have a global distinguisher")}
+	}
+	if mac[0]&0x01 != 0 {
+		// Group addresses (multicast and broadcast) do not identify a device
+		return apierror.APIError{Code: http.StatusUnprocessableEntity, WrappedError: fmt.Errorf("multicast MAC address not allowed")}
+	}
+	if isZeroMAC(mac) {
+		return apierror.APIError{Code: http.StatusUnprocessableEntity, WrappedError: fmt.Errorf("all-zero MAC address not allowed")}
+	}
+	return nil
+}
+
+// canonicalMAC formats the address as lower case, colon separated octets
+func canonicalMAC(r ReportLocator) ReportLocator {
+	if mac, ok := isValidMAC(r.Value); ok {
+		r.Value = mac.String()
+	}
+	return r
+}
@@ -0,0 +1,48 @@
+package intermediaries
+
+import (
+	"bufio"
+	_ "embed"
+	"net"
+	"strings"
+)
+
+//go:embed oui.txt
+var ouiTable string
+
+// ouiVendors maps the first three octets of a MAC address, formatted
+// as lower case colon separated hex, to the organization it is assigned to.
+var ouiVendors = parseOUITable(ouiTable)
+
+func parseOUITable(table string) map[string]string {
+	vendors := map[string]string{}
+	scanner := bufio.NewScanner(strings.NewReader(table))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		oui, vendor, found := strings.Cut(line, "\t")
+		if !found {
+			// The table is embedded at build time, a malformed line is a programming error
+			panic("malformed OUI table line: " + line)
+		}
+		vendors[strings.ToLower(strings.ReplaceAll(oui, "-", ":"))] = strings.TrimSpace(vendor)
+	}
+	return vendors
+}
+
+// MACVendor looks up the organization that the OUI of a MAC address is assigned to.
+// Locally administered addresses are never vendor assigned, and will not be found.
+func MACVendor(value string) (string, bool) {
+	mac, ok := isValidMAC(value)
+	if !ok {
+		return "", false
+	}
+	if mac[0]&0x02 != 0 {
+		// Locally administered bit set
+		return "", false
+	}
+	vendor, found := ouiVendors[net.HardwareAddr(mac[:3]).String()]
+	return vendor, found
+}
@@ -0,0 +1,43 @@
+package intermediaries
+
+import (
+	"crypto/rand"
+	"fmt"
+	"time"
+)
+
+// OutboxEvent is an event that has been stored together with the change that caused it,
+// and is waiting to be relayed to the event broker
+type OutboxEvent struct {
+	// Identifier is unique per event, and lets consumers deduplicate events delivered more than once
+	Identifier     string
+	OrganizationId int
+	Type           string
+	// Payload is the encoded event, as it is published
+	Payload     []byte
+	CreatedAt   time.Time
+	DeliveredAt *time.Time
+}
+
+// OutboxCursor is a position in the outbox, ordered by when events were created and then by their identifier
+type OutboxCursor struct {
+	CreatedAt  time.Time
+	Identifier string
+}
+
+// Cursor is the position of the event in the outbox
+func (outboxEvent OutboxEvent) Cursor() OutboxCursor {
+	return OutboxCursor{CreatedAt: outboxEvent.CreatedAt, Identifier: outboxEvent.Identifier}
+}
+
+// NewEventID generates a random (version 4) UUID for identifying an event
+func NewEventID() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		// crypto/rand never fails on supported platforms
+		panic(err)
+	}
+	id[6] = (id[6] & 0x0f) | 0x40
+	id[8] = (id[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:16])
+}
@@ -0,0 +1,99 @@
+package intermediaries
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/Kaese72/riskie-lib/apierror"
+)
+
+// Owner is who is responsible for acting on a finding
+type Owner struct {
+	Team    string
+	Contact string
+}
+
+func (owner Owner) IsZero() bool {
+	return owner == Owner{}
+}
+
+// OwnershipRule assigns an owner to the findings of an organization that match it.
+// A rule matches a finding when any of its locator patterns match the finding,
+// and the report distinguisher type of the finding is one of the distinguisher types.
+// Criteria that are left empty are ignored, but at least one must be set.
+type OwnershipRule struct {
+	Identifier     string
+	OrganizationId int
+	Name           string
+	// Priority decides which rule applies when several rules match a finding, lowest first
+	Priority           int
+	LocatorPatterns    []LocatorPattern
+	DistinguisherTypes []string
+	Owner              Owner
+}
+
+func (rule OwnershipRule) Validate() error {
+	if rule.Name == "" {
+		return apierror.APIError{Code: http.StatusBadRequest, WrappedError: fmt.Errorf("missing Name")}
+	}
+	if rule.Owner.Team == "" {
+		return apierror.APIError{Code: http.StatusBadRequest, WrappedError: fmt.Errorf("missing Owner Team")}
+	}
+	if len(rule.LocatorPatterns) == 0 && len(rule.DistinguisherTypes) == 0 {
+		return apierror.APIError{Code: http.StatusBadRequest, WrappedError: fmt.Errorf("must set locator patterns or distinguisher types")}
+	}
+	for _, pattern := range rule.LocatorPatterns {
+		if err := pattern.Validate(); err != nil {
+			return err
+		}
+	}
+	for _, distinguisherType := range rule.DistinguisherTypes {
+		if distinguisherType == "" {
+			return apierror.APIError{Code: http.StatusBadRequest, WrappedError: fmt.Errorf("distinguisher types may not be empty")}
+		}
+	}
+	return nil
+}
+
+func (rule OwnershipRule) Matches(finding Finding) bool {
+	if len(rule.DistinguisherTypes) > 0 {
+		found := false
+		for _, distinguisherType := range rule.DistinguisherTypes {
+			if distinguisherType == finding.ReportDistinguisher.Type {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(rule.LocatorPatterns) > 0 {
+		return FindingFilter{LocatorPatterns: rule.LocatorPatterns}.Matches(finding)
+	}
+	return true
+}
+
+// SortOwnershipRules orders rules in the order they are evaluated, by priority and then identifier
+func SortOwnershipRules(rules []OwnershipRule) {
+	sort.SliceStable(rules, func(i, j int) bool {
+		if rules[i].Priority != rules[j].Priority {
+			return rules[i].Priority < rules[j].Priority
+		}
+		return rules[i].Identifier < rules[j].Identifier
+	})
+}
+
+// ResolveOwner returns the owner of the first matching rule, in evaluation order.
+// The zero Owner is returned if no rule matches.
+func ResolveOwner(rules []OwnershipRule, finding Finding) Owner {
+	sorted := append([]OwnershipRule{}, rules...)
+	SortOwnershipRules(sorted)
+	for _, rule := range sorted {
+		if rule.Matches(finding) {
+			return rule.Owner
+		}
+	}
+	return Owner{}
+}
@@ -0,0 +1,62 @@
+package intermediaries_test
+
+import (
+	"testing"
+
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
+)
+
+func TestResolveOwner(t *testing.T) {
+	rules := []intermediaries.OwnershipRule{
+		{
+			Identifier:      "b",
+			Name:            "ssh anywhere",
+			Priority:        20,
+			LocatorPatterns: []intermediaries.LocatorPattern{{Type: intermediaries.TCP, Value: "*:22"}},
+			Owner:           intermediaries.Owner{Team: "infrastructure"},
+		},
+		{
+			Identifier:         "a",
+			Name:               "datacenter scanner",
+			Priority:           10,
+			LocatorPatterns:    []intermediaries.LocatorPattern{{Type: intermediaries.IPv4, Value: "10.20.0.0/16", Distinguisher: "dc1"}},
+			DistinguisherTypes: []string{"nessus"},
+			Owner:              intermediaries.Owner{Team: "dc1"},
+		},
+		{
+			Identifier:         "c",
+			Name:               "pentests",
+			Priority:           30,
+			DistinguisherTypes: []string{"pentest"},
+			Owner:              intermediaries.Owner{Team: "security"},
+		},
+	}
+	var tests = []struct {
+		name     string
+		locator  intermediaries.ReportLocator
+		dType    string
+		expected intermediaries.Owner
+	}{
+		{"priority wins", intermediaries.ReportLocator{Type: intermediaries.TCP, Value: "10.20.0.1:22", Distinguisher: "dc1"}, "nessus", intermediaries.Owner{Team: "dc1"}},
+		{"all criteria must match", intermediaries.ReportLocator{Type: intermediaries.TCP, Value: "10.20.0.1:22", Distinguisher: "dc1"}, "other", intermediaries.Owner{Team: "infrastructure"}},
+		{"distinguisher type only", intermediaries.ReportLocator{Type: intermediaries.Hostname, Value: "example.com", Distinguisher: "global"}, "pentest", intermediaries.Owner{Team: "security"}},
+		{"no match", intermediaries.ReportLocator{Type: intermediaries.Hostname, Value: "example.com", Distinguisher: "global"}, "other", intermediaries.Owner{}},
+	}
+	for _, testInput := range tests {
+		t.Run(testInput.name, func(t *testing.T) {
+			implied, err := testInput.locator.Implied()
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			finding := intermediaries.Finding{
+				ReportDistinguisher:   intermediaries.ReportDistinguisher{Type: testInput.dType, Value: "some uuid"},
+				ReportLocator:         testInput.locator,
+				ImpliedReportLocators: implied,
+			}
+			owner := intermediaries.ResolveOwner(rules, finding)
+			if owner != testInput.expected {
+				t.Fatalf("expected %v, got %v", testInput.expected, owner)
+			}
+		})
+	}
+}
@@ -0,0 +1,25 @@
+package intermediaries
+
+import "time"
+
+// ReplayProgress describes how far republishing the findings of an organization has come
+type ReplayProgress struct {
+	Total     int
+	Published int
+	Done      bool
+	// Error is set when the replay stopped before it was done
+	Error string
+}
+
+// Replay is a replay running in the background, or one that has stopped
+type Replay struct {
+	Identifier     string
+	OrganizationId int
+	StartedAt      time.Time
+	Progress       ReplayProgress
+}
+
+// Running checks if the replay has neither finished nor stopped early
+func (replay Replay) Running() bool {
+	return !replay.Progress.Done && replay.Progress.Error == ""
+}
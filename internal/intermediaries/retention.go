@@ -0,0 +1,69 @@
+package intermediaries
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Kaese72/riskie-lib/apierror"
+)
+
+// maxRetentionDays bounds the retention periods, which keeps the cutoffs within the times every backend stores
+const maxRetentionDays = 100 * 365
+
+// RetentionPolicy decides how long an organization keeps findings it no longer needs.
+// A period of 0 days keeps those findings forever, which is also how organizations without a policy are treated.
+type RetentionPolicy struct {
+	OrganizationId int
+	// ResolvedDays is how long a resolved finding is kept after it last changed, before it is deleted for good
+	ResolvedDays int
+	// DeletedDays is how long a deleted finding is kept as a tombstone, before it is purged
+	DeletedDays int
+	// ArchiveDays is how long a resolved finding is kept among the active findings after it last changed,
+	// before it is moved to the archive
+	ArchiveDays int
+}
+
+func (policy RetentionPolicy) Validate() error {
+	if policy.ResolvedDays < 0 || policy.ResolvedDays > maxRetentionDays {
+		return apierror.APIError{Code: http.StatusUnprocessableEntity, WrappedError: fmt.Errorf("ResolvedDays must be between 0 and %d", maxRetentionDays)}
+	}
+	if policy.DeletedDays < 0 || policy.DeletedDays > maxRetentionDays {
+		return apierror.APIError{Code: http.StatusUnprocessableEntity, WrappedError: fmt.Errorf("DeletedDays must be between 0 and %d", maxRetentionDays)}
+	}
+	if policy.ArchiveDays < 0 || policy.ArchiveDays > maxRetentionDays {
+		return apierror.APIError{Code: http.StatusUnprocessableEntity, WrappedError: fmt.Errorf("ArchiveDays must be between 0 and %d", maxRetentionDays)}
+	}
+	if policy.ArchiveDays > 0 && policy.ResolvedDays > 0 && policy.ArchiveDays >= policy.ResolvedDays {
+		// Resolved findings would be deleted before they are archived
+		return apierror.APIError{Code: http.StatusUnprocessableEntity, WrappedError: fmt.Errorf("ArchiveDays must be less than ResolvedDays")}
+	}
+	return nil
+}
+
+// Expired checks if the policy no longer keeps the finding at the time
+func (policy RetentionPolicy) Expired(finding Finding, at time.Time) bool {
+	if finding.Deleted() {
+		return policy.DeletedDays > 0 && finding.DeletedAt.Before(at.AddDate(0, 0, -policy.DeletedDays))
+	}
+	return policy.ResolvedDays > 0 && finding.Status == StatusResolved && finding.UpdatedAt.Before(at.AddDate(0, 0, -policy.ResolvedDays))
+}
+
+// Archivable checks if the policy moves the finding to the archive at the time. Archived findings are
+// still deleted once they expire.
+func (policy RetentionPolicy) Archivable(finding Finding, at time.Time) bool {
+	return policy.ArchiveDays > 0 && !finding.Deleted() && !finding.Archived() && finding.Status == StatusResolved &&
+		finding.UpdatedAt.Before(at.AddDate(0, 0, -policy.ArchiveDays))
+}
+
+// FindingPurge is the outcome of deleting findings for good
+type FindingPurge struct {
+	// Purged is the number of findings deleted for good
+	Purged int
+}
+
+// FindingArchive is the outcome of archiving findings
+type FindingArchive struct {
+	// Archived is the number of findings moved to the archive
+	Archived int
+}
@@ -0,0 +1,101 @@
+package intermediaries_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
+)
+
+func TestRetentionPolicyValidate(t *testing.T) {
+	var tests = []struct {
+		name    string
+		policy  intermediaries.RetentionPolicy
+		success bool
+	}{
+		{"keep forever", intermediaries.RetentionPolicy{}, true},
+		{"both periods", intermediaries.RetentionPolicy{ResolvedDays: 90, DeletedDays: 30}, true},
+		{"negative resolved days", intermediaries.RetentionPolicy{ResolvedDays: -1}, false},
+		{"negative deleted days", intermediaries.RetentionPolicy{DeletedDays: -1}, false},
+		{"too many days", intermediaries.RetentionPolicy{ResolvedDays: 1000 * 365}, false},
+		{"archived before deleted", intermediaries.RetentionPolicy{ResolvedDays: 90, ArchiveDays: 30}, true},
+		{"archived only", intermediaries.RetentionPolicy{ArchiveDays: 30}, true},
+		{"negative archive days", intermediaries.RetentionPolicy{ArchiveDays: -1}, false},
+		{"deleted before archived", intermediaries.RetentionPolicy{ResolvedDays: 30, ArchiveDays: 30}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Validate()
+			if tt.success && err != nil {
+				t.Errorf("expected success, got %s", err.Error())
+			}
+			if !tt.success && err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestRetentionPolicyExpired(t *testing.T) {
+	at := time.Date(2024, 3, 31, 12, 0, 0, 0, time.UTC)
+	daysAgo := func(days int) time.Time {
+		return at.AddDate(0, 0, -days)
+	}
+	deleted := func(days int) intermediaries.Finding {
+		deletedAt := daysAgo(days)
+		return intermediaries.Finding{Status: intermediaries.StatusOpen, UpdatedAt: daysAgo(100), DeletedAt: &deletedAt}
+	}
+	policy := intermediaries.RetentionPolicy{ResolvedDays: 30, DeletedDays: 7}
+	var tests = []struct {
+		name     string
+		policy   intermediaries.RetentionPolicy
+		finding  intermediaries.Finding
+		expected bool
+	}{
+		{"resolved long ago", policy, intermediaries.Finding{Status: intermediaries.StatusResolved, UpdatedAt: daysAgo(31)}, true},
+		{"resolved recently", policy, intermediaries.Finding{Status: intermediaries.StatusResolved, UpdatedAt: daysAgo(29)}, false},
+		{"open long ago", policy, intermediaries.Finding{Status: intermediaries.StatusOpen, UpdatedAt: daysAgo(31)}, false},
+		{"accepted long ago", policy, intermediaries.Finding{Status: intermediaries.StatusAccepted, UpdatedAt: daysAgo(31)}, false},
+		{"deleted long ago", policy, deleted(8), true},
+		{"deleted recently", policy, deleted(6), false},
+		{"resolved kept forever", intermediaries.RetentionPolicy{DeletedDays: 7}, intermediaries.Finding{Status: intermediaries.StatusResolved, UpdatedAt: daysAgo(1000)}, false},
+		{"deleted kept forever", intermediaries.RetentionPolicy{ResolvedDays: 30}, deleted(1000), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if actual := tt.policy.Expired(tt.finding, at); actual != tt.expected {
+				t.Errorf("expected %t, got %t", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestRetentionPolicyArchivable(t *testing.T) {
+	at := time.Date(2024, 3, 31, 12, 0, 0, 0, time.UTC)
+	daysAgo := func(days int) time.Time {
+		return at.AddDate(0, 0, -days)
+	}
+	archivedAt := daysAgo(1)
+	deletedAt := daysAgo(1)
+	policy := intermediaries.RetentionPolicy{ResolvedDays: 90, ArchiveDays: 30}
+	var tests = []struct {
+		name     string
+		policy   intermediaries.RetentionPolicy
+		finding  intermediaries.Finding
+		expected bool
+	}{
+		{"resolved long ago", policy, intermediaries.Finding{Status: intermediaries.StatusResolved, UpdatedAt: daysAgo(31)}, true},
+		{"resolved recently", policy, intermediaries.Finding{Status: intermediaries.StatusResolved, UpdatedAt: daysAgo(29)}, false},
+		{"open long ago", policy, intermediaries.Finding{Status: intermediaries.StatusOpen, UpdatedAt: daysAgo(31)}, false},
+		{"already archived", policy, intermediaries.Finding{Status: intermediaries.StatusResolved, UpdatedAt: daysAgo(31), ArchivedAt: &archivedAt}, false},
+		{"deleted", policy, intermediaries.Finding{Status: intermediaries.StatusResolved, UpdatedAt: daysAgo(31), DeletedAt: &deletedAt}, false},
+		{"never archived", intermediaries.RetentionPolicy{ResolvedDays: 90}, intermediaries.Finding{Status: intermediaries.StatusResolved, UpdatedAt: daysAgo(1000)}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if actual := tt.policy.Archivable(tt.finding, at); actual != tt.expected {
+				t.Errorf("expected %t, got %t", tt.expected, actual)
+			}
+		})
+	}
+}
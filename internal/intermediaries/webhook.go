@@ -0,0 +1,107 @@
+package intermediaries
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/Kaese72/riskie-lib/apierror"
+)
+
+// WebhookSubscription receives the events of an organization as HTTP POST requests
+type WebhookSubscription struct {
+	Identifier     string
+	OrganizationId int
+	URL            string
+	// Secret signs every delivery, so that the receiver can verify where it came from
+	Secret string
+	// EventTypes limits the subscription to the listed event types, every event type if empty
+	EventTypes []string
+	Enabled    bool
+	// ConsecutiveFailures counts failed delivery attempts since the last successful one.
+	// The subscription is disabled when it reaches the configured limit.
+	ConsecutiveFailures int
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+}
+
+func (subscription WebhookSubscription) Validate() error {
+	if subscription.URL == "" {
+		return apierror.APIError{Code: http.StatusBadRequest, WrappedError: fmt.Errorf("missing URL")}
+	}
+	parsed, err := url.Parse(subscription.URL)
+	if err != nil || !parsed.IsAbs() || parsed.Host == "" {
+		return apierror.APIError{Code: http.StatusBadRequest, WrappedError: fmt.Errorf("invalid URL: %s", subscription.URL)}
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return apierror.APIError{Code: http.StatusUnprocessableEntity, WrappedError: fmt.Errorf("URL must use http or https: %s", subscription.URL)}
+	}
+	return nil
+}
+
+// Subscribes tells whether events of the type are delivered to the subscription
+func (subscription WebhookSubscription) Subscribes(eventType string) bool {
+	if !subscription.Enabled {
+		return false
+	}
+	if len(subscription.EventTypes) == 0 {
+		return true
+	}
+	for _, subscribed := range subscription.EventTypes {
+		if subscribed == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// NewWebhookSecret generates a random secret for signing deliveries
+func NewWebhookSecret() string {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		// crypto/rand never fails on supported platforms
+		panic(err)
+	}
+	return hex.EncodeToString(secret)
+}
+
+type WebhookDeliveryStatus string
+
+const (
+	DeliveryPending   WebhookDeliveryStatus = "pending"
+	DeliverySucceeded WebhookDeliveryStatus = "succeeded"
+	DeliveryFailed    WebhookDeliveryStatus = "failed"
+)
+
+// WebhookDelivery is a single event delivered, or to be delivered, to a subscription, and is kept as a log of deliveries
+type WebhookDelivery struct {
+	Identifier     string
+	SubscriptionId string
+	OrganizationId int
+	EventId        string
+	EventType      string
+	// Payload is the encoded event, as it is posted
+	Payload        []byte
+	Status         WebhookDeliveryStatus
+	Attempts       int
+	NextAttemptAt  time.Time
+	LastAttemptAt  *time.Time
+	LastStatusCode int
+	LastError      string
+	CreatedAt      time.Time
+}
+
+// WebhookDeliveryCursor is a position in the deliveries of a subscription, ordered by when deliveries were created
+// and then by their identifier. The zero cursor is after every delivery.
+type WebhookDeliveryCursor struct {
+	CreatedAt  time.Time
+	Identifier string
+}
+
+// Cursor is the position of the delivery in the deliveries of its subscription
+func (delivery WebhookDelivery) Cursor() WebhookDeliveryCursor {
+	return WebhookDeliveryCursor{CreatedAt: delivery.CreatedAt, Identifier: delivery.Identifier}
+}
@@ -0,0 +1,52 @@
+package intermediaries_test
+
+import (
+	"testing"
+
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
+)
+
+func TestWebhookSubscriptionValidate(t *testing.T) {
+	var tests = []struct {
+		url     string
+		success bool
+	}{
+		{"https://hooks.example.com/findings", true},
+		{"http://10.0.0.1:8080/", true},
+		{"", false},
+		{"/findings", false},
+		{"ftp://example.com/", false},
+		{"https://", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			err := intermediaries.WebhookSubscription{URL: tt.url}.Validate()
+			if tt.success && err != nil {
+				t.Errorf("expected success, got %s", err.Error())
+			}
+			if !tt.success && err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestWebhookSubscriptionSubscribes(t *testing.T) {
+	var tests = []struct {
+		name         string
+		subscription intermediaries.WebhookSubscription
+		expected     bool
+	}{
+		{"every event type", intermediaries.WebhookSubscription{Enabled: true}, true},
+		{"listed event type", intermediaries.WebhookSubscription{Enabled: true, EventTypes: []string{"finding.deleted", "finding.created"}}, true},
+		{"other event type", intermediaries.WebhookSubscription{Enabled: true, EventTypes: []string{"finding.deleted"}}, false},
+		{"disabled", intermediaries.WebhookSubscription{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if actual := tt.subscription.Subscribes("finding.created"); actual != tt.expected {
+				t.Errorf("expected %t, got %t", tt.expected, actual)
+			}
+		})
+	}
+}
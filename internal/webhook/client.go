@@ -0,0 +1,67 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// ErrAddressNotAllowed is returned when the host of a webhook resolves to an address deliveries are not made to
+var ErrAddressNotAllowed = errors.New("address not allowed")
+
+// sharedAddressSpace is the carrier grade NAT range, which is not routed on the internet either
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// allowedAddress checks that deliveries may be made to the address, which rules out the loopback, private,
+// link-local, unspecified and multicast addresses of the network the registry runs in
+func allowedAddress(ip net.IP) bool {
+	if ipv4 := ip.To4(); ipv4 != nil && ipv4[0] == 0 {
+		// 0.0.0.0/8 is "this network"
+		return false
+	}
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() || sharedAddressSpace.Contains(ip))
+}
+
+// checkDialedAddress refuses to connect to addresses that are not allowed. It is called with the resolved address
+// of every connection, so a host that resolves to another address by the time it is delivered to is checked as well.
+func checkDialedAddress(network string, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !allowedAddress(ip) {
+		return fmt.Errorf("%w: %s", ErrAddressNotAllowed, host)
+	}
+	return nil
+}
+
+// NewClient returns the client deliveries are posted with, where every attempt is bounded by the timeout.
+// Unless allowPrivate is set, the client only connects to public addresses, so that subscriptions can not be used
+// to reach the network the registry runs in. Redirects are not followed, and are failed attempts like other responses than 2xx.
+func NewClient(timeout time.Duration, allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second}
+	if !allowPrivate {
+		dialer.Control = checkDialedAddress
+	}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			// Proxies from the environment are not used, as the address of the proxy would be checked rather than the receiver
+			Proxy:                 nil,
+			DialContext:           dialer.DialContext,
+			ForceAttemptHTTP2:     true,
+			MaxIdleConns:          100,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: time.Second,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
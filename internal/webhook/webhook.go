@@ -0,0 +1,99 @@
+// Package webhook posts events to webhook subscribers, signed so that the receivers can verify them
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// EventTypeHeader carries the type of the delivered event
+	EventTypeHeader = "X-Finding-Registry-Event"
+	// DeliveryHeader carries the identifier of the delivery, which is the same for every attempt
+	DeliveryHeader = "X-Finding-Registry-Delivery"
+	// TimestampHeader carries when the attempt was signed, as seconds since the Unix epoch
+	TimestampHeader = "X-Finding-Registry-Timestamp"
+	// SignatureHeader carries the signature of the attempt, formatted as sha256=<hex encoded HMAC>
+	SignatureHeader = "X-Finding-Registry-Signature"
+)
+
+// Sign signs the body of a delivery together with its timestamp, so that old deliveries can not be replayed with a new timestamp.
+// The signature is the HMAC-SHA256 of "<timestamp>.<body>" keyed with the secret of the subscription.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp.Unix(), 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature and timestamp headers of a received delivery, and rejects deliveries older than tolerance
+func Verify(secret string, header http.Header, body []byte, tolerance time.Duration, now time.Time) error {
+	seconds, err := strconv.ParseInt(header.Get(TimestampHeader), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp: %s", err.Error())
+	}
+	timestamp := time.Unix(seconds, 0)
+	if now.Sub(timestamp) > tolerance || timestamp.Sub(now) > tolerance {
+		return fmt.Errorf("timestamp outside tolerance")
+	}
+	if !hmac.Equal([]byte(header.Get(SignatureHeader)), []byte(Sign(secret, timestamp, body))) {
+		return fmt.Errorf("invalid signature")
+	}
+	return nil
+}
+
+// Delivery is a single attempt at posting an event to a subscriber
+type Delivery struct {
+	URL        string
+	Secret     string
+	DeliveryID string
+	EventType  string
+	Payload    []byte
+}
+
+// Post posts the delivery and returns the status code of the response. Responses other than 2xx are returned as errors.
+func Post(ctx context.Context, client *http.Client, delivery Delivery, now time.Time) (int, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "finding-registry-webhook")
+	request.Header.Set(EventTypeHeader, delivery.EventType)
+	request.Header.Set(DeliveryHeader, delivery.DeliveryID)
+	request.Header.Set(TimestampHeader, strconv.FormatInt(now.Unix(), 10))
+	request.Header.Set(SignatureHeader, Sign(delivery.Secret, now, delivery.Payload))
+	response, err := client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	// Drain a bounded part of the body, so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(response.Body, 64*1024))
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return response.StatusCode, fmt.Errorf("unexpected response status: %s", response.Status)
+	}
+	return response.StatusCode, nil
+}
+
+// Backoff is how long to wait before the next attempt after the given number of failed attempts,
+// doubling from minBackoff for every attempt and bounded by maxBackoff
+func Backoff(attempts int, minBackoff time.Duration, maxBackoff time.Duration) time.Duration {
+	backoff := minBackoff
+	for attempt := 1; attempt < attempts; attempt++ {
+		backoff *= 2
+		if backoff >= maxBackoff {
+			return maxBackoff
+		}
+	}
+	return backoff
+}
@@ -0,0 +1,150 @@
+package webhook_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Kaese72/finding-registry/internal/webhook"
+)
+
+func TestPost(t *testing.T) {
+	now := time.Now()
+	received := make(chan *http.Request, 1)
+	receivedBody := make(chan []byte, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if err := webhook.Verify("secret", r.Header, body, time.Minute, now); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		received <- r
+		receivedBody <- body
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	delivery := webhook.Delivery{URL: receiver.URL, Secret: "secret", DeliveryID: "delivery-1", EventType: "finding.created", Payload: []byte(`{"eventId":"abc"}`)}
+	status, err := webhook.Post(context.Background(), receiver.Client(), delivery, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != http.StatusNoContent {
+		t.Errorf("expected status 204, got %d", status)
+	}
+	request := <-received
+	if request.Header.Get(webhook.EventTypeHeader) != "finding.created" || request.Header.Get(webhook.DeliveryHeader) != "delivery-1" {
+		t.Errorf("unexpected headers %v", request.Header)
+	}
+	if body := <-receivedBody; string(body) != `{"eventId":"abc"}` {
+		t.Errorf("unexpected body %s", body)
+	}
+
+	delivery.Secret = "other"
+	status, err = webhook.Post(context.Background(), receiver.Client(), delivery, now)
+	if err == nil || status != http.StatusUnauthorized {
+		t.Errorf("expected receiver to reject the signature, got %d %v", status, err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Now()
+	body := []byte(`{"eventId":"abc"}`)
+	signed := func(secret string, at time.Time) http.Header {
+		header := http.Header{}
+		header.Set(webhook.TimestampHeader, strconv.FormatInt(at.Unix(), 10))
+		header.Set(webhook.SignatureHeader, webhook.Sign(secret, at, body))
+		return header
+	}
+	var tests = []struct {
+		name    string
+		header  http.Header
+		body    []byte
+		success bool
+	}{
+		{"valid", signed("secret", now), body, true},
+		{"other secret", signed("other", now), body, false},
+		{"modified body", signed("secret", now), []byte(`{"eventId":"def"}`), false},
+		{"too old", signed("secret", now.Add(-10*time.Minute)), body, false},
+		{"missing timestamp", http.Header{}, body, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := webhook.Verify("secret", tt.header, tt.body, 5*time.Minute, now)
+			if tt.success && err != nil {
+				t.Errorf("expected success, got %s", err.Error())
+			}
+			if !tt.success && err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	var tests = []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{4, 8 * time.Second},
+		{20, time.Minute},
+	}
+	for _, tt := range tests {
+		if actual := webhook.Backoff(tt.attempts, time.Second, time.Minute); actual != tt.expected {
+			t.Errorf("expected backoff %s after %d attempts, got %s", tt.expected, tt.attempts, actual)
+		}
+	}
+}
+
+func TestNewClientRefusesPrivateAddresses(t *testing.T) {
+	var tests = []struct {
+		name string
+		url  string
+	}{
+		{"loopback", "http://127.0.0.1:1/"},
+		{"loopback IPv6", "http://[::1]:1/"},
+		{"private", "http://10.0.0.1:1/"},
+		{"private IPv6", "http://[fd00::1]:1/"},
+		{"link-local", "http://169.254.169.254/latest/meta-data/"},
+		{"unspecified", "http://0.0.0.0:1/"},
+		{"this network", "http://0.1.2.3:1/"},
+		{"shared address space", "http://100.64.0.1:1/"},
+		{"IPv4 mapped loopback", "http://[::ffff:127.0.0.1]:1/"},
+		{"localhost", "http://localhost:1/"},
+	}
+	client := webhook.NewClient(time.Second, false)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := webhook.Post(context.Background(), client, webhook.Delivery{URL: tt.url, Secret: "secret"}, time.Now())
+			if !errors.Is(err, webhook.ErrAddressNotAllowed) {
+				t.Errorf("expected the address to be refused, got %v", err)
+			}
+		})
+	}
+}
+
+func TestNewClientDoesNotFollowRedirects(t *testing.T) {
+	redirected := false
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		redirected = true
+	}))
+	defer target.Close()
+	receiver := httptest.NewServer(http.RedirectHandler(target.URL, http.StatusTemporaryRedirect))
+	defer receiver.Close()
+
+	// Private addresses are allowed, as the receivers of the test run on the loopback address
+	status, err := webhook.Post(context.Background(), webhook.NewClient(time.Second, true), webhook.Delivery{URL: receiver.URL, Secret: "secret"}, time.Now())
+	if err == nil || status != http.StatusTemporaryRedirect {
+		t.Errorf("expected the redirect to fail the attempt, got %d %v", status, err)
+	}
+	if redirected {
+		t.Error("expected the redirect not to be followed")
+	}
+}
@@ -4,11 +4,14 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"os"
 	"strings"
+	"time"
 
 	"github.com/Kaese72/finding-registry/event"
 	"github.com/Kaese72/finding-registry/internal/application"
 	"github.com/Kaese72/finding-registry/internal/database"
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
 	"github.com/Kaese72/finding-registry/rest"
 	"github.com/Kaese72/riskie-lib/logging"
 	"github.com/spf13/viper"
@@ -16,20 +19,51 @@ import (
 
 type Config struct {
 	Database struct {
+		Backend          string `mapstructure:"backend"`
 		ConnectionString string `mapstructure:"connectionString"`
 		Name             string `mapstructure:"name"`
+		Path             string `mapstructure:"path"`
+		AllowStandalone  bool   `mapstructure:"allowStandalone"`
 	} `mapstructure:"database"`
 	JWT struct {
 		Secret string `mapstructure:"secret"`
 	} `mapstructure:"jwt"`
+	Admin struct {
+		UserIds []int `mapstructure:"userIds"`
+	} `mapstructure:"admin"`
 	Listen struct {
 		Host string `mapstructure:"host"`
 		Port int    `mapstructure:"port"`
 	} `mapstructure:"listen"`
 	Event struct {
+		Transport        string `mapstructure:"transport"`
+		Exchange         string `mapstructure:"exchange"`
 		FindingUpdates   string `mapstructure:"findingUpdates"`
+		Topic            string `mapstructure:"topic"`
+		Stream           string `mapstructure:"stream"`
 		ConnectionString string `mapstructure:"connectionString"`
+		BufferSize       int    `mapstructure:"bufferSize"`
+		MaxRetries       int    `mapstructure:"maxRetries"`
+		Source           string `mapstructure:"source"`
+		ContentMode      string `mapstructure:"contentMode"`
 	} `mapstructure:"event"`
+	Webhook struct {
+		MaxAttempts           int  `mapstructure:"maxAttempts"`
+		DisableAfter          int  `mapstructure:"disableAfter"`
+		AllowPrivateNetworks  bool `mapstructure:"allowPrivateNetworks"`
+		Concurrency           int  `mapstructure:"concurrency"`
+		DeliveryRetentionDays int  `mapstructure:"deliveryRetentionDays"`
+	} `mapstructure:"webhook"`
+	Stream struct {
+		SettleDelaySeconds            int `mapstructure:"settleDelaySeconds"`
+		MaxConnections                int `mapstructure:"maxConnections"`
+		MaxConnectionsPerOrganization int `mapstructure:"maxConnectionsPerOrganization"`
+	} `mapstructure:"stream"`
+	Ingest struct {
+		ConnectionString string `mapstructure:"connectionString"`
+		Queue            string `mapstructure:"queue"`
+		DeadLetterQueue  string `mapstructure:"deadLetterQueue"`
+	} `mapstructure:"ingest"`
 }
 
 var Loaded Config
@@ -37,13 +71,22 @@ var Loaded Config
 func init() {
 	// Load configuration from environment
 	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_", "-", "_"))
+	viper.BindEnv("database.backend")
+	viper.SetDefault("database.backend", string(database.BackendMongoDB))
 	viper.BindEnv("database.connectionString")
 	viper.BindEnv("database.name")
 	viper.SetDefault("database.name", "riskRegistry")
+	viper.BindEnv("database.path")
+	viper.SetDefault("database.path", "finding-registry.db")
+	viper.BindEnv("database.allowStandalone")
+	viper.SetDefault("database.allowStandalone", false)
 
 	// JWT configuration
 	viper.BindEnv("jwt.secret")
 
+	// Administrators, as a comma separated list of user IDs
+	viper.BindEnv("admin.userIds")
+
 	// HTTP listen config
 	viper.BindEnv("listen.host")
 	viper.SetDefault("listen.host", "0.0.0.0")
@@ -51,40 +94,201 @@ func init() {
 	viper.SetDefault("listen.port", "8080")
 
 	// Event configuration
+	viper.BindEnv("event.transport")
+	viper.SetDefault("event.transport", string(event.TransportAMQP))
+	viper.BindEnv("event.exchange")
+	viper.SetDefault("event.exchange", event.DefaultExchange)
 	viper.BindEnv("event.findingUpdates")
 	viper.SetDefault("event.findingUpdates", "findingUpdates")
+	viper.BindEnv("event.topic")
+	viper.SetDefault("event.topic", event.DefaultTopic)
+	viper.BindEnv("event.stream")
+	viper.SetDefault("event.stream", event.DefaultStream)
 	viper.BindEnv("event.connectionString")
+	viper.BindEnv("event.bufferSize")
+	viper.SetDefault("event.bufferSize", 1000)
+	viper.BindEnv("event.maxRetries")
+	viper.SetDefault("event.maxRetries", 5)
+	viper.BindEnv("event.source")
+	viper.SetDefault("event.source", event.DefaultSource)
+	viper.BindEnv("event.contentMode")
+	viper.SetDefault("event.contentMode", string(event.ContentModeStructured))
+
+	// Webhook configuration
+	viper.BindEnv("webhook.maxAttempts")
+	viper.SetDefault("webhook.maxAttempts", 8)
+	viper.BindEnv("webhook.disableAfter")
+	viper.SetDefault("webhook.disableAfter", 20)
+	viper.BindEnv("webhook.allowPrivateNetworks")
+	viper.SetDefault("webhook.allowPrivateNetworks", false)
+	viper.BindEnv("webhook.concurrency")
+	viper.SetDefault("webhook.concurrency", 10)
+	viper.BindEnv("webhook.deliveryRetentionDays")
+	viper.SetDefault("webhook.deliveryRetentionDays", 7)
+
+	// Stream configuration
+	viper.BindEnv("stream.settleDelaySeconds")
+	viper.SetDefault("stream.settleDelaySeconds", 2)
+	viper.BindEnv("stream.maxConnections")
+	viper.SetDefault("stream.maxConnections", 1000)
+	viper.BindEnv("stream.maxConnectionsPerOrganization")
+	viper.SetDefault("stream.maxConnectionsPerOrganization", 20)
+
+	// Ingest configuration, submissions are only consumed when a queue is configured
+	viper.BindEnv("ingest.connectionString")
+	viper.BindEnv("ingest.queue")
+	viper.BindEnv("ingest.deadLetterQueue")
 
 	err := viper.Unmarshal(&Loaded)
 	if err != nil {
 		logging.Fatal(context.Background(), err.Error())
 	}
-	if Loaded.Database.ConnectionString == "" {
-		logging.Fatal(context.Background(), "Database connection string not set")
+	switch database.Backend(Loaded.Database.Backend) {
+	case database.BackendMemory, database.BackendBolt:
+		// Nothing to connect to
+	default:
+		if Loaded.Database.ConnectionString == "" {
+			logging.Fatal(context.Background(), "Database connection string not set")
+		}
 	}
 	if Loaded.JWT.Secret == "" {
 		logging.Fatal(context.Background(), "JWT secret key not set")
 	}
-	if Loaded.Event.ConnectionString == "" {
+	if Loaded.Event.ConnectionString == "" && event.Transport(Loaded.Event.Transport) != event.TransportMemory {
 		logging.Fatal(context.Background(), "Event connection string not set")
 	}
 }
 
-func main() {
-	db, err := database.NewMongoFindingsPersistence(database.MongoDBConfig{
-		ConnectionString: Loaded.Database.ConnectionString,
-		DbName:           Loaded.Database.Name,
-	})
+func databaseConfig() database.Config {
+	return database.Config{
+		Backend: database.Backend(Loaded.Database.Backend),
+		MongoDB: database.MongoDBConfig{
+			ConnectionString: Loaded.Database.ConnectionString,
+			DbName:           Loaded.Database.Name,
+			AllowStandalone:  Loaded.Database.AllowStandalone,
+		},
+		Postgres: database.PostgresConfig{
+			ConnectionString: Loaded.Database.ConnectionString,
+		},
+		Bolt: database.BoltConfig{
+			Path: Loaded.Database.Path,
+		},
+	}
+}
+
+// submittedFindingToIntermediary reads a finding submitted through the queue like a finding posted to the REST API
+func submittedFindingToIntermediary(finding event.SubmittedFinding) intermediaries.Finding {
+	return intermediaries.Finding{
+		Name:           finding.Name,
+		OrganizationId: finding.OrganizationId,
+		ReportDistinguisher: intermediaries.ReportDistinguisher{
+			Type:  finding.ReportDistinguisher.Type,
+			Value: finding.ReportDistinguisher.Value,
+		},
+		ReportLocator: intermediaries.ReportLocator{
+			Type:          intermediaries.ReportLocatorType(finding.ReportLocator.Type),
+			Value:         finding.ReportLocator.Value,
+			Distinguisher: finding.ReportLocator.Distinguisher,
+		},
+		Severity: intermediaries.Severity(finding.Severity),
+	}
+}
+
+// setupApplication connects the database and the event transport
+func setupApplication() application.ApplicationLogic {
+	db, err := database.Setup(databaseConfig())
 	if err != nil {
 		panic(err)
 	}
 	// if err := db.Purge(); err != nil {
 	// 	panic(err)
 	// }
-	updateChannel, err := event.Setup(Loaded.Event.ConnectionString, Loaded.Event.FindingUpdates)
+	publisher, err := event.Setup(event.Config{
+		Transport: event.Transport(Loaded.Event.Transport),
+		CloudEvents: event.CloudEventsConfig{
+			Source:      Loaded.Event.Source,
+			ContentMode: event.ContentMode(Loaded.Event.ContentMode),
+		},
+		AMQP: event.AMQPConfig{
+			ConnectionString: Loaded.Event.ConnectionString,
+			Exchange:         Loaded.Event.Exchange,
+			QueueName:        Loaded.Event.FindingUpdates,
+			BufferSize:       Loaded.Event.BufferSize,
+			MaxRetries:       Loaded.Event.MaxRetries,
+		},
+		Kafka: event.KafkaConfig{
+			Brokers:    strings.Split(Loaded.Event.ConnectionString, ","),
+			Topic:      Loaded.Event.Topic,
+			MaxRetries: Loaded.Event.MaxRetries,
+		},
+		NATS: event.NATSConfig{
+			URL:    Loaded.Event.ConnectionString,
+			Stream: Loaded.Event.Stream,
+		},
+		Memory: event.MemoryConfig{
+			BufferSize: Loaded.Event.BufferSize,
+		},
+	})
 	if err != nil {
 		panic(err)
 	}
-	router := rest.InitMux(application.NewApplicationLogic(db, updateChannel), Loaded.JWT.Secret)
+	return application.NewApplicationLogic(db, publisher).WithStreamConfig(application.StreamConfig{
+		SettleDelay:                   time.Duration(Loaded.Stream.SettleDelaySeconds) * time.Second,
+		MaxConnections:                Loaded.Stream.MaxConnections,
+		MaxConnectionsPerOrganization: Loaded.Stream.MaxConnectionsPerOrganization,
+	})
+}
+
+func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "replay":
+			replayCommand(os.Args[2:])
+			return
+		case "migrate":
+			migrateCommand(os.Args[2:])
+			return
+		case "export":
+			exportCommand(os.Args[2:])
+			return
+		case "import":
+			importCommand(os.Args[2:])
+			return
+		default:
+			logging.Fatal(context.Background(), fmt.Sprintf("unknown command: %s", os.Args[1]))
+		}
+	}
+	logic := setupApplication()
+	go logic.RunOutboxRelay(context.Background(), time.Second)
+	go logic.RunRetention(context.Background(), time.Hour)
+	go logic.RunWebhookDispatcher(context.Background(), application.WebhookConfig{
+		MaxAttempts:          Loaded.Webhook.MaxAttempts,
+		DisableAfter:         Loaded.Webhook.DisableAfter,
+		AllowPrivateNetworks: Loaded.Webhook.AllowPrivateNetworks,
+		Concurrency:          Loaded.Webhook.Concurrency,
+		DeliveryRetention:    time.Duration(Loaded.Webhook.DeliveryRetentionDays) * 24 * time.Hour,
+	})
+	if Loaded.Ingest.Queue != "" {
+		connectionString := Loaded.Ingest.ConnectionString
+		if connectionString == "" {
+			connectionString = Loaded.Event.ConnectionString
+		}
+		consumer, err := event.NewConsumer(event.ConsumerConfig{
+			ConnectionString:    connectionString,
+			QueueName:           Loaded.Ingest.Queue,
+			DeadLetterQueueName: Loaded.Ingest.DeadLetterQueue,
+			JWTSecret:           Loaded.JWT.Secret,
+		}, func(ctx context.Context, finding event.SubmittedFinding, organizationID int) error {
+			_, err := logic.PostFinding(ctx, submittedFindingToIntermediary(finding), intermediaries.VersionPrecondition{}, organizationID)
+			return err
+		})
+		if err != nil {
+			panic(err)
+		}
+		go consumer.Run(context.Background())
+		// The service is not healthy while submissions can not be consumed
+		logic = logic.WithHealthCheck(consumer.Health)
+	}
+	router := rest.InitMux(logic, Loaded.JWT.Secret, Loaded.Admin.UserIds)
 	http.ListenAndServe(fmt.Sprintf("%s:%d", Loaded.Listen.Host, Loaded.Listen.Port), router)
 }
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"context"
+	"flag"
+
+	"github.com/Kaese72/finding-registry/internal/database"
+	"github.com/Kaese72/riskie-lib/logging"
+)
+
+// migrateCommand brings the database schema up to date without starting the service
+func migrateCommand(args []string) {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	flags.Parse(args)
+	if err := database.Migrate(context.Background(), databaseConfig()); err != nil {
+		logging.Fatal(context.Background(), "Migration failed", map[string]interface{}{"error": err.Error()})
+	}
+	logging.Info(context.Background(), "Database is up to date")
+}
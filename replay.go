@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Kaese72/finding-registry/internal/application"
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
+	"github.com/Kaese72/riskie-lib/logging"
+)
+
+// replayCommand republishes the findings of an organization, like POST /finding-registry/admin/findings/replay
+func replayCommand(args []string) {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	organizationID := flags.Int("organization", 0, "organization to republish the findings of")
+	locatorTypes := flags.String("locator-types", "", "comma separated locator types to republish, all if not set")
+	updatedSince := flags.String("updated-since", "", "only republish findings updated at or after this RFC 3339 time")
+	rate := flags.Int("rate", application.DefaultReplayRate, "events republished per second")
+	flags.Parse(args)
+	if *organizationID == 0 {
+		fmt.Fprintln(os.Stderr, "-organization is required")
+		flags.Usage()
+		os.Exit(2)
+	}
+	filter := intermediaries.FindingFilter{}
+	if *locatorTypes != "" {
+		for _, locatorType := range strings.Split(*locatorTypes, ",") {
+			filter.LocatorTypes = append(filter.LocatorTypes, intermediaries.ReportLocatorType(strings.TrimSpace(locatorType)))
+		}
+	}
+	if *updatedSince != "" {
+		since, err := time.Parse(time.RFC3339, *updatedSince)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid -updated-since: %s\n", err.Error())
+			os.Exit(2)
+		}
+		filter.UpdatedSince = since
+	}
+	logic := setupApplication()
+	ctx := context.Background()
+	_, err := logic.ReplayFindings(ctx, *organizationID, filter, *rate, func(progress intermediaries.ReplayProgress) {
+		logging.Info(ctx, "Replay progress", map[string]interface{}{"organizationId": *organizationID, "published": progress.Published, "total": progress.Total})
+	})
+	if err != nil {
+		logging.Fatal(ctx, "Replay failed", map[string]interface{}{"organizationId": *organizationID, "error": err.Error()})
+	}
+}
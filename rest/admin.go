@@ -0,0 +1,28 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/Kaese72/organization-registry/authentication"
+	"github.com/Kaese72/riskie-lib/apierror"
+)
+
+// adminMiddleware only lets the users in adminUserIDs through. Tokens do not say whether a user administers
+// the organization, so administration is limited to the users the service is configured with.
+func adminMiddleware(adminUserIDs []int) func(http.Handler) http.Handler {
+	admins := map[int]bool{}
+	for _, userID := range adminUserIDs {
+		admins[userID] = true
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID := int(r.Context().Value(authentication.UserIDKey).(float64))
+			if !admins[userID] {
+				apierror.TerminalHTTPError(r.Context(), w, apierror.APIError{Code: http.StatusForbidden, WrappedError: fmt.Errorf("user %d is not an administrator", userID)})
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
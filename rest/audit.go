@@ -0,0 +1,178 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/Kaese72/finding-registry/internal/application"
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
+	"github.com/Kaese72/finding-registry/rest/models"
+	"github.com/Kaese72/organization-registry/authentication"
+	"github.com/Kaese72/riskie-lib/apierror"
+	"github.com/gorilla/mux"
+)
+
+// RequestIDHeader identifies a request in the audit log. It is generated when the client does not set it,
+// and returned in the response either way.
+const RequestIDHeader = "X-Request-Id"
+
+// auditActorMiddleware attributes the changes of a request to the request for the audit log. The user is taken
+// from the token by the application. The source IP is the address the request was received from, which is the
+// address of the proxy when running behind one.
+func auditActorMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(RequestIDHeader)
+		if requestID == "" {
+			requestID = intermediaries.NewEventID()
+		}
+		w.Header().Set(RequestIDHeader, requestID)
+		sourceIP, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			sourceIP = r.RemoteAddr
+		}
+		ctx := application.WithAuditActor(r.Context(), intermediaries.AuditActor{RequestId: requestID, SourceIP: sourceIP})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// auditFilterFromQuery reads the criteria of searching the audit log from the query parameters
+func auditFilterFromQuery(query url.Values) (intermediaries.AuditFilter, error) {
+	filter := intermediaries.AuditFilter{FindingIdentifier: query.Get("findingId")}
+	if userID := query.Get("userId"); userID != "" {
+		var err error
+		if filter.UserId, err = strconv.Atoi(userID); err != nil {
+			return intermediaries.AuditFilter{}, apierror.APIError{Code: http.StatusBadRequest, WrappedError: fmt.Errorf("invalid userId: %s", userID)}
+		}
+	}
+	for _, action := range query["action"] {
+		if err := intermediaries.AuditAction(action).Validate(); err != nil {
+			return intermediaries.AuditFilter{}, err
+		}
+		filter.Actions = append(filter.Actions, intermediaries.AuditAction(action))
+	}
+	if since := query.Get("since"); since != "" {
+		parsed, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			return intermediaries.AuditFilter{}, apierror.APIError{Code: http.StatusBadRequest, WrappedError: fmt.Errorf("invalid since: %s", err.Error())}
+		}
+		filter.Since = parsed
+	}
+	if until := query.Get("until"); until != "" {
+		parsed, err := time.Parse(time.RFC3339, until)
+		if err != nil {
+			return intermediaries.AuditFilter{}, apierror.APIError{Code: http.StatusBadRequest, WrappedError: fmt.Errorf("invalid until: %s", err.Error())}
+		}
+		filter.Until = parsed
+	}
+	return filter, nil
+}
+
+const (
+	// defaultAuditEntriesLimit and maxAuditEntriesLimit bound the entries listed on a page of the audit log
+	defaultAuditEntriesLimit = 100
+	maxAuditEntriesLimit     = 1000
+)
+
+// auditPageFromQuery reads the sequence the page of the audit log starts after, and the limit of the page
+func auditPageFromQuery(query url.Values) (int, int, error) {
+	after, limit := 0, defaultAuditEntriesLimit
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxAuditEntriesLimit {
+			return 0, 0, apierror.APIError{Code: http.StatusBadRequest, WrappedError: fmt.Errorf("limit must be between 1 and %d", maxAuditEntriesLimit)}
+		}
+		limit = parsed
+	}
+	if value := query.Get("after"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			return 0, 0, apierror.APIError{Code: http.StatusBadRequest, WrappedError: fmt.Errorf("invalid after: %s", value)}
+		}
+		after = parsed
+	}
+	return after, limit, nil
+}
+
+// encodeAuditEntries writes a page of the audit log. A full page links to the next page with a Link header,
+// which keeps the other query parameters of the request.
+func encodeAuditEntries(w http.ResponseWriter, r *http.Request, entries []intermediaries.AuditEntry, limit int) {
+	if len(entries) == limit {
+		next := r.URL.Query()
+		next.Set("limit", strconv.Itoa(limit))
+		next.Set("after", strconv.Itoa(entries[len(entries)-1].Sequence))
+		w.Header().Set("Link", fmt.Sprintf(`<%s?%s>; rel="next"`, r.URL.Path, next.Encode()))
+	}
+	result := []models.AuditEntry{}
+	for index := range entries {
+		result = append(result, models.AuditEntryFromIntermediary(entries[index]))
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "   ")
+	err := encoder.Encode(result)
+	if err != nil {
+		apierror.TerminalHTTPError(r.Context(), w, err)
+		return
+	}
+}
+
+func (appMux restApplicationMux) findingAuditGetHandler(w http.ResponseWriter, r *http.Request) {
+	organizationID := int(r.Context().Value(authentication.OrganizationIDKey).(float64))
+	identifier, ok := mux.Vars(r)["identifier"]
+	if !ok {
+		apierror.TerminalHTTPError(r.Context(), w, apierror.APIError{Code: http.StatusBadRequest, WrappedError: errors.New("missing identifier")})
+		return
+	}
+	after, limit, err := auditPageFromQuery(r.URL.Query())
+	if err != nil {
+		apierror.TerminalHTTPError(r.Context(), w, err)
+		return
+	}
+	entries, err := appMux.application.ReadFindingAudit(r.Context(), identifier, organizationID, after, limit)
+	if err != nil {
+		apierror.TerminalHTTPError(r.Context(), w, err)
+		return
+	}
+	encodeAuditEntries(w, r, entries, limit)
+}
+
+func (appMux restApplicationMux) auditGetHandler(w http.ResponseWriter, r *http.Request) {
+	organizationID := int(r.Context().Value(authentication.OrganizationIDKey).(float64))
+	filter, err := auditFilterFromQuery(r.URL.Query())
+	if err != nil {
+		apierror.TerminalHTTPError(r.Context(), w, err)
+		return
+	}
+	after, limit, err := auditPageFromQuery(r.URL.Query())
+	if err != nil {
+		apierror.TerminalHTTPError(r.Context(), w, err)
+		return
+	}
+	entries, err := appMux.application.ReadAuditEntries(r.Context(), organizationID, filter, after, limit)
+	if err != nil {
+		apierror.TerminalHTTPError(r.Context(), w, err)
+		return
+	}
+	encodeAuditEntries(w, r, entries, limit)
+}
+
+func (appMux restApplicationMux) auditVerifyGetHandler(w http.ResponseWriter, r *http.Request) {
+	organizationID := int(r.Context().Value(authentication.OrganizationIDKey).(float64))
+	verification, err := appMux.application.VerifyAudit(r.Context(), organizationID)
+	if err != nil {
+		apierror.TerminalHTTPError(r.Context(), w, err)
+		return
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "   ")
+	err = encoder.Encode(models.AuditVerificationFromIntermediary(verification))
+	if err != nil {
+		apierror.TerminalHTTPError(r.Context(), w, err)
+		return
+	}
+}
@@ -0,0 +1,99 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Kaese72/finding-registry/rest/models"
+	"github.com/Kaese72/organization-registry/authentication"
+	"github.com/Kaese72/riskie-lib/apierror"
+	"github.com/gorilla/mux"
+)
+
+func (appMux restApplicationMux) distinguisherAliasesGetHandler(w http.ResponseWriter, r *http.Request) {
+	organizationID := int(r.Context().Value(authentication.OrganizationIDKey).(float64))
+	aliases, err := appMux.application.ReadDistinguisherAliases(r.Context(), organizationID)
+	if err != nil {
+		apierror.TerminalHTTPError(r.Context(), w, err)
+		return
+	}
+	result := []models.DistinguisherAlias{}
+	for index := range aliases {
+		result = append(result, models.DistinguisherAliasFromIntermediary(aliases[index]))
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "   ")
+	err = encoder.Encode(result)
+	if err != nil {
+		apierror.TerminalHTTPError(r.Context(), w, err)
+		return
+	}
+}
+
+func (appMux restApplicationMux) distinguisherAliasPutHandler(w http.ResponseWriter, r *http.Request) {
+	organizationID := int(r.Context().Value(authentication.OrganizationIDKey).(float64))
+	alias, ok := mux.Vars(r)["alias"]
+	if !ok {
+		apierror.TerminalHTTPError(r.Context(), w, apierror.APIError{Code: http.StatusBadRequest, WrappedError: errors.New("missing alias")})
+		return
+	}
+	inputAlias := models.DistinguisherAlias{}
+	err := json.NewDecoder(r.Body).Decode(&inputAlias)
+	if err != nil {
+		apierror.TerminalHTTPError(r.Context(), w, apierror.APIError{Code: http.StatusBadRequest, WrappedError: fmt.Errorf("error decoding request: %s", err.Error())})
+		return
+	}
+	// The alias in the path always takes precedence
+	inputAlias.Alias = alias
+	resAlias, err := appMux.application.PutDistinguisherAlias(r.Context(), inputAlias.ToIntermediary(), organizationID)
+	if err != nil {
+		apierror.TerminalHTTPError(r.Context(), w, err)
+		return
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "   ")
+	err = encoder.Encode(models.DistinguisherAliasFromIntermediary(resAlias))
+	if err != nil {
+		apierror.TerminalHTTPError(r.Context(), w, err)
+		return
+	}
+}
+
+func (appMux restApplicationMux) distinguisherAliasDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	organizationID := int(r.Context().Value(authentication.OrganizationIDKey).(float64))
+	alias, ok := mux.Vars(r)["alias"]
+	if !ok {
+		apierror.TerminalHTTPError(r.Context(), w, apierror.APIError{Code: http.StatusBadRequest, WrappedError: errors.New("missing alias")})
+		return
+	}
+	err := appMux.application.DeleteDistinguisherAlias(r.Context(), alias, organizationID)
+	if err != nil {
+		apierror.TerminalHTTPError(r.Context(), w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (appMux restApplicationMux) distinguisherMergePostHandler(w http.ResponseWriter, r *http.Request) {
+	organizationID := int(r.Context().Value(authentication.OrganizationIDKey).(float64))
+	request := models.DistinguisherMergeRequest{}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		apierror.TerminalHTTPError(r.Context(), w, apierror.APIError{Code: http.StatusBadRequest, WrappedError: fmt.Errorf("error decoding request: %s", err.Error())})
+		return
+	}
+	merge, err := appMux.application.MergeDistinguishers(r.Context(), request.From, request.Into, organizationID)
+	if err != nil {
+		apierror.TerminalHTTPError(r.Context(), w, err)
+		return
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "   ")
+	err = encoder.Encode(models.DistinguisherMergeFromIntermediary(merge))
+	if err != nil {
+		apierror.TerminalHTTPError(r.Context(), w, err)
+		return
+	}
+}
@@ -0,0 +1,50 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Kaese72/finding-registry/event"
+	"github.com/Kaese72/finding-registry/rest/models"
+	"github.com/Kaese72/riskie-lib/apierror"
+	"github.com/gorilla/mux"
+)
+
+func (appMux restApplicationMux) eventSchemasGetHandler(w http.ResponseWriter, r *http.Request) {
+	result := []models.EventType{}
+	for _, eventType := range appMux.application.ReadEventTypes(r.Context()) {
+		result = append(result, models.EventType{
+			Type:          string(eventType),
+			SchemaVersion: event.SchemaVersion,
+			Schema:        fmt.Sprintf("/finding-registry/event-schemas/%s", eventType),
+		})
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "   ")
+	err := encoder.Encode(result)
+	if err != nil {
+		apierror.TerminalHTTPError(r.Context(), w, err)
+		return
+	}
+}
+
+func (appMux restApplicationMux) eventSchemaGetHandler(w http.ResponseWriter, r *http.Request) {
+	eventType, ok := mux.Vars(r)["type"]
+	if !ok {
+		apierror.TerminalHTTPError(r.Context(), w, apierror.APIError{Code: http.StatusBadRequest, WrappedError: errors.New("missing type")})
+		return
+	}
+	schema, err := appMux.application.ReadEventSchema(r.Context(), event.EventType(eventType))
+	if err != nil {
+		apierror.TerminalHTTPError(r.Context(), w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/schema+json")
+	_, err = w.Write(schema)
+	if err != nil {
+		apierror.TerminalHTTPError(r.Context(), w, err)
+		return
+	}
+}
@@ -0,0 +1,51 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/Kaese72/finding-registry/rest/models"
+	"github.com/Kaese72/organization-registry/authentication"
+	"github.com/Kaese72/riskie-lib/apierror"
+	"github.com/Kaese72/riskie-lib/logging"
+)
+
+// maxImportBytes bounds the size of an imported export, which is read a finding at a time
+const maxImportBytes = 1024 * 1024 * 1024
+
+// exportGetHandler streams every finding of the organization, with its audit history, as newline delimited JSON
+func (appMux restApplicationMux) exportGetHandler(w http.ResponseWriter, r *http.Request) {
+	organizationID := int(r.Context().Value(authentication.OrganizationIDKey).(float64))
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	writer := models.NewExportWriter(w)
+	if err := appMux.application.ExportFindings(r.Context(), organizationID, writer); err != nil {
+		if writer.Written() == 0 {
+			apierror.TerminalHTTPError(r.Context(), w, err)
+			return
+		}
+		// The export has been partly written, so the client is left to notice it was cut short
+		logging.Error(r.Context(), "Failed to write export", map[string]interface{}{"error": err.Error()})
+	}
+}
+
+// importPostHandler restores the findings of an export into the organization
+func (appMux restApplicationMux) importPostHandler(w http.ResponseWriter, r *http.Request) {
+	organizationID := int(r.Context().Value(authentication.OrganizationIDKey).(float64))
+	reader, err := models.NewExportReader(http.MaxBytesReader(w, r.Body, maxImportBytes))
+	if err != nil {
+		apierror.TerminalHTTPError(r.Context(), w, err)
+		return
+	}
+	result, err := appMux.application.ImportFindings(r.Context(), reader, organizationID)
+	if err != nil {
+		apierror.TerminalHTTPError(r.Context(), w, err)
+		return
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "   ")
+	err = encoder.Encode(models.FindingImportFromIntermediary(result))
+	if err != nil {
+		apierror.TerminalHTTPError(r.Context(), w, err)
+		return
+	}
+}
@@ -0,0 +1,83 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
+)
+
+type AuditActor struct {
+	// UserId is 0 for changes made by the service itself, like enforcing retention policies
+	UserId    int    `json:"userId"`
+	RequestId string `json:"requestId,omitempty"`
+	SourceIP  string `json:"sourceIP,omitempty"`
+}
+
+type AuditChange struct {
+	Field string `json:"field"`
+	// Before and After are null when the finding did not exist before or after the change
+	Before json.RawMessage `json:"before"`
+	After  json.RawMessage `json:"after"`
+}
+
+type AuditEntry struct {
+	Sequence          int           `json:"sequence"`
+	FindingIdentifier string        `json:"findingId"`
+	Action            string        `json:"action"`
+	Actor             AuditActor    `json:"actor"`
+	Changes           []AuditChange `json:"changes"`
+	CreatedAt         time.Time     `json:"createdAt"`
+	PreviousHash      string        `json:"previousHash"`
+	Hash              string        `json:"hash"`
+}
+
+// auditValue is the JSON encoded value of an audit change, which is null if there was no value
+func auditValue(encoded string) json.RawMessage {
+	if encoded == "" {
+		return json.RawMessage("null")
+	}
+	return json.RawMessage(encoded)
+}
+
+func AuditEntryFromIntermediary(intermediary intermediaries.AuditEntry) AuditEntry {
+	changes := []AuditChange{}
+	for _, change := range intermediary.Changes {
+		changes = append(changes, AuditChange{
+			Field:  change.Field,
+			Before: auditValue(change.Before),
+			After:  auditValue(change.After),
+		})
+	}
+	return AuditEntry{
+		Sequence:          intermediary.Sequence,
+		FindingIdentifier: intermediary.FindingIdentifier,
+		Action:            string(intermediary.Action),
+		Actor: AuditActor{
+			UserId:    intermediary.Actor.UserId,
+			RequestId: intermediary.Actor.RequestId,
+			SourceIP:  intermediary.Actor.SourceIP,
+		},
+		Changes:      changes,
+		CreatedAt:    intermediary.CreatedAt,
+		PreviousHash: intermediary.PreviousHash,
+		Hash:         intermediary.Hash,
+	}
+}
+
+type AuditVerification struct {
+	Valid   bool `json:"valid"`
+	Entries int  `json:"entries"`
+	// BrokenAt is the sequence of the first entry that does not belong in the chain
+	BrokenAt int    `json:"brokenAt,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+func AuditVerificationFromIntermediary(intermediary intermediaries.AuditVerification) AuditVerification {
+	return AuditVerification{
+		Valid:    intermediary.Valid(),
+		Entries:  intermediary.Entries,
+		BrokenAt: intermediary.BrokenAt,
+		Reason:   intermediary.Reason,
+	}
+}
@@ -0,0 +1,43 @@
+package models
+
+import "github.com/Kaese72/finding-registry/internal/intermediaries"
+
+type DistinguisherAlias struct {
+	Alias         string `json:"alias"`
+	Distinguisher string `json:"distinguisher"`
+}
+
+func (alias DistinguisherAlias) ToIntermediary() intermediaries.DistinguisherAlias {
+	return intermediaries.DistinguisherAlias{
+		Alias:         alias.Alias,
+		Distinguisher: alias.Distinguisher,
+	}
+}
+
+func DistinguisherAliasFromIntermediary(intermediary intermediaries.DistinguisherAlias) DistinguisherAlias {
+	return DistinguisherAlias{
+		Alias:         intermediary.Alias,
+		Distinguisher: intermediary.Distinguisher,
+	}
+}
+
+type DistinguisherMergeRequest struct {
+	From string `json:"from"`
+	Into string `json:"into"`
+}
+
+type DistinguisherMerge struct {
+	From         string `json:"from"`
+	Into         string `json:"into"`
+	Rekeyed      int    `json:"rekeyed"`
+	Deduplicated int    `json:"deduplicated"`
+}
+
+func DistinguisherMergeFromIntermediary(intermediary intermediaries.DistinguisherMerge) DistinguisherMerge {
+	return DistinguisherMerge{
+		From:         intermediary.From,
+		Into:         intermediary.Into,
+		Rekeyed:      intermediary.Rekeyed,
+		Deduplicated: intermediary.Deduplicated,
+	}
+}
@@ -0,0 +1,8 @@
+package models
+
+type EventType struct {
+	Type          string `json:"type"`
+	SchemaVersion int    `json:"schemaVersion"`
+	// Schema is the path of the JSON Schema document describing the event type
+	Schema string `json:"schema"`
+}
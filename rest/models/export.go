@@ -0,0 +1,252 @@
+package models
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
+	"github.com/Kaese72/riskie-lib/apierror"
+)
+
+// ExportFormat identifies the first line of an export, so that other files are not mistaken for one
+const ExportFormat = "finding-registry-export"
+
+type ExportHeader struct {
+	Format         string    `json:"format"`
+	Version        int       `json:"version"`
+	OrganizationId int       `json:"organizationId"`
+	ExportedAt     time.Time `json:"exportedAt"`
+}
+
+func (header ExportHeader) ToIntermediary() intermediaries.ExportHeader {
+	return intermediaries.ExportHeader{
+		Version:        header.Version,
+		OrganizationId: header.OrganizationId,
+		ExportedAt:     header.ExportedAt,
+	}
+}
+
+func ExportHeaderFromIntermediary(intermediary intermediaries.ExportHeader) ExportHeader {
+	return ExportHeader{
+		Format:         ExportFormat,
+		Version:        intermediary.Version,
+		OrganizationId: intermediary.OrganizationId,
+		ExportedAt:     intermediary.ExportedAt,
+	}
+}
+
+// ExportedAuditChange is a change as exported, where a value is left out when the finding did not exist rather
+// than being null like in the audit log, since a field may have been null and the entries must still match their hash
+type ExportedAuditChange struct {
+	Field  string          `json:"field"`
+	Before json.RawMessage `json:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty"`
+}
+
+// ExportedAuditEntry is an audit entry as exported, with the changes as exported in place of those of the entry
+type ExportedAuditEntry struct {
+	AuditEntry
+	Changes []ExportedAuditChange `json:"changes"`
+}
+
+// toIntermediary converts an audit entry of the organization, which the entry is hashed together with
+func (entry ExportedAuditEntry) toIntermediary(organizationID int) intermediaries.AuditEntry {
+	changes := []intermediaries.AuditChange{}
+	for _, change := range entry.Changes {
+		changes = append(changes, intermediaries.AuditChange{
+			Field:  change.Field,
+			Before: string(change.Before),
+			After:  string(change.After),
+		})
+	}
+	return intermediaries.AuditEntry{
+		OrganizationId:    organizationID,
+		Sequence:          entry.Sequence,
+		FindingIdentifier: entry.FindingIdentifier,
+		Action:            intermediaries.AuditAction(entry.Action),
+		Actor: intermediaries.AuditActor{
+			UserId:    entry.Actor.UserId,
+			RequestId: entry.Actor.RequestId,
+			SourceIP:  entry.Actor.SourceIP,
+		},
+		Changes:      changes,
+		CreatedAt:    entry.CreatedAt,
+		PreviousHash: entry.PreviousHash,
+		Hash:         entry.Hash,
+	}
+}
+
+func ExportedAuditEntryFromIntermediary(intermediary intermediaries.AuditEntry) ExportedAuditEntry {
+	changes := []ExportedAuditChange{}
+	for _, change := range intermediary.Changes {
+		changes = append(changes, ExportedAuditChange{
+			Field:  change.Field,
+			Before: json.RawMessage(change.Before),
+			After:  json.RawMessage(change.After),
+		})
+	}
+	entry := AuditEntryFromIntermediary(intermediary)
+	entry.Changes = nil
+	return ExportedAuditEntry{AuditEntry: entry, Changes: changes}
+}
+
+// ExportedFinding is a finding as exported, where unlike on input every field of the finding is kept
+type ExportedFinding struct {
+	Finding Finding              `json:"finding"`
+	History []ExportedAuditEntry `json:"history"`
+}
+
+// toIntermediary converts a finding exported from the organization
+func (exported ExportedFinding) toIntermediary(organizationID int) intermediaries.ExportedFinding {
+	finding := exported.Finding.ToIntermediary()
+	finding.Owner = exported.Finding.Owner.toIntermediary()
+	finding.Status = intermediaries.FindingStatus(exported.Finding.Status)
+	finding.CreatedAt = exported.Finding.CreatedAt
+	finding.UpdatedAt = exported.Finding.UpdatedAt
+	finding.Version = exported.Finding.Version
+	finding.DeletedAt = exported.Finding.DeletedAt
+	finding.DeletedBy = exported.Finding.DeletedBy
+	finding.ArchivedAt = exported.Finding.ArchivedAt
+	history := []intermediaries.AuditEntry{}
+	for index := range exported.History {
+		history = append(history, exported.History[index].toIntermediary(organizationID))
+	}
+	return intermediaries.ExportedFinding{Finding: finding, History: history}
+}
+
+func ExportedFindingFromIntermediary(intermediary intermediaries.ExportedFinding) ExportedFinding {
+	history := []ExportedAuditEntry{}
+	for index := range intermediary.History {
+		history = append(history, ExportedAuditEntryFromIntermediary(intermediary.History[index]))
+	}
+	return ExportedFinding{Finding: FindingFromIntermediary(intermediary.Finding), History: history}
+}
+
+// ExportWriter writes an export as newline delimited JSON, the header first and then a line per finding.
+// The writer is flushed after every line if it can be.
+type ExportWriter struct {
+	encoder *json.Encoder
+	flusher http.Flusher
+	written int
+}
+
+func NewExportWriter(w io.Writer) *ExportWriter {
+	flusher, _ := w.(http.Flusher)
+	return &ExportWriter{encoder: json.NewEncoder(w), flusher: flusher}
+}
+
+func (writer *ExportWriter) WriteHeader(header intermediaries.ExportHeader) error {
+	return writer.writeLine(ExportHeaderFromIntermediary(header))
+}
+
+func (writer *ExportWriter) WriteFinding(exported intermediaries.ExportedFinding) error {
+	return writer.writeLine(ExportedFindingFromIntermediary(exported))
+}
+
+func (writer *ExportWriter) writeLine(line interface{}) error {
+	if err := writer.encoder.Encode(line); err != nil {
+		return err
+	}
+	writer.written++
+	if writer.flusher != nil {
+		writer.flusher.Flush()
+	}
+	return nil
+}
+
+// Written is the number of lines written, the header included
+func (writer *ExportWriter) Written() int {
+	return writer.written
+}
+
+// maxExportLineBytes is the length of the longest line read, since a line holds a finding with its whole history
+const maxExportLineBytes = 16 * 1024 * 1024
+
+// ExportReader reads an export written by ExportWriter a finding at a time. Only the format is checked,
+// the contents are validated on import.
+type ExportReader struct {
+	scanner *bufio.Scanner
+	header  intermediaries.ExportHeader
+	line    int
+}
+
+// NewExportReader reads the header of the export
+func NewExportReader(r io.Reader) (*ExportReader, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxExportLineBytes)
+	reader := &ExportReader{scanner: scanner}
+	if !reader.scan() {
+		if err := reader.err(); err != nil {
+			return nil, err
+		}
+		return nil, apierror.APIError{Code: http.StatusBadRequest, WrappedError: fmt.Errorf("empty export")}
+	}
+	header := ExportHeader{}
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil || header.Format != ExportFormat {
+		return nil, apierror.APIError{Code: http.StatusBadRequest, WrappedError: fmt.Errorf("line %d is not an export header", reader.line)}
+	}
+	reader.header = header.ToIntermediary()
+	return reader, nil
+}
+
+func (reader *ExportReader) Header() intermediaries.ExportHeader {
+	return reader.header
+}
+
+// Next reads the next finding, or returns io.EOF after the last one
+func (reader *ExportReader) Next() (intermediaries.ExportedFinding, error) {
+	if !reader.scan() {
+		if err := reader.err(); err != nil {
+			return intermediaries.ExportedFinding{}, err
+		}
+		return intermediaries.ExportedFinding{}, io.EOF
+	}
+	exported := ExportedFinding{}
+	if err := json.Unmarshal(reader.scanner.Bytes(), &exported); err != nil {
+		return intermediaries.ExportedFinding{}, apierror.APIError{Code: http.StatusBadRequest, WrappedError: fmt.Errorf("error decoding line %d: %s", reader.line, err.Error())}
+	}
+	return exported.toIntermediary(reader.header.OrganizationId), nil
+}
+
+// scan moves to the next line that is not empty
+func (reader *ExportReader) scan() bool {
+	for reader.scanner.Scan() {
+		reader.line++
+		if len(reader.scanner.Bytes()) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// err is the error that stopped reading, if any, where a line or body that is too long is too large to import
+func (reader *ExportReader) err() error {
+	err := reader.scanner.Err()
+	if err == nil {
+		return nil
+	}
+	var maxBytesErr *http.MaxBytesError
+	if errors.Is(err, bufio.ErrTooLong) || errors.As(err, &maxBytesErr) {
+		return apierror.APIError{Code: http.StatusRequestEntityTooLarge, WrappedError: fmt.Errorf("error reading line %d: %s", reader.line+1, err.Error())}
+	}
+	return apierror.APIError{Code: http.StatusBadRequest, WrappedError: fmt.Errorf("error reading export: %s", err.Error())}
+}
+
+type FindingImport struct {
+	Created   int `json:"created"`
+	Updated   int `json:"updated"`
+	Unchanged int `json:"unchanged"`
+}
+
+func FindingImportFromIntermediary(intermediary intermediaries.FindingImport) FindingImport {
+	return FindingImport{
+		Created:   intermediary.Created,
+		Updated:   intermediary.Updated,
+		Unchanged: intermediary.Unchanged,
+	}
+}
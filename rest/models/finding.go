@@ -1,11 +1,17 @@
 package models
 
-import "github.com/Kaese72/finding-registry/internal/intermediaries"
+import (
+	"time"
+
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
+)
 
 type ReportLocator struct {
 	Type          string `json:"type"`
 	Value         string `json:"value"`
 	Distinguisher string `json:"distinguisher"`
+	// Vendor is only informational and is ignored on input
+	Vendor string `json:"vendor,omitempty"`
 }
 
 func (locator ReportLocator) toIntermediary() intermediaries.ReportLocator {
@@ -17,11 +23,15 @@ func (locator ReportLocator) toIntermediary() intermediaries.ReportLocator {
 }
 
 func ReportLocatorFromIntermediary(intermediary intermediaries.ReportLocator) ReportLocator {
-	return ReportLocator{
+	locator := ReportLocator{
 		Type:          string(intermediary.Type),
 		Value:         intermediary.Value,
 		Distinguisher: intermediary.Distinguisher,
 	}
+	if intermediary.Type == intermediaries.MAC {
+		locator.Vendor, _ = intermediaries.MACVendor(intermediary.Value)
+	}
+	return locator
 }
 
 type ReportDistinguisher struct {
@@ -43,6 +53,25 @@ func ReportDistinguisherFromIntermediary(intermediary intermediaries.ReportDisti
 	}
 }
 
+type Owner struct {
+	Team    string `json:"team"`
+	Contact string `json:"contact"`
+}
+
+func (owner Owner) toIntermediary() intermediaries.Owner {
+	return intermediaries.Owner{
+		Team:    owner.Team,
+		Contact: owner.Contact,
+	}
+}
+
+func OwnerFromIntermediary(intermediary intermediaries.Owner) Owner {
+	return Owner{
+		Team:    intermediary.Team,
+		Contact: intermediary.Contact,
+	}
+}
+
 type Finding struct {
 	Identifier            string              `json:"identifier"`
 	Name                  string              `json:"name"`
@@ -50,6 +79,26 @@ type Finding struct {
 	ReportDistinguisher   ReportDistinguisher `json:"reportDistinguisher"`
 	ReportLocator         ReportLocator       `json:"reportLocator"`
 	ImpliedReportLocators []ReportLocator     `json:"impliedReportLocators"`
+	// Owner is assigned by ownership rules and is ignored on input
+	Owner Owner `json:"owner"`
+	// Severity is optional, and one of info, low, medium, high and critical
+	Severity string `json:"severity"`
+	// Status is changed through the status endpoint and is ignored on input, like the timestamps
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	// Version is incremented on every change, is returned as the ETag of the finding, and is ignored on input
+	Version int `json:"version"`
+	// DeletedAt and DeletedBy are only set on deleted findings, which are listed with the deleted filter
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+	DeletedBy int        `json:"deletedBy,omitempty"`
+	// Archived is set on findings moved to the archive, which are listed with the includeArchived filter
+	Archived   bool       `json:"archived"`
+	ArchivedAt *time.Time `json:"archivedAt,omitempty"`
+}
+
+type FindingStatusUpdate struct {
+	Status string `json:"status"`
 }
 
 func (finding Finding) ToIntermediary() intermediaries.Finding {
@@ -64,6 +113,7 @@ func (finding Finding) ToIntermediary() intermediaries.Finding {
 		ReportDistinguisher:   finding.ReportDistinguisher.toIntermediary(),
 		ReportLocator:         finding.ReportLocator.toIntermediary(),
 		ImpliedReportLocators: implied,
+		Severity:              intermediaries.Severity(finding.Severity),
 	}
 }
 
@@ -79,5 +129,15 @@ func FindingFromIntermediary(intermediary intermediaries.Finding) Finding {
 		ReportDistinguisher:   ReportDistinguisherFromIntermediary(intermediary.ReportDistinguisher),
 		ReportLocator:         ReportLocatorFromIntermediary(intermediary.ReportLocator),
 		ImpliedReportLocators: reportLocators,
+		Owner:                 OwnerFromIntermediary(intermediary.Owner),
+		Severity:              string(intermediary.Severity),
+		Status:                string(intermediary.Status),
+		CreatedAt:             intermediary.CreatedAt,
+		UpdatedAt:             intermediary.UpdatedAt,
+		Version:               intermediary.Version,
+		DeletedAt:             intermediary.DeletedAt,
+		DeletedBy:             intermediary.DeletedBy,
+		Archived:              intermediary.Archived(),
+		ArchivedAt:            intermediary.ArchivedAt,
 	}
 }
@@ -0,0 +1,19 @@
+package models
+
+import "github.com/Kaese72/finding-registry/internal/intermediaries"
+
+type LocatorType struct {
+	Type          string `json:"type"`
+	Format        string `json:"format"`
+	Example       string `json:"example"`
+	PatternFormat string `json:"patternFormat"`
+}
+
+func LocatorTypeFromIntermediary(intermediary intermediaries.LocatorType) LocatorType {
+	return LocatorType{
+		Type:          string(intermediary.Type),
+		Format:        intermediary.Format,
+		Example:       intermediary.Example,
+		PatternFormat: intermediary.PatternFormat,
+	}
+}
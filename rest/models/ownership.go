@@ -0,0 +1,64 @@
+package models
+
+import "github.com/Kaese72/finding-registry/internal/intermediaries"
+
+type LocatorPattern struct {
+	Type          string `json:"type"`
+	Value         string `json:"value"`
+	Distinguisher string `json:"distinguisher"`
+}
+
+func (pattern LocatorPattern) toIntermediary() intermediaries.LocatorPattern {
+	return intermediaries.LocatorPattern{
+		Type:          intermediaries.ReportLocatorType(pattern.Type),
+		Value:         pattern.Value,
+		Distinguisher: pattern.Distinguisher,
+	}
+}
+
+func LocatorPatternFromIntermediary(intermediary intermediaries.LocatorPattern) LocatorPattern {
+	return LocatorPattern{
+		Type:          string(intermediary.Type),
+		Value:         intermediary.Value,
+		Distinguisher: intermediary.Distinguisher,
+	}
+}
+
+type OwnershipRule struct {
+	Identifier         string           `json:"identifier"`
+	Name               string           `json:"name"`
+	Priority           int              `json:"priority"`
+	LocatorPatterns    []LocatorPattern `json:"locatorPatterns"`
+	DistinguisherTypes []string         `json:"distinguisherTypes"`
+	Owner              Owner            `json:"owner"`
+}
+
+func (rule OwnershipRule) ToIntermediary() intermediaries.OwnershipRule {
+	patterns := []intermediaries.LocatorPattern{}
+	for index := range rule.LocatorPatterns {
+		patterns = append(patterns, rule.LocatorPatterns[index].toIntermediary())
+	}
+	return intermediaries.OwnershipRule{
+		Identifier:         rule.Identifier,
+		Name:               rule.Name,
+		Priority:           rule.Priority,
+		LocatorPatterns:    patterns,
+		DistinguisherTypes: append([]string{}, rule.DistinguisherTypes...),
+		Owner:              rule.Owner.toIntermediary(),
+	}
+}
+
+func OwnershipRuleFromIntermediary(intermediary intermediaries.OwnershipRule) OwnershipRule {
+	patterns := []LocatorPattern{}
+	for index := range intermediary.LocatorPatterns {
+		patterns = append(patterns, LocatorPatternFromIntermediary(intermediary.LocatorPatterns[index]))
+	}
+	return OwnershipRule{
+		Identifier:         intermediary.Identifier,
+		Name:               intermediary.Name,
+		Priority:           intermediary.Priority,
+		LocatorPatterns:    patterns,
+		DistinguisherTypes: append([]string{}, intermediary.DistinguisherTypes...),
+		Owner:              OwnerFromIntermediary(intermediary.Owner),
+	}
+}
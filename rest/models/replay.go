@@ -0,0 +1,56 @@
+package models
+
+import (
+	"time"
+
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
+)
+
+type ReplayRequest struct {
+	LocatorTypes []string   `json:"locatorTypes"`
+	UpdatedSince *time.Time `json:"updatedSince"`
+	// Rate is the number of events republished per second
+	Rate int `json:"rate"`
+}
+
+func (request ReplayRequest) ToIntermediaryFilter() intermediaries.FindingFilter {
+	filter := intermediaries.FindingFilter{}
+	for _, locatorType := range request.LocatorTypes {
+		filter.LocatorTypes = append(filter.LocatorTypes, intermediaries.ReportLocatorType(locatorType))
+	}
+	if request.UpdatedSince != nil {
+		filter.UpdatedSince = *request.UpdatedSince
+	}
+	return filter
+}
+
+type ReplayProgress struct {
+	Total     int  `json:"total"`
+	Published int  `json:"published"`
+	Done      bool `json:"done"`
+	// Error is set when the replay stopped before it was done
+	Error string `json:"error,omitempty"`
+}
+
+func ReplayProgressFromIntermediary(intermediary intermediaries.ReplayProgress) ReplayProgress {
+	return ReplayProgress{
+		Total:     intermediary.Total,
+		Published: intermediary.Published,
+		Done:      intermediary.Done,
+		Error:     intermediary.Error,
+	}
+}
+
+type Replay struct {
+	Identifier string    `json:"identifier"`
+	StartedAt  time.Time `json:"startedAt"`
+	ReplayProgress
+}
+
+func ReplayFromIntermediary(intermediary intermediaries.Replay) Replay {
+	return Replay{
+		Identifier:     intermediary.Identifier,
+		StartedAt:      intermediary.StartedAt,
+		ReplayProgress: ReplayProgressFromIntermediary(intermediary.Progress),
+	}
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
+)
+
+type RetentionPolicy struct {
+	// ResolvedDays is how long resolved findings are kept after they last changed, 0 keeps them forever
+	ResolvedDays int `json:"resolvedDays"`
+	// DeletedDays is how long deleted findings are kept before they are purged, 0 keeps them until purged by an admin
+	DeletedDays int `json:"deletedDays"`
+	// ArchiveDays is how long resolved findings are listed after they last changed, before they are archived,
+	// 0 never archives them. It must be less than ResolvedDays when both are set.
+	ArchiveDays int `json:"archiveDays"`
+}
+
+func (policy RetentionPolicy) ToIntermediary() intermediaries.RetentionPolicy {
+	return intermediaries.RetentionPolicy{
+		ResolvedDays: policy.ResolvedDays,
+		DeletedDays:  policy.DeletedDays,
+		ArchiveDays:  policy.ArchiveDays,
+	}
+}
+
+func RetentionPolicyFromIntermediary(intermediary intermediaries.RetentionPolicy) RetentionPolicy {
+	return RetentionPolicy{
+		ResolvedDays: intermediary.ResolvedDays,
+		DeletedDays:  intermediary.DeletedDays,
+		ArchiveDays:  intermediary.ArchiveDays,
+	}
+}
+
+type FindingPurgeRequest struct {
+	// DeletedBefore limits the purge to findings deleted before the time, every deleted finding if not set
+	DeletedBefore *time.Time `json:"deletedBefore"`
+}
+
+type FindingPurge struct {
+	Purged int `json:"purged"`
+}
+
+func FindingPurgeFromIntermediary(intermediary intermediaries.FindingPurge) FindingPurge {
+	return FindingPurge{
+		Purged: intermediary.Purged,
+	}
+}
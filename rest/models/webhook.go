@@ -0,0 +1,84 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
+)
+
+type WebhookSubscription struct {
+	Identifier string `json:"identifier"`
+	URL        string `json:"url"`
+	// Secret is only returned when the subscription is created, and is kept when left out on update
+	Secret     string   `json:"secret,omitempty"`
+	EventTypes []string `json:"eventTypes"`
+	// Enabled defaults to true when left out
+	Enabled             *bool     `json:"enabled"`
+	ConsecutiveFailures int       `json:"consecutiveFailures"`
+	CreatedAt           time.Time `json:"createdAt"`
+	UpdatedAt           time.Time `json:"updatedAt"`
+}
+
+func (subscription WebhookSubscription) ToIntermediary() intermediaries.WebhookSubscription {
+	enabled := true
+	if subscription.Enabled != nil {
+		enabled = *subscription.Enabled
+	}
+	return intermediaries.WebhookSubscription{
+		Identifier: subscription.Identifier,
+		URL:        subscription.URL,
+		Secret:     subscription.Secret,
+		EventTypes: append([]string{}, subscription.EventTypes...),
+		Enabled:    enabled,
+	}
+}
+
+// WebhookSubscriptionFromIntermediary converts the subscription, leaving out the secret
+func WebhookSubscriptionFromIntermediary(intermediary intermediaries.WebhookSubscription) WebhookSubscription {
+	enabled := intermediary.Enabled
+	return WebhookSubscription{
+		Identifier:          intermediary.Identifier,
+		URL:                 intermediary.URL,
+		EventTypes:          append([]string{}, intermediary.EventTypes...),
+		Enabled:             &enabled,
+		ConsecutiveFailures: intermediary.ConsecutiveFailures,
+		CreatedAt:           intermediary.CreatedAt,
+		UpdatedAt:           intermediary.UpdatedAt,
+	}
+}
+
+type WebhookDelivery struct {
+	Identifier     string          `json:"identifier"`
+	EventId        string          `json:"eventId"`
+	EventType      string          `json:"eventType"`
+	Event          json.RawMessage `json:"event"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  *time.Time      `json:"nextAttemptAt,omitempty"`
+	LastAttemptAt  *time.Time      `json:"lastAttemptAt,omitempty"`
+	LastStatusCode int             `json:"lastStatusCode,omitempty"`
+	LastError      string          `json:"lastError,omitempty"`
+	CreatedAt      time.Time       `json:"createdAt"`
+}
+
+func WebhookDeliveryFromIntermediary(intermediary intermediaries.WebhookDelivery) WebhookDelivery {
+	delivery := WebhookDelivery{
+		Identifier:     intermediary.Identifier,
+		EventId:        intermediary.EventId,
+		EventType:      intermediary.EventType,
+		Event:          json.RawMessage(intermediary.Payload),
+		Status:         string(intermediary.Status),
+		Attempts:       intermediary.Attempts,
+		LastAttemptAt:  intermediary.LastAttemptAt,
+		LastStatusCode: intermediary.LastStatusCode,
+		LastError:      intermediary.LastError,
+		CreatedAt:      intermediary.CreatedAt,
+	}
+	if intermediary.Status == intermediaries.DeliveryPending {
+		// The next attempt is only meaningful while the delivery is pending
+		nextAttemptAt := intermediary.NextAttemptAt
+		delivery.NextAttemptAt = &nextAttemptAt
+	}
+	return delivery
+}
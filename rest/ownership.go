@@ -0,0 +1,120 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Kaese72/finding-registry/rest/models"
+	"github.com/Kaese72/organization-registry/authentication"
+	"github.com/Kaese72/riskie-lib/apierror"
+	"github.com/gorilla/mux"
+)
+
+func (appMux restApplicationMux) ownershipRulesGetHandler(w http.ResponseWriter, r *http.Request) {
+	organizationID := int(r.Context().Value(authentication.OrganizationIDKey).(float64))
+	rules, err := appMux.application.ReadOwnershipRules(r.Context(), organizationID)
+	if err != nil {
+		apierror.TerminalHTTPError(r.Context(), w, err)
+		return
+	}
+	result := []models.OwnershipRule{}
+	for index := range rules {
+		result = append(result, models.OwnershipRuleFromIntermediary(rules[index]))
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "   ")
+	err = encoder.Encode(result)
+	if err != nil {
+		apierror.TerminalHTTPError(r.Context(), w, err)
+		return
+	}
+}
+
+func (appMux restApplicationMux) ownershipRulePostHandler(w http.ResponseWriter, r *http.Request) {
+	organizationID := int(r.Context().Value(authentication.OrganizationIDKey).(float64))
+	inputRule := models.OwnershipRule{}
+	err := json.NewDecoder(r.Body).Decode(&inputRule)
+	if err != nil {
+		apierror.TerminalHTTPError(r.Context(), w, apierror.APIError{Code: http.StatusBadRequest, WrappedError: fmt.Errorf("error decoding request: %s", err.Error())})
+		return
+	}
+	rule, err := appMux.application.PostOwnershipRule(r.Context(), inputRule.ToIntermediary(), organizationID)
+	if err != nil {
+		apierror.TerminalHTTPError(r.Context(), w, err)
+		return
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "   ")
+	err = encoder.Encode(models.OwnershipRuleFromIntermediary(rule))
+	if err != nil {
+		apierror.TerminalHTTPError(r.Context(), w, err)
+		return
+	}
+}
+
+func (appMux restApplicationMux) ownershipRuleGetHandler(w http.ResponseWriter, r *http.Request) {
+	organizationID := int(r.Context().Value(authentication.OrganizationIDKey).(float64))
+	identifier, ok := mux.Vars(r)["identifier"]
+	if !ok {
+		apierror.TerminalHTTPError(r.Context(), w, apierror.APIError{Code: http.StatusBadRequest, WrappedError: errors.New("missing identifier")})
+		return
+	}
+	rule, err := appMux.application.ReadOwnershipRule(r.Context(), identifier, organizationID)
+	if err != nil {
+		apierror.TerminalHTTPError(r.Context(), w, err)
+		return
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "   ")
+	err = encoder.Encode(models.OwnershipRuleFromIntermediary(rule))
+	if err != nil {
+		apierror.TerminalHTTPError(r.Context(), w, err)
+		return
+	}
+}
+
+func (appMux restApplicationMux) ownershipRulePutHandler(w http.ResponseWriter, r *http.Request) {
+	organizationID := int(r.Context().Value(authentication.OrganizationIDKey).(float64))
+	identifier, ok := mux.Vars(r)["identifier"]
+	if !ok {
+		apierror.TerminalHTTPError(r.Context(), w, apierror.APIError{Code: http.StatusBadRequest, WrappedError: errors.New("missing identifier")})
+		return
+	}
+	inputRule := models.OwnershipRule{}
+	err := json.NewDecoder(r.Body).Decode(&inputRule)
+	if err != nil {
+		apierror.TerminalHTTPError(r.Context(), w, apierror.APIError{Code: http.StatusBadRequest, WrappedError: fmt.Errorf("error decoding request: %s", err.Error())})
+		return
+	}
+	// The identifier in the path always takes precedence
+	inputRule.Identifier = identifier
+	rule, err := appMux.application.PutOwnershipRule(r.Context(), inputRule.ToIntermediary(), organizationID)
+	if err != nil {
+		apierror.TerminalHTTPError(r.Context(), w, err)
+		return
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "   ")
+	err = encoder.Encode(models.OwnershipRuleFromIntermediary(rule))
+	if err != nil {
+		apierror.TerminalHTTPError(r.Context(), w, err)
+		return
+	}
+}
+
+func (appMux restApplicationMux) ownershipRuleDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	organizationID := int(r.Context().Value(authentication.OrganizationIDKey).(float64))
+	identifier, ok := mux.Vars(r)["identifier"]
+	if !ok {
+		apierror.TerminalHTTPError(r.Context(), w, apierror.APIError{Code: http.StatusBadRequest, WrappedError: errors.New("missing identifier")})
+		return
+	}
+	err := appMux.application.DeleteOwnershipRule(r.Context(), identifier, organizationID)
+	if err != nil {
+		apierror.TerminalHTTPError(r.Context(), w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
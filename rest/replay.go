@@ -0,0 +1,75 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Kaese72/finding-registry/rest/models"
+	"github.com/Kaese72/organization-registry/authentication"
+	"github.com/Kaese72/riskie-lib/apierror"
+	"github.com/gorilla/mux"
+)
+
+// findingsReplayPostHandler starts republishing the findings of the organization in the background,
+// and responds with the replay to follow its progress with
+func (appMux restApplicationMux) findingsReplayPostHandler(w http.ResponseWriter, r *http.Request) {
+	organizationID := int(r.Context().Value(authentication.OrganizationIDKey).(float64))
+	request := models.ReplayRequest{}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		apierror.TerminalHTTPError(r.Context(), w, apierror.APIError{Code: http.StatusBadRequest, WrappedError: fmt.Errorf("error decoding request: %s", err.Error())})
+		return
+	}
+	replay, err := appMux.application.StartReplay(r.Context(), organizationID, request.ToIntermediaryFilter(), request.Rate)
+	if err != nil {
+		apierror.TerminalHTTPError(r.Context(), w, err)
+		return
+	}
+	w.Header().Set("Location", r.URL.Path+"/"+replay.Identifier)
+	w.WriteHeader(http.StatusAccepted)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "   ")
+	err = encoder.Encode(models.ReplayFromIntermediary(replay))
+	if err != nil {
+		apierror.TerminalHTTPError(r.Context(), w, err)
+		return
+	}
+}
+
+func (appMux restApplicationMux) findingsReplayGetHandler(w http.ResponseWriter, r *http.Request) {
+	organizationID := int(r.Context().Value(authentication.OrganizationIDKey).(float64))
+	identifier, ok := mux.Vars(r)["identifier"]
+	if !ok {
+		apierror.TerminalHTTPError(r.Context(), w, apierror.APIError{Code: http.StatusBadRequest, WrappedError: errors.New("missing identifier")})
+		return
+	}
+	replay, err := appMux.application.ReadReplay(r.Context(), identifier, organizationID)
+	if err != nil {
+		apierror.TerminalHTTPError(r.Context(), w, err)
+		return
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "   ")
+	err = encoder.Encode(models.ReplayFromIntermediary(replay))
+	if err != nil {
+		apierror.TerminalHTTPError(r.Context(), w, err)
+		return
+	}
+}
+
+func (appMux restApplicationMux) findingsReplayDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	organizationID := int(r.Context().Value(authentication.OrganizationIDKey).(float64))
+	identifier, ok := mux.Vars(r)["identifier"]
+	if !ok {
+		apierror.TerminalHTTPError(r.Context(), w, apierror.APIError{Code: http.StatusBadRequest, WrappedError: errors.New("missing identifier")})
+		return
+	}
+	err := appMux.application.CancelReplay(r.Context(), identifier, organizationID)
+	if err != nil {
+		apierror.TerminalHTTPError(r.Context(), w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
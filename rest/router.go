@@ -5,12 +5,17 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/Kaese72/organization-registry/authentication"
 	"github.com/Kaese72/riskie-lib/apierror"
 	"go.elastic.co/apm/module/apmgorilla/v2"
 
 	"github.com/Kaese72/finding-registry/internal/application"
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
 	"github.com/Kaese72/finding-registry/rest/models"
 	"github.com/gorilla/mux"
 )
@@ -32,18 +37,96 @@ func (appMux restApplicationMux) findingGetHandler(w http.ResponseWriter, r *htt
 		apierror.TerminalHTTPError(r.Context(), w, err)
 		return
 	}
+	w.Header().Set("ETag", findingETag(finding))
 	encoder := json.NewEncoder(w)
 	encoder.SetIndent("", "   ")
-	err = encoder.Encode(finding)
+	err = encoder.Encode(models.FindingFromIntermediary(finding))
 	if err != nil {
 		apierror.TerminalHTTPError(r.Context(), w, err)
 		return
 	}
 }
 
+// findingETag is the strong entity tag of a finding, which is its version
+func findingETag(finding intermediaries.Finding) string {
+	return strconv.Quote(strconv.Itoa(finding.Version))
+}
+
+// versionPreconditionFromIfMatch reads the versions a change expects the finding to be at from the If-Match header.
+// No header expects nothing, and * expects the finding to exist at any version.
+func versionPreconditionFromIfMatch(r *http.Request) (intermediaries.VersionPrecondition, error) {
+	ifMatch := strings.TrimSpace(r.Header.Get("If-Match"))
+	if ifMatch == "" {
+		return intermediaries.VersionPrecondition{}, nil
+	}
+	if ifMatch == "*" {
+		return intermediaries.VersionPrecondition{Exists: true}, nil
+	}
+	// A list of entity tags matches if any of them does. Findings only have strong entity tags,
+	// so weak ones never match, and neither does a list of tags that are not versions.
+	precondition := intermediaries.VersionPrecondition{}
+	for _, tag := range strings.Split(ifMatch, ",") {
+		tag = strings.TrimSpace(tag)
+		version, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(tag, `"`), `"`))
+		if err == nil && version >= 1 && tag == strconv.Quote(strconv.Itoa(version)) {
+			precondition.Versions = append(precondition.Versions, version)
+		}
+	}
+	if len(precondition.Versions) == 0 {
+		return intermediaries.VersionPrecondition{}, apierror.APIError{Code: http.StatusPreconditionFailed, WrappedError: fmt.Errorf("If-Match does not match any version: %s", ifMatch)}
+	}
+	return precondition, nil
+}
+
+// findingFilterFromQuery reads the filters of listing findings from the query parameters
+func findingFilterFromQuery(query url.Values) (intermediaries.FindingFilter, error) {
+	filter := intermediaries.FindingFilter{}
+	for _, rawPattern := range query["locatorPattern"] {
+		pattern, err := intermediaries.ParseLocatorPattern(rawPattern)
+		if err != nil {
+			return intermediaries.FindingFilter{}, err
+		}
+		filter.LocatorPatterns = append(filter.LocatorPatterns, pattern)
+	}
+	for _, locatorType := range query["locatorType"] {
+		filter.LocatorTypes = append(filter.LocatorTypes, intermediaries.ReportLocatorType(locatorType))
+	}
+	for _, severity := range query["severity"] {
+		if err := intermediaries.Severity(severity).Validate(); err != nil {
+			return intermediaries.FindingFilter{}, err
+		}
+		filter.Severities = append(filter.Severities, intermediaries.Severity(severity))
+	}
+	if updatedSince := query.Get("updatedSince"); updatedSince != "" {
+		since, err := time.Parse(time.RFC3339, updatedSince)
+		if err != nil {
+			return intermediaries.FindingFilter{}, apierror.APIError{Code: http.StatusBadRequest, WrappedError: fmt.Errorf("invalid updatedSince: %s", err.Error())}
+		}
+		filter.UpdatedSince = since
+	}
+	if deleted := query.Get("deleted"); deleted != "" {
+		var err error
+		if filter.Deleted, err = strconv.ParseBool(deleted); err != nil {
+			return intermediaries.FindingFilter{}, apierror.APIError{Code: http.StatusBadRequest, WrappedError: fmt.Errorf("invalid deleted: %s", deleted)}
+		}
+	}
+	if includeArchived := query.Get("includeArchived"); includeArchived != "" {
+		var err error
+		if filter.IncludeArchived, err = strconv.ParseBool(includeArchived); err != nil {
+			return intermediaries.FindingFilter{}, apierror.APIError{Code: http.StatusBadRequest, WrappedError: fmt.Errorf("invalid includeArchived: %s", includeArchived)}
+		}
+	}
+	return filter, nil
+}
+
 func (appMux restApplicationMux) findingsGetHandler(w http.ResponseWriter, r *http.Request) {
 	organizationId := int(r.Context().Value(authentication.OrganizationIDKey).(float64))
-	findings, err := appMux.application.ReadFindings(r.Context(), organizationId)
+	filter, err := findingFilterFromQuery(r.URL.Query())
+	if err != nil {
+		apierror.TerminalHTTPError(r.Context(), w, err)
+		return
+	}
+	findings, err := appMux.application.ReadFindings(r.Context(), organizationId, filter)
 	if err != nil {
 		apierror.TerminalHTTPError(r.Context(), w, err)
 		return
@@ -73,11 +156,17 @@ func (appMux restApplicationMux) findingsPostHandler(w http.ResponseWriter, r *h
 	// Reset Identifier, just to be sure
 	// FIXME should not be fixed here
 	inputFinding.Identifier = ""
-	findingR, err := appMux.application.PostFinding(r.Context(), inputFinding.ToIntermediary(), organizationID)
+	precondition, err := versionPreconditionFromIfMatch(r)
 	if err != nil {
 		apierror.TerminalHTTPError(r.Context(), w, err)
 		return
 	}
+	findingR, err := appMux.application.PostFinding(r.Context(), inputFinding.ToIntermediary(), precondition, organizationID)
+	if err != nil {
+		apierror.TerminalHTTPError(r.Context(), w, err)
+		return
+	}
+	w.Header().Set("ETag", findingETag(findingR))
 	encoder := json.NewEncoder(w)
 	encoder.SetIndent("", "   ")
 	err = encoder.Encode(models.FindingFromIntermediary(findingR))
@@ -87,13 +176,117 @@ func (appMux restApplicationMux) findingsPostHandler(w http.ResponseWriter, r *h
 	}
 }
 
-func InitMux(logic application.ApplicationLogic, jwtSecret string) *mux.Router {
-	router := mux.NewRouter().PathPrefix("/finding-registry").Subrouter()
-	apmgorilla.Instrument(router)
+func (appMux restApplicationMux) findingStatusPutHandler(w http.ResponseWriter, r *http.Request) {
+	organizationID := int(r.Context().Value(authentication.OrganizationIDKey).(float64))
+	identifier, ok := mux.Vars(r)["identifier"]
+	if !ok {
+		apierror.TerminalHTTPError(r.Context(), w, apierror.APIError{Code: http.StatusBadRequest, WrappedError: errors.New("missing identifier")})
+		return
+	}
+	precondition, err := versionPreconditionFromIfMatch(r)
+	if err != nil {
+		apierror.TerminalHTTPError(r.Context(), w, err)
+		return
+	}
+	statusUpdate := models.FindingStatusUpdate{}
+	err = json.NewDecoder(r.Body).Decode(&statusUpdate)
+	if err != nil {
+		apierror.TerminalHTTPError(r.Context(), w, apierror.APIError{Code: http.StatusBadRequest, WrappedError: fmt.Errorf("error decoding request: %s", err.Error())})
+		return
+	}
+	finding, err := appMux.application.UpdateFindingStatus(r.Context(), identifier, intermediaries.FindingStatus(statusUpdate.Status), precondition, organizationID)
+	if err != nil {
+		apierror.TerminalHTTPError(r.Context(), w, err)
+		return
+	}
+	w.Header().Set("ETag", findingETag(finding))
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "   ")
+	err = encoder.Encode(models.FindingFromIntermediary(finding))
+	if err != nil {
+		apierror.TerminalHTTPError(r.Context(), w, err)
+		return
+	}
+}
+
+func (appMux restApplicationMux) locatorTypesGetHandler(w http.ResponseWriter, r *http.Request) {
+	locatorTypes := appMux.application.ReadLocatorTypes(r.Context())
+	result := []models.LocatorType{}
+	for index := range locatorTypes {
+		result = append(result, models.LocatorTypeFromIntermediary(locatorTypes[index]))
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "   ")
+	err := encoder.Encode(result)
+	if err != nil {
+		apierror.TerminalHTTPError(r.Context(), w, err)
+		return
+	}
+}
+
+func (appMux restApplicationMux) healthGetHandler(w http.ResponseWriter, r *http.Request) {
+	err := appMux.application.Health(r.Context())
+	if err != nil {
+		apierror.TerminalHTTPError(r.Context(), w, apierror.APIError{Code: http.StatusServiceUnavailable, WrappedError: err})
+		return
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "   ")
+	err = encoder.Encode(map[string]string{"status": "ok"})
+	if err != nil {
+		apierror.TerminalHTTPError(r.Context(), w, err)
+		return
+	}
+}
+
+// InitMux routes the API. The administrative routes are only served to the users in adminUserIDs.
+func InitMux(logic application.ApplicationLogic, jwtSecret string, adminUserIDs []int) *mux.Router {
+	rootRouter := mux.NewRouter()
+	apmgorilla.Instrument(rootRouter)
 	appMux := restApplicationMux{application: logic}
+	// Health is checked by orchestration without credentials, and is registered outside of the authenticated routes
+	rootRouter.HandleFunc("/finding-registry/health", appMux.healthGetHandler).Methods(http.MethodGet)
+	router := rootRouter.PathPrefix("/finding-registry").Subrouter()
 	router.Use(authentication.DefaultJWTAuthentication(jwtSecret))
+	router.Use(auditActorMiddleware)
+	// The stream is registered before the findings, so that it is not taken for a finding identifier
+	router.HandleFunc("/findings/stream", appMux.findingsStreamGetHandler).Methods(http.MethodGet)
 	router.HandleFunc("/findings/{identifier}", appMux.findingGetHandler).Methods(http.MethodGet)
+	router.HandleFunc("/findings/{identifier}", appMux.findingDeleteHandler).Methods(http.MethodDelete)
+	router.HandleFunc("/findings/{identifier}/status", appMux.findingStatusPutHandler).Methods(http.MethodPut)
+	router.HandleFunc("/findings/{identifier}/audit", appMux.findingAuditGetHandler).Methods(http.MethodGet)
 	router.HandleFunc("/findings", appMux.findingsGetHandler).Methods(http.MethodGet)
 	router.HandleFunc("/findings", appMux.findingsPostHandler).Methods(http.MethodPost)
-	return router
+	router.HandleFunc("/locator-types", appMux.locatorTypesGetHandler).Methods(http.MethodGet)
+	router.HandleFunc("/ownership-rules/{identifier}", appMux.ownershipRuleGetHandler).Methods(http.MethodGet)
+	router.HandleFunc("/ownership-rules/{identifier}", appMux.ownershipRulePutHandler).Methods(http.MethodPut)
+	router.HandleFunc("/ownership-rules/{identifier}", appMux.ownershipRuleDeleteHandler).Methods(http.MethodDelete)
+	router.HandleFunc("/ownership-rules", appMux.ownershipRulesGetHandler).Methods(http.MethodGet)
+	router.HandleFunc("/ownership-rules", appMux.ownershipRulePostHandler).Methods(http.MethodPost)
+	router.HandleFunc("/distinguisher-aliases", appMux.distinguisherAliasesGetHandler).Methods(http.MethodGet)
+	router.HandleFunc("/distinguisher-aliases/{alias}", appMux.distinguisherAliasPutHandler).Methods(http.MethodPut)
+	router.HandleFunc("/distinguisher-aliases/{alias}", appMux.distinguisherAliasDeleteHandler).Methods(http.MethodDelete)
+	router.HandleFunc("/audit/verify", appMux.auditVerifyGetHandler).Methods(http.MethodGet)
+	router.HandleFunc("/audit", appMux.auditGetHandler).Methods(http.MethodGet)
+	router.HandleFunc("/retention-policy", appMux.retentionPolicyGetHandler).Methods(http.MethodGet)
+	router.HandleFunc("/webhooks/{identifier}/deliveries", appMux.webhookDeliveriesGetHandler).Methods(http.MethodGet)
+	router.HandleFunc("/webhooks/{identifier}", appMux.webhookGetHandler).Methods(http.MethodGet)
+	router.HandleFunc("/webhooks/{identifier}", appMux.webhookPutHandler).Methods(http.MethodPut)
+	router.HandleFunc("/webhooks/{identifier}", appMux.webhookDeleteHandler).Methods(http.MethodDelete)
+	router.HandleFunc("/webhooks", appMux.webhooksGetHandler).Methods(http.MethodGet)
+	router.HandleFunc("/webhooks", appMux.webhookPostHandler).Methods(http.MethodPost)
+	router.HandleFunc("/event-schemas", appMux.eventSchemasGetHandler).Methods(http.MethodGet)
+	router.HandleFunc("/event-schemas/{type}", appMux.eventSchemaGetHandler).Methods(http.MethodGet)
+	// Administrative routes act on the whole organization, and are only served to administrators
+	adminRouter := router.PathPrefix("/admin").Subrouter()
+	adminRouter.Use(adminMiddleware(adminUserIDs))
+	adminRouter.HandleFunc("/export", appMux.exportGetHandler).Methods(http.MethodGet)
+	adminRouter.HandleFunc("/import", appMux.importPostHandler).Methods(http.MethodPost)
+	adminRouter.HandleFunc("/distinguishers/merge", appMux.distinguisherMergePostHandler).Methods(http.MethodPost)
+	adminRouter.HandleFunc("/findings/purge", appMux.findingsPurgePostHandler).Methods(http.MethodPost)
+	adminRouter.HandleFunc("/findings/replay/{identifier}", appMux.findingsReplayGetHandler).Methods(http.MethodGet)
+	adminRouter.HandleFunc("/findings/replay/{identifier}", appMux.findingsReplayDeleteHandler).Methods(http.MethodDelete)
+	adminRouter.HandleFunc("/findings/replay", appMux.findingsReplayPostHandler).Methods(http.MethodPost)
+	adminRouter.HandleFunc("/retention-policy", appMux.retentionPolicyPutHandler).Methods(http.MethodPut)
+	return rootRouter
 }
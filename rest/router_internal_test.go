@@ -0,0 +1,749 @@
+package rest_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Kaese72/finding-registry/event"
+	"github.com/Kaese72/finding-registry/internal/application"
+	"github.com/Kaese72/finding-registry/internal/database"
+	"github.com/Kaese72/finding-registry/rest"
+	"github.com/Kaese72/finding-registry/rest/models"
+)
+
+const testSecret = "secret"
+
+// testAdmin is the user the test servers are administered by, and the user of testToken
+const testAdmin = 1
+
+// testToken signs a token for the administrator of the test servers
+func testToken(organizationID int) string {
+	return testUserToken(testAdmin, organizationID)
+}
+
+// testUserToken signs a token like the organization registry does
+func testUserToken(userID int, organizationID int) string {
+	encode := func(value interface{}) string {
+		encoded, _ := json.Marshal(value)
+		return base64.RawURLEncoding.EncodeToString(encoded)
+	}
+	unsigned := encode(map[string]string{"alg": "HS256", "typ": "JWT"}) + "." + encode(map[string]int{"userID": userID, "organizationID": organizationID})
+	mac := hmac.New(sha256.New, []byte(testSecret))
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func newServer(t *testing.T) *httptest.Server {
+	return newServerOn(t, database.NewMemoryFindingsPersistence())
+}
+
+// newServerOn serves the persistence, for tests that need to change it behind the application
+func newServerOn(t *testing.T, persistence database.Persistence) *httptest.Server {
+	publisher := event.NewMemoryPublisher(event.MemoryConfig{})
+	logic := application.NewApplicationLogic(persistence, publisher)
+	server := httptest.NewServer(rest.InitMux(logic, testSecret, []int{testAdmin}))
+	t.Cleanup(func() {
+		server.Close()
+		publisher.Close()
+	})
+	return server
+}
+
+// request makes a request as the administrator of the organization, or without credentials if the organization is 0,
+// and decodes the response into result if it is not nil
+func request(t *testing.T, server *httptest.Server, method string, path string, organizationID int, body interface{}, result interface{}) int {
+	t.Helper()
+	return requestAs(t, server, method, path, testAdmin, organizationID, body, result)
+}
+
+// requestAs makes a request like request, as the user
+func requestAs(t *testing.T, server *httptest.Server, method string, path string, userID int, organizationID int, body interface{}, result interface{}) int {
+	t.Helper()
+	var encoded bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&encoded).Encode(body); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	req, err := http.NewRequest(method, server.URL+path, &encoded)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if organizationID != 0 {
+		req.Header.Set("Authorization", "Bearer "+testUserToken(userID, organizationID))
+	}
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer resp.Body.Close()
+	if result != nil && resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	return resp.StatusCode
+}
+
+func expectStatus(t *testing.T, expected int, actual int) {
+	t.Helper()
+	if expected != actual {
+		t.Errorf("expected status %d, got %d", expected, actual)
+	}
+}
+
+func newFinding(value string, severity string) models.Finding {
+	return models.Finding{
+		Name:                "Open SSH",
+		ReportDistinguisher: models.ReportDistinguisher{Type: "scanner", Value: "nmap"},
+		ReportLocator:       models.ReportLocator{Type: "TCP", Value: value, Distinguisher: "dc1"},
+		Severity:            severity,
+	}
+}
+
+func TestFindings(t *testing.T) {
+	server := newServer(t)
+
+	created := models.Finding{}
+	expectStatus(t, http.StatusOK, request(t, server, http.MethodPost, "/finding-registry/findings", 1, newFinding("10.0.0.1:22", "high"), &created))
+	if created.Identifier == "" || created.Status != "open" || created.Severity != "high" {
+		t.Errorf("expected an open finding of high severity, got %+v", created)
+	}
+	expectStatus(t, http.StatusOK, request(t, server, http.MethodPost, "/finding-registry/findings", 1, newFinding("10.0.0.2:22", "low"), nil))
+
+	found := models.Finding{}
+	expectStatus(t, http.StatusOK, request(t, server, http.MethodGet, "/finding-registry/findings/"+created.Identifier, 1, nil, &found))
+	if found.Identifier != created.Identifier {
+		t.Errorf("expected finding %s, got %s", created.Identifier, found.Identifier)
+	}
+
+	findings := []models.Finding{}
+	expectStatus(t, http.StatusOK, request(t, server, http.MethodGet, "/finding-registry/findings?severity=high", 1, nil, &findings))
+	if len(findings) != 1 || findings[0].Identifier != created.Identifier {
+		t.Errorf("expected only the finding of high severity, got %+v", findings)
+	}
+
+	updated := models.Finding{}
+	expectStatus(t, http.StatusOK, request(t, server, http.MethodPut, "/finding-registry/findings/"+created.Identifier+"/status", 1, models.FindingStatusUpdate{Status: "resolved"}, &updated))
+	if updated.Status != "resolved" {
+		t.Errorf("expected the finding to be resolved, got %s", updated.Status)
+	}
+}
+
+func TestFindingsScopedByOrganization(t *testing.T) {
+	server := newServer(t)
+	created := models.Finding{}
+	expectStatus(t, http.StatusOK, request(t, server, http.MethodPost, "/finding-registry/findings", 1, newFinding("10.0.0.1:22", ""), &created))
+
+	expectStatus(t, http.StatusNotFound, request(t, server, http.MethodGet, "/finding-registry/findings/"+created.Identifier, 2, nil, nil))
+	expectStatus(t, http.StatusNotFound, request(t, server, http.MethodPut, "/finding-registry/findings/"+created.Identifier+"/status", 2, models.FindingStatusUpdate{Status: "resolved"}, nil))
+	findings := []models.Finding{}
+	expectStatus(t, http.StatusOK, request(t, server, http.MethodGet, "/finding-registry/findings", 2, nil, &findings))
+	if len(findings) != 0 {
+		t.Errorf("expected no findings of organization 2, got %d", len(findings))
+	}
+}
+
+func TestFindingVersions(t *testing.T) {
+	server := newServer(t)
+	created := models.Finding{}
+	expectStatus(t, http.StatusOK, request(t, server, http.MethodPost, "/finding-registry/findings", 1, newFinding("10.0.0.1:22", ""), &created))
+	if created.Version != 1 {
+		t.Errorf("expected version 1, got %d", created.Version)
+	}
+
+	// findingRequest makes a request as organization 1 with the If-Match header, and returns the status and ETag of the response
+	findingRequest := func(method string, path string, ifMatch string, body interface{}) (int, string) {
+		t.Helper()
+		var encoded bytes.Buffer
+		if body != nil {
+			if err := json.NewEncoder(&encoded).Encode(body); err != nil {
+				t.Fatal(err.Error())
+			}
+		}
+		req, err := http.NewRequest(method, server.URL+path, &encoded)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken(1))
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		resp, err := server.Client().Do(req)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		resp.Body.Close()
+		return resp.StatusCode, resp.Header.Get("ETag")
+	}
+	statusPath := "/finding-registry/findings/" + created.Identifier + "/status"
+
+	status, etag := findingRequest(http.MethodGet, "/finding-registry/findings/"+created.Identifier, "", nil)
+	expectStatus(t, http.StatusOK, status)
+	if etag != `"1"` {
+		t.Errorf(`expected ETag "1", got %s`, etag)
+	}
+
+	tests := []struct {
+		name          string
+		ifMatch       string
+		findingStatus string
+		status        int
+		etag          string
+	}{
+		{"OtherVersion", `"2"`, "resolved", http.StatusPreconditionFailed, ""},
+		{"WeakTag", `W/"1"`, "resolved", http.StatusPreconditionFailed, ""},
+		{"Unquoted", `1`, "resolved", http.StatusPreconditionFailed, ""},
+		{"SeveralOtherTags", `"2", W/"1", "3"`, "resolved", http.StatusPreconditionFailed, ""},
+		{"SeveralTags", `"2", "1"`, "resolved", http.StatusOK, `"2"`},
+		{"PreviousVersion", `"1"`, "open", http.StatusPreconditionFailed, ""},
+		{"AnyVersion", `*`, "open", http.StatusOK, `"3"`},
+		{"NoPrecondition", "", "resolved", http.StatusOK, `"4"`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status, etag := findingRequest(http.MethodPut, statusPath, test.ifMatch, models.FindingStatusUpdate{Status: test.findingStatus})
+			expectStatus(t, test.status, status)
+			if test.etag != "" && etag != test.etag {
+				t.Errorf("expected ETag %s, got %s", test.etag, etag)
+			}
+		})
+	}
+
+	// Reporting a finding again is checked against the finding it updates, and a finding that is created does not exist
+	reportTests := []struct {
+		name    string
+		ifMatch string
+		finding models.Finding
+		status  int
+		etag    string
+	}{
+		{"ReportOtherVersion", `"3"`, newFinding("10.0.0.1:22", "high"), http.StatusPreconditionFailed, ""},
+		{"ReportSeveralTags", `"3", "4"`, newFinding("10.0.0.1:22", "high"), http.StatusOK, `"5"`},
+		{"ReportAnyVersion", `*`, newFinding("10.0.0.1:22", "low"), http.StatusOK, `"6"`},
+		{"ReportNewVersion", `"1"`, newFinding("10.0.0.2:22", ""), http.StatusPreconditionFailed, ""},
+		{"ReportNewAnyVersion", `*`, newFinding("10.0.0.2:22", ""), http.StatusPreconditionFailed, ""},
+		{"ReportNewNoPrecondition", "", newFinding("10.0.0.2:22", ""), http.StatusOK, `"1"`},
+	}
+	for _, test := range reportTests {
+		t.Run(test.name, func(t *testing.T) {
+			status, etag := findingRequest(http.MethodPost, "/finding-registry/findings", test.ifMatch, test.finding)
+			expectStatus(t, test.status, status)
+			if test.etag != "" && etag != test.etag {
+				t.Errorf("expected ETag %s, got %s", test.etag, etag)
+			}
+		})
+	}
+}
+
+func TestFindingDeletion(t *testing.T) {
+	server := newServer(t)
+	created := models.Finding{}
+	expectStatus(t, http.StatusOK, request(t, server, http.MethodPost, "/finding-registry/findings", 1, newFinding("10.0.0.1:22", ""), &created))
+
+	expectStatus(t, http.StatusNotFound, request(t, server, http.MethodDelete, "/finding-registry/findings/"+created.Identifier, 2, nil, nil))
+	expectStatus(t, http.StatusNoContent, request(t, server, http.MethodDelete, "/finding-registry/findings/"+created.Identifier, 1, nil, nil))
+	expectStatus(t, http.StatusNotFound, request(t, server, http.MethodGet, "/finding-registry/findings/"+created.Identifier, 1, nil, nil))
+	expectStatus(t, http.StatusNotFound, request(t, server, http.MethodDelete, "/finding-registry/findings/"+created.Identifier, 1, nil, nil))
+
+	findings := []models.Finding{}
+	expectStatus(t, http.StatusOK, request(t, server, http.MethodGet, "/finding-registry/findings?deleted=true", 1, nil, &findings))
+	if len(findings) != 1 || findings[0].Identifier != created.Identifier || findings[0].DeletedAt == nil || findings[0].DeletedBy != 1 {
+		t.Errorf("expected the finding deleted by user 1, got %+v", findings)
+	}
+	expectStatus(t, http.StatusBadRequest, request(t, server, http.MethodGet, "/finding-registry/findings?deleted=maybe", 1, nil, nil))
+
+	purge := models.FindingPurge{}
+	expectStatus(t, http.StatusOK, request(t, server, http.MethodPost, "/finding-registry/admin/findings/purge", 1, nil, &purge))
+	if purge.Purged != 1 {
+		t.Errorf("expected 1 finding to be purged, got %d", purge.Purged)
+	}
+	expectStatus(t, http.StatusOK, request(t, server, http.MethodGet, "/finding-registry/findings?deleted=true", 1, nil, &findings))
+	if len(findings) != 0 {
+		t.Errorf("expected no deleted findings, got %d", len(findings))
+	}
+}
+
+func TestFindingArchive(t *testing.T) {
+	persistence := database.NewMemoryFindingsPersistence()
+	server := newServerOn(t, persistence)
+	created := models.Finding{}
+	expectStatus(t, http.StatusOK, request(t, server, http.MethodPost, "/finding-registry/findings", 1, newFinding("10.0.0.1:22", ""), &created))
+	statusPath := "/finding-registry/findings/" + created.Identifier + "/status"
+	expectStatus(t, http.StatusOK, request(t, server, http.MethodPut, statusPath, 1, models.FindingStatusUpdate{Status: "resolved"}, nil))
+	if _, err := persistence.ArchiveFinding(context.Background(), created.Identifier, time.Now(), 1); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	found := models.Finding{}
+	expectStatus(t, http.StatusOK, request(t, server, http.MethodGet, "/finding-registry/findings/"+created.Identifier, 1, nil, &found))
+	if !found.Archived || found.ArchivedAt == nil {
+		t.Errorf("expected the finding to be archived, got %+v", found)
+	}
+	expectStatus(t, http.StatusConflict, request(t, server, http.MethodPut, statusPath, 1, models.FindingStatusUpdate{Status: "open"}, nil))
+
+	findings := []models.Finding{}
+	expectStatus(t, http.StatusOK, request(t, server, http.MethodGet, "/finding-registry/findings", 1, nil, &findings))
+	if len(findings) != 0 {
+		t.Errorf("expected archived findings not to be listed, got %+v", findings)
+	}
+	expectStatus(t, http.StatusOK, request(t, server, http.MethodGet, "/finding-registry/findings?includeArchived=true", 1, nil, &findings))
+	if len(findings) != 1 || !findings[0].Archived {
+		t.Errorf("expected the archived finding, got %+v", findings)
+	}
+	expectStatus(t, http.StatusBadRequest, request(t, server, http.MethodGet, "/finding-registry/findings?includeArchived=maybe", 1, nil, nil))
+
+	// Reporting the finding again restores it
+	expectStatus(t, http.StatusOK, request(t, server, http.MethodPost, "/finding-registry/findings", 1, newFinding("10.0.0.1:22", ""), &found))
+	if found.Identifier != created.Identifier || found.Archived || found.Status != "open" {
+		t.Errorf("expected the finding to be restored and reopened, got %+v", found)
+	}
+}
+
+func TestRetentionPolicy(t *testing.T) {
+	server := newServer(t)
+	policy := models.RetentionPolicy{}
+	expectStatus(t, http.StatusOK, request(t, server, http.MethodGet, "/finding-registry/retention-policy", 1, nil, &policy))
+	if policy != (models.RetentionPolicy{}) {
+		t.Errorf("expected findings to be kept forever, got %+v", policy)
+	}
+	expectStatus(t, http.StatusUnprocessableEntity, request(t, server, http.MethodPut, "/finding-registry/admin/retention-policy", 1, models.RetentionPolicy{DeletedDays: -1}, nil))
+	expectStatus(t, http.StatusOK, request(t, server, http.MethodPut, "/finding-registry/admin/retention-policy", 1, models.RetentionPolicy{ResolvedDays: 30, DeletedDays: 7}, nil))
+	expectStatus(t, http.StatusOK, request(t, server, http.MethodGet, "/finding-registry/retention-policy", 1, nil, &policy))
+	if policy != (models.RetentionPolicy{ResolvedDays: 30, DeletedDays: 7}) {
+		t.Errorf("expected the policy that was set, got %+v", policy)
+	}
+	// Resolved findings must be archived before they are deleted
+	expectStatus(t, http.StatusUnprocessableEntity, request(t, server, http.MethodPut, "/finding-registry/admin/retention-policy", 1, models.RetentionPolicy{ResolvedDays: 30, ArchiveDays: 30}, nil))
+	expectStatus(t, http.StatusOK, request(t, server, http.MethodPut, "/finding-registry/admin/retention-policy", 1, models.RetentionPolicy{ResolvedDays: 30, ArchiveDays: 7}, &policy))
+	if policy != (models.RetentionPolicy{ResolvedDays: 30, ArchiveDays: 7}) {
+		t.Errorf("expected the policy that was set, got %+v", policy)
+	}
+	// Any user of the organization may read the policy, while only administrators may set it
+	expectStatus(t, http.StatusOK, requestAs(t, server, http.MethodGet, "/finding-registry/retention-policy", testAdmin+1, 1, nil, nil))
+	expectStatus(t, http.StatusOK, request(t, server, http.MethodGet, "/finding-registry/retention-policy", 2, nil, &policy))
+	if policy != (models.RetentionPolicy{}) {
+		t.Errorf("expected the policy of organization 1 to not apply to organization 2, got %+v", policy)
+	}
+}
+
+func TestAudit(t *testing.T) {
+	server := newServer(t)
+	created := models.Finding{}
+	expectStatus(t, http.StatusOK, request(t, server, http.MethodPost, "/finding-registry/findings", 1, newFinding("10.0.0.1:22", ""), &created))
+
+	req, err := http.NewRequest(http.MethodPut, server.URL+"/finding-registry/findings/"+created.Identifier+"/status", strings.NewReader(`{"status": "resolved"}`))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	req.Header.Set("Authorization", "Bearer "+testToken(1))
+	req.Header.Set(rest.RequestIDHeader, "request-1")
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	resp.Body.Close()
+	expectStatus(t, http.StatusOK, resp.StatusCode)
+	if resp.Header.Get(rest.RequestIDHeader) != "request-1" {
+		t.Errorf("expected the request id to be returned, got %s", resp.Header.Get(rest.RequestIDHeader))
+	}
+
+	entries := []models.AuditEntry{}
+	expectStatus(t, http.StatusOK, request(t, server, http.MethodGet, "/finding-registry/findings/"+created.Identifier+"/audit", 1, nil, &entries))
+	if len(entries) != 2 || entries[0].Action != "created" || entries[1].Action != "statusChanged" {
+		t.Fatalf("expected the finding to be created and resolved, got %+v", entries)
+	}
+	if entries[1].Actor.UserId != 1 || entries[1].Actor.RequestId != "request-1" || entries[1].Actor.SourceIP != "127.0.0.1" {
+		t.Errorf("expected the status change to be attributed to the request, got %+v", entries[1].Actor)
+	}
+	if string(entries[1].Changes[0].Before) != `"open"` || string(entries[1].Changes[0].After) != `"resolved"` {
+		t.Errorf("expected the status to change from open to resolved, got %+v", entries[1].Changes)
+	}
+	if string(entries[0].Changes[0].Before) != "null" {
+		t.Errorf("expected nothing before the finding was created, got %s", entries[0].Changes[0].Before)
+	}
+	expectStatus(t, http.StatusNotFound, request(t, server, http.MethodGet, "/finding-registry/findings/"+created.Identifier+"/audit", 2, nil, nil))
+
+	expectStatus(t, http.StatusOK, request(t, server, http.MethodGet, "/finding-registry/audit?action=statusChanged&userId=1", 1, nil, &entries))
+	if len(entries) != 1 || entries[0].Sequence != 2 {
+		t.Errorf("expected only the status change, got %+v", entries)
+	}
+	expectStatus(t, http.StatusBadRequest, request(t, server, http.MethodGet, "/finding-registry/audit?action=renamed", 1, nil, nil))
+	expectStatus(t, http.StatusBadRequest, request(t, server, http.MethodGet, "/finding-registry/audit?since=yesterday", 1, nil, nil))
+
+	verification := models.AuditVerification{}
+	expectStatus(t, http.StatusOK, request(t, server, http.MethodGet, "/finding-registry/audit/verify", 1, nil, &verification))
+	if !verification.Valid || verification.Entries != 2 {
+		t.Errorf("expected a valid chain of 2 entries, got %+v", verification)
+	}
+
+	// A full page links to the next one with the same criteria, and the last page does not link further
+	expectStatus(t, http.StatusOK, request(t, server, http.MethodPost, "/finding-registry/findings", 1, newFinding("10.0.0.2:22", ""), nil))
+	path := "/finding-registry/audit?action=created&limit=1"
+	sequences := []int{}
+	for pages := 0; path != ""; pages++ {
+		if pages == 3 {
+			t.Fatalf("expected three pages, got a link to %s", path)
+		}
+		req, err := http.NewRequest(http.MethodGet, server.URL+path, nil)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken(1))
+		resp, err := server.Client().Do(req)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		defer resp.Body.Close()
+		expectStatus(t, http.StatusOK, resp.StatusCode)
+		page := []models.AuditEntry{}
+		if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+			t.Fatal(err.Error())
+		}
+		for _, entry := range page {
+			sequences = append(sequences, entry.Sequence)
+		}
+		path = ""
+		if link := resp.Header.Get("Link"); link != "" {
+			path = strings.TrimSuffix(strings.TrimPrefix(link, "<"), `>; rel="next"`)
+		}
+	}
+	if len(sequences) != 2 || sequences[0] != 1 || sequences[1] != 3 {
+		t.Errorf("expected the creations to be listed a page at a time, got %v", sequences)
+	}
+	expectStatus(t, http.StatusOK, request(t, server, http.MethodGet, "/finding-registry/findings/"+created.Identifier+"/audit?after=1", 1, nil, &entries))
+	if len(entries) != 1 || entries[0].Sequence != 2 {
+		t.Errorf("expected the entries of the finding after the first one, got %+v", entries)
+	}
+	expectStatus(t, http.StatusBadRequest, request(t, server, http.MethodGet, "/finding-registry/audit?limit=0", 1, nil, nil))
+	expectStatus(t, http.StatusBadRequest, request(t, server, http.MethodGet, "/finding-registry/audit?after=first", 1, nil, nil))
+}
+
+func TestExportImport(t *testing.T) {
+	server := newServer(t)
+	created := models.Finding{}
+	expectStatus(t, http.StatusOK, request(t, server, http.MethodPost, "/finding-registry/findings", 1, newFinding("10.0.0.1:22", "high"), &created))
+	expectStatus(t, http.StatusOK, request(t, server, http.MethodPut, "/finding-registry/findings/"+created.Identifier+"/status", 1, models.FindingStatusUpdate{Status: "accepted"}, nil))
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/finding-registry/admin/export", nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	req.Header.Set("Authorization", "Bearer "+testToken(1))
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	export, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectStatus(t, http.StatusOK, resp.StatusCode)
+	if resp.Header.Get("Content-Type") != "application/x-ndjson" {
+		t.Errorf("expected newline delimited JSON, got %s", resp.Header.Get("Content-Type"))
+	}
+	if lines := strings.Split(strings.TrimSpace(string(export)), "\n"); len(lines) != 2 {
+		t.Fatalf("expected a header and a finding, got %s", export)
+	}
+
+	importExport := func(organizationID int, body string) (int, models.FindingImport) {
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/finding-registry/admin/import", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken(organizationID))
+		resp, err := server.Client().Do(req)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		defer resp.Body.Close()
+		result := models.FindingImport{}
+		if resp.StatusCode == http.StatusOK {
+			if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+				t.Fatal(err.Error())
+			}
+		}
+		return resp.StatusCode, result
+	}
+	status, result := importExport(2, string(export))
+	expectStatus(t, http.StatusOK, status)
+	if result != (models.FindingImport{Created: 1}) {
+		t.Errorf("expected the finding to be created, got %+v", result)
+	}
+	status, result = importExport(2, string(export))
+	expectStatus(t, http.StatusOK, status)
+	if result != (models.FindingImport{Unchanged: 1}) {
+		t.Errorf("expected the finding to be unchanged, got %+v", result)
+	}
+
+	findings := []models.Finding{}
+	expectStatus(t, http.StatusOK, request(t, server, http.MethodGet, "/finding-registry/findings", 2, nil, &findings))
+	if len(findings) != 1 || findings[0].Status != "accepted" || findings[0].Severity != "high" || findings[0].OrganizationId != 2 {
+		t.Errorf("expected the finding to be restored in organization 2, got %+v", findings)
+	}
+	// The history survives being encoded, or it would no longer match its hashes and the import would be refused,
+	// but only the import itself is recorded
+	entries := []models.AuditEntry{}
+	expectStatus(t, http.StatusOK, request(t, server, http.MethodGet, "/finding-registry/audit", 2, nil, &entries))
+	if len(entries) != 1 || entries[0].Action != "imported" || entries[0].Actor.UserId != testAdmin {
+		t.Errorf("expected a single entry of the import, got %+v", entries)
+	}
+
+	status, _ = importExport(2, `{"name": "not an export"}`)
+	expectStatus(t, http.StatusBadRequest, status)
+	status, _ = importExport(2, strings.Replace(string(export), `"version":1`, `"version":2`, 1))
+	expectStatus(t, http.StatusUnprocessableEntity, status)
+	// A finding is read a line at a time, and a line longer than any finding is refused
+	header := strings.SplitN(string(export), "\n", 2)[0]
+	status, _ = importExport(2, header+"\n"+`{"finding": "`+strings.Repeat("a", 17*1024*1024)+`"}`+"\n")
+	expectStatus(t, http.StatusRequestEntityTooLarge, status)
+}
+
+func TestAdminRoutes(t *testing.T) {
+	server := newServer(t)
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   interface{}
+		status int
+	}{
+		{"Export", http.MethodGet, "/finding-registry/admin/export", nil, http.StatusOK},
+		{"Import", http.MethodPost, "/finding-registry/admin/import", nil, http.StatusBadRequest},
+		{"MergeDistinguishers", http.MethodPost, "/finding-registry/admin/distinguishers/merge", models.DistinguisherMergeRequest{From: "dc1", Into: "dc2"}, http.StatusOK},
+		{"Purge", http.MethodPost, "/finding-registry/admin/findings/purge", nil, http.StatusOK},
+		{"Replay", http.MethodPost, "/finding-registry/admin/findings/replay", models.ReplayRequest{}, http.StatusAccepted},
+		{"UnknownReplay", http.MethodGet, "/finding-registry/admin/findings/replay/unknown", nil, http.StatusNotFound},
+		{"RetentionPolicy", http.MethodPut, "/finding-registry/admin/retention-policy", models.RetentionPolicy{ResolvedDays: 30}, http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Other users of the organization are not administrators
+			expectStatus(t, http.StatusForbidden, requestAs(t, server, test.method, test.path, testAdmin+1, 1, test.body, nil))
+			expectStatus(t, test.status, request(t, server, test.method, test.path, 1, test.body, nil))
+		})
+	}
+}
+
+func TestReplay(t *testing.T) {
+	server := newServer(t)
+	expectStatus(t, http.StatusOK, request(t, server, http.MethodPost, "/finding-registry/findings", 1, newFinding("10.0.0.1:22", "high"), nil))
+
+	body, err := json.Marshal(models.ReplayRequest{Rate: 1})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/finding-registry/admin/findings/replay", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	req.Header.Set("Authorization", "Bearer "+testToken(1))
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer resp.Body.Close()
+	expectStatus(t, http.StatusAccepted, resp.StatusCode)
+	started := models.Replay{}
+	if err := json.NewDecoder(resp.Body).Decode(&started); err != nil {
+		t.Fatal(err.Error())
+	}
+	location := resp.Header.Get("Location")
+	if location != "/finding-registry/admin/findings/replay/"+started.Identifier {
+		t.Errorf("expected the location of replay %s, got %s", started.Identifier, location)
+	}
+
+	// The request starting the replay does not wait for it
+	replay := models.Replay{}
+	expectStatus(t, http.StatusOK, request(t, server, http.MethodGet, location, 1, nil, &replay))
+	if replay.Identifier != started.Identifier || replay.Done {
+		t.Errorf("expected replay %s to be running, got %+v", started.Identifier, replay)
+	}
+	expectStatus(t, http.StatusConflict, request(t, server, http.MethodPost, "/finding-registry/admin/findings/replay", 1, models.ReplayRequest{}, nil))
+	expectStatus(t, http.StatusNotFound, request(t, server, http.MethodGet, location, 2, nil, nil))
+	expectStatus(t, http.StatusNoContent, request(t, server, http.MethodDelete, location, 1, nil, nil))
+}
+
+func TestWebhookDeliveries(t *testing.T) {
+	server := newServer(t)
+	subscription := models.WebhookSubscription{}
+	expectStatus(t, http.StatusOK, request(t, server, http.MethodPost, "/finding-registry/webhooks", 1, models.WebhookSubscription{URL: "https://hooks.example.com/findings"}, &subscription))
+	for _, value := range []string{"10.0.0.1:22", "10.0.0.2:22", "10.0.0.3:22"} {
+		expectStatus(t, http.StatusOK, request(t, server, http.MethodPost, "/finding-registry/findings", 1, newFinding(value, "high"), nil))
+	}
+
+	// A full page links to the next one, and the last page does not link further
+	path := "/finding-registry/webhooks/" + subscription.Identifier + "/deliveries?limit=2"
+	identifiers := map[string]bool{}
+	for pages := 0; path != ""; pages++ {
+		if pages == 2 {
+			t.Fatalf("expected two pages, got a link to %s", path)
+		}
+		req, err := http.NewRequest(http.MethodGet, server.URL+path, nil)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken(1))
+		resp, err := server.Client().Do(req)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		defer resp.Body.Close()
+		expectStatus(t, http.StatusOK, resp.StatusCode)
+		deliveries := []models.WebhookDelivery{}
+		if err := json.NewDecoder(resp.Body).Decode(&deliveries); err != nil {
+			t.Fatal(err.Error())
+		}
+		for _, delivery := range deliveries {
+			identifiers[delivery.Identifier] = true
+		}
+		path = ""
+		if link := resp.Header.Get("Link"); link != "" {
+			path = strings.TrimSuffix(strings.TrimPrefix(link, "<"), `>; rel="next"`)
+		}
+	}
+	if len(identifiers) != 3 {
+		t.Errorf("expected every delivery to be listed once, got %v", identifiers)
+	}
+
+	expectStatus(t, http.StatusBadRequest, request(t, server, http.MethodGet, "/finding-registry/webhooks/"+subscription.Identifier+"/deliveries?limit=0", 1, nil, nil))
+	expectStatus(t, http.StatusBadRequest, request(t, server, http.MethodGet, "/finding-registry/webhooks/"+subscription.Identifier+"/deliveries?before=yesterday", 1, nil, nil))
+	expectStatus(t, http.StatusNotFound, request(t, server, http.MethodGet, "/finding-registry/webhooks/"+subscription.Identifier+"/deliveries", 2, nil, nil))
+}
+
+// streamEvent is an event read from a finding stream
+type streamEvent struct {
+	id        string
+	eventType string
+}
+
+// openStream opens the finding stream of organization 1, resuming after lastEventID unless it is empty,
+// and returns the events read from it until the test ends
+func openStream(t *testing.T, server *httptest.Server, lastEventID string) <-chan streamEvent {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/finding-registry/findings/stream", nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	req.Header.Set("Authorization", "Bearer "+testToken(1))
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectStatus(t, http.StatusOK, resp.StatusCode)
+	events := make(chan streamEvent, 10)
+	go func() {
+		defer resp.Body.Close()
+		scanner := bufio.NewScanner(resp.Body)
+		read := streamEvent{}
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "id: "):
+				read.id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "event: "):
+				read.eventType = strings.TrimPrefix(line, "event: ")
+			case line == "" && read.eventType != "":
+				events <- read
+				read = streamEvent{}
+			}
+		}
+	}()
+	t.Cleanup(cancel)
+	return events
+}
+
+// expectStreamEvent waits for the next event of the stream, and fails unless it has the type
+func expectStreamEvent(t *testing.T, events <-chan streamEvent, eventType string) streamEvent {
+	t.Helper()
+	select {
+	case read := <-events:
+		if read.eventType != eventType {
+			t.Fatalf("expected a %s event, got %+v", eventType, read)
+		}
+		return read
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected a %s event, got none", eventType)
+	}
+	return streamEvent{}
+}
+
+func TestFindingsStream(t *testing.T) {
+	publisher := event.NewMemoryPublisher(event.MemoryConfig{})
+	logic := application.NewApplicationLogic(database.NewMemoryFindingsPersistence(), publisher).WithStreamConfig(application.StreamConfig{
+		SettleDelay:                   time.Millisecond,
+		MaxConnectionsPerOrganization: 2,
+	})
+	server := httptest.NewServer(rest.InitMux(logic, testSecret, []int{testAdmin}))
+	t.Cleanup(func() {
+		server.Close()
+		publisher.Close()
+	})
+
+	stream := openStream(t, server, "")
+	expectStatus(t, http.StatusOK, request(t, server, http.MethodPost, "/finding-registry/findings", 1, newFinding("10.0.0.1:22", "high"), nil))
+	created := expectStreamEvent(t, stream, "finding.created")
+
+	// A stream resuming after the event only streams the events after it
+	expectStatus(t, http.StatusOK, request(t, server, http.MethodPost, "/finding-registry/findings", 1, newFinding("10.0.0.2:22", "high"), nil))
+	expectStreamEvent(t, stream, "finding.created")
+	resumed := openStream(t, server, created.id)
+	if read := expectStreamEvent(t, resumed, "finding.created"); read.id == created.id {
+		t.Errorf("expected the stream to resume after event %s", created.id)
+	}
+
+	// Streams over the limit of the organization are refused
+	expectStatus(t, http.StatusTooManyRequests, request(t, server, http.MethodGet, "/finding-registry/findings/stream", 1, nil, nil))
+}
+
+func TestFindingsStreamReset(t *testing.T) {
+	server := newServer(t)
+	// The stream can not resume after an unknown event, and tells the client to reload
+	stream := openStream(t, server, "00000000-0000-4000-8000-000000000000")
+	expectStreamEvent(t, stream, "reset")
+}
+
+func TestFindingsError(t *testing.T) {
+	server := newServer(t)
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		organizationID int
+		body           interface{}
+		status         int
+	}{
+		{"Unauthenticated", http.MethodGet, "/finding-registry/findings", 0, nil, http.StatusUnauthorized},
+		{"InvalidSeverity", http.MethodPost, "/finding-registry/findings", 1, newFinding("10.0.0.1:22", "urgent"), http.StatusBadRequest},
+		{"InvalidSeverityFilter", http.MethodGet, "/finding-registry/findings?severity=urgent", 1, nil, http.StatusBadRequest},
+		{"InvalidUpdatedSince", http.MethodGet, "/finding-registry/findings?updatedSince=yesterday", 1, nil, http.StatusBadRequest},
+		{"UnknownFinding", http.MethodGet, "/finding-registry/findings/000000000000000000000000", 1, nil, http.StatusNotFound},
+		{"InvalidStatus", http.MethodPut, "/finding-registry/findings/000000000000000000000000/status", 1, models.FindingStatusUpdate{Status: "fixed"}, http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expectStatus(t, test.status, request(t, server, test.method, test.path, test.organizationID, test.body, nil))
+		})
+	}
+}
+
+func TestHealth(t *testing.T) {
+	server := newServer(t)
+	expectStatus(t, http.StatusOK, request(t, server, http.MethodGet, "/finding-registry/health", 0, nil, nil))
+}
@@ -0,0 +1,92 @@
+package rest
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Kaese72/organization-registry/authentication"
+	"github.com/Kaese72/riskie-lib/apierror"
+	"github.com/Kaese72/riskie-lib/logging"
+)
+
+const (
+	// streamPollInterval is how often new events are looked for
+	streamPollInterval = time.Second
+	// streamKeepAliveInterval is how often an idle stream is written to, so that proxies do not close it
+	streamKeepAliveInterval = 15 * time.Second
+	// streamRetry is how long clients wait before reconnecting, in milliseconds
+	streamRetry = 2000
+)
+
+// findingsStreamGetHandler streams the finding events of the organization as Server-Sent Events.
+// Clients resume after the last event they received with the Last-Event-ID header.
+// Every stream polls the database, so the number of streams is limited by the application.
+func (appMux restApplicationMux) findingsStreamGetHandler(w http.ResponseWriter, r *http.Request) {
+	organizationID := int(r.Context().Value(authentication.OrganizationIDKey).(float64))
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		apierror.TerminalHTTPError(r.Context(), w, apierror.APIError{Code: http.StatusInternalServerError, WrappedError: errors.New("streaming not supported")})
+		return
+	}
+	filter, err := findingFilterFromQuery(r.URL.Query())
+	if err != nil {
+		apierror.TerminalHTTPError(r.Context(), w, err)
+		return
+	}
+	release, err := appMux.application.OpenFindingStream(organizationID)
+	if err != nil {
+		apierror.TerminalHTTPError(r.Context(), w, err)
+		return
+	}
+	defer release()
+	lastEventID := r.Header.Get("Last-Event-ID")
+	cursor, resumed, err := appMux.application.FindingEventCursor(r.Context(), lastEventID, organizationID)
+	if err != nil {
+		apierror.TerminalHTTPError(r.Context(), w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// Disables response buffering in nginx
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", streamRetry)
+	if lastEventID != "" && !resumed {
+		// Events may have been missed, so the client should reload the findings it shows
+		fmt.Fprint(w, "event: reset\ndata: {}\n\n")
+	}
+	flusher.Flush()
+
+	poll := time.NewTicker(streamPollInterval)
+	defer poll.Stop()
+	lastWrite := time.Now()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-poll.C:
+		}
+		outboxEvents, next, err := appMux.application.PollFindingEvents(r.Context(), cursor, filter, organizationID)
+		if err != nil {
+			if r.Context().Err() == nil {
+				logging.Error(r.Context(), "Failed to poll finding events", map[string]interface{}{"error": err.Error()})
+			}
+			continue
+		}
+		cursor = next
+		for _, outboxEvent := range outboxEvents {
+			fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", outboxEvent.Identifier, outboxEvent.Type, outboxEvent.Payload)
+		}
+		if len(outboxEvents) == 0 && time.Since(lastWrite) < streamKeepAliveInterval {
+			continue
+		}
+		if len(outboxEvents) == 0 {
+			fmt.Fprint(w, ": keep-alive\n\n")
+		}
+		flusher.Flush()
+		lastWrite = time.Now()
+	}
+}
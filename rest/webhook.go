@@ -0,0 +1,198 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Kaese72/finding-registry/internal/intermediaries"
+	"github.com/Kaese72/finding-registry/rest/models"
+	"github.com/Kaese72/organization-registry/authentication"
+	"github.com/Kaese72/riskie-lib/apierror"
+	"github.com/gorilla/mux"
+)
+
+func (appMux restApplicationMux) webhooksGetHandler(w http.ResponseWriter, r *http.Request) {
+	organizationID := int(r.Context().Value(authentication.OrganizationIDKey).(float64))
+	subscriptions, err := appMux.application.ReadWebhookSubscriptions(r.Context(), organizationID)
+	if err != nil {
+		apierror.TerminalHTTPError(r.Context(), w, err)
+		return
+	}
+	result := []models.WebhookSubscription{}
+	for index := range subscriptions {
+		result = append(result, models.WebhookSubscriptionFromIntermediary(subscriptions[index]))
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "   ")
+	err = encoder.Encode(result)
+	if err != nil {
+		apierror.TerminalHTTPError(r.Context(), w, err)
+		return
+	}
+}
+
+func (appMux restApplicationMux) webhookPostHandler(w http.ResponseWriter, r *http.Request) {
+	organizationID := int(r.Context().Value(authentication.OrganizationIDKey).(float64))
+	inputSubscription := models.WebhookSubscription{}
+	err := json.NewDecoder(r.Body).Decode(&inputSubscription)
+	if err != nil {
+		apierror.TerminalHTTPError(r.Context(), w, apierror.APIError{Code: http.StatusBadRequest, WrappedError: fmt.Errorf("error decoding request: %s", err.Error())})
+		return
+	}
+	subscription, err := appMux.application.PostWebhookSubscription(r.Context(), inputSubscription.ToIntermediary(), organizationID)
+	if err != nil {
+		apierror.TerminalHTTPError(r.Context(), w, err)
+		return
+	}
+	result := models.WebhookSubscriptionFromIntermediary(subscription)
+	// The secret is only ever returned here, so that it can be configured on the receiver
+	result.Secret = subscription.Secret
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "   ")
+	err = encoder.Encode(result)
+	if err != nil {
+		apierror.TerminalHTTPError(r.Context(), w, err)
+		return
+	}
+}
+
+func (appMux restApplicationMux) webhookGetHandler(w http.ResponseWriter, r *http.Request) {
+	organizationID := int(r.Context().Value(authentication.OrganizationIDKey).(float64))
+	identifier, ok := mux.Vars(r)["identifier"]
+	if !ok {
+		apierror.TerminalHTTPError(r.Context(), w, apierror.APIError{Code: http.StatusBadRequest, WrappedError: errors.New("missing identifier")})
+		return
+	}
+	subscription, err := appMux.application.ReadWebhookSubscription(r.Context(), identifier, organizationID)
+	if err != nil {
+		apierror.TerminalHTTPError(r.Context(), w, err)
+		return
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "   ")
+	err = encoder.Encode(models.WebhookSubscriptionFromIntermediary(subscription))
+	if err != nil {
+		apierror.TerminalHTTPError(r.Context(), w, err)
+		return
+	}
+}
+
+func (appMux restApplicationMux) webhookPutHandler(w http.ResponseWriter, r *http.Request) {
+	organizationID := int(r.Context().Value(authentication.OrganizationIDKey).(float64))
+	identifier, ok := mux.Vars(r)["identifier"]
+	if !ok {
+		apierror.TerminalHTTPError(r.Context(), w, apierror.APIError{Code: http.StatusBadRequest, WrappedError: errors.New("missing identifier")})
+		return
+	}
+	inputSubscription := models.WebhookSubscription{}
+	err := json.NewDecoder(r.Body).Decode(&inputSubscription)
+	if err != nil {
+		apierror.TerminalHTTPError(r.Context(), w, apierror.APIError{Code: http.StatusBadRequest, WrappedError: fmt.Errorf("error decoding request: %s", err.Error())})
+		return
+	}
+	// The identifier in the path always takes precedence
+	inputSubscription.Identifier = identifier
+	subscription, err := appMux.application.PutWebhookSubscription(r.Context(), inputSubscription.ToIntermediary(), organizationID)
+	if err != nil {
+		apierror.TerminalHTTPError(r.Context(), w, err)
+		return
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "   ")
+	err = encoder.Encode(models.WebhookSubscriptionFromIntermediary(subscription))
+	if err != nil {
+		apierror.TerminalHTTPError(r.Context(), w, err)
+		return
+	}
+}
+
+func (appMux restApplicationMux) webhookDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	organizationID := int(r.Context().Value(authentication.OrganizationIDKey).(float64))
+	identifier, ok := mux.Vars(r)["identifier"]
+	if !ok {
+		apierror.TerminalHTTPError(r.Context(), w, apierror.APIError{Code: http.StatusBadRequest, WrappedError: errors.New("missing identifier")})
+		return
+	}
+	err := appMux.application.DeleteWebhookSubscription(r.Context(), identifier, organizationID)
+	if err != nil {
+		apierror.TerminalHTTPError(r.Context(), w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+const (
+	// defaultWebhookDeliveriesLimit and maxWebhookDeliveriesLimit bound the deliveries listed on a page of the delivery log
+	defaultWebhookDeliveriesLimit = 100
+	maxWebhookDeliveriesLimit     = 1000
+)
+
+// encodeWebhookDeliveryCursor is the before parameter listing the deliveries after the delivery on the next page
+func encodeWebhookDeliveryCursor(cursor intermediaries.WebhookDeliveryCursor) string {
+	return strconv.FormatInt(cursor.CreatedAt.UnixMilli(), 10) + "." + cursor.Identifier
+}
+
+// webhookDeliveriesPageFromQuery reads the cursor and the limit of a page of the delivery log
+func webhookDeliveriesPageFromQuery(query url.Values) (intermediaries.WebhookDeliveryCursor, int, error) {
+	cursor := intermediaries.WebhookDeliveryCursor{}
+	limit := defaultWebhookDeliveriesLimit
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxWebhookDeliveriesLimit {
+			return cursor, 0, apierror.APIError{Code: http.StatusBadRequest, WrappedError: fmt.Errorf("limit must be between 1 and %d", maxWebhookDeliveriesLimit)}
+		}
+		limit = parsed
+	}
+	if value := query.Get("before"); value != "" {
+		millis, identifier, ok := strings.Cut(value, ".")
+		parsed, err := strconv.ParseInt(millis, 10, 64)
+		if !ok || err != nil || identifier == "" {
+			return cursor, 0, apierror.APIError{Code: http.StatusBadRequest, WrappedError: errors.New("invalid before")}
+		}
+		cursor = intermediaries.WebhookDeliveryCursor{CreatedAt: time.UnixMilli(parsed).UTC(), Identifier: identifier}
+	}
+	return cursor, limit, nil
+}
+
+// webhookDeliveriesGetHandler lists a page of the delivery log. A full page links to the next page with a Link header.
+func (appMux restApplicationMux) webhookDeliveriesGetHandler(w http.ResponseWriter, r *http.Request) {
+	organizationID := int(r.Context().Value(authentication.OrganizationIDKey).(float64))
+	identifier, ok := mux.Vars(r)["identifier"]
+	if !ok {
+		apierror.TerminalHTTPError(r.Context(), w, apierror.APIError{Code: http.StatusBadRequest, WrappedError: errors.New("missing identifier")})
+		return
+	}
+	before, limit, err := webhookDeliveriesPageFromQuery(r.URL.Query())
+	if err != nil {
+		apierror.TerminalHTTPError(r.Context(), w, err)
+		return
+	}
+	deliveries, err := appMux.application.ReadWebhookDeliveries(r.Context(), identifier, before, limit, organizationID)
+	if err != nil {
+		apierror.TerminalHTTPError(r.Context(), w, err)
+		return
+	}
+	if len(deliveries) == limit {
+		next := url.Values{}
+		next.Set("limit", strconv.Itoa(limit))
+		next.Set("before", encodeWebhookDeliveryCursor(deliveries[len(deliveries)-1].Cursor()))
+		w.Header().Set("Link", fmt.Sprintf(`<%s?%s>; rel="next"`, r.URL.Path, next.Encode()))
+	}
+	result := []models.WebhookDelivery{}
+	for index := range deliveries {
+		result = append(result, models.WebhookDeliveryFromIntermediary(deliveries[index]))
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "   ")
+	err = encoder.Encode(result)
+	if err != nil {
+		apierror.TerminalHTTPError(r.Context(), w, err)
+		return
+	}
+}
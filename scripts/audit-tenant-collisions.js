@@ -0,0 +1,77 @@
+// Lists findings of the MongoDB backend that more than one organization has reported. Before findings were
+// upserted by organization, an organization reporting the report distinguisher and locator of a finding of
+// another organization took that finding over. Every change to a finding is recorded in the audit log under the
+// organization that made it, and audit entries are never deleted, so a finding that was taken over has audit
+// entries of more than one organization, or of another organization than the one it belongs to now. Nothing is
+// changed.
+//
+// The audit log only records what happened since it was introduced. A finding whose creation, or import, is in
+// the audit log has its whole history there, and is either listed as a collision or known not to have collided.
+// Any other finding was created before the audit log, and may have been taken over before then without a trace.
+// Those findings are listed as unverifiable, since no data kept by the service can tell whether they collided.
+//
+//   mongosh "<database.connectionString>/<database.name>" scripts/audit-tenant-collisions.js
+//
+// Exits with 1 when collisions are found, with 2 when none are found but some findings are unverifiable, and
+// with 0 only when every finding is known not to have collided.
+const organizationsByFinding = new Map();
+const recordedFromStart = new Set();
+db.auditEntries.aggregate([
+  {
+    $group: {
+      _id: "$findingId",
+      organizations: { $addToSet: "$organizationId" },
+      actions: { $addToSet: "$action" },
+    },
+  },
+]).forEach((finding) => {
+  organizationsByFinding.set(finding._id, finding.organizations);
+  if (finding.actions.includes("created") || finding.actions.includes("imported")) {
+    recordedFromStart.add(finding._id);
+  }
+});
+
+// The organization each finding belongs to now, archived findings included
+const currentOrganizations = new Map();
+const unverifiable = [];
+for (const collection of [db.findings, db.archivedFindings]) {
+  collection.find({}, { organizationId: 1, reportDistinguisher: 1, reportLocator: 1 }).forEach((finding) => {
+    const findingId = finding._id.toHexString();
+    currentOrganizations.set(findingId, finding.organizationId);
+    if (!recordedFromStart.has(findingId)) {
+      unverifiable.push({
+        finding: findingId,
+        organization: finding.organizationId,
+        reportDistinguisher: finding.reportDistinguisher,
+        reportLocator: finding.reportLocator,
+      });
+    }
+  });
+}
+
+let collisions = 0;
+for (const [findingId, organizations] of organizationsByFinding) {
+  // Findings that have been purged since are gone, but their audit entries are not
+  const current = currentOrganizations.has(findingId) ? currentOrganizations.get(findingId) : null;
+  if (organizations.length < 2 && (current === null || organizations[0] === current)) {
+    continue;
+  }
+  collisions++;
+  printjson({
+    finding: findingId,
+    organizations: [...organizations].sort((a, b) => a - b),
+    // The organization that reported the finding last, and owns it now, unless it has been purged
+    organization: current,
+  });
+}
+print(`${collisions} findings reported by more than one organization`);
+if (unverifiable.length > 0) {
+  unverifiable.forEach((finding) => printjson({ unverifiable: finding }));
+  print(`${unverifiable.length} findings were created before the audit log, and can not be verified`);
+}
+if (collisions > 0) {
+  quit(1);
+}
+if (unverifiable.length > 0) {
+  quit(2);
+}